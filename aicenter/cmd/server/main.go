@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/tgo/captain/aicenter/internal/config"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
 	"github.com/tgo/captain/aicenter/internal/handler"
 	"github.com/tgo/captain/aicenter/internal/pkg/db"
 	"github.com/tgo/captain/aicenter/internal/service"
@@ -17,6 +19,10 @@ import (
 	"github.com/tgo/captain/aicenter/internal/trace"
 )
 
+// staleRunsInterval is how often the runs left running by a stopped replica
+// are failed
+const staleRunsInterval = 10 * time.Minute
+
 func main() {
 	ctx := context.Background()
 
@@ -40,6 +46,9 @@ func main() {
 	if err := db.AutoMigrate(database); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+	if err := usage.SeedPrices(ctx, database); err != nil {
+		log.Fatalf("Failed to seed model prices: %v", err)
+	}
 
 	// Setup router
 	router := handler.SetupRouter(cfg, database)
@@ -54,6 +63,12 @@ func main() {
 	// Run startup tasks once
 	scheduler.RunOnce(context.Background())
 
+	// Any replica may stop while running, its runs are failed periodically
+	runsScheduler := task.NewScheduler()
+	runsScheduler.RegisterTask(task.NewStaleRunsTask(runs.NewHistory(database)))
+	runsScheduler.StartPeriodic(staleRunsInterval)
+	defer runsScheduler.Stop()
+
 	// Create server
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
@@ -25,6 +25,9 @@ type Config struct {
 
 	// Internal API (apiserver internal endpoint)
 	InternalAPIURL string `mapstructure:"INTERNAL_API_URL"`
+	// InternalAPIKey is shared with the apiserver and signs the internal
+	// requests that read project data, such as visitor attachments
+	InternalAPIKey string `mapstructure:"INTERNAL_API_KEY"`
 
 	// Environment
 	Environment string `mapstructure:"ENVIRONMENT"`
@@ -42,6 +45,9 @@ type Config struct {
 	// Auth
 	SecretKey    string `mapstructure:"SECRET_KEY"`
 	APIKeyPrefix string `mapstructure:"API_KEY_PREFIX"`
+	// AdminAPIKey guards the routes shared by every project, they are
+	// disabled when it is empty
+	AdminAPIKey string `mapstructure:"ADMIN_API_KEY"`
 
 	// Logging
 	LogLevel string `mapstructure:"LOG_LEVEL"`
@@ -70,9 +76,9 @@ func Load() (*Config, error) {
 	// Bind environment variables
 	for _, key := range []string{
 		"PORT", "GIN_MODE", "DATABASE_URL", "DATABASE_POOL_SIZE", "DATABASE_MAX_OVERFLOW",
-		"REDIS_URL", "AUTH_SERVICE_URL", "INTERNAL_API_URL", "ENVIRONMENT", "RAG_SERVICE_URL", "MCP_SERVICE_URL",
+		"REDIS_URL", "AUTH_SERVICE_URL", "INTERNAL_API_URL", "INTERNAL_API_KEY", "ENVIRONMENT", "RAG_SERVICE_URL", "MCP_SERVICE_URL",
 		"ARK_API_KEY", "ARK_MODEL", "OPENAI_API_KEY", "OPENAI_MODEL",
-		"SECRET_KEY", "API_KEY_PREFIX", "LOG_LEVEL",
+		"SECRET_KEY", "API_KEY_PREFIX", "ADMIN_API_KEY", "LOG_LEVEL",
 	} {
 		if val := os.Getenv(key); val != "" {
 			viper.Set(key, val)
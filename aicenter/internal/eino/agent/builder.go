@@ -29,6 +29,23 @@ func NewBuilder(llmFactory *llm.Factory) *Builder {
 	return &Builder{llmFactory: llmFactory}
 }
 
+// Snapshot describes the agent config, without provider credentials
+func (c *AgentConfig) Snapshot(ctx context.Context) map[string]interface{} {
+	tools := make([]string, 0, len(c.Tools))
+	for _, t := range c.Tools {
+		if info, err := t.Info(ctx); err == nil && info != nil {
+			tools = append(tools, info.Name)
+		}
+	}
+	return map[string]interface{}{
+		"name":        c.Name,
+		"description": c.Description,
+		"instruction": c.Instruction,
+		"provider":    c.Provider.Snapshot(),
+		"tools":       tools,
+	}
+}
+
 func (b *Builder) Build(ctx context.Context, cfg *AgentConfig) (adk.Agent, error) {
 	chatModel, err := b.llmFactory.CreateToolCalling(ctx, cfg.Provider)
 	if err != nil {
@@ -0,0 +1,713 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	defaultClaudeBaseURL   = "https://api.anthropic.com"
+	defaultClaudeVersion   = "2023-06-01"
+	defaultClaudeMaxTokens = 4096
+	// claudeMaxTemperature is the highest temperature the Messages API
+	// accepts, higher ones allowed by MaxTemperature are capped
+	claudeMaxTemperature = 1.0
+)
+
+// ClaudeConfig configures the native Anthropic chat model
+type ClaudeConfig struct {
+	APIKey  string
+	Model   string
+	BaseURL string
+	// MaxTokens is required by the Messages API, defaults to 4096
+	MaxTokens   int
+	Temperature *float32
+	TopP        *float32
+	Stop        []string
+	// HTTPClient is optional, http.DefaultClient is used when nil
+	HTTPClient *http.Client
+}
+
+// ClaudeChatModel implements model.ToolCallingChatModel on top of the
+// Anthropic Messages API (https://docs.anthropic.com/en/api/messages)
+type ClaudeChatModel struct {
+	httpClient  *http.Client
+	apiKey      string
+	baseURL     string
+	model       string
+	maxTokens   int
+	temperature *float32
+	topP        *float32
+	stop        []string
+	tools       []*schema.ToolInfo
+	toolChoice  *schema.ToolChoice
+}
+
+// NewClaudeChatModel creates a Claude chat model
+func NewClaudeChatModel(_ context.Context, cfg *ClaudeConfig) (*ClaudeChatModel, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("claude config is nil")
+	}
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("anthropic api key is required")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("anthropic model is required")
+	}
+
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultClaudeBaseURL
+	}
+	// Accept base URLs configured with or without the /v1 suffix
+	baseURL = strings.TrimSuffix(baseURL, "/v1")
+
+	maxTokens := cfg.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultClaudeMaxTokens
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &ClaudeChatModel{
+		httpClient:  httpClient,
+		apiKey:      cfg.APIKey,
+		baseURL:     baseURL,
+		model:       cfg.Model,
+		maxTokens:   maxTokens,
+		temperature: cfg.Temperature,
+		topP:        cfg.TopP,
+		stop:        cfg.Stop,
+	}, nil
+}
+
+// Generate sends a non-streaming Messages request
+func (m *ClaudeChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (outMsg *schema.Message, err error) {
+	req, cbInput, err := m.genRequest(input, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = callbacks.OnStart(ctx, cbInput)
+	defer func() {
+		if err != nil {
+			callbacks.OnError(ctx, err)
+		}
+	}()
+
+	resp, err := m.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out claudeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode anthropic response: %w", err)
+	}
+
+	outMsg = &schema.Message{
+		Role: schema.Assistant,
+		ResponseMeta: &schema.ResponseMeta{
+			FinishReason: claudeFinishReason(out.StopReason),
+			Usage:        out.Usage.toTokenUsage(),
+		},
+	}
+	var text strings.Builder
+	for _, block := range out.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			outMsg.ToolCalls = append(outMsg.ToolCalls, schema.ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: schema.FunctionCall{
+					Name:      block.Name,
+					Arguments: args,
+				},
+			})
+		}
+	}
+	outMsg.Content = text.String()
+
+	callbacks.OnEnd(ctx, &model.CallbackOutput{
+		Message:    outMsg,
+		Config:     cbInput.Config,
+		TokenUsage: toCallbackUsage(outMsg.ResponseMeta.Usage),
+	})
+
+	return outMsg, nil
+}
+
+// Stream sends a streaming Messages request and converts SSE events into message chunks
+func (m *ClaudeChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (outStream *schema.StreamReader[*schema.Message], err error) {
+	defer func() {
+		if err != nil {
+			callbacks.OnError(ctx, err)
+		}
+	}()
+
+	req, cbInput, err := m.genRequest(input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	req.Stream = true
+
+	ctx = callbacks.OnStart(ctx, cbInput)
+
+	resp, err := m.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	sr, sw := schema.Pipe[*model.CallbackOutput](1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				_ = sw.Send(nil, fmt.Errorf("panic in claude stream: %v\n%s", p, debug.Stack()))
+			}
+			_ = resp.Body.Close()
+			sw.Close()
+		}()
+
+		var usage claudeUsage
+		toolIndex := make(map[int]int) // content block index -> tool call index
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "" {
+				continue
+			}
+
+			var ev claudeStreamEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				_ = sw.Send(nil, fmt.Errorf("decode anthropic stream event: %w", err))
+				return
+			}
+
+			var msg *schema.Message
+			switch ev.Type {
+			case "message_start":
+				if ev.Message != nil {
+					usage = ev.Message.Usage
+				}
+			case "content_block_start":
+				if ev.ContentBlock != nil && ev.ContentBlock.Type == "tool_use" {
+					idx := len(toolIndex)
+					toolIndex[ev.Index] = idx
+					msg = &schema.Message{
+						Role: schema.Assistant,
+						ToolCalls: []schema.ToolCall{{
+							Index:    &idx,
+							ID:       ev.ContentBlock.ID,
+							Type:     "function",
+							Function: schema.FunctionCall{Name: ev.ContentBlock.Name},
+						}},
+					}
+				}
+			case "content_block_delta":
+				if ev.Delta == nil {
+					continue
+				}
+				switch ev.Delta.Type {
+				case "text_delta":
+					msg = &schema.Message{Role: schema.Assistant, Content: ev.Delta.Text}
+				case "input_json_delta":
+					idx, ok := toolIndex[ev.Index]
+					if !ok || ev.Delta.PartialJSON == "" {
+						continue
+					}
+					msg = &schema.Message{
+						Role: schema.Assistant,
+						ToolCalls: []schema.ToolCall{{
+							Index:    &idx,
+							Function: schema.FunctionCall{Arguments: ev.Delta.PartialJSON},
+						}},
+					}
+				}
+			case "message_delta":
+				if ev.Usage != nil {
+					usage.OutputTokens = ev.Usage.OutputTokens
+				}
+				stopReason := ""
+				if ev.Delta != nil {
+					stopReason = ev.Delta.StopReason
+				}
+				msg = &schema.Message{
+					Role: schema.Assistant,
+					ResponseMeta: &schema.ResponseMeta{
+						FinishReason: claudeFinishReason(stopReason),
+						Usage:        usage.toTokenUsage(),
+					},
+				}
+			case "error":
+				apiErr := &APIError{Provider: ProviderAnthropic, StatusCode: http.StatusInternalServerError}
+				if ev.Error != nil {
+					apiErr.Type = ev.Error.Type
+					apiErr.Message = ev.Error.Message
+					if ev.Error.Type == "overloaded_error" {
+						apiErr.StatusCode = 529
+					}
+				}
+				_ = sw.Send(nil, apiErr)
+				return
+			}
+
+			if msg == nil {
+				continue
+			}
+			var tokenUsage *model.TokenUsage
+			if msg.ResponseMeta != nil {
+				tokenUsage = toCallbackUsage(msg.ResponseMeta.Usage)
+			}
+			if closed := sw.Send(&model.CallbackOutput{
+				Message:    msg,
+				Config:     cbInput.Config,
+				TokenUsage: tokenUsage,
+			}, nil); closed {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			_ = sw.Send(nil, fmt.Errorf("read anthropic stream: %w", err))
+		}
+	}()
+
+	ctx, nsr := callbacks.OnEndWithStreamOutput(ctx, schema.StreamReaderWithConvert(sr,
+		func(src *model.CallbackOutput) (callbacks.CallbackOutput, error) {
+			return src, nil
+		}))
+
+	outStream = schema.StreamReaderWithConvert(nsr,
+		func(src callbacks.CallbackOutput) (*schema.Message, error) {
+			s := src.(*model.CallbackOutput)
+			if s.Message == nil {
+				return nil, schema.ErrNoValue
+			}
+			return s.Message, nil
+		},
+	)
+
+	return outStream, nil
+}
+
+// WithTools returns a copy of the model bound to the given tools
+func (m *ClaudeChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	if len(tools) == 0 {
+		return nil, errors.New("no tools to bind")
+	}
+	tc := schema.ToolChoiceAllowed
+	nm := *m
+	nm.tools = tools
+	nm.toolChoice = &tc
+	return &nm, nil
+}
+
+// BindTools binds tools in place (model.ChatModel compatibility for react.Agent)
+func (m *ClaudeChatModel) BindTools(tools []*schema.ToolInfo) error {
+	if len(tools) == 0 {
+		return errors.New("no tools to bind")
+	}
+	tc := schema.ToolChoiceAllowed
+	m.tools = tools
+	m.toolChoice = &tc
+	return nil
+}
+
+func (m *ClaudeChatModel) GetType() string {
+	return "Claude"
+}
+
+func (m *ClaudeChatModel) IsCallbacksEnabled() bool {
+	return true
+}
+
+func (m *ClaudeChatModel) genRequest(input []*schema.Message, opts ...model.Option) (*claudeRequest, *model.CallbackInput, error) {
+	options := model.GetCommonOptions(&model.Options{
+		Model:       &m.model,
+		MaxTokens:   &m.maxTokens,
+		Temperature: m.temperature,
+		TopP:        m.topP,
+		Stop:        m.stop,
+		Tools:       m.tools,
+		ToolChoice:  m.toolChoice,
+	}, opts...)
+
+	temperature := options.Temperature
+	if temperature != nil && *temperature > claudeMaxTemperature {
+		capped := float32(claudeMaxTemperature)
+		temperature = &capped
+	}
+
+	req := &claudeRequest{
+		Model:         *options.Model,
+		MaxTokens:     *options.MaxTokens,
+		Temperature:   temperature,
+		TopP:          options.TopP,
+		StopSequences: options.Stop,
+	}
+
+	var system []string
+	for _, msg := range input {
+		if msg == nil {
+			continue
+		}
+		if msg.Role == schema.System {
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+			continue
+		}
+		role, blocks, err := toClaudeBlocks(msg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		// The Messages API expects alternating turns, so merge consecutive
+		// messages of the same role (e.g. several tool results)
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, blocks...)
+			continue
+		}
+		req.Messages = append(req.Messages, claudeMessage{Role: role, Content: blocks})
+	}
+	req.System = strings.Join(system, "\n\n")
+
+	if len(options.Tools) > 0 && (options.ToolChoice == nil || *options.ToolChoice != schema.ToolChoiceForbidden) {
+		for _, ti := range options.Tools {
+			t, err := toClaudeTool(ti)
+			if err != nil {
+				return nil, nil, err
+			}
+			req.Tools = append(req.Tools, t)
+		}
+		if options.ToolChoice != nil && *options.ToolChoice == schema.ToolChoiceForced {
+			req.ToolChoice = &claudeToolChoice{Type: "any"}
+			if len(options.AllowedToolNames) == 1 {
+				req.ToolChoice = &claudeToolChoice{Type: "tool", Name: options.AllowedToolNames[0]}
+			}
+		}
+	}
+
+	cbInput := &model.CallbackInput{
+		Messages:   input,
+		Tools:      options.Tools,
+		ToolChoice: options.ToolChoice,
+		Config: &model.Config{
+			Model:     req.Model,
+			MaxTokens: req.MaxTokens,
+			Stop:      req.StopSequences,
+		},
+	}
+	if req.Temperature != nil {
+		cbInput.Config.Temperature = *req.Temperature
+	}
+	if req.TopP != nil {
+		cbInput.Config.TopP = *req.TopP
+	}
+
+	return req, cbInput, nil
+}
+
+func (m *ClaudeChatModel) do(ctx context.Context, req *claudeRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal anthropic request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create anthropic request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", m.apiKey)
+	httpReq.Header.Set("anthropic-version", defaultClaudeVersion)
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := m.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic request: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		apiErr := &APIError{Provider: ProviderAnthropic, StatusCode: resp.StatusCode, Message: string(raw)}
+		var errBody struct {
+			Error *claudeErrorBody `json:"error"`
+		}
+		if json.Unmarshal(raw, &errBody) == nil && errBody.Error != nil {
+			apiErr.Type = errBody.Error.Type
+			apiErr.Message = errBody.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+func toClaudeBlocks(msg *schema.Message) (string, []claudeContentBlock, error) {
+	switch msg.Role {
+	case schema.User:
+		if len(msg.UserInputMultiContent) > 0 {
+			blocks, err := toClaudeUserBlocks(msg)
+			return "user", blocks, err
+		}
+		if msg.Content == "" {
+			return "user", nil, nil
+		}
+		return "user", []claudeContentBlock{{Type: "text", Text: msg.Content}}, nil
+	case schema.Assistant:
+		var blocks []claudeContentBlock
+		if msg.Content != "" {
+			blocks = append(blocks, claudeContentBlock{Type: "text", Text: msg.Content})
+		}
+		for _, tc := range msg.ToolCalls {
+			args := strings.TrimSpace(tc.Function.Arguments)
+			if args == "" {
+				args = "{}"
+			}
+			if !json.Valid([]byte(args)) {
+				return "", nil, fmt.Errorf("invalid arguments for tool call %s: %s", tc.Function.Name, args)
+			}
+			blocks = append(blocks, claudeContentBlock{
+				Type:  "tool_use",
+				ID:    tc.ID,
+				Name:  tc.Function.Name,
+				Input: json.RawMessage(args),
+			})
+		}
+		return "assistant", blocks, nil
+	case schema.Tool:
+		return "user", []claudeContentBlock{{
+			Type:      "tool_result",
+			ToolUseID: msg.ToolCallID,
+			Content:   msg.Content,
+		}}, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported message role for anthropic: %s", msg.Role)
+	}
+}
+
+// toClaudeUserBlocks converts the text and image parts of a user message,
+// images are sent inline when they are data URLs or base64 data
+func toClaudeUserBlocks(msg *schema.Message) ([]claudeContentBlock, error) {
+	var blocks []claudeContentBlock
+	if msg.Content != "" {
+		blocks = append(blocks, claudeContentBlock{Type: "text", Text: msg.Content})
+	}
+	for _, part := range msg.UserInputMultiContent {
+		switch part.Type {
+		case schema.ChatMessagePartTypeText:
+			if part.Text != "" {
+				blocks = append(blocks, claudeContentBlock{Type: "text", Text: part.Text})
+			}
+		case schema.ChatMessagePartTypeImageURL:
+			if part.Image == nil {
+				continue
+			}
+			source, err := toClaudeImageSource(part.Image)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, claudeContentBlock{Type: "image", Source: source})
+		default:
+			return nil, fmt.Errorf("unsupported message part type for anthropic: %s", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+func toClaudeImageSource(image *schema.MessageInputImage) (*claudeImageSource, error) {
+	if image.Base64Data != nil && *image.Base64Data != "" {
+		mimeType := image.MIMEType
+		if mimeType == "" {
+			return nil, errors.New("anthropic image needs a MIME type with base64 data")
+		}
+		return &claudeImageSource{Type: "base64", MediaType: mimeType, Data: *image.Base64Data}, nil
+	}
+	if image.URL == nil || *image.URL == "" {
+		return nil, errors.New("anthropic image has neither URL nor data")
+	}
+	if mimeType, data, ok := ParseDataURL(*image.URL); ok {
+		return &claudeImageSource{Type: "base64", MediaType: mimeType, Data: data}, nil
+	}
+	return &claudeImageSource{Type: "url", URL: *image.URL}, nil
+}
+
+func toClaudeTool(ti *schema.ToolInfo) (claudeTool, error) {
+	t := claudeTool{Name: ti.Name, Description: ti.Desc}
+	if ti.ParamsOneOf != nil {
+		js, err := ti.ParamsOneOf.ToJSONSchema()
+		if err != nil {
+			return t, fmt.Errorf("convert tool %s params: %w", ti.Name, err)
+		}
+		if js != nil {
+			raw, err := json.Marshal(js)
+			if err != nil {
+				return t, fmt.Errorf("marshal tool %s schema: %w", ti.Name, err)
+			}
+			t.InputSchema = raw
+		}
+	}
+	if len(t.InputSchema) == 0 {
+		t.InputSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return t, nil
+}
+
+// claudeFinishReason maps Anthropic stop reasons onto OpenAI-style finish reasons
+func claudeFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return stopReason
+	}
+}
+
+func toCallbackUsage(u *schema.TokenUsage) *model.TokenUsage {
+	if u == nil {
+		return nil
+	}
+	return &model.TokenUsage{
+		PromptTokens: u.PromptTokens,
+		PromptTokenDetails: model.PromptTokenDetails{
+			CachedTokens: u.PromptTokenDetails.CachedTokens,
+		},
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		CompletionTokensDetails: model.CompletionTokensDetails{
+			ReasoningTokens: u.CompletionTokensDetails.ReasoningTokens,
+		},
+	}
+}
+
+type claudeRequest struct {
+	Model         string            `json:"model"`
+	System        string            `json:"system,omitempty"`
+	Messages      []claudeMessage   `json:"messages"`
+	MaxTokens     int               `json:"max_tokens"`
+	Temperature   *float32          `json:"temperature,omitempty"`
+	TopP          *float32          `json:"top_p,omitempty"`
+	StopSequences []string          `json:"stop_sequences,omitempty"`
+	Tools         []claudeTool      `json:"tools,omitempty"`
+	ToolChoice    *claudeToolChoice `json:"tool_choice,omitempty"`
+	Stream        bool              `json:"stream,omitempty"`
+}
+
+type claudeMessage struct {
+	Role    string               `json:"role"`
+	Content []claudeContentBlock `json:"content"`
+}
+
+type claudeContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+
+	Source *claudeImageSource `json:"source,omitempty"`
+}
+
+type claudeImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type claudeTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type claudeToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type claudeResponse struct {
+	ID         string               `json:"id"`
+	Content    []claudeContentBlock `json:"content"`
+	StopReason string               `json:"stop_reason"`
+	Usage      claudeUsage          `json:"usage"`
+}
+
+type claudeUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+func (u claudeUsage) toTokenUsage() *schema.TokenUsage {
+	// input_tokens excludes cached tokens, report the full prompt size
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return &schema.TokenUsage{
+		PromptTokens: prompt,
+		PromptTokenDetails: schema.PromptTokenDetails{
+			CachedTokens: u.CacheReadInputTokens,
+		},
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+}
+
+type claudeStreamEvent struct {
+	Type         string              `json:"type"`
+	Index        int                 `json:"index"`
+	Message      *claudeResponse     `json:"message,omitempty"`
+	ContentBlock *claudeContentBlock `json:"content_block,omitempty"`
+	Delta        *claudeStreamDelta  `json:"delta,omitempty"`
+	Usage        *claudeUsage        `json:"usage,omitempty"`
+	Error        *claudeErrorBody    `json:"error,omitempty"`
+}
+
+type claudeStreamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	PartialJSON string `json:"partial_json"`
+	StopReason  string `json:"stop_reason"`
+}
+
+type claudeErrorBody struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
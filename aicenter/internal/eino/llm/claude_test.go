@@ -0,0 +1,206 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// newTestClaude returns a Claude model sending its requests to handler
+func newTestClaude(t *testing.T, handler http.HandlerFunc) *ClaudeChatModel {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	m, err := NewClaudeChatModel(context.Background(), &ClaudeConfig{
+		APIKey:  "test-key",
+		Model:   "claude-test",
+		BaseURL: server.URL + "/v1",
+	})
+	if err != nil {
+		t.Fatalf("NewClaudeChatModel() error = %v", err)
+	}
+	return m
+}
+
+func TestClaudeGenerate(t *testing.T) {
+	var got claudeRequest
+	m := newTestClaude(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("request path = %s, want /v1/messages", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("request headers = %v, want the api key and version", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = io.WriteString(w, `{
+			"id": "msg_1",
+			"content": [
+				{"type": "text", "text": "Checking the order."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_order", "input": {"id": "42"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "output_tokens": 5, "cache_read_input_tokens": 4}
+		}`)
+	})
+
+	input := []*schema.Message{
+		schema.SystemMessage("Be brief."),
+		schema.SystemMessage("Answer in English."),
+		schema.UserMessage("Where is my order?"),
+		schema.AssistantMessage("", []schema.ToolCall{
+			{ID: "toolu_0", Function: schema.FunctionCall{Name: "find_orders", Arguments: `{}`}},
+			{ID: "toolu_9", Function: schema.FunctionCall{Name: "find_orders", Arguments: ``}},
+		}),
+		schema.ToolMessage("order 42", "toolu_0"),
+		schema.ToolMessage("none", "toolu_9"),
+	}
+	out, err := m.Generate(context.Background(), input, model.WithTemperature(1.5))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if got.Model != "claude-test" || got.MaxTokens != defaultClaudeMaxTokens {
+		t.Errorf("request model = %s, max_tokens = %d", got.Model, got.MaxTokens)
+	}
+	if got.System != "Be brief.\n\nAnswer in English." {
+		t.Errorf("request system = %q, want the system messages joined", got.System)
+	}
+	if got.Temperature == nil || *got.Temperature != claudeMaxTemperature {
+		t.Errorf("request temperature = %v, want it capped at %v", got.Temperature, claudeMaxTemperature)
+	}
+	if len(got.Messages) != 3 {
+		t.Fatalf("request has %d messages, want the tool results merged into 3", len(got.Messages))
+	}
+	results := got.Messages[2]
+	if results.Role != "user" || len(results.Content) != 2 || results.Content[1].ToolUseID != "toolu_9" {
+		t.Errorf("tool results message = %+v, want both results in one user turn", results)
+	}
+	if args := string(got.Messages[1].Content[1].Input); args != "{}" {
+		t.Errorf("empty tool call arguments sent as %s, want {}", args)
+	}
+
+	if out.Content != "Checking the order." {
+		t.Errorf("Generate() content = %q", out.Content)
+	}
+	if len(out.ToolCalls) != 1 || out.ToolCalls[0].Function.Name != "get_order" || out.ToolCalls[0].Function.Arguments != `{"id": "42"}` {
+		t.Errorf("Generate() tool calls = %+v", out.ToolCalls)
+	}
+	if out.ResponseMeta.FinishReason != "tool_calls" {
+		t.Errorf("Generate() finish reason = %s, want tool_calls", out.ResponseMeta.FinishReason)
+	}
+	if usage := out.ResponseMeta.Usage; usage.PromptTokens != 14 || usage.PromptTokenDetails.CachedTokens != 4 || usage.TotalTokens != 19 {
+		t.Errorf("Generate() usage = %+v, want cached tokens counted in the prompt", usage)
+	}
+}
+
+func TestClaudeGenerateError(t *testing.T) {
+	m := newTestClaude(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		_, _ = io.WriteString(w, `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`)
+	})
+
+	_, err := m.Generate(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Generate() error = %v, want an APIError", err)
+	}
+	if apiErr.StatusCode != 529 || apiErr.Type != "overloaded_error" || apiErr.Message != "Overloaded" {
+		t.Errorf("Generate() error = %+v", apiErr)
+	}
+	if !IsRetryable(err) {
+		t.Error("an overloaded Anthropic API is not retried")
+	}
+}
+
+func TestClaudeStream(t *testing.T) {
+	events := []string{
+		`{"type": "message_start", "message": {"id": "msg_1", "usage": {"input_tokens": 12, "output_tokens": 1}}}`,
+		`{"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}`,
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Let me "}}`,
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "check."}}`,
+		`{"type": "content_block_stop", "index": 0}`,
+		`{"type": "content_block_start", "index": 1, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "get_order"}}`,
+		`{"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "{\"id\":"}}`,
+		`{"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": " \"42\"}"}}`,
+		`{"type": "content_block_stop", "index": 1}`,
+		`{"type": "message_delta", "delta": {"stop_reason": "tool_use"}, "usage": {"output_tokens": 20}}`,
+		`{"type": "message_stop"}`,
+	}
+	var streamed bool
+	m := newTestClaude(t, func(w http.ResponseWriter, r *http.Request) {
+		var req claudeRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		streamed = req.Stream
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range events {
+			var ev claudeStreamEvent
+			_ = json.Unmarshal([]byte(data), &ev)
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+	})
+
+	sr, err := m.Stream(context.Background(), []*schema.Message{schema.UserMessage("Where is my order?")})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	defer sr.Close()
+	var chunks []*schema.Message
+	for {
+		chunk, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv() error = %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !streamed {
+		t.Error("the request did not ask for a stream")
+	}
+
+	out, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		t.Fatalf("ConcatMessages() error = %v", err)
+	}
+	if out.Content != "Let me check." {
+		t.Errorf("streamed content = %q", out.Content)
+	}
+	if len(out.ToolCalls) != 1 || out.ToolCalls[0].ID != "toolu_1" || out.ToolCalls[0].Function.Arguments != `{"id": "42"}` {
+		t.Errorf("streamed tool calls = %+v", out.ToolCalls)
+	}
+	if out.ResponseMeta == nil || out.ResponseMeta.FinishReason != "tool_calls" {
+		t.Fatalf("streamed response meta = %+v, want finish reason tool_calls", out.ResponseMeta)
+	}
+	if usage := out.ResponseMeta.Usage; usage.PromptTokens != 12 || usage.CompletionTokens != 20 {
+		t.Errorf("streamed usage = %+v, want 12 prompt and 20 completion tokens", usage)
+	}
+}
+
+func TestClaudeStreamError(t *testing.T) {
+	m := newTestClaude(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n")
+	})
+
+	sr, err := m.Stream(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	defer sr.Close()
+	_, err = sr.Recv()
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 529 {
+		t.Errorf("Recv() error = %v, want an overloaded APIError", err)
+	}
+}
@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cloudwego/eino-ext/libs/acl/openai"
+	"github.com/cloudwego/eino/components/embedding"
+)
+
+// CreateEmbedder returns the embedding model of cfg. Only providers with an
+// OpenAI-compatible embeddings API are supported.
+func (f *Factory) CreateEmbedder(ctx context.Context, cfg *ProviderConfig) (embedding.Embedder, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("provider config is required")
+	}
+
+	switch NormalizeProviderKind(string(cfg.Kind)) {
+	case ProviderOpenAI, ProviderCompatible, ProviderDashscope:
+		embedCfg := &openai.EmbeddingConfig{
+			APIKey:  cfg.APIKey,
+			BaseURL: cfg.BaseURL,
+			Model:   cfg.Model,
+		}
+		if cfg.Timeout > 0 {
+			embedCfg.HTTPClient = &http.Client{Timeout: cfg.Timeout}
+		}
+		return openai.NewEmbeddingClient(ctx, embedCfg)
+	default:
+		return nil, fmt.Errorf("unsupported embedding provider: %s", cfg.Kind)
+	}
+}
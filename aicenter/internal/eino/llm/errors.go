@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	goopenai "github.com/meguminnnnnnnnn/go-openai"
+	arkmodel "github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
+	"google.golang.org/genai"
+)
+
+// APIError is returned by the native provider clients when the upstream API
+// responds with a non-2xx status
+type APIError struct {
+	Provider   ProviderKind
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("%s api error: status=%d type=%s message=%s", e.Provider, e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("%s api error: status=%d message=%s", e.Provider, e.StatusCode, e.Message)
+}
+
+// StatusCode extracts the upstream HTTP status code from a provider error,
+// it returns 0 when the error carries no status
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	var oaiErr *goopenai.APIError
+	if errors.As(err, &oaiErr) {
+		return oaiErr.HTTPStatusCode
+	}
+	var oaiReqErr *goopenai.RequestError
+	if errors.As(err, &oaiReqErr) {
+		return oaiReqErr.HTTPStatusCode
+	}
+	var arkErr *arkmodel.APIError
+	if errors.As(err, &arkErr) {
+		return arkErr.HTTPStatusCode
+	}
+	var arkReqErr *arkmodel.RequestError
+	if errors.As(err, &arkReqErr) {
+		return arkReqErr.HTTPStatusCode
+	}
+	var genaiErr genai.APIError
+	if errors.As(err, &genaiErr) {
+		return genaiErr.Code
+	}
+	return 0
+}
+
+// IsRetryable reports whether a provider error is transient: timeouts,
+// connection failures, rate limits and server side errors. Cancellations are
+// final, unless caused by a deadline.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	switch code := StatusCode(err); {
+	case code == http.StatusRequestTimeout, code == http.StatusConflict, code == http.StatusTooManyRequests:
+		return true
+	case code >= 500:
+		return true
+	}
+	return false
+}
@@ -2,11 +2,18 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/cloudwego/eino-ext/components/model/ark"
 	"github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+	arkModel "github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
 )
 
 type ProviderKind string
@@ -18,13 +25,77 @@ const (
 	ProviderAnthropic  ProviderKind = "anthropic"
 	ProviderGoogle     ProviderKind = "google"
 	ProviderDashscope  ProviderKind = "dashscope"
+	ProviderOllama     ProviderKind = "ollama"
 )
 
+// NormalizeProviderKind maps provider names stored on LLM providers
+// (e.g. "claude", "Gemini") onto the canonical ProviderKind values
+func NormalizeProviderKind(kind string) ProviderKind {
+	switch k := strings.ToLower(strings.TrimSpace(kind)); k {
+	case "claude":
+		return ProviderAnthropic
+	case "gemini":
+		return ProviderGoogle
+	case "llamacpp", "llama.cpp", "llama_cpp":
+		// llama.cpp server only exposes the OpenAI-compatible API
+		return ProviderCompatible
+	default:
+		return ProviderKind(k)
+	}
+}
+
 type ProviderConfig struct {
 	Kind    ProviderKind
 	APIKey  string
 	Model   string
 	BaseURL string
+	// Options holds provider specific settings from LLMProvider.Config,
+	// e.g. "options" and "keep_alive" for ollama
+	Options map[string]interface{}
+	// Params are the default generation params of the model
+	Params *GenerationParams
+	// Timeout bounds a single attempt (time to first chunk when streaming)
+	Timeout time.Duration
+	// Fallbacks are tried in order when this provider keeps failing
+	Fallbacks []*ProviderConfig
+	// Retry enables retries with backoff, nil disables retrying
+	Retry *RetryPolicy
+	// Output constrains the answers to a JSON Schema on the providers that
+	// support it natively, see SupportsNativeOutput
+	Output *OutputSchema
+}
+
+// OutputSchema is the JSON Schema the answers of a model must conform to
+type OutputSchema struct {
+	Name   string
+	Schema json.RawMessage
+}
+
+// SupportsNativeOutput reports whether the provider enforces an output schema
+// itself. Other providers must be instructed to follow it.
+func SupportsNativeOutput(kind ProviderKind) bool {
+	switch NormalizeProviderKind(string(kind)) {
+	case ProviderOpenAI, ProviderArk, ProviderOllama:
+		return true
+	}
+	return false
+}
+
+// WithOutput returns a copy of the provider config, fallbacks included, whose
+// answers are constrained to the output schema
+func (c *ProviderConfig) WithOutput(output *OutputSchema) *ProviderConfig {
+	if c == nil || output == nil {
+		return c
+	}
+	out := *c
+	out.Output = output
+	if len(c.Fallbacks) > 0 {
+		out.Fallbacks = make([]*ProviderConfig, len(c.Fallbacks))
+		for i, fb := range c.Fallbacks {
+			out.Fallbacks[i] = fb.WithOutput(output)
+		}
+	}
+	return &out
 }
 
 type Factory struct{}
@@ -39,44 +110,150 @@ func (f *Factory) Create(ctx context.Context, cfg *ProviderConfig) (model.ToolCa
 }
 
 func (f *Factory) CreateToolCalling(ctx context.Context, cfg *ProviderConfig) (model.ToolCallingChatModel, error) {
-	if cfg == nil {
-		return nil, fmt.Errorf("provider config is nil")
-	}
-	switch cfg.Kind {
-	case ProviderOpenAI, ProviderCompatible, ProviderDashscope:
-		return openai.NewChatModel(ctx, &openai.ChatModelConfig{
-			APIKey:  cfg.APIKey,
-			Model:   cfg.Model,
-			BaseURL: cfg.BaseURL,
-		})
-	case ProviderArk:
-		return ark.NewChatModel(ctx, &ark.ChatModelConfig{
-			APIKey: cfg.APIKey,
-			Model:  cfg.Model,
-		})
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", cfg.Kind)
-	}
+	return f.create(ctx, cfg)
 }
 
 // CreateChatModel returns model.ChatModel for use with react.Agent
 func (f *Factory) CreateChatModel(ctx context.Context, cfg *ProviderConfig) (model.ChatModel, error) {
+	return f.create(ctx, cfg)
+}
+
+// chatModel is implemented by every supported provider model
+type chatModel interface {
+	model.ToolCallingChatModel
+	BindTools(tools []*schema.ToolInfo) error
+}
+
+// create builds the model of cfg, wrapped in a FallbackChatModel when
+// retries or fallbacks are configured
+func (f *Factory) create(ctx context.Context, cfg *ProviderConfig) (chatModel, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("provider config is nil")
 	}
-	switch cfg.Kind {
+	if cfg.Retry == nil && len(cfg.Fallbacks) == 0 {
+		return f.createSingle(ctx, cfg)
+	}
+
+	primary, err := f.createSingle(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []fallbackCandidate{{cfg: cfg, model: primary}}
+	for _, fb := range cfg.Fallbacks {
+		if fb == nil {
+			continue
+		}
+		m, err := f.createSingle(ctx, fb)
+		if err != nil {
+			// A misconfigured fallback must not break the primary provider
+			log.Printf("[LLM] skipping fallback %s/%s: %v", fb.Kind, fb.Model, err)
+			continue
+		}
+		candidates = append(candidates, fallbackCandidate{cfg: fb, model: m})
+	}
+
+	retry := RetryPolicy{}
+	if cfg.Retry != nil {
+		retry = *cfg.Retry
+	}
+	return newFallbackChatModel(candidates, retry), nil
+}
+
+func (f *Factory) createSingle(ctx context.Context, cfg *ProviderConfig) (chatModel, error) {
+	params := cfg.Params
+	if params == nil {
+		params = &GenerationParams{}
+	}
+
+	kind := NormalizeProviderKind(string(cfg.Kind))
+	output := cfg.Output
+	if !SupportsNativeOutput(kind) {
+		output = nil
+	}
+
+	switch kind {
 	case ProviderOpenAI, ProviderCompatible, ProviderDashscope:
-		return openai.NewChatModel(ctx, &openai.ChatModelConfig{
-			APIKey:  cfg.APIKey,
-			Model:   cfg.Model,
-			BaseURL: cfg.BaseURL,
-		})
+		openaiCfg := &openai.ChatModelConfig{
+			APIKey:      cfg.APIKey,
+			Model:       cfg.Model,
+			BaseURL:     cfg.BaseURL,
+			Temperature: params.Temperature,
+			MaxTokens:   params.MaxTokens,
+			TopP:        params.TopP,
+			Stop:        params.Stop,
+		}
+		if output != nil {
+			var js jsonschema.Schema
+			if err := json.Unmarshal(output.Schema, &js); err != nil {
+				return nil, fmt.Errorf("decode output schema: %w", err)
+			}
+			openaiCfg.ResponseFormat = &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+				JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+					Name:       output.Name,
+					JSONSchema: &js,
+				},
+			}
+		}
+		return openai.NewChatModel(ctx, openaiCfg)
 	case ProviderArk:
-		return ark.NewChatModel(ctx, &ark.ChatModelConfig{
-			APIKey: cfg.APIKey,
-			Model:  cfg.Model,
-		})
+		arkCfg := &ark.ChatModelConfig{
+			APIKey:      cfg.APIKey,
+			Model:       cfg.Model,
+			Temperature: params.Temperature,
+			MaxTokens:   params.MaxTokens,
+			TopP:        params.TopP,
+			Stop:        params.Stop,
+		}
+		if output != nil {
+			arkCfg.ResponseFormat = &ark.ResponseFormat{
+				Type: arkModel.ResponseFormatJSONSchema,
+				JSONSchema: &arkModel.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   output.Name,
+					Schema: output.Schema,
+				},
+			}
+		}
+		return ark.NewChatModel(ctx, arkCfg)
+	case ProviderAnthropic:
+		claudeCfg := &ClaudeConfig{
+			APIKey:      cfg.APIKey,
+			Model:       cfg.Model,
+			BaseURL:     cfg.BaseURL,
+			Temperature: params.Temperature,
+			TopP:        params.TopP,
+			Stop:        params.Stop,
+		}
+		if params.MaxTokens != nil {
+			claudeCfg.MaxTokens = *params.MaxTokens
+		}
+		return NewClaudeChatModel(ctx, claudeCfg)
+	case ProviderGoogle:
+		return newGeminiChatModel(ctx, cfg, params)
+	case ProviderOllama:
+		return newOllamaFromProvider(ctx, cfg, params, output)
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", cfg.Kind)
 	}
 }
+
+func newOllamaFromProvider(ctx context.Context, cfg *ProviderConfig, params *GenerationParams, output *OutputSchema) (*OllamaChatModel, error) {
+	ollamaCfg := &OllamaConfig{
+		BaseURL:     cfg.BaseURL,
+		Model:       cfg.Model,
+		Temperature: params.Temperature,
+		MaxTokens:   params.MaxTokens,
+		TopP:        params.TopP,
+		Stop:        params.Stop,
+	}
+	if output != nil {
+		ollamaCfg.Format = output.Schema
+	}
+	if opts, ok := cfg.Options["options"].(map[string]interface{}); ok {
+		ollamaCfg.Options = opts
+	}
+	if keepAlive, ok := cfg.Options["keep_alive"].(string); ok {
+		ollamaCfg.KeepAlive = keepAlive
+	}
+	return NewOllamaChatModel(ctx, ollamaCfg)
+}
@@ -0,0 +1,329 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Message.Extra keys set on the first message (or stream chunk) of a
+// FallbackChatModel response, so run events can tell which provider answered
+const (
+	ExtraKeyProvider      = "llm_provider"
+	ExtraKeyModel         = "llm_model"
+	ExtraKeyFallbackIndex = "llm_fallback_index"
+	ExtraKeyAttempts      = "llm_attempts"
+)
+
+// RetryPolicy controls how often a provider is retried before failing over
+type RetryPolicy struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy fills the settings a configured retry policy leaves out
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     2,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// backoff returns the exponential backoff with jitter before the given retry (1-based)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// +/- 20% jitter so replicas do not retry in lockstep
+	jitter := time.Duration(rand.Int63n(int64(d)/5 + 1))
+	return d - d/10 + jitter
+}
+
+type fallbackCandidate struct {
+	cfg   *ProviderConfig
+	model model.ToolCallingChatModel
+}
+
+// FallbackChatModel calls an ordered list of models. Each model is retried
+// with backoff on transient errors, then the next one is tried.
+type FallbackChatModel struct {
+	candidates []fallbackCandidate
+	retry      RetryPolicy
+}
+
+func newFallbackChatModel(candidates []fallbackCandidate, retry RetryPolicy) *FallbackChatModel {
+	return &FallbackChatModel{candidates: candidates, retry: retry}
+}
+
+func (m *FallbackChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	var errs []error
+	for i, c := range m.candidates {
+		for attempt := 0; attempt <= m.retry.MaxRetries; attempt++ {
+			if attempt > 0 {
+				if err := sleepContext(ctx, m.retry.backoff(attempt)); err != nil {
+					return nil, err
+				}
+			}
+
+			callCtx, cancel := withAttemptTimeout(withCallProvider(ctx, c.cfg), c.cfg.Timeout)
+			msg, err := c.model.Generate(callCtx, input, opts...)
+			err = attemptError(callCtx, err)
+			cancel()
+			if err == nil {
+				annotateMessage(msg, c.cfg, i, attempt+1)
+				return msg, nil
+			}
+
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s/%s: %w", c.cfg.Kind, c.cfg.Model, err))
+			if !IsRetryable(err) {
+				break
+			}
+			log.Printf("[LLM] %s/%s attempt %d failed: %v", c.cfg.Kind, c.cfg.Model, attempt+1, err)
+		}
+		if i < len(m.candidates)-1 {
+			next := m.candidates[i+1].cfg
+			log.Printf("[LLM] failing over from %s/%s to %s/%s", c.cfg.Kind, c.cfg.Model, next.Kind, next.Model)
+		}
+	}
+	return nil, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
+
+// Stream fails over only until the first chunk arrives, once content has been
+// emitted the stream belongs to that provider
+func (m *FallbackChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	var errs []error
+	for i, c := range m.candidates {
+		for attempt := 0; attempt <= m.retry.MaxRetries; attempt++ {
+			if attempt > 0 {
+				if err := sleepContext(ctx, m.retry.backoff(attempt)); err != nil {
+					return nil, err
+				}
+			}
+
+			sr, err := m.streamAttempt(ctx, c, i, attempt+1, input, opts...)
+			if err == nil {
+				return sr, nil
+			}
+
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s/%s: %w", c.cfg.Kind, c.cfg.Model, err))
+			if !IsRetryable(err) {
+				break
+			}
+			log.Printf("[LLM] %s/%s stream attempt %d failed: %v", c.cfg.Kind, c.cfg.Model, attempt+1, err)
+		}
+		if i < len(m.candidates)-1 {
+			next := m.candidates[i+1].cfg
+			log.Printf("[LLM] failing over from %s/%s to %s/%s", c.cfg.Kind, c.cfg.Model, next.Kind, next.Model)
+		}
+	}
+	return nil, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
+
+func (m *FallbackChatModel) streamAttempt(ctx context.Context, c fallbackCandidate, index, attempts int, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	// The timeout only bounds the time to the first chunk
+	callCtx, cancelCause := context.WithCancelCause(withCallProvider(ctx, c.cfg))
+	cancel := func() { cancelCause(nil) }
+	var timer *time.Timer
+	if c.cfg.Timeout > 0 {
+		timer = time.AfterFunc(c.cfg.Timeout, func() { cancelCause(errAttemptTimeout) })
+	}
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+
+	sr, err := c.model.Stream(callCtx, input, opts...)
+	if err != nil {
+		stopTimer()
+		err = attemptError(callCtx, err)
+		cancel()
+		return nil, err
+	}
+
+	first, err := sr.Recv()
+	stopTimer()
+	if err != nil && !errors.Is(err, io.EOF) {
+		sr.Close()
+		err = attemptError(callCtx, err)
+		cancel()
+		return nil, err
+	}
+	if errors.Is(err, io.EOF) {
+		sr.Close()
+		cancel()
+		return schema.StreamReaderFromArray([]*schema.Message{}), nil
+	}
+
+	first = copyMessage(first)
+	annotateMessage(first, c.cfg, index, attempts)
+
+	out, sw := schema.Pipe[*schema.Message](1)
+	go func() {
+		defer func() {
+			sr.Close()
+			sw.Close()
+			cancel()
+		}()
+		if closed := sw.Send(first, nil); closed {
+			return
+		}
+		for {
+			chunk, err := sr.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if closed := sw.Send(chunk, err); closed || err != nil {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// WithTools binds tools on every candidate
+func (m *FallbackChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	candidates := make([]fallbackCandidate, 0, len(m.candidates))
+	for _, c := range m.candidates {
+		withTools, err := c.model.WithTools(tools)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", c.cfg.Kind, c.cfg.Model, err)
+		}
+		candidates = append(candidates, fallbackCandidate{cfg: c.cfg, model: withTools})
+	}
+	return newFallbackChatModel(candidates, m.retry), nil
+}
+
+// BindTools binds tools in place (model.ChatModel compatibility for react.Agent)
+func (m *FallbackChatModel) BindTools(tools []*schema.ToolInfo) error {
+	for _, c := range m.candidates {
+		binder, ok := c.model.(interface {
+			BindTools([]*schema.ToolInfo) error
+		})
+		if !ok {
+			return fmt.Errorf("%s/%s does not support BindTools", c.cfg.Kind, c.cfg.Model)
+		}
+		if err := binder.BindTools(tools); err != nil {
+			return fmt.Errorf("%s/%s: %w", c.cfg.Kind, c.cfg.Model, err)
+		}
+	}
+	return nil
+}
+
+func (m *FallbackChatModel) GetType() string {
+	return "Fallback"
+}
+
+// IsCallbacksEnabled is true because every wrapped model reports its own callbacks
+func (m *FallbackChatModel) IsCallbacksEnabled() bool {
+	return true
+}
+
+// AnsweredBy returns the provider and model recorded on a FallbackChatModel response
+func AnsweredBy(msg *schema.Message) (provider string, modelName string, ok bool) {
+	if msg == nil || msg.Extra == nil {
+		return "", "", false
+	}
+	provider, ok = msg.Extra[ExtraKeyProvider].(string)
+	modelName, _ = msg.Extra[ExtraKeyModel].(string)
+	return provider, modelName, ok
+}
+
+type callProviderKey struct{}
+
+type callProvider struct {
+	kind  string
+	model string
+}
+
+func withCallProvider(ctx context.Context, cfg *ProviderConfig) context.Context {
+	return context.WithValue(ctx, callProviderKey{}, callProvider{kind: string(cfg.Kind), model: cfg.Model})
+}
+
+// CallProvider returns the provider kind and model a FallbackChatModel is
+// currently calling, for callback handlers of the wrapped model
+func CallProvider(ctx context.Context) (kind string, modelName string, ok bool) {
+	p, ok := ctx.Value(callProviderKey{}).(callProvider)
+	return p.kind, p.model, ok
+}
+
+func annotateMessage(msg *schema.Message, cfg *ProviderConfig, index, attempts int) {
+	if msg == nil {
+		return
+	}
+	if msg.Extra == nil {
+		msg.Extra = make(map[string]any, 4)
+	}
+	msg.Extra[ExtraKeyProvider] = string(cfg.Kind)
+	msg.Extra[ExtraKeyModel] = cfg.Model
+	msg.Extra[ExtraKeyFallbackIndex] = index
+	msg.Extra[ExtraKeyAttempts] = attempts
+}
+
+func copyMessage(msg *schema.Message) *schema.Message {
+	if msg == nil {
+		return &schema.Message{Role: schema.Assistant}
+	}
+	out := *msg
+	if msg.Extra != nil {
+		out.Extra = make(map[string]any, len(msg.Extra)+4)
+		for k, v := range msg.Extra {
+			out.Extra[k] = v
+		}
+	}
+	return &out
+}
+
+// errAttemptTimeout is the cause of an attempt cut off by the provider
+// timeout. It is a deadline, so the attempt is retried and fails over.
+var errAttemptTimeout = fmt.Errorf("attempt timed out: %w", context.DeadlineExceeded)
+
+func withAttemptTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, timeout, errAttemptTimeout)
+}
+
+// attemptError reports an attempt cut off by its timeout as a timeout,
+// whichever error the provider client returned once its context was done
+func attemptError(callCtx context.Context, err error) error {
+	if err == nil || errors.Is(err, errAttemptTimeout) || !errors.Is(context.Cause(callCtx), errAttemptTimeout) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errAttemptTimeout, err)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
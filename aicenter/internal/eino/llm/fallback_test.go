@@ -0,0 +1,164 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// fakeChatModel answers with reply, or blocks until its context is done when
+// slow, like a provider that never responds
+type fakeChatModel struct {
+	slow  bool
+	err   error
+	reply string
+	calls int
+}
+
+func (m *fakeChatModel) Generate(ctx context.Context, _ []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	m.calls++
+	if m.slow {
+		<-ctx.Done()
+		// Clients report the cancellation, not its cause
+		return nil, fmt.Errorf("send request: %w", context.Canceled)
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return schema.AssistantMessage(m.reply, nil), nil
+}
+
+func (m *fakeChatModel) Stream(ctx context.Context, _ []*schema.Message, _ ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	m.calls++
+	if m.slow {
+		<-ctx.Done()
+		return nil, fmt.Errorf("send request: %w", context.Canceled)
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{schema.AssistantMessage(m.reply, nil)}), nil
+}
+
+func (m *fakeChatModel) WithTools(_ []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func newTestFallback(primary, fallback *fakeChatModel) *FallbackChatModel {
+	return newFallbackChatModel([]fallbackCandidate{
+		{cfg: &ProviderConfig{Kind: ProviderOpenAI, Model: "primary", Timeout: 20 * time.Millisecond}, model: primary},
+		{cfg: &ProviderConfig{Kind: ProviderOpenAI, Model: "fallback", Timeout: time.Second}, model: fallback},
+	}, RetryPolicy{MaxRetries: 1})
+}
+
+func TestFallbackGenerateSlowPrimary(t *testing.T) {
+	primary := &fakeChatModel{slow: true}
+	fallback := &fakeChatModel{reply: "from fallback"}
+
+	msg, err := newTestFallback(primary, fallback).Generate(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if msg.Content != "from fallback" {
+		t.Errorf("Generate() = %q, want the fallback reply", msg.Content)
+	}
+	if _, modelName, _ := AnsweredBy(msg); modelName != "fallback" {
+		t.Errorf("AnsweredBy() model = %q, want fallback", modelName)
+	}
+	if primary.calls != 2 {
+		t.Errorf("primary called %d times, want 2 (retried once)", primary.calls)
+	}
+}
+
+func TestFallbackStreamSlowPrimary(t *testing.T) {
+	primary := &fakeChatModel{slow: true}
+	fallback := &fakeChatModel{reply: "from fallback"}
+
+	sr, err := newTestFallback(primary, fallback).Stream(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	defer sr.Close()
+
+	msg, err := sr.Recv()
+	if err != nil {
+		t.Fatalf("Recv() error = %v", err)
+	}
+	if msg.Content != "from fallback" {
+		t.Errorf("Recv() = %q, want the fallback reply", msg.Content)
+	}
+	if _, err := sr.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Recv() after the last chunk error = %v, want EOF", err)
+	}
+	if primary.calls != 2 {
+		t.Errorf("primary called %d times, want 2 (retried once)", primary.calls)
+	}
+}
+
+func TestFallbackCancelledByCaller(t *testing.T) {
+	primary := &fakeChatModel{slow: true}
+	fallback := &fakeChatModel{reply: "from fallback"}
+	m := newFallbackChatModel([]fallbackCandidate{
+		{cfg: &ProviderConfig{Kind: ProviderOpenAI, Model: "primary", Timeout: time.Second}, model: primary},
+		{cfg: &ProviderConfig{Kind: ProviderOpenAI, Model: "fallback"}, model: fallback},
+	}, RetryPolicy{MaxRetries: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := m.Generate(ctx, []*schema.Message{schema.UserMessage("hi")}); err == nil {
+		t.Fatal("Generate() error = nil, want the cancellation")
+	}
+	if fallback.calls != 0 {
+		t.Errorf("fallback called %d times after the caller gave up", fallback.calls)
+	}
+}
+
+func TestFallbackNonRetryableError(t *testing.T) {
+	primary := &fakeChatModel{err: &APIError{Provider: ProviderOpenAI, StatusCode: http.StatusBadRequest}}
+	fallback := &fakeChatModel{reply: "from fallback"}
+
+	msg, err := newTestFallback(primary, fallback).Generate(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if msg.Content != "from fallback" {
+		t.Errorf("Generate() = %q, want the fallback reply", msg.Content)
+	}
+	if primary.calls != 1 {
+		t.Errorf("primary called %d times, want 1 (not retried)", primary.calls)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "deadline", err: context.DeadlineExceeded, want: true},
+		{name: "attempt timeout", err: fmt.Errorf("%w: %v", errAttemptTimeout, context.Canceled), want: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, want: true},
+		{name: "rate limited", err: &APIError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "server error", err: &APIError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "bad request", err: &APIError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "unauthorized", err: &APIError{StatusCode: http.StatusUnauthorized}, want: false},
+		{name: "plain error", err: errors.New("invalid tool call"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// imageFetchTimeout bounds the download of an image, body included
+	imageFetchTimeout = 30 * time.Second
+	// maxImageRedirects bounds the redirects followed when downloading an image
+	maxImageRedirects = 3
+)
+
+// ErrNonPublicAddress is returned when a URL supplied by a caller points to a
+// private, loopback, link-local or otherwise internal address
+var ErrNonPublicAddress = errors.New("address is not public")
+
+// internalPrefixes are the ranges not covered by the netip predicates that
+// must not be reached with caller-supplied URLs
+var internalPrefixes = []netip.Prefix{
+	// "This network", 0.0.0.0 reaches the local host on Linux
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// Shared address space, used by cloud metadata services such as
+	// 100.100.100.200
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// Benchmarking
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// NAT64, may embed any IPv4 address
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// imageHTTPClient downloads the images callers give by URL. It only connects
+// to public addresses, checked after DNS resolution so that a host name cannot
+// point it at the internal network, and follows a few redirects.
+var imageHTTPClient = newPublicHTTPClient(imageFetchTimeout, maxImageRedirects)
+
+func newPublicHTTPClient(timeout time.Duration, maxRedirects int) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !IsPublicAddr(addr) {
+				return fmt.Errorf("connect to %s: %w", host, ErrNonPublicAddress)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy, the address checked must be the one reached
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return ValidatePublicURL(req.URL.String())
+		},
+	}
+}
+
+// IsPublicAddr reports whether an address may be reached with a URL supplied
+// by a caller
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidatePublicURL checks that a URL supplied by a caller is an http(s) URL
+// whose host is not an internal address. Host names are resolved, and their
+// addresses checked, when connecting.
+func ValidatePublicURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q, only http and https are allowed", u.Scheme)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return errors.New("URL has no host")
+	}
+	if u.User != nil {
+		return errors.New("URL must not contain credentials")
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("host %s: %w", host, ErrNonPublicAddress)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !IsPublicAddr(addr) {
+		return fmt.Errorf("host %s: %w", host, ErrNonPublicAddress)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/eino-ext/components/model/gemini"
+	"google.golang.org/genai"
+)
+
+// newGeminiChatModel creates a Gemini chat model backed by the Gemini API
+// Stop sequences are not supported by the eino gemini model and are ignored.
+func newGeminiChatModel(ctx context.Context, cfg *ProviderConfig, params *GenerationParams) (*gemini.ChatModel, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("google api key is required")
+	}
+
+	clientCfg := &genai.ClientConfig{
+		APIKey:  cfg.APIKey,
+		Backend: genai.BackendGeminiAPI,
+	}
+	if cfg.BaseURL != "" {
+		clientCfg.HTTPOptions.BaseURL = cfg.BaseURL
+	}
+
+	client, err := genai.NewClient(ctx, clientCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create genai client: %w", err)
+	}
+
+	return gemini.NewChatModel(ctx, &gemini.Config{
+		Client:      client,
+		Model:       cfg.Model,
+		MaxTokens:   params.MaxTokens,
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+	})
+}
@@ -0,0 +1,602 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+// OllamaConfig configures the native Ollama chat model
+type OllamaConfig struct {
+	BaseURL string
+	Model   string
+	// Options are passed through as the Ollama "options" object
+	// (num_ctx, num_predict, repeat_penalty, seed, ...)
+	Options map[string]interface{}
+	// KeepAlive controls how long the model stays loaded, e.g. "5m" or "-1"
+	KeepAlive string
+	// Format constrains the answers to a JSON Schema
+	Format      json.RawMessage
+	Temperature *float32
+	MaxTokens   *int
+	TopP        *float32
+	Stop        []string
+	// HTTPClient is optional, http.DefaultClient is used when nil
+	HTTPClient *http.Client
+}
+
+// OllamaChatModel implements model.ToolCallingChatModel on top of the Ollama
+// native chat API (/api/chat). It also works with any server exposing the same API.
+type OllamaChatModel struct {
+	httpClient  *http.Client
+	baseURL     string
+	model       string
+	options     map[string]interface{}
+	keepAlive   string
+	format      json.RawMessage
+	temperature *float32
+	maxTokens   *int
+	topP        *float32
+	stop        []string
+	tools       []*schema.ToolInfo
+	toolChoice  *schema.ToolChoice
+}
+
+// OllamaModel describes a locally available model returned by /api/tags
+type OllamaModel struct {
+	Name       string    `json:"name"`
+	Model      string    `json:"model"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// NewOllamaChatModel creates an Ollama chat model
+func NewOllamaChatModel(_ context.Context, cfg *OllamaConfig) (*OllamaChatModel, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("ollama config is nil")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("ollama model is required")
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &OllamaChatModel{
+		httpClient:  httpClient,
+		baseURL:     ollamaBaseURL(cfg.BaseURL),
+		model:       cfg.Model,
+		options:     cfg.Options,
+		keepAlive:   cfg.KeepAlive,
+		format:      cfg.Format,
+		temperature: cfg.Temperature,
+		maxTokens:   cfg.MaxTokens,
+		topP:        cfg.TopP,
+		stop:        cfg.Stop,
+	}, nil
+}
+
+// ListOllamaModels returns the models pulled on the Ollama server
+func ListOllamaModels(ctx context.Context, baseURL string) ([]OllamaModel, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, ollamaBaseURL(baseURL)+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create ollama request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ollama request: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkOllamaResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Models []OllamaModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode ollama models: %w", err)
+	}
+	return out.Models, nil
+}
+
+// Generate sends a non-streaming chat request
+func (m *OllamaChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (outMsg *schema.Message, err error) {
+	req, cbInput, err := m.genRequest(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = callbacks.OnStart(ctx, cbInput)
+	defer func() {
+		if err != nil {
+			callbacks.OnError(ctx, err)
+		}
+	}()
+
+	resp, err := m.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode ollama response: %w", err)
+	}
+
+	outMsg = out.toMessage(0)
+	callbacks.OnEnd(ctx, &model.CallbackOutput{
+		Message:    outMsg,
+		Config:     cbInput.Config,
+		TokenUsage: toCallbackUsage(outMsg.ResponseMeta.Usage),
+	})
+
+	return outMsg, nil
+}
+
+// Stream sends a streaming chat request, Ollama streams newline-delimited JSON
+func (m *OllamaChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (outStream *schema.StreamReader[*schema.Message], err error) {
+	defer func() {
+		if err != nil {
+			callbacks.OnError(ctx, err)
+		}
+	}()
+
+	req, cbInput, err := m.genRequest(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	req.Stream = true
+
+	ctx = callbacks.OnStart(ctx, cbInput)
+
+	resp, err := m.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	sr, sw := schema.Pipe[*model.CallbackOutput](1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				_ = sw.Send(nil, fmt.Errorf("panic in ollama stream: %v\n%s", p, debug.Stack()))
+			}
+			_ = resp.Body.Close()
+			sw.Close()
+		}()
+
+		toolCalls := 0
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var chunk ollamaChatResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				_ = sw.Send(nil, fmt.Errorf("decode ollama stream chunk: %w", err))
+				return
+			}
+			if chunk.Error != "" {
+				_ = sw.Send(nil, &APIError{Provider: ProviderOllama, StatusCode: http.StatusInternalServerError, Message: chunk.Error})
+				return
+			}
+
+			msg := chunk.toMessage(toolCalls)
+			toolCalls += len(msg.ToolCalls)
+			if msg.Content == "" && len(msg.ToolCalls) == 0 && msg.ResponseMeta == nil {
+				continue
+			}
+
+			var tokenUsage *model.TokenUsage
+			if msg.ResponseMeta != nil {
+				tokenUsage = toCallbackUsage(msg.ResponseMeta.Usage)
+			}
+			if closed := sw.Send(&model.CallbackOutput{
+				Message:    msg,
+				Config:     cbInput.Config,
+				TokenUsage: tokenUsage,
+			}, nil); closed {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			_ = sw.Send(nil, fmt.Errorf("read ollama stream: %w", err))
+		}
+	}()
+
+	ctx, nsr := callbacks.OnEndWithStreamOutput(ctx, schema.StreamReaderWithConvert(sr,
+		func(src *model.CallbackOutput) (callbacks.CallbackOutput, error) {
+			return src, nil
+		}))
+
+	outStream = schema.StreamReaderWithConvert(nsr,
+		func(src callbacks.CallbackOutput) (*schema.Message, error) {
+			s := src.(*model.CallbackOutput)
+			if s.Message == nil {
+				return nil, schema.ErrNoValue
+			}
+			return s.Message, nil
+		},
+	)
+
+	return outStream, nil
+}
+
+// WithTools returns a copy of the model bound to the given tools
+func (m *OllamaChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	if len(tools) == 0 {
+		return nil, errors.New("no tools to bind")
+	}
+	tc := schema.ToolChoiceAllowed
+	nm := *m
+	nm.tools = tools
+	nm.toolChoice = &tc
+	return &nm, nil
+}
+
+// BindTools binds tools in place (model.ChatModel compatibility for react.Agent)
+func (m *OllamaChatModel) BindTools(tools []*schema.ToolInfo) error {
+	if len(tools) == 0 {
+		return errors.New("no tools to bind")
+	}
+	tc := schema.ToolChoiceAllowed
+	m.tools = tools
+	m.toolChoice = &tc
+	return nil
+}
+
+func (m *OllamaChatModel) GetType() string {
+	return "Ollama"
+}
+
+func (m *OllamaChatModel) IsCallbacksEnabled() bool {
+	return true
+}
+
+func (m *OllamaChatModel) genRequest(ctx context.Context, input []*schema.Message, opts ...model.Option) (*ollamaChatRequest, *model.CallbackInput, error) {
+	options := model.GetCommonOptions(&model.Options{
+		Model:       &m.model,
+		Temperature: m.temperature,
+		MaxTokens:   m.maxTokens,
+		TopP:        m.topP,
+		Stop:        m.stop,
+		Tools:       m.tools,
+		ToolChoice:  m.toolChoice,
+	}, opts...)
+
+	req := &ollamaChatRequest{
+		Model:     *options.Model,
+		KeepAlive: m.keepAlive,
+		Format:    m.format,
+		Options:   make(map[string]interface{}, len(m.options)+4),
+	}
+	for k, v := range m.options {
+		req.Options[k] = v
+	}
+	if options.Temperature != nil {
+		req.Options["temperature"] = *options.Temperature
+	}
+	if options.TopP != nil {
+		req.Options["top_p"] = *options.TopP
+	}
+	if options.MaxTokens != nil {
+		req.Options["num_predict"] = *options.MaxTokens
+	}
+	if len(options.Stop) > 0 {
+		req.Options["stop"] = options.Stop
+	}
+
+	for _, msg := range input {
+		if msg == nil {
+			continue
+		}
+		om := ollamaMessage{
+			Role:     string(msg.Role),
+			Content:  msg.Content,
+			ToolName: msg.ToolName,
+		}
+		if err := m.addImages(ctx, &om, msg.UserInputMultiContent); err != nil {
+			return nil, nil, err
+		}
+		for _, tc := range msg.ToolCalls {
+			args := strings.TrimSpace(tc.Function.Arguments)
+			if args == "" {
+				args = "{}"
+			}
+			if !json.Valid([]byte(args)) {
+				return nil, nil, fmt.Errorf("invalid arguments for tool call %s: %s", tc.Function.Name, args)
+			}
+			om.ToolCalls = append(om.ToolCalls, ollamaToolCall{
+				Function: ollamaFunctionCall{Name: tc.Function.Name, Arguments: json.RawMessage(args)},
+			})
+		}
+		req.Messages = append(req.Messages, om)
+	}
+
+	// Ollama has no tool_choice, so forbidden simply means not sending tools
+	if len(options.Tools) > 0 && (options.ToolChoice == nil || *options.ToolChoice != schema.ToolChoiceForbidden) {
+		for _, ti := range options.Tools {
+			params := json.RawMessage(`{"type":"object","properties":{}}`)
+			if ti.ParamsOneOf != nil {
+				js, err := ti.ParamsOneOf.ToJSONSchema()
+				if err != nil {
+					return nil, nil, fmt.Errorf("convert tool %s params: %w", ti.Name, err)
+				}
+				if js != nil {
+					raw, err := json.Marshal(js)
+					if err != nil {
+						return nil, nil, fmt.Errorf("marshal tool %s schema: %w", ti.Name, err)
+					}
+					params = raw
+				}
+			}
+			req.Tools = append(req.Tools, ollamaTool{
+				Type: "function",
+				Function: ollamaToolFunction{
+					Name:        ti.Name,
+					Description: ti.Desc,
+					Parameters:  params,
+				},
+			})
+		}
+	}
+
+	cbInput := &model.CallbackInput{
+		Messages:   input,
+		Tools:      options.Tools,
+		ToolChoice: options.ToolChoice,
+		Config: &model.Config{
+			Model: req.Model,
+			Stop:  options.Stop,
+		},
+	}
+	if options.MaxTokens != nil {
+		cbInput.Config.MaxTokens = *options.MaxTokens
+	}
+	if options.Temperature != nil {
+		cbInput.Config.Temperature = *options.Temperature
+	}
+	if options.TopP != nil {
+		cbInput.Config.TopP = *options.TopP
+	}
+
+	return req, cbInput, nil
+}
+
+func (m *OllamaChatModel) do(ctx context.Context, req *ollamaChatRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal ollama request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create ollama request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ollama request: %w", err)
+	}
+	if err := checkOllamaResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func checkOllamaResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	apiErr := &APIError{Provider: ProviderOllama, StatusCode: resp.StatusCode, Message: string(raw)}
+	var errBody struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(raw, &errBody) == nil && errBody.Error != "" {
+		apiErr.Message = errBody.Error
+	}
+	return apiErr
+}
+
+// ollamaBaseURL normalizes the configured base URL. Users often paste the
+// OpenAI-compatible endpoint (http://host:11434/v1), strip that suffix.
+func ollamaBaseURL(baseURL string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if baseURL == "" {
+		return defaultOllamaBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/v1")
+}
+
+// maxOllamaImageSize bounds the images downloaded to be sent inline
+const maxOllamaImageSize = 20 << 20
+
+// addImages adds the text and image parts of a user message to an Ollama
+// message. Ollama only takes inline base64 images, images given by http(s)
+// URL are downloaded.
+func (m *OllamaChatModel) addImages(ctx context.Context, om *ollamaMessage, parts []schema.MessageInputPart) error {
+	for _, part := range parts {
+		switch part.Type {
+		case schema.ChatMessagePartTypeText:
+			if part.Text == "" {
+				continue
+			}
+			if om.Content != "" {
+				om.Content += "\n"
+			}
+			om.Content += part.Text
+		case schema.ChatMessagePartTypeImageURL:
+			if part.Image == nil {
+				continue
+			}
+			data, err := m.imageData(ctx, part.Image)
+			if err != nil {
+				return err
+			}
+			om.Images = append(om.Images, data)
+		default:
+			return fmt.Errorf("unsupported message part type for ollama: %s", part.Type)
+		}
+	}
+	return nil
+}
+
+func (m *OllamaChatModel) imageData(ctx context.Context, image *schema.MessageInputImage) (string, error) {
+	if image.Base64Data != nil && *image.Base64Data != "" {
+		return *image.Base64Data, nil
+	}
+	if image.URL == nil || *image.URL == "" {
+		return "", errors.New("ollama image has neither URL nor data")
+	}
+	if _, data, ok := ParseDataURL(*image.URL); ok {
+		return data, nil
+	}
+
+	// The URL comes from the caller, it must not reach the internal network
+	if err := ValidatePublicURL(*image.URL); err != nil {
+		return "", fmt.Errorf("image url: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, *image.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("create image request: %w", err)
+	}
+	resp, err := imageHTTPClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("download image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download image: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxOllamaImageSize {
+		return "", fmt.Errorf("image is larger than %d bytes", maxOllamaImageSize)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOllamaImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("read image: %w", err)
+	}
+	if len(body) > maxOllamaImageSize {
+		return "", fmt.Errorf("image is larger than %d bytes", maxOllamaImageSize)
+	}
+	return base64.StdEncoding.EncodeToString(body), nil
+}
+
+type ollamaChatRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []ollamaMessage        `json:"messages"`
+	Tools     []ollamaTool           `json:"tools,omitempty"`
+	Stream    bool                   `json:"stream"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Format    json.RawMessage        `json:"format,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function ollamaFunctionCall `json:"function"`
+}
+
+type ollamaFunctionCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type ollamaTool struct {
+	Type     string             `json:"type"`
+	Function ollamaToolFunction `json:"function"`
+}
+
+type ollamaToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// toMessage converts a response (or stream chunk) to a schema message.
+// Ollama does not assign tool call ids, so they are generated here; toolOffset
+// keeps stream chunk indexes unique across chunks.
+func (r *ollamaChatResponse) toMessage(toolOffset int) *schema.Message {
+	msg := &schema.Message{
+		Role:    schema.Assistant,
+		Content: r.Message.Content,
+	}
+	for i, tc := range r.Message.ToolCalls {
+		idx := toolOffset + i
+		args := string(tc.Function.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		msg.ToolCalls = append(msg.ToolCalls, schema.ToolCall{
+			Index: &idx,
+			ID:    "call_" + uuid.NewString(),
+			Type:  "function",
+			Function: schema.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: args,
+			},
+		})
+	}
+	if r.Done {
+		finish := r.DoneReason
+		if len(msg.ToolCalls) > 0 || (finish == "stop" && toolOffset > 0) {
+			finish = "tool_calls"
+		}
+		msg.ResponseMeta = &schema.ResponseMeta{
+			FinishReason: finish,
+			Usage: &schema.TokenUsage{
+				PromptTokens:     r.PromptEvalCount,
+				CompletionTokens: r.EvalCount,
+				TotalTokens:      r.PromptEvalCount + r.EvalCount,
+			},
+		}
+	}
+	return msg
+}
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Generation parameter limits, shared by agent/team validation and request overrides
+const (
+	MaxTemperature   = 2.0
+	MaxStopSequences = 4
+)
+
+// GenerationParams are the sampling settings applied to every call of a model.
+// Nil fields fall back to the provider defaults.
+type GenerationParams struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// ParseGenerationParams reads generation params from an agent/team Config map.
+// It returns nil when none of the keys are set.
+func ParseGenerationParams(cfg map[string]interface{}) (*GenerationParams, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+
+	subset := make(map[string]interface{})
+	for _, key := range []string{"temperature", "max_tokens", "top_p", "stop"} {
+		if v, ok := cfg[key]; ok && v != nil {
+			subset[key] = v
+		}
+	}
+	if len(subset) == 0 {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(subset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generation params: %w", err)
+	}
+	var p GenerationParams
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("invalid generation params: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks the params are within the ranges accepted by the providers
+func (p *GenerationParams) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > MaxTemperature) {
+		return fmt.Errorf("temperature must be between 0 and %.0f", MaxTemperature)
+	}
+	if p.MaxTokens != nil && *p.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be greater than 0")
+	}
+	if p.TopP != nil && (*p.TopP <= 0 || *p.TopP > 1) {
+		return fmt.Errorf("top_p must be greater than 0 and at most 1")
+	}
+	if len(p.Stop) > MaxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", MaxStopSequences)
+	}
+	for _, s := range p.Stop {
+		if s == "" {
+			return fmt.Errorf("stop sequences must not be empty")
+		}
+	}
+	return nil
+}
+
+// Merge returns a copy of p with the non-nil fields of override applied on top
+func (p *GenerationParams) Merge(override *GenerationParams) *GenerationParams {
+	if p == nil && override == nil {
+		return nil
+	}
+	var out GenerationParams
+	if p != nil {
+		out = *p
+	}
+	if override == nil {
+		return &out
+	}
+	if override.Temperature != nil {
+		out.Temperature = override.Temperature
+	}
+	if override.MaxTokens != nil {
+		out.MaxTokens = override.MaxTokens
+	}
+	if override.TopP != nil {
+		out.TopP = override.TopP
+	}
+	if len(override.Stop) > 0 {
+		out.Stop = override.Stop
+	}
+	return &out
+}
+
+// WithParams returns a copy of the provider config with override merged into its params
+func (c *ProviderConfig) WithParams(override *GenerationParams) *ProviderConfig {
+	if c == nil || override == nil {
+		return c
+	}
+	out := *c
+	out.Params = c.Params.Merge(override)
+	if len(c.Fallbacks) > 0 {
+		out.Fallbacks = make([]*ProviderConfig, len(c.Fallbacks))
+		for i, fb := range c.Fallbacks {
+			out.Fallbacks[i] = fb.WithParams(override)
+		}
+	}
+	return &out
+}
+
+// Snapshot describes the provider config without its credentials, e.g. for
+// run history
+func (c *ProviderConfig) Snapshot() map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	snapshot := map[string]interface{}{
+		"kind":  string(c.Kind),
+		"model": c.Model,
+	}
+	if c.BaseURL != "" {
+		snapshot["base_url"] = c.BaseURL
+	}
+	if c.Params != nil {
+		snapshot["params"] = c.Params
+	}
+	if c.Output != nil {
+		snapshot["output_schema"] = c.Output.Name
+	}
+	if len(c.Fallbacks) > 0 {
+		fallbacks := make([]map[string]interface{}, 0, len(c.Fallbacks))
+		for _, fb := range c.Fallbacks {
+			fallbacks = append(fallbacks, fb.Snapshot())
+		}
+		snapshot["fallbacks"] = fallbacks
+	}
+	return snapshot
+}
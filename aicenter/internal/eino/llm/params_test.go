@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func float32Ptr(v float32) *float32 { return &v }
+
+func intPtr(v int) *int { return &v }
+
+func TestGenerationParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  *GenerationParams
+		wantErr bool
+	}{
+		{name: "nil", params: nil},
+		{name: "empty", params: &GenerationParams{}},
+		{name: "temperature 0", params: &GenerationParams{Temperature: float32Ptr(0)}},
+		{name: "temperature max", params: &GenerationParams{Temperature: float32Ptr(MaxTemperature)}},
+		{name: "temperature negative", params: &GenerationParams{Temperature: float32Ptr(-0.1)}, wantErr: true},
+		{name: "temperature above max", params: &GenerationParams{Temperature: float32Ptr(2.1)}, wantErr: true},
+		{name: "max_tokens 1", params: &GenerationParams{MaxTokens: intPtr(1)}},
+		{name: "max_tokens 0", params: &GenerationParams{MaxTokens: intPtr(0)}, wantErr: true},
+		{name: "max_tokens negative", params: &GenerationParams{MaxTokens: intPtr(-1)}, wantErr: true},
+		{name: "top_p 1", params: &GenerationParams{TopP: float32Ptr(1)}},
+		{name: "top_p small", params: &GenerationParams{TopP: float32Ptr(0.01)}},
+		{name: "top_p 0", params: &GenerationParams{TopP: float32Ptr(0)}, wantErr: true},
+		{name: "top_p above 1", params: &GenerationParams{TopP: float32Ptr(1.01)}, wantErr: true},
+		{name: "max stop sequences", params: &GenerationParams{Stop: []string{"a", "b", "c", "d"}}},
+		{name: "too many stop sequences", params: &GenerationParams{Stop: []string{"a", "b", "c", "d", "e"}}, wantErr: true},
+		{name: "empty stop sequence", params: &GenerationParams{Stop: []string{"a", ""}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseGenerationParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     map[string]interface{}
+		want    *GenerationParams
+		wantErr bool
+	}{
+		{name: "nil config", cfg: nil},
+		{name: "no params", cfg: map[string]interface{}{"other": 1, "temperature": nil}},
+		{
+			name: "params among other keys",
+			cfg:  map[string]interface{}{"temperature": 0.5, "max_tokens": 256, "top_p": 0.9, "stop": []interface{}{"END"}, "other": "x"},
+			want: &GenerationParams{Temperature: float32Ptr(0.5), MaxTokens: intPtr(256), TopP: float32Ptr(0.9), Stop: []string{"END"}},
+		},
+		{name: "wrong type", cfg: map[string]interface{}{"max_tokens": "many"}, wantErr: true},
+		{name: "out of range", cfg: map[string]interface{}{"temperature": 3}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGenerationParams(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGenerationParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGenerationParams() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerationParamsMerge(t *testing.T) {
+	base := &GenerationParams{Temperature: float32Ptr(0.2), MaxTokens: intPtr(100), Stop: []string{"END"}}
+	override := &GenerationParams{Temperature: float32Ptr(0.9), TopP: float32Ptr(0.5)}
+
+	got := base.Merge(override)
+	want := &GenerationParams{Temperature: float32Ptr(0.9), MaxTokens: intPtr(100), TopP: float32Ptr(0.5), Stop: []string{"END"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+	if *base.Temperature != 0.2 || base.TopP != nil {
+		t.Errorf("Merge() modified the receiver: %+v", base)
+	}
+
+	var nilParams *GenerationParams
+	if got := nilParams.Merge(nil); got != nil {
+		t.Errorf("nil.Merge(nil) = %+v, want nil", got)
+	}
+	if got := nilParams.Merge(override); !reflect.DeepEqual(got, override) {
+		t.Errorf("nil.Merge(override) = %+v, want %+v", got, override)
+	}
+}
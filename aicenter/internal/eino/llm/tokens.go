@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultContextWindow is the context size assumed for unknown models
+const DefaultContextWindow = 8192
+
+// defaultOllamaContextWindow is the num_ctx Ollama runs models with unless
+// the provider options set it
+const defaultOllamaContextWindow = 4096
+
+// contextWindowHints are the context sizes of model families, matched on the
+// model name in order
+var contextWindowHints = []struct {
+	hint string
+	size int
+}{
+	{"gpt-4.1", 1047576},
+	{"gpt-5", 400000},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4", 8192},
+	{"gpt-3.5", 16385},
+	{"claude", 200000},
+	{"gemini-1.5-pro", 2097152},
+	{"gemini", 1048576},
+	{"qwen-long", 1000000},
+	{"qwen-turbo", 1000000},
+	{"qwen-plus", 131072},
+	{"qwen-max", 32768},
+	{"qwen", 32768},
+	{"deepseek", 65536},
+	{"glm-4", 128000},
+	{"llama3.1", 131072},
+	{"llama3.2", 131072},
+	{"llama3.3", 131072},
+	{"llama3", 8192},
+	{"mistral", 32768},
+	{"doubao", 32768},
+}
+
+// contextSuffix matches the context size in names such as "doubao-pro-128k"
+var contextSuffix = regexp.MustCompile(`(\d+)k\b`)
+
+// ContextWindow returns the context size in tokens of the model of the
+// provider, and of each of its fallbacks: the smallest one. The
+// "context_window" option of the provider config overrides the size guessed
+// from the model name.
+func (c *ProviderConfig) ContextWindow() int {
+	if c == nil {
+		return DefaultContextWindow
+	}
+	size := c.contextWindow()
+	for _, fb := range c.Fallbacks {
+		if fb != nil {
+			size = min(size, fb.contextWindow())
+		}
+	}
+	return size
+}
+
+func (c *ProviderConfig) contextWindow() int {
+	if size, ok := positiveInt(c.Options["context_window"]); ok {
+		return size
+	}
+	kind := NormalizeProviderKind(string(c.Kind))
+	if kind == ProviderOllama {
+		if opts, ok := c.Options["options"].(map[string]interface{}); ok {
+			if size, ok := positiveInt(opts["num_ctx"]); ok {
+				return size
+			}
+		}
+		return defaultOllamaContextWindow
+	}
+
+	name := strings.ToLower(c.Model)
+	if m := contextSuffix.FindStringSubmatch(name); m != nil {
+		if k, err := strconv.Atoi(m[1]); err == nil && k > 0 {
+			return k * 1024
+		}
+	}
+	if strings.HasPrefix(name, "o1") || strings.HasPrefix(name, "o3") || strings.HasPrefix(name, "o4") {
+		return 200000
+	}
+	for _, h := range contextWindowHints {
+		if strings.Contains(name, h.hint) {
+			return h.size
+		}
+	}
+	if kind == ProviderAnthropic {
+		return 200000
+	}
+	if kind == ProviderGoogle {
+		return 1048576
+	}
+	return DefaultContextWindow
+}
+
+func positiveInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, n > 0
+	case int64:
+		return int(n), n > 0
+	case float64:
+		return int(n), n > 0
+	}
+	return 0, false
+}
+
+// Tokenizer counts the tokens of a text for a model
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// estimator estimates the tokens of a text from its characters, with the
+// average number of characters per token of a tokenizer family
+type estimator struct {
+	// asciiPerToken is the number of ASCII characters per token
+	asciiPerToken float64
+	// otherPerToken is the number of other characters, e.g. CJK, per token
+	otherPerToken float64
+}
+
+func (e estimator) CountTokens(text string) int {
+	var ascii, other int
+	for _, r := range text {
+		if r <= unicode.MaxASCII {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return int(math.Ceil(float64(ascii)/e.asciiPerToken + float64(other)/e.otherPerToken))
+}
+
+// Estimators of the tokenizer families. The ratios lean towards more tokens
+// so that an estimated window fits the model.
+var (
+	o200kEstimator    = estimator{asciiPerToken: 4, otherPerToken: 1}
+	cl100kEstimator   = estimator{asciiPerToken: 4, otherPerToken: 0.7}
+	claudeEstimator   = estimator{asciiPerToken: 3.5, otherPerToken: 0.8}
+	geminiEstimator   = estimator{asciiPerToken: 4, otherPerToken: 1}
+	qwenEstimator     = estimator{asciiPerToken: 4, otherPerToken: 1.3}
+	deepseekEstimator = estimator{asciiPerToken: 3.3, otherPerToken: 1.4}
+	defaultEstimator  = estimator{asciiPerToken: 3.5, otherPerToken: 0.8}
+)
+
+// Tokenizer returns the tokenizer of the model of the provider. Tokens are
+// estimated with the ratios of the tokenizer family of the model, the
+// tokenizers themselves are not bundled.
+func (c *ProviderConfig) Tokenizer() Tokenizer {
+	if c == nil {
+		return defaultEstimator
+	}
+
+	name := strings.ToLower(c.Model)
+	switch {
+	case strings.Contains(name, "gpt-4o"), strings.Contains(name, "gpt-4.1"), strings.Contains(name, "gpt-5"),
+		strings.HasPrefix(name, "o1"), strings.HasPrefix(name, "o3"), strings.HasPrefix(name, "o4"):
+		return o200kEstimator
+	case strings.Contains(name, "gpt-"):
+		return cl100kEstimator
+	case strings.Contains(name, "claude"):
+		return claudeEstimator
+	case strings.Contains(name, "gemini"), strings.Contains(name, "gemma"):
+		return geminiEstimator
+	case strings.Contains(name, "qwen"), strings.Contains(name, "qwq"), strings.Contains(name, "doubao"):
+		return qwenEstimator
+	case strings.Contains(name, "deepseek"):
+		return deepseekEstimator
+	}
+
+	switch NormalizeProviderKind(string(c.Kind)) {
+	case ProviderOpenAI:
+		return o200kEstimator
+	case ProviderAnthropic:
+		return claudeEstimator
+	case ProviderGoogle:
+		return geminiEstimator
+	case ProviderDashscope, ProviderArk:
+		return qwenEstimator
+	}
+	return defaultEstimator
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"strings"
+)
+
+// visionModelHints are substrings of the names of vision-capable models served
+// by OpenAI-compatible, Ark, Dashscope and Ollama providers
+var visionModelHints = []string{
+	"vision", "-vl", "vl-", "qvq", "llava", "bakllava", "pixtral", "gemma3",
+	"minicpm-v", "moondream", "gpt-4o", "gpt-4.1", "gpt-5",
+}
+
+// SupportsVision reports whether the model of the provider, and of each of
+// its fallbacks, accepts images. The "vision" option of the provider config
+// overrides the guess made from the provider kind and model name.
+func (c *ProviderConfig) SupportsVision() bool {
+	if c == nil || !c.supportsVision() {
+		return false
+	}
+	for _, fb := range c.Fallbacks {
+		if fb != nil && !fb.supportsVision() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ProviderConfig) supportsVision() bool {
+	if vision, ok := c.Options["vision"].(bool); ok {
+		return vision
+	}
+
+	name := strings.ToLower(c.Model)
+	switch NormalizeProviderKind(string(c.Kind)) {
+	case ProviderAnthropic:
+		// Every model since Claude 3 accepts images
+		return !strings.HasPrefix(name, "claude-2") && !strings.HasPrefix(name, "claude-instant")
+	case ProviderOpenAI:
+		if strings.HasPrefix(name, "o1") || strings.HasPrefix(name, "o3") || strings.HasPrefix(name, "o4") {
+			return !strings.Contains(name, "mini") || strings.HasPrefix(name, "o4-mini")
+		}
+		return hasVisionHint(name)
+	case ProviderCompatible, ProviderDashscope, ProviderArk, ProviderOllama:
+		return hasVisionHint(name)
+	}
+	// The Gemini model only reads images from Gemini file URIs, images are
+	// described to it as text instead
+	return false
+}
+
+func hasVisionHint(name string) bool {
+	for _, hint := range visionModelHints {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDataURL splits a base64 data URL such as "data:image/png;base64,..."
+// into its MIME type and base64 data
+func ParseDataURL(url string) (mimeType, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mimeType, found = strings.CutSuffix(meta, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mimeType, data, true
+}
@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+)
+
+const (
+	// MaxHistoryTokens caps the history of models with a large context, which
+	// would otherwise be sent, and billed, whole sessions
+	MaxHistoryTokens = 32000
+	// RAGReserveTokens is kept for the knowledge base search results, and
+	// other tool results, of agents with tools
+	RAGReserveTokens = 4000
+	// DefaultOutputReserveTokens is kept for the answer when max_tokens is unset
+	DefaultOutputReserveTokens = 2048
+
+	// minHistoryTokens is the history budget of models whose context is filled
+	// by their instruction and tools
+	minHistoryTokens = 256
+	// maxWindowMessages caps the messages of a history windowed by tokens
+	maxWindowMessages = 100
+	// messageOverheadTokens is the cost of the format of a message
+	messageOverheadTokens = 4
+)
+
+// HistoryBudget returns the tokens left for the history in the context of a
+// model: its context size minus the instruction, the tools, the answer and,
+// with tools, the RAG reserve
+func HistoryBudget(ctx context.Context, provider *llm.ProviderConfig, instruction string, tools []tool.BaseTool) int {
+	tokenizer := provider.Tokenizer()
+	budget := provider.ContextWindow() - tokenizer.CountTokens(instruction) - toolTokens(ctx, tokenizer, tools)
+	if provider != nil && provider.Params != nil && provider.Params.MaxTokens != nil {
+		budget -= *provider.Params.MaxTokens
+	} else {
+		budget -= DefaultOutputReserveTokens
+	}
+	if len(tools) > 0 {
+		budget -= RAGReserveTokens
+	}
+	return max(min(budget, MaxHistoryTokens), minHistoryTokens)
+}
+
+// toolTokens estimates the tokens of the definitions of the tools
+func toolTokens(ctx context.Context, tokenizer llm.Tokenizer, tools []tool.BaseTool) int {
+	tokens := 0
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil || info == nil {
+			continue
+		}
+		tokens += tokenizer.CountTokens(info.Name) + tokenizer.CountTokens(info.Desc)
+		if info.ParamsOneOf == nil {
+			continue
+		}
+		if params, err := info.ParamsOneOf.ToJSONSchema(); err == nil && params != nil {
+			if data, err := json.Marshal(params); err == nil {
+				tokens += tokenizer.CountTokens(string(data))
+			}
+		}
+	}
+	return tokens
+}
+
+// messageTokens estimates the tokens of a message: its content, tool calls
+// and format
+func messageTokens(tokenizer llm.Tokenizer, msg *schema.Message) int {
+	if msg == nil {
+		return 0
+	}
+	tokens := messageOverheadTokens + tokenizer.CountTokens(msg.Content)
+	for _, tc := range msg.ToolCalls {
+		tokens += tokenizer.CountTokens(tc.Function.Name) + tokenizer.CountTokens(tc.Function.Arguments)
+	}
+	return tokens
+}
+
+// tokenWindowStart returns the index of the first of the latest messages
+// fitting in budget tokens. An assistant message calling tools and the
+// results of the calls are kept or trimmed together.
+func tokenWindowStart(tokenizer llm.Tokenizer, msgs []*schema.Message, budget int) int {
+	start, used := len(msgs), 0
+	for end := len(msgs); end > 0; {
+		// The unit ending at end: tool results go with the call before them
+		begin := end - 1
+		for begin > 0 && msgs[begin].Role == schema.Tool {
+			begin--
+		}
+		if msgs[begin].Role != schema.Assistant || len(msgs[begin].ToolCalls) == 0 {
+			// Results without their call start the window on their own
+			if msgs[end-1].Role == schema.Tool {
+				begin = end - 1
+			}
+		}
+
+		tokens := 0
+		for _, msg := range msgs[begin:end] {
+			tokens += messageTokens(tokenizer, msg)
+		}
+		if used+tokens > budget || len(msgs)-begin > maxWindowMessages {
+			break
+		}
+		used += tokens
+		start, end = begin, begin
+	}
+
+	// Results whose call was trimmed cannot be sent
+	for start < len(msgs) && msgs[start].Role == schema.Tool {
+		start++
+	}
+	return start
+}
@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+)
+
+// charTokenizer counts a token per byte, so that the tests control the size
+// of each message: its content length plus messageOverheadTokens
+type charTokenizer struct{}
+
+func (charTokenizer) CountTokens(text string) int { return len(text) }
+
+func toolCall(ids ...string) *schema.Message {
+	calls := make([]schema.ToolCall, 0, len(ids))
+	for _, id := range ids {
+		calls = append(calls, schema.ToolCall{ID: id, Function: schema.FunctionCall{Name: "f"}})
+	}
+	return schema.AssistantMessage("", calls)
+}
+
+func TestTokenWindowStart(t *testing.T) {
+	tests := []struct {
+		name   string
+		msgs   []*schema.Message
+		budget int
+		want   int
+	}{
+		{name: "empty", msgs: nil, budget: 100, want: 0},
+		{
+			name:   "everything fits",
+			msgs:   []*schema.Message{schema.UserMessage("aaaa"), schema.AssistantMessage("bbbb", nil)},
+			budget: 100,
+			want:   0,
+		},
+		{
+			name:   "nothing fits",
+			msgs:   []*schema.Message{schema.UserMessage("aaaa"), schema.AssistantMessage("bbbb", nil)},
+			budget: 7,
+			want:   2,
+		},
+		{
+			// Each message costs 8 tokens
+			name: "latest messages fitting exactly",
+			msgs: []*schema.Message{
+				schema.UserMessage("aaaa"), schema.AssistantMessage("bbbb", nil),
+				schema.UserMessage("cccc"), schema.AssistantMessage("dddd", nil),
+			},
+			budget: 16,
+			want:   2,
+		},
+		{
+			name: "one token short",
+			msgs: []*schema.Message{
+				schema.UserMessage("aaaa"), schema.AssistantMessage("bbbb", nil),
+				schema.UserMessage("cccc"), schema.AssistantMessage("dddd", nil),
+			},
+			budget: 15,
+			want:   3,
+		},
+		{
+			// The call (5) and its result (8) fit together with the answer (5)
+			name: "call kept with its result",
+			msgs: []*schema.Message{
+				schema.UserMessage("q"), toolCall("1"), schema.ToolMessage("rrrr", "1"), schema.AssistantMessage("x", nil),
+			},
+			budget: 18,
+			want:   1,
+		},
+		{
+			// The result alone would fit, it is trimmed with its call
+			name: "result trimmed with its call",
+			msgs: []*schema.Message{
+				schema.UserMessage("q"), toolCall("1"), schema.ToolMessage("rrrr", "1"), schema.AssistantMessage("x", nil),
+			},
+			budget: 17,
+			want:   3,
+		},
+		{
+			name: "call with several results",
+			msgs: []*schema.Message{
+				schema.UserMessage("q"), toolCall("1", "2"), schema.ToolMessage("r", "1"), schema.ToolMessage("r", "2"),
+			},
+			// call 4+2, results 5 each
+			budget: 16,
+			want:   1,
+		},
+		{
+			name: "several results trimmed together",
+			msgs: []*schema.Message{
+				schema.UserMessage("q"), toolCall("1", "2"), schema.ToolMessage("r", "1"), schema.ToolMessage("r", "2"),
+			},
+			budget: 15,
+			want:   4,
+		},
+		{
+			name:   "orphan results at the start are dropped",
+			msgs:   []*schema.Message{schema.ToolMessage("r", "1"), schema.ToolMessage("r", "2"), schema.AssistantMessage("x", nil)},
+			budget: 100,
+			want:   2,
+		},
+		{
+			name: "orphan results after a user message are kept with it",
+			msgs: []*schema.Message{
+				schema.UserMessage("q"), schema.ToolMessage("r", "1"), schema.AssistantMessage("x", nil),
+			},
+			budget: 100,
+			want:   0,
+		},
+		{
+			name: "window starting at an orphan result skips it",
+			msgs: []*schema.Message{
+				schema.UserMessage("q"), schema.ToolMessage("r", "1"), schema.AssistantMessage("x", nil),
+			},
+			budget: 10,
+			want:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenWindowStart(charTokenizer{}, tt.msgs, tt.budget); got != tt.want {
+				t.Errorf("tokenWindowStart() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenWindowStartMaxMessages(t *testing.T) {
+	msgs := make([]*schema.Message, 0, maxWindowMessages+50)
+	for i := 0; i < maxWindowMessages+50; i++ {
+		msgs = append(msgs, schema.UserMessage("a"))
+	}
+	if got := tokenWindowStart(charTokenizer{}, msgs, 1<<20); got != 50 {
+		t.Errorf("tokenWindowStart() = %d, want the window capped at %d messages", got, maxWindowMessages)
+	}
+}
+
+// namedTool is a tool whose definition is only its name
+type namedTool struct{ name string }
+
+func (t namedTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name}, nil
+}
+
+func TestHistoryBudget(t *testing.T) {
+	maxTokens := 1000
+	provider := func(contextWindow int, params *llm.GenerationParams) *llm.ProviderConfig {
+		// gpt-4o models count 4 ASCII characters per token
+		return &llm.ProviderConfig{
+			Kind:    llm.ProviderOpenAI,
+			Model:   "gpt-4o",
+			Options: map[string]interface{}{"context_window": contextWindow},
+			Params:  params,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		provider    *llm.ProviderConfig
+		instruction string
+		tools       []tool.BaseTool
+		want        int
+	}{
+		{name: "no provider", provider: nil, want: llm.DefaultContextWindow - DefaultOutputReserveTokens},
+		{name: "output reserve", provider: provider(10000, nil), want: 10000 - DefaultOutputReserveTokens},
+		{name: "max_tokens", provider: provider(10000, &llm.GenerationParams{MaxTokens: &maxTokens}), want: 10000 - maxTokens},
+		{name: "instruction", provider: provider(10000, nil), instruction: strings.Repeat("a", 400), want: 10000 - 100 - DefaultOutputReserveTokens},
+		{
+			name:     "tools and RAG reserve",
+			provider: provider(10000, nil),
+			tools:    []tool.BaseTool{namedTool{name: "lookup__"}},
+			want:     10000 - 2 - DefaultOutputReserveTokens - RAGReserveTokens,
+		},
+		{name: "small context clamped to the minimum", provider: provider(2000, nil), want: minHistoryTokens},
+		{name: "large context capped", provider: provider(1000000, nil), want: MaxHistoryTokens},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HistoryBudget(context.Background(), tt.provider, tt.instruction, tt.tools); got != tt.want {
+				t.Errorf("HistoryBudget() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
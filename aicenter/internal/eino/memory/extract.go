@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// FactExtractionPrompt is the system prompt for extracting the facts about a
+// visitor from a conversation
+const FactExtractionPrompt = `你是一个访客记忆助手。你的任务是从客服对话中提取关于访客的、在以后的对话中仍然有用的长期信息。
+
+提取的内容：
+1. fact：访客的事实信息，例如订单号、购买的产品、所在城市、遇到的问题
+2. preference：访客的偏好，例如使用的语言、联系方式、沟通风格
+3. status：访客的身份或状态，例如 VIP、企业客户、已投诉
+
+要求：
+1. 只提取访客本人明确说出或确认的信息，不要推测
+2. 不要提取一次性的寒暄、客服的回答内容或只与本次问题相关的细节
+3. 每条信息简洁独立，使用访客所用的语言
+4. 不要重复已知信息
+
+已知信息：
+{known}
+
+对话：
+{conversation}
+
+请只输出 JSON 数组，例如 [{"content": "有订单 #123", "category": "fact"}]，没有新信息时输出 []。`
+
+// ExtractedFact is a fact about a visitor, extracted from a conversation or
+// remembered by an agent
+type ExtractedFact struct {
+	Content  string `json:"content"`
+	Category string `json:"category"`
+}
+
+// FactExtractor extracts the facts about a visitor from conversations using LLM
+type FactExtractor struct {
+	model model.BaseChatModel
+}
+
+// NewFactExtractor creates a fact extractor
+func NewFactExtractor(chatModel model.BaseChatModel) (*FactExtractor, error) {
+	if chatModel == nil {
+		return nil, fmt.Errorf("model is required")
+	}
+	return &FactExtractor{model: chatModel}, nil
+}
+
+// Extract returns the facts about the visitor in msgs which are not among the
+// known ones
+func (e *FactExtractor) Extract(ctx context.Context, known []VisitorFact, msgs []*schema.Message) ([]ExtractedFact, error) {
+	var conv strings.Builder
+	for _, m := range msgs {
+		if m == nil || m.Content == "" || (m.Role != schema.User && m.Role != schema.Assistant) {
+			continue
+		}
+		conv.WriteString(fmt.Sprintf("[%s]: %s\n", m.Role, m.Content))
+	}
+	if conv.Len() == 0 {
+		return nil, nil
+	}
+
+	knownText := "无"
+	if len(known) > 0 {
+		var sb strings.Builder
+		for _, f := range known {
+			sb.WriteString(fmt.Sprintf("- [%s] %s\n", f.Category, f.Content))
+		}
+		knownText = sb.String()
+	}
+
+	// The prompt has JSON braces, so it is not an FString template
+	prompt := strings.NewReplacer("{known}", knownText, "{conversation}", conv.String()).Replace(FactExtractionPrompt)
+	resp, err := e.model.Generate(ctx, []*schema.Message{schema.SystemMessage(prompt)})
+	if err != nil {
+		return nil, fmt.Errorf("fact extraction failed: %w", err)
+	}
+	return parseExtractedFacts(resp.Content)
+}
+
+// parseExtractedFacts reads the JSON array of the answer, which models may
+// wrap in a code block or prose
+func parseExtractedFacts(content string) ([]ExtractedFact, error) {
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in extraction: %q", content)
+	}
+	var facts []ExtractedFact
+	if err := json.Unmarshal([]byte(content[start:end+1]), &facts); err != nil {
+		return nil, fmt.Errorf("parse extracted facts: %w", err)
+	}
+	return facts, nil
+}
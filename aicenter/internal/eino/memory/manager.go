@@ -2,10 +2,15 @@ package memory
 
 import (
 	"context"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/cloudwego/eino/schema"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
 )
 
 // ManagerConfig configures the memory manager
@@ -24,13 +29,31 @@ type ManagerConfig struct {
 	RedisStore *RedisStore
 	// Summarizer for conversation compression (optional)
 	Summarizer *Summarizer
+	// NewSummarizer builds the summarizer when a session is summarized if
+	// Summarizer is nil, e.g. from the model of the project (optional)
+	NewSummarizer func(ctx context.Context) (*Summarizer, error)
 }
 
+// summarizeTimeout bounds a background summarization
+const summarizeTimeout = 2 * time.Minute
+
+// summarizing holds the sessions being summarized in the background
+var summarizing sync.Map
+
 // Manager manages conversation memory for agents
 type Manager struct {
 	store      Store
 	windowSize int
-	summarizer *Summarizer
+	summarizer func(ctx context.Context) (*Summarizer, error)
+	// summaries keeps the rolling summaries of the sessions, only with
+	// persistence
+	summaries *SummaryStore
+	// messages reads the sequence numbers of the messages the summaries are
+	// keyed to, only with persistence
+	messages *PostgresStore
+	// tokenBudget windows the history by tokens instead of messages when set
+	tokenBudget int
+	tokenizer   llm.Tokenizer
 }
 
 // NewManager creates a new memory manager
@@ -48,7 +71,7 @@ func NewManager(cfg *ManagerConfig) *Manager {
 		pgStore := NewPostgresStore(cfg.DB, cfg.ProjectID)
 		// Use HybridStore if Redis is available
 		if cfg.RedisStore != nil {
-			store = NewHybridStore(cfg.RedisStore, pgStore)
+			store = NewHybridStore(cfg.RedisStore.ForProject(cfg.ProjectID), pgStore)
 		} else {
 			store = pgStore
 		}
@@ -56,11 +79,28 @@ func NewManager(cfg *ManagerConfig) *Manager {
 		store = NewInMemoryStore()
 	}
 
-	return &Manager{
+	m := &Manager{
 		store:      store,
 		windowSize: windowSize,
-		summarizer: cfg.Summarizer,
+		summarizer: cfg.NewSummarizer,
 	}
+	if cfg.Summarizer != nil {
+		summarizer := cfg.Summarizer
+		m.summarizer = func(context.Context) (*Summarizer, error) { return summarizer, nil }
+	}
+	if cfg.EnablePersistence && cfg.DB != nil {
+		m.summaries = NewSummaryStore(cfg.DB, cfg.ProjectID)
+		m.messages = NewPostgresStore(cfg.DB, cfg.ProjectID)
+	}
+	return m
+}
+
+// SetTokenBudget windows the history by tokens rather than WindowSize
+// messages: the latest messages fitting in budget tokens counted with
+// tokenizer, see HistoryBudget
+func (m *Manager) SetTokenBudget(budget int, tokenizer llm.Tokenizer) {
+	m.tokenBudget = budget
+	m.tokenizer = tokenizer
 }
 
 // GetHistory returns the conversation history for a session
@@ -68,16 +108,56 @@ func (m *Manager) GetHistory(ctx context.Context, sessionID string) ([]*schema.M
 	return m.store.Read(ctx, sessionID)
 }
 
-// GetWindowedHistory returns the last N messages for a session
+// GetWindowedHistory returns the latest messages of a session, by token
+// budget or else the last WindowSize ones, preceded by the summary of the
+// older ones if any
 func (m *Manager) GetWindowedHistory(ctx context.Context, sessionID string) ([]*schema.Message, error) {
 	msgs, err := m.store.Read(ctx, sessionID)
 	if err != nil {
 		return nil, err
 	}
-	if len(msgs) <= m.windowSize {
-		return msgs, nil
+	start := m.windowStart(msgs, 0)
+	if start == 0 || m.summaries == nil {
+		return msgs[start:], nil
+	}
+
+	summary, err := m.summaries.Get(ctx, sessionID)
+	if err != nil {
+		log.Printf("[Memory] Failed to read summary of session %s: %v", sessionID, err)
+		return msgs[start:], nil
+	}
+	if summary == nil || summary.Content == "" {
+		return msgs[start:], nil
 	}
-	return msgs[len(msgs)-m.windowSize:], nil
+	summaryMsg := SummaryMessage(summary.Content)
+	summaryTokens := m.summaryTokens(summaryMsg)
+	if summaryTokens < 0 {
+		return msgs[start:], nil
+	}
+	start = m.windowStart(msgs, summaryTokens)
+	return append([]*schema.Message{summaryMsg}, msgs[start:]...), nil
+}
+
+// windowStart returns the index of the first message of the history window,
+// the summary of the older messages taking summaryTokens of the budget
+func (m *Manager) windowStart(msgs []*schema.Message, summaryTokens int) int {
+	if m.tokenBudget <= 0 {
+		return max(len(msgs)-m.windowSize, 0)
+	}
+	return tokenWindowStart(m.tokenizer, msgs, m.tokenBudget-summaryTokens)
+}
+
+// summaryTokens returns the tokens of the summary in the budget, -1 when it
+// would take more than half of it and is left out
+func (m *Manager) summaryTokens(summaryMsg *schema.Message) int {
+	if m.tokenBudget <= 0 {
+		return 0
+	}
+	tokens := messageTokens(m.tokenizer, summaryMsg)
+	if tokens > m.tokenBudget/2 {
+		return -1
+	}
+	return tokens
 }
 
 // AddMessage adds a message to the conversation history
@@ -95,13 +175,23 @@ func (m *Manager) AddUserMessage(ctx context.Context, sessionID string, content
 	return m.AddMessage(ctx, sessionID, schema.UserMessage(content))
 }
 
-// AddAssistantMessage adds an assistant message to the history
+// AddAssistantMessage adds an assistant message to the history and updates
+// the summary of the session in the background
 func (m *Manager) AddAssistantMessage(ctx context.Context, sessionID string, content string) error {
-	return m.AddMessage(ctx, sessionID, schema.AssistantMessage(content, nil))
+	if err := m.AddMessage(ctx, sessionID, schema.AssistantMessage(content, nil)); err != nil {
+		return err
+	}
+	m.summarizeAsync(ctx, sessionID)
+	return nil
 }
 
 // ClearHistory clears the conversation history for a session
 func (m *Manager) ClearHistory(ctx context.Context, sessionID string) error {
+	if m.summaries != nil {
+		if err := m.summaries.Delete(ctx, sessionID); err != nil {
+			return err
+		}
+	}
 	return m.store.Delete(ctx, sessionID)
 }
 
@@ -130,29 +220,88 @@ func (m *Manager) BuildContextMessages(ctx context.Context, sessionID string, sy
 	return msgs, nil
 }
 
-// SummarizeIfNeeded checks if history exceeds threshold and summarizes
+// SummarizeIfNeeded folds the messages that left the history window into the
+// summary of the session. The messages themselves are kept. The progress of
+// the summary is the sequence number of the last message it covers, read
+// from PostgreSQL, so that it stays right when messages are removed or the
+// Redis cache expires.
 func (m *Manager) SummarizeIfNeeded(ctx context.Context, sessionID string) (bool, error) {
-	if m.summarizer == nil {
+	if m.summarizer == nil || m.summaries == nil {
 		return false, nil
 	}
 
-	msgs, err := m.store.Read(ctx, sessionID)
+	msgs, seqs, err := m.messages.ReadSequenced(ctx, sessionID)
 	if err != nil {
 		return false, err
 	}
+	if m.windowStart(msgs, 0) == 0 {
+		return false, nil
+	}
 
-	summarized, didSummarize, err := m.summarizer.SummarizeIfNeeded(ctx, msgs)
+	summary, err := m.summaries.Get(ctx, sessionID)
 	if err != nil {
 		return false, err
 	}
+	var previous string
+	var lastSeq int64
+	var summaryTokens int
+	if summary != nil {
+		previous, lastSeq = summary.Content, summary.LastSeq
+		summaryTokens = max(m.summaryTokens(SummaryMessage(summary.Content)), 0)
+	}
+	// The messages before the window, as GetWindowedHistory reads it
+	older := m.windowStart(msgs, summaryTokens)
+	from := firstUncovered(seqs[:older], lastSeq)
+	if from >= older {
+		return false, nil
+	}
 
-	if didSummarize {
-		if err := m.store.Write(ctx, sessionID, summarized); err != nil {
-			return false, err
+	summarizer, err := m.summarizer(ctx)
+	if err != nil {
+		return false, err
+	}
+	content, err := summarizer.SummarizeRolling(ctx, previous, msgs[from:older])
+	if err != nil {
+		return false, err
+	}
+	if err := m.summaries.Save(ctx, sessionID, content, seqs[older-1]); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// firstUncovered returns the index of the first message not covered by a
+// summary of the messages up to lastSeq, len(seqs) if it covers them all
+func firstUncovered(seqs []int64, lastSeq int64) int {
+	for i, seq := range seqs {
+		if seq > lastSeq {
+			return i
 		}
 	}
+	return len(seqs)
+}
 
-	return didSummarize, nil
+// summarizeAsync runs SummarizeIfNeeded in the background so it never delays
+// the reply. A session already being summarized is skipped, the next reply
+// catches up.
+func (m *Manager) summarizeAsync(ctx context.Context, sessionID string) {
+	if m.summarizer == nil || m.summaries == nil {
+		return
+	}
+	key := m.summaries.projectID.String() + ":" + sessionID
+	if _, running := summarizing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer summarizing.Delete(key)
+		ctx, cancel := context.WithTimeout(ctx, summarizeTimeout)
+		defer cancel()
+		if _, err := m.SummarizeIfNeeded(ctx, sessionID); err != nil {
+			log.Printf("[Memory] Failed to summarize session %s: %v", sessionID, err)
+		}
+	}()
 }
 
 // GetStore returns the underlying store
@@ -0,0 +1,181 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// summaryModel answers every summarization with reply and records the
+// conversation it was asked to summarize
+type summaryModel struct {
+	reply string
+	input string
+}
+
+func (m *summaryModel) Generate(_ context.Context, input []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	m.input = input[len(input)-1].Content
+	return schema.AssistantMessage(m.reply, nil), nil
+}
+
+func (m *summaryModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := m.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+// storedSession makes the queries of the dry run db find the messages with
+// the given sequence numbers, content "message <seq>", and summary
+func storedSession(t *testing.T, db *gorm.DB, seqs []int64, summary *ConversationSummary) {
+	t.Helper()
+	fill := func(tx *gorm.DB) {
+		switch dest := tx.Statement.Dest.(type) {
+		case *[]ConversationMessage:
+			for _, seq := range seqs {
+				*dest = append(*dest, ConversationMessage{
+					Seq:     seq,
+					Role:    string(schema.User),
+					Content: fmt.Sprintf("message %d", seq),
+				})
+			}
+		case *ConversationSummary:
+			if summary != nil {
+				*dest = *summary
+			}
+		}
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("test:fill", fill); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+}
+
+func TestSummarizeIfNeeded(t *testing.T) {
+	tests := []struct {
+		name    string
+		seqs    []int64
+		summary *ConversationSummary
+		// want are the sequence numbers of the messages summarized
+		want        []int64
+		wantLastSeq int64
+	}{
+		{
+			name: "first summary",
+			seqs: []int64{1, 2, 3, 4, 5},
+			want: []int64{1, 2, 3}, wantLastSeq: 3,
+		},
+		{
+			name:    "messages after the summary",
+			seqs:    []int64{1, 2, 3, 4, 5, 6, 7},
+			summary: &ConversationSummary{Content: "earlier", LastSeq: 3},
+			want:    []int64{4, 5}, wantLastSeq: 5,
+		},
+		{
+			name:    "messages removed before the summarized ones",
+			seqs:    []int64{3, 7, 8, 9, 10, 11},
+			summary: &ConversationSummary{Content: "earlier", LastSeq: 7},
+			want:    []int64{8, 9}, wantLastSeq: 9,
+		},
+		{
+			name:    "summary up to date",
+			seqs:    []int64{1, 2, 3, 4, 5},
+			summary: &ConversationSummary{Content: "earlier", LastSeq: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := dryRunDB(t)
+			storedSession(t, db, tt.seqs, tt.summary)
+			var saved *ConversationSummary
+			capture := func(tx *gorm.DB) { saved, _ = tx.Statement.Dest.(*ConversationSummary) }
+			if err := db.Callback().Create().After("gorm:create").Register("test:saved", capture); err != nil {
+				t.Fatalf("register callback: %v", err)
+			}
+
+			llm := &summaryModel{reply: "new summary"}
+			summarizer, err := NewSummarizer(context.Background(), &SummarizerConfig{Model: llm})
+			if err != nil {
+				t.Fatalf("NewSummarizer() error = %v", err)
+			}
+			m := NewManager(&ManagerConfig{
+				WindowSize:        2,
+				EnablePersistence: true,
+				DB:                db,
+				ProjectID:         uuid.New(),
+				Summarizer:        summarizer,
+			})
+
+			summarized, err := m.SummarizeIfNeeded(context.Background(), "session")
+			if err != nil {
+				t.Fatalf("SummarizeIfNeeded() error = %v", err)
+			}
+			if summarized != (len(tt.want) > 0) {
+				t.Fatalf("SummarizeIfNeeded() = %v, want %v", summarized, len(tt.want) > 0)
+			}
+			if !summarized {
+				if saved != nil {
+					t.Errorf("SummarizeIfNeeded() saved %+v, want nothing", saved)
+				}
+				return
+			}
+
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(llm.input), "\n") {
+				if strings.HasPrefix(line, "[user]") {
+					lines = append(lines, line)
+				}
+			}
+			if len(lines) != len(tt.want) {
+				t.Fatalf("summarized messages %q, want %v", lines, tt.want)
+			}
+			for i, seq := range tt.want {
+				if want := fmt.Sprintf("[user]: message %d", seq); lines[i] != want {
+					t.Errorf("summarized message %d = %q, want %q", i, lines[i], want)
+				}
+			}
+			if tt.summary != nil && !strings.Contains(llm.input, tt.summary.Content) {
+				t.Errorf("summarization input %q does not fold in the previous summary", llm.input)
+			}
+			if saved == nil || saved.Content != "new summary" || saved.LastSeq != tt.wantLastSeq {
+				t.Errorf("SummarizeIfNeeded() saved %+v, want the new summary up to %d", saved, tt.wantLastSeq)
+			}
+		})
+	}
+}
+
+func TestGetWindowedHistorySummaryIsSystemMessage(t *testing.T) {
+	db, _ := dryRunDB(t)
+	storedSession(t, db, nil, &ConversationSummary{Content: "earlier", LastSeq: 2})
+	m := NewManager(&ManagerConfig{
+		WindowSize:        2,
+		EnablePersistence: true,
+		DB:                db,
+		ProjectID:         uuid.New(),
+		Store:             NewInMemoryStore(),
+	})
+	ctx := context.Background()
+	for _, content := range []string{"one", "two", "three"} {
+		if err := m.AddUserMessage(ctx, "session", content); err != nil {
+			t.Fatalf("AddUserMessage() error = %v", err)
+		}
+	}
+
+	history, err := m.GetWindowedHistory(ctx, "session")
+	if err != nil {
+		t.Fatalf("GetWindowedHistory() error = %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("GetWindowedHistory() = %d messages, want the summary and 2 messages", len(history))
+	}
+	if history[0].Role != schema.System || !strings.Contains(history[0].Content, "earlier") {
+		t.Errorf("GetWindowedHistory() starts with %+v, want the summary as a system message", history[0])
+	}
+}
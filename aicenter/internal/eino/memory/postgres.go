@@ -12,9 +12,17 @@ import (
 	"gorm.io/gorm"
 )
 
+// Orders of the messages of a session. Messages appended together share
+// their creation time, their sequence number keeps them in order.
+const (
+	messagesOldestFirst = "created_at ASC, seq ASC"
+	messagesNewestFirst = "created_at DESC, seq DESC"
+)
+
 // ConversationMessage represents a stored message in the database
 type ConversationMessage struct {
 	ID        uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Seq       int64          `gorm:"autoIncrement;not null"`
 	SessionID string         `gorm:"size:255;index;not null"`
 	ProjectID uuid.UUID      `gorm:"type:uuid;index"`
 	UserID    string         `gorm:"size:255;index"`
@@ -29,6 +37,24 @@ func (ConversationMessage) TableName() string {
 	return "conversation_messages"
 }
 
+// toMessage restores the message, with its tool calls or the ID of the call
+// it answers so that calls and results stay paired
+func (m ConversationMessage) toMessage() *schema.Message {
+	msg := &schema.Message{
+		Role:    schema.RoleType(m.Role),
+		Content: m.Content,
+	}
+	if raw, ok := m.Metadata["tool_calls"].(string); ok {
+		if err := json.Unmarshal([]byte(raw), &msg.ToolCalls); err != nil {
+			msg.ToolCalls = nil
+		}
+	}
+	if id, ok := m.Metadata["tool_call_id"].(string); ok {
+		msg.ToolCallID = id
+	}
+	return msg
+}
+
 // JSONMap for JSONB storage
 type JSONMap map[string]interface{}
 
@@ -89,7 +115,7 @@ func (s *PostgresStore) Read(ctx context.Context, sessionID string) ([]*schema.M
 	var dbMsgs []ConversationMessage
 	err := s.db.WithContext(ctx).
 		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
-		Order("created_at ASC").
+		Order(messagesOldestFirst).
 		Find(&dbMsgs).Error
 	if err != nil {
 		return nil, err
@@ -97,15 +123,33 @@ func (s *PostgresStore) Read(ctx context.Context, sessionID string) ([]*schema.M
 
 	msgs := make([]*schema.Message, 0, len(dbMsgs))
 	for _, dbMsg := range dbMsgs {
-		msg := &schema.Message{
-			Role:    schema.RoleType(dbMsg.Role),
-			Content: dbMsg.Content,
-		}
-		msgs = append(msgs, msg)
+		msgs = append(msgs, dbMsg.toMessage())
 	}
 	return msgs, nil
 }
 
+// ReadSequenced returns the messages of a session, oldest first, and their
+// sequence numbers, which unlike their positions do not change when earlier
+// messages are removed
+func (s *PostgresStore) ReadSequenced(ctx context.Context, sessionID string) ([]*schema.Message, []int64, error) {
+	var dbMsgs []ConversationMessage
+	err := s.db.WithContext(ctx).
+		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
+		Order(messagesOldestFirst).
+		Find(&dbMsgs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs := make([]*schema.Message, 0, len(dbMsgs))
+	seqs := make([]int64, 0, len(dbMsgs))
+	for _, dbMsg := range dbMsgs {
+		msgs = append(msgs, dbMsg.toMessage())
+		seqs = append(seqs, dbMsg.Seq)
+	}
+	return msgs, seqs, nil
+}
+
 // Append adds messages to a session
 func (s *PostgresStore) Append(ctx context.Context, sessionID string, msgs ...*schema.Message) error {
 	if len(msgs) == 0 {
@@ -123,6 +167,9 @@ func (s *PostgresStore) Append(ctx context.Context, sessionID string, msgs ...*s
 			toolCallsJSON, _ := json.Marshal(msg.ToolCalls)
 			metadata["tool_calls"] = string(toolCallsJSON)
 		}
+		if msg.ToolCallID != "" {
+			metadata["tool_call_id"] = msg.ToolCallID
+		}
 
 		dbMsg := ConversationMessage{
 			ID:        uuid.New(),
@@ -150,7 +197,7 @@ func (s *PostgresStore) GetWindowedMessages(ctx context.Context, sessionID strin
 	var dbMsgs []ConversationMessage
 	err := s.db.WithContext(ctx).
 		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
-		Order("created_at DESC").
+		Order(messagesNewestFirst).
 		Limit(windowSize).
 		Find(&dbMsgs).Error
 	if err != nil {
@@ -160,10 +207,7 @@ func (s *PostgresStore) GetWindowedMessages(ctx context.Context, sessionID strin
 	// Reverse to get chronological order
 	msgs := make([]*schema.Message, len(dbMsgs))
 	for i, dbMsg := range dbMsgs {
-		msgs[len(dbMsgs)-1-i] = &schema.Message{
-			Role:    schema.RoleType(dbMsg.Role),
-			Content: dbMsg.Content,
-		}
+		msgs[len(dbMsgs)-1-i] = dbMsg.toMessage()
 	}
 	return msgs, nil
 }
@@ -188,3 +232,120 @@ func (s *PostgresStore) ListSessions(ctx context.Context) ([]string, error) {
 		Pluck("session_id", &sessions).Error
 	return sessions, err
 }
+
+// SessionInfo describes a stored session
+type SessionInfo struct {
+	SessionID      string    `json:"session_id"`
+	MessageCount   int64     `json:"message_count"`
+	FirstMessageAt time.Time `json:"first_message_at"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+}
+
+// ListSessionInfos returns a page of the sessions of the project, most
+// recently active first, and their total
+func (s *PostgresStore) ListSessionInfos(ctx context.Context, limit, offset int) ([]SessionInfo, int64, error) {
+	var total int64
+	err := s.db.WithContext(ctx).
+		Model(&ConversationMessage{}).
+		Where("project_id = ?", s.projectID).
+		Distinct("session_id").
+		Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var infos []SessionInfo
+	err = s.db.WithContext(ctx).
+		Model(&ConversationMessage{}).
+		Select("session_id, COUNT(*) AS message_count, MIN(created_at) AS first_message_at, MAX(created_at) AS last_activity_at").
+		Where("project_id = ?", s.projectID).
+		Group("session_id").
+		Order("last_activity_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&infos).Error
+	return infos, total, err
+}
+
+// GetSessionInfo returns the description of a session, nil if it has no
+// messages
+func (s *PostgresStore) GetSessionInfo(ctx context.Context, sessionID string) (*SessionInfo, error) {
+	var infos []SessionInfo
+	err := s.db.WithContext(ctx).
+		Model(&ConversationMessage{}).
+		Select("session_id, COUNT(*) AS message_count, MIN(created_at) AS first_message_at, MAX(created_at) AS last_activity_at").
+		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
+		Group("session_id").
+		Scan(&infos).Error
+	if err != nil || len(infos) == 0 {
+		return nil, err
+	}
+	return &infos[0], nil
+}
+
+// StoredMessage is a message of a session as stored, for inspection and export
+type StoredMessage struct {
+	ID         uuid.UUID         `json:"id"`
+	Seq        int64             `json:"seq"`
+	Role       schema.RoleType   `json:"role"`
+	Content    string            `json:"content"`
+	ToolCalls  []schema.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string            `json:"tool_call_id,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// ReadStored returns the messages of a session as stored, oldest first
+func (s *PostgresStore) ReadStored(ctx context.Context, sessionID string) ([]StoredMessage, error) {
+	var dbMsgs []ConversationMessage
+	err := s.db.WithContext(ctx).
+		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
+		Order(messagesOldestFirst).
+		Find(&dbMsgs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]StoredMessage, 0, len(dbMsgs))
+	for _, dbMsg := range dbMsgs {
+		msg := dbMsg.toMessage()
+		msgs = append(msgs, StoredMessage{
+			ID:         dbMsg.ID,
+			Seq:        dbMsg.Seq,
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+			CreatedAt:  dbMsg.CreatedAt,
+		})
+	}
+	return msgs, nil
+}
+
+// Erase permanently removes a session's messages, including the ones Delete
+// only marked as deleted
+func (s *PostgresStore) Erase(ctx context.Context, sessionID string) (int64, error) {
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
+		Delete(&ConversationMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// Truncate permanently removes the messages of a session after the first
+// keep ones and returns how many were removed
+func (s *PostgresStore) Truncate(ctx context.Context, sessionID string, keep int) (int64, error) {
+	var ids []uuid.UUID
+	err := s.db.WithContext(ctx).
+		Model(&ConversationMessage{}).
+		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
+		Order(messagesOldestFirst).
+		Offset(keep).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("id IN ?", ids).
+		Delete(&ConversationMessage{})
+	return result.RowsAffected, result.Error
+}
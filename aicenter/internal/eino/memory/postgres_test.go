@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB returns a PostgreSQL session that builds statements without
+// running them, and the SQL of the statements it built
+func dryRunDB(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open dry run db: %v", err)
+	}
+	var statements []string
+	capture := func(tx *gorm.DB) { statements = append(statements, tx.Statement.SQL.String()) }
+	if err := db.Callback().Query().After("gorm:query").Register("test:capture", capture); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	return db, &statements
+}
+
+func TestPostgresStoreMessageOrder(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		run  func(s *PostgresStore) error
+		want string
+	}{
+		{
+			name: "Read",
+			run:  func(s *PostgresStore) error { _, err := s.Read(ctx, "session"); return err },
+			want: "ORDER BY created_at ASC, seq ASC",
+		},
+		{
+			name: "ReadSequenced",
+			run:  func(s *PostgresStore) error { _, _, err := s.ReadSequenced(ctx, "session"); return err },
+			want: "ORDER BY created_at ASC, seq ASC",
+		},
+		{
+			name: "ReadStored",
+			run:  func(s *PostgresStore) error { _, err := s.ReadStored(ctx, "session"); return err },
+			want: "ORDER BY created_at ASC, seq ASC",
+		},
+		{
+			name: "Truncate",
+			run:  func(s *PostgresStore) error { _, err := s.Truncate(ctx, "session", 2); return err },
+			want: "ORDER BY created_at ASC, seq ASC",
+		},
+		{
+			name: "GetWindowedMessages",
+			run:  func(s *PostgresStore) error { _, err := s.GetWindowedMessages(ctx, "session", 10); return err },
+			want: "ORDER BY created_at DESC, seq DESC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := dryRunDB(t)
+			if err := tt.run(NewPostgresStore(db, uuid.New())); err != nil {
+				t.Fatalf("%s() error = %v", tt.name, err)
+			}
+			if len(*statements) == 0 {
+				t.Fatalf("%s() ran no query", tt.name)
+			}
+			if sql := (*statements)[0]; !strings.Contains(sql, tt.want) {
+				t.Errorf("%s() query = %s, want it to contain %q", tt.name, sql, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresStoreAppendLeavesSeqToDatabase(t *testing.T) {
+	db, _ := dryRunDB(t)
+	var stmt *gorm.Statement
+	if err := db.Callback().Create().After("gorm:create").Register("test:capture_create", func(tx *gorm.DB) {
+		stmt = tx.Statement
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	msgs := []*schema.Message{schema.UserMessage("hi"), schema.AssistantMessage("hello", nil)}
+	if err := NewPostgresStore(db, uuid.New()).Append(context.Background(), "session", msgs...); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	values, ok := stmt.Clauses["VALUES"].Expression.(clause.Values)
+	if !ok {
+		t.Fatalf("Append() built no INSERT: %s", stmt.SQL.String())
+	}
+	for _, column := range values.Columns {
+		if column.Name == "seq" {
+			t.Fatalf("Append() sets seq, it must come from the sequence: %s", stmt.SQL.String())
+		}
+	}
+	if len(values.Values) != len(msgs) {
+		t.Errorf("Append() inserts %d rows, want %d in one statement", len(values.Values), len(msgs))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -12,6 +13,9 @@ import (
 type RedisStore struct {
 	cli *redis.Client
 	ttl time.Duration // 0 means no expiration
+	// projectID scopes the session keys, session IDs are only unique within
+	// a project
+	projectID uuid.UUID
 }
 
 // RedisStoreConfig configures the Redis store
@@ -55,8 +59,14 @@ func NewRedisStoreFromURL(redisURL string, ttl time.Duration) (*RedisStore, erro
 	}), nil
 }
 
+// ForProject returns the store of the sessions of a project, sharing the
+// client
+func (s *RedisStore) ForProject(projectID uuid.UUID) *RedisStore {
+	return &RedisStore{cli: s.cli, ttl: s.ttl, projectID: projectID}
+}
+
 func (s *RedisStore) sessionKey(sessionID string) string {
-	return "memory:session:" + sessionID
+	return "memory:session:" + s.projectID.String() + ":" + sessionID
 }
 
 // Write stores messages for a session (replaces existing)
@@ -114,6 +124,11 @@ func (s *RedisStore) GetTTL(ctx context.Context, sessionID string) (time.Duratio
 	return s.cli.TTL(ctx, s.sessionKey(sessionID)).Result()
 }
 
+// Client returns the underlying Redis client, shared by other Redis users
+func (s *RedisStore) Client() *redis.Client {
+	return s.cli
+}
+
 // Close closes the Redis client connection
 func (s *RedisStore) Close() error {
 	return s.cli.Close()
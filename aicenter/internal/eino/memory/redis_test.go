@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRedisStoreSessionKeyScopedByProject(t *testing.T) {
+	store := NewRedisStore(&RedisStoreConfig{})
+	projectA, projectB := uuid.New(), uuid.New()
+
+	keyA := store.ForProject(projectA).sessionKey("session-1")
+	keyB := store.ForProject(projectB).sessionKey("session-1")
+	if keyA == keyB {
+		t.Fatalf("projects share the cache key %q of a session ID", keyA)
+	}
+	if want := "memory:session:" + projectA.String() + ":session-1"; keyA != want {
+		t.Errorf("sessionKey() = %q, want %q", keyA, want)
+	}
+	if got := store.ForProject(projectA).sessionKey("session-1"); got != keyA {
+		t.Errorf("sessionKey() = %q for the same project, want %q", got, keyA)
+	}
+}
@@ -144,18 +144,47 @@ func (s *Summarizer) Summarize(ctx context.Context, msgs []*schema.Message) ([]*
 	result := make([]*schema.Message, 0, len(systemMsgs)+1+len(recentMsgs))
 	result = append(result, systemMsgs...)
 
-	// Add summary as a special assistant message
-	summaryContent := fmt.Sprintf("[对话摘要]\n%s", summaryMsg.Content)
-	result = append(result, &schema.Message{
-		Role:    schema.Assistant,
-		Content: summaryContent,
-	})
+	// Add summary as a special system message
+	result = append(result, SummaryMessage(summaryMsg.Content))
 
 	result = append(result, recentMsgs...)
 
 	return result, nil
 }
 
+// SummarizeRolling folds messages into the previous summary of the
+// conversation, which may be empty, and returns the new summary
+func (s *Summarizer) SummarizeRolling(ctx context.Context, previous string, msgs []*schema.Message) (string, error) {
+	var sb strings.Builder
+	if previous != "" {
+		sb.WriteString(fmt.Sprintf("[之前的对话摘要]: %s\n", previous))
+	}
+	for _, m := range msgs {
+		if m == nil || m.Role == schema.System {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("[%s]: %s\n", m.Role, m.Content))
+	}
+
+	summaryMsg, err := s.chain.Invoke(ctx, map[string]any{
+		"conversation": sb.String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("summarization failed: %w", err)
+	}
+	return summaryMsg.Content, nil
+}
+
+// SummaryMessage is the message standing for the summarized part of a
+// conversation in its history. It is a system message so that the model
+// does not take it for something it said.
+func SummaryMessage(summary string) *schema.Message {
+	return &schema.Message{
+		Role:    schema.System,
+		Content: fmt.Sprintf("[对话摘要]\n%s", summary),
+	}
+}
+
 // SummarizeIfNeeded checks and summarizes if threshold is exceeded
 func (s *Summarizer) SummarizeIfNeeded(ctx context.Context, msgs []*schema.Message) ([]*schema.Message, bool, error) {
 	if !s.ShouldSummarize(msgs) {
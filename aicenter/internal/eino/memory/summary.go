@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationSummary is the rolling summary of the older messages of a session
+type ConversationSummary struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	SessionID string    `gorm:"size:255;not null;uniqueIndex:idx_conversation_summaries_session"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_conversation_summaries_session"`
+	Content   string    `gorm:"type:text"`
+	// LastSeq is the sequence number of the last message covered, the
+	// summary covers the messages up to it
+	LastSeq   int64     `gorm:"not null;default:0"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (ConversationSummary) TableName() string {
+	return "conversation_summaries"
+}
+
+// SummaryStore persists the summaries of the sessions to PostgreSQL
+type SummaryStore struct {
+	db        *gorm.DB
+	projectID uuid.UUID
+}
+
+// NewSummaryStore creates a PostgreSQL-backed summary store
+func NewSummaryStore(db *gorm.DB, projectID uuid.UUID) *SummaryStore {
+	return &SummaryStore{
+		db:        db,
+		projectID: projectID,
+	}
+}
+
+// Get returns the summary of a session, nil if it has none
+func (s *SummaryStore) Get(ctx context.Context, sessionID string) (*ConversationSummary, error) {
+	var summary ConversationSummary
+	err := s.db.WithContext(ctx).
+		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
+		First(&summary).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// Save stores the summary of a session covering its messages up to lastSeq.
+// A summary covering fewer messages than the stored one, e.g. from a
+// concurrent replica, is ignored.
+func (s *SummaryStore) Save(ctx context.Context, sessionID, content string, lastSeq int64) error {
+	summary := &ConversationSummary{
+		ID:        uuid.New(),
+		SessionID: sessionID,
+		ProjectID: s.projectID,
+		Content:   content,
+		LastSeq:   lastSeq,
+	}
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "session_id"}, {Name: "project_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"content", "last_seq", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "conversation_summaries.last_seq < excluded.last_seq"},
+			}},
+		}).
+		Create(summary).Error
+}
+
+// Delete removes the summary of a session
+func (s *SummaryStore) Delete(ctx context.Context, sessionID string) error {
+	return s.db.WithContext(ctx).
+		Where("session_id = ? AND project_id = ?", sessionID, s.projectID).
+		Delete(&ConversationSummary{}).Error
+}
@@ -0,0 +1,370 @@
+package memory
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Categories of visitor facts
+const (
+	FactCategoryFact       = "fact"       // e.g. "has order #123"
+	FactCategoryPreference = "preference" // e.g. "prefers English"
+	FactCategoryStatus     = "status"     // e.g. "VIP"
+)
+
+// Sources of visitor facts
+const (
+	FactSourceExtraction = "extraction" // extracted from a session once it ended
+	FactSourceTool       = "tool"       // remembered by an agent during a run
+)
+
+// VisitorFact is a fact or preference about a visitor, remembered across
+// sessions
+type VisitorFact struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index:idx_visitor_facts_visitor" json:"project_id"`
+	VisitorID uuid.UUID `gorm:"type:uuid;not null;index:idx_visitor_facts_visitor" json:"visitor_id"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	Category  string    `gorm:"size:50" json:"category"`
+	Source    string    `gorm:"size:50" json:"source"`
+	// SessionID is the session the fact was learned in
+	SessionID string `gorm:"size:255" json:"session_id,omitempty"`
+	// Embedding of the content, for semantic recall
+	Embedding Vector    `gorm:"type:jsonb" json:"-"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (VisitorFact) TableName() string {
+	return "visitor_facts"
+}
+
+// VisitorExtraction is how far the facts of a session were extracted
+type VisitorExtraction struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	SessionID string    `gorm:"size:255;not null;uniqueIndex:idx_visitor_extractions_session"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_visitor_extractions_session"`
+	VisitorID uuid.UUID `gorm:"type:uuid;index"`
+	// MessageCount is the number of leading messages of the session extracted
+	MessageCount int       `gorm:"not null;default:0"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (VisitorExtraction) TableName() string {
+	return "visitor_extractions"
+}
+
+// Vector for JSONB storage of embeddings
+type Vector []float64
+
+// Value implements driver.Valuer for GORM
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// Scan implements sql.Scanner for GORM
+func (v *Vector) Scan(value interface{}) error {
+	if value == nil {
+		*v = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch val := value.(type) {
+	case []byte:
+		bytes = val
+	case string:
+		bytes = []byte(val)
+	default:
+		return fmt.Errorf("unsupported type: %T", value)
+	}
+
+	return json.Unmarshal(bytes, v)
+}
+
+// VisitorMemory is the long-term memory of the visitors of a project
+type VisitorMemory struct {
+	db        *gorm.DB
+	projectID uuid.UUID
+	embedder  embedding.Embedder
+}
+
+// NewVisitorMemory creates the visitor memory of a project
+func NewVisitorMemory(db *gorm.DB, projectID uuid.UUID) *VisitorMemory {
+	return &VisitorMemory{
+		db:        db,
+		projectID: projectID,
+	}
+}
+
+// SetEmbedder enables semantic recall of the facts
+func (m *VisitorMemory) SetEmbedder(embedder embedding.Embedder) {
+	m.embedder = embedder
+}
+
+// All returns the facts about a visitor, newest first
+func (m *VisitorMemory) All(ctx context.Context, visitorID uuid.UUID) ([]VisitorFact, error) {
+	var facts []VisitorFact
+	err := m.db.WithContext(ctx).
+		Where("project_id = ? AND visitor_id = ?", m.projectID, visitorID).
+		Order("created_at DESC").
+		Find(&facts).Error
+	return facts, err
+}
+
+// List returns a page of the facts about a visitor, newest first, and their total
+func (m *VisitorMemory) List(ctx context.Context, visitorID uuid.UUID, limit, offset int) ([]VisitorFact, int64, error) {
+	var facts []VisitorFact
+	var total int64
+
+	query := m.db.WithContext(ctx).Model(&VisitorFact{}).
+		Where("project_id = ? AND visitor_id = ?", m.projectID, visitorID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&facts).Error; err != nil {
+		return nil, 0, err
+	}
+	return facts, total, nil
+}
+
+// Get returns a fact about a visitor
+func (m *VisitorMemory) Get(ctx context.Context, visitorID, factID uuid.UUID) (*VisitorFact, error) {
+	var fact VisitorFact
+	err := m.db.WithContext(ctx).
+		Where("id = ? AND project_id = ? AND visitor_id = ?", factID, m.projectID, visitorID).
+		First(&fact).Error
+	if err != nil {
+		return nil, err
+	}
+	return &fact, nil
+}
+
+// Remember stores the facts about a visitor it does not know yet and returns
+// them
+func (m *VisitorMemory) Remember(ctx context.Context, visitorID uuid.UUID, sessionID, source string, facts []ExtractedFact) ([]VisitorFact, error) {
+	known, err := m.All(ctx, visitorID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(known)+len(facts))
+	for _, f := range known {
+		seen[normalizeFact(f.Content)] = true
+	}
+
+	var added []VisitorFact
+	for _, f := range facts {
+		content := strings.TrimSpace(f.Content)
+		if content == "" || seen[normalizeFact(content)] {
+			continue
+		}
+		seen[normalizeFact(content)] = true
+		added = append(added, VisitorFact{
+			ID:        uuid.New(),
+			ProjectID: m.projectID,
+			VisitorID: visitorID,
+			Content:   content,
+			Category:  factCategory(f.Category),
+			Source:    source,
+			SessionID: sessionID,
+		})
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	if m.embedder != nil {
+		texts := make([]string, len(added))
+		for i := range added {
+			texts[i] = added[i].Content
+		}
+		if vectors, err := m.embedder.EmbedStrings(ctx, texts); err != nil {
+			log.Printf("[VisitorMemory] Failed to embed facts of visitor %s: %v", visitorID, err)
+		} else if len(vectors) == len(added) {
+			for i := range added {
+				added[i].Embedding = vectors[i]
+			}
+		}
+	}
+
+	if err := m.db.WithContext(ctx).Create(&added).Error; err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// Recall returns at most limit facts about a visitor: all of them when they
+// fit, or else the ones closest to the query, newest first without embedding
+func (m *VisitorMemory) Recall(ctx context.Context, visitorID uuid.UUID, query string, limit int) ([]VisitorFact, error) {
+	facts, err := m.All(ctx, visitorID)
+	if err != nil || len(facts) <= limit {
+		return facts, err
+	}
+	if m.embedder == nil || strings.TrimSpace(query) == "" {
+		return facts[:limit], nil
+	}
+
+	vectors, err := m.embedder.EmbedStrings(ctx, []string{query})
+	if err != nil || len(vectors) != 1 {
+		log.Printf("[VisitorMemory] Failed to embed query, recalling the newest facts: %v", err)
+		return facts[:limit], nil
+	}
+	scores := make(map[uuid.UUID]float64, len(facts))
+	for _, f := range facts {
+		scores[f.ID] = cosine(vectors[0], f.Embedding)
+	}
+	sort.SliceStable(facts, func(i, j int) bool {
+		return scores[facts[i].ID] > scores[facts[j].ID]
+	})
+	return facts[:limit], nil
+}
+
+// Delete forgets a fact about a visitor
+func (m *VisitorMemory) Delete(ctx context.Context, visitorID, factID uuid.UUID) error {
+	return m.db.WithContext(ctx).
+		Where("id = ? AND project_id = ? AND visitor_id = ?", factID, m.projectID, visitorID).
+		Delete(&VisitorFact{}).Error
+}
+
+// DeleteAll forgets every fact about a visitor and returns how many there were
+func (m *VisitorMemory) DeleteAll(ctx context.Context, visitorID uuid.UUID) (int64, error) {
+	result := m.db.WithContext(ctx).
+		Where("project_id = ? AND visitor_id = ?", m.projectID, visitorID).
+		Delete(&VisitorFact{})
+	return result.RowsAffected, result.Error
+}
+
+// ExtractedCount returns how many leading messages of the session were
+// extracted
+func (m *VisitorMemory) ExtractedCount(ctx context.Context, sessionID string) (int, error) {
+	var extraction VisitorExtraction
+	err := m.db.WithContext(ctx).
+		Where("session_id = ? AND project_id = ?", sessionID, m.projectID).
+		First(&extraction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return extraction.MessageCount, nil
+}
+
+// SetExtractedCount records that the leading messageCount messages of the
+// session were extracted
+func (m *VisitorMemory) SetExtractedCount(ctx context.Context, visitorID uuid.UUID, sessionID string, messageCount int) error {
+	extraction := &VisitorExtraction{
+		ID:           uuid.New(),
+		SessionID:    sessionID,
+		ProjectID:    m.projectID,
+		VisitorID:    visitorID,
+		MessageCount: messageCount,
+	}
+	return m.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "session_id"}, {Name: "project_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"visitor_id", "message_count", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "visitor_extractions.message_count < excluded.message_count"},
+			}},
+		}).
+		Create(extraction).Error
+}
+
+// RewindExtraction records that at most the leading messageCount messages of
+// the session were extracted, after the others were removed
+func (m *VisitorMemory) RewindExtraction(ctx context.Context, sessionID string, messageCount int) error {
+	return m.db.WithContext(ctx).
+		Model(&VisitorExtraction{}).
+		Where("session_id = ? AND project_id = ? AND message_count > ?", sessionID, m.projectID, messageCount).
+		Update("message_count", messageCount).Error
+}
+
+// DeleteExtraction forgets how far the facts of a session were extracted
+func (m *VisitorMemory) DeleteExtraction(ctx context.Context, sessionID string) error {
+	return m.db.WithContext(ctx).
+		Where("session_id = ? AND project_id = ?", sessionID, m.projectID).
+		Delete(&VisitorExtraction{}).Error
+}
+
+// Sessions returns the sessions the facts of a visitor were learned in or
+// extracted from
+func (m *VisitorMemory) Sessions(ctx context.Context, visitorID uuid.UUID) ([]string, error) {
+	var extracted, learned []string
+	err := m.db.WithContext(ctx).
+		Model(&VisitorExtraction{}).
+		Where("project_id = ? AND visitor_id = ?", m.projectID, visitorID).
+		Distinct("session_id").
+		Pluck("session_id", &extracted).Error
+	if err != nil {
+		return nil, err
+	}
+	err = m.db.WithContext(ctx).
+		Model(&VisitorFact{}).
+		Where("project_id = ? AND visitor_id = ? AND session_id <> ''", m.projectID, visitorID).
+		Distinct("session_id").
+		Pluck("session_id", &learned).Error
+	if err != nil {
+		return nil, err
+	}
+	return append(extracted, learned...), nil
+}
+
+// VisitorFactsInstruction lists the facts for the instruction of an agent
+func VisitorFactsInstruction(facts []VisitorFact) string {
+	if len(facts) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("What you know about this visitor from previous conversations, use it to personalize your answers:")
+	for _, f := range facts {
+		sb.WriteString(fmt.Sprintf("\n- [%s] %s", f.Category, f.Content))
+	}
+	return sb.String()
+}
+
+func normalizeFact(content string) string {
+	return strings.ToLower(strings.Join(strings.Fields(content), " "))
+}
+
+func factCategory(category string) string {
+	switch c := strings.ToLower(strings.TrimSpace(category)); c {
+	case FactCategoryPreference, FactCategoryStatus:
+		return c
+	default:
+		return FactCategoryFact
+	}
+}
+
+// cosine is the cosine similarity of two vectors, 0 when either is missing
+func cosine(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,279 @@
+package orchestration
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// StepStatus 步骤执行状态
+type StepStatus string
+
+const (
+	StepCompleted StepStatus = "completed" // 执行成功
+	StepFailed    StepStatus = "failed"    // 执行失败
+)
+
+// StepResult 单个步骤（子问题）的执行结果
+type StepResult struct {
+	ID        string     `json:"id"`                   // 子问题 ID
+	Question  string     `json:"question"`             // 实际执行的问题
+	AgentID   string     `json:"agent_id"`             // 执行的 Agent ID
+	Stage     int        `json:"stage"`                // 所在分组（从 1 开始），同组步骤并行执行
+	DependsOn []string   `json:"depends_on,omitempty"` // 输出被注入本步骤的前置步骤
+	Status    StepStatus `json:"status"`               // 执行状态
+	Content   string     `json:"content,omitempty"`    // 执行结果
+	Error     string     `json:"error,omitempty"`      // 失败原因
+}
+
+// DAGResult DAG 执行结果
+type DAGResult struct {
+	Content  string       `json:"content"`  // 聚合后的最终回答
+	Workflow WorkflowType `json:"workflow"` // 工作流类型
+	Steps    []StepResult `json:"steps"`    // 各步骤结果
+}
+
+// StepRunner 使用指定 Agent 回答一个问题
+type StepRunner func(ctx context.Context, agentID, question string) (string, error)
+
+// DAGExecutor 按 QueryAnalyzer 给出的依赖分组执行子问题：
+// 同一分组内的子问题并行执行，后续分组的子问题会带上其依赖分组的输出，
+// 最后由 ResultConsolidator 聚合所有结果
+type DAGExecutor struct {
+	run          StepRunner
+	consolidator *ResultConsolidator
+}
+
+// NewDAGExecutor 创建 DAG 执行器
+func NewDAGExecutor(run StepRunner, consolidator *ResultConsolidator) *DAGExecutor {
+	return &DAGExecutor{
+		run:          run,
+		consolidator: consolidator,
+	}
+}
+
+// Execute 执行分析结果中的子问题并聚合结果
+func (e *DAGExecutor) Execute(ctx context.Context, analysis *QueryAnalysisResult, query string) (*DAGResult, error) {
+	stages, err := BuildStages(analysis, query)
+	if err != nil {
+		return nil, fmt.Errorf("build stages: %w", err)
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no steps to execute")
+	}
+	log.Printf("[DAGExecutor] Executing %s workflow in %d stages", analysis.Workflow, len(stages))
+
+	var steps []StepResult
+	execResult := &ExecutionResult{Workflow: analysis.Workflow, IsSuccess: true}
+	for i, stage := range stages {
+		if err := ctx.Err(); err != nil {
+			return nil, context.Cause(ctx)
+		}
+
+		// 后续分组依赖之前的分组：流水线只接收上一组的输出，分层执行接收之前所有分组的输出
+		deps := steps
+		if analysis.Workflow == WorkflowPipeline && i > 0 {
+			deps = steps[len(steps)-len(stages[i-1]):]
+		}
+
+		results := make([]StepResult, len(stage))
+		var wg sync.WaitGroup
+		for j, sq := range stage {
+			wg.Add(1)
+			go func(j int, sq SubQuestion) {
+				defer wg.Done()
+				results[j] = e.runStep(ctx, sq, i+1, deps)
+			}(j, sq)
+		}
+		wg.Wait()
+
+		for j, r := range results {
+			steps = append(steps, r)
+			sq := stage[j]
+			agentResult := AgentResult{AgentID: r.AgentID, Content: r.Content, SubQuestion: &sq}
+			if r.Status == StepFailed {
+				agentResult.Error = fmt.Errorf("%s", r.Error)
+				execResult.IsSuccess = false
+			}
+			execResult.Results = append(execResult.Results, agentResult)
+		}
+	}
+
+	if !anySucceeded(steps) {
+		return nil, fmt.Errorf("all %d steps failed: %s", len(steps), steps[0].Error)
+	}
+
+	content, err := e.consolidator.Consolidate(ctx, execResult, query)
+	if err != nil {
+		return nil, fmt.Errorf("consolidate results: %w", err)
+	}
+	return &DAGResult{Content: content, Workflow: analysis.Workflow, Steps: steps}, nil
+}
+
+// runStep 执行一个子问题，依赖步骤的输出作为上下文附在问题之后
+func (e *DAGExecutor) runStep(ctx context.Context, sq SubQuestion, stage int, deps []StepResult) StepResult {
+	question := withDependencies(sq.Question, deps)
+	result := StepResult{
+		ID:       sq.ID,
+		Question: question,
+		AgentID:  sq.AssignedAgentID,
+		Stage:    stage,
+	}
+	for _, d := range deps {
+		result.DependsOn = append(result.DependsOn, d.ID)
+	}
+
+	content, err := e.run(ctx, sq.AssignedAgentID, question)
+	if err != nil {
+		log.Printf("[DAGExecutor] Step %s failed: %v", sq.ID, err)
+		result.Status = StepFailed
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = StepCompleted
+	result.Content = content
+	return result
+}
+
+// withDependencies 将前置步骤的结果附加到问题中
+func withDependencies(question string, deps []StepResult) string {
+	if len(deps) == 0 {
+		return question
+	}
+	var sb strings.Builder
+	sb.WriteString(question)
+	sb.WriteString("\n\n## 前置步骤的结果\n")
+	for _, d := range deps {
+		if d.Status == StepFailed {
+			sb.WriteString(fmt.Sprintf("### %s (执行失败)\n错误: %s\n\n", d.ID, d.Error))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("### %s\n%s\n\n", d.ID, d.Content))
+	}
+	return sb.String()
+}
+
+func anySucceeded(steps []StepResult) bool {
+	for _, s := range steps {
+		if s.Status == StepCompleted {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildStages 根据分析结果构建执行分组。优先使用 ExecutionPlan.Dependencies，
+// 其次 ParallelGroups；没有执行计划时，并行工作流所有子问题同组，
+// 其他工作流每个子问题单独一组按顺序执行。未出现在计划中的子问题放在第一组。
+// 没有子问题时，每个选中的 Agent 回答原始问题。
+// 子问题 ID 重复，或同一子问题在计划中出现多次（依赖关系自相矛盾）时返回错误。
+func BuildStages(analysis *QueryAnalysisResult, query string) ([][]SubQuestion, error) {
+	questions := analysis.SubQuestions
+	if len(questions) == 0 {
+		for i, id := range analysis.SelectedAgentIDs {
+			questions = append(questions, SubQuestion{
+				ID:              fmt.Sprintf("sq-%d", i+1),
+				Question:        query,
+				AssignedAgentID: id,
+			})
+		}
+	}
+	questions = assignAgents(questions, analysis.SelectedAgentIDs)
+	if len(questions) == 0 {
+		return nil, nil
+	}
+
+	byID := make(map[string]SubQuestion, len(questions))
+	for _, q := range questions {
+		if _, ok := byID[q.ID]; ok {
+			return nil, fmt.Errorf("duplicate sub-question ID %q", q.ID)
+		}
+		byID[q.ID] = q
+	}
+
+	var groups [][]string
+	if plan := analysis.ExecutionPlan; plan != nil {
+		groups = plan.Dependencies
+		if len(groups) == 0 {
+			groups = plan.ParallelGroups
+		}
+	}
+	if len(groups) == 0 {
+		if analysis.Workflow == WorkflowParallel {
+			return [][]SubQuestion{questions}, nil
+		}
+		stages := make([][]SubQuestion, 0, len(questions))
+		for _, q := range questions {
+			stages = append(stages, []SubQuestion{q})
+		}
+		return stages, nil
+	}
+
+	placed := make(map[string]bool, len(questions))
+	var stages [][]SubQuestion
+	for _, group := range groups {
+		var stage []SubQuestion
+		for _, id := range group {
+			q, ok := byID[id]
+			if !ok {
+				continue
+			}
+			// 出现在多个分组中的子问题既依赖又被依赖于其他分组，无法排序
+			if placed[id] {
+				return nil, fmt.Errorf("sub-question %q appears more than once in the execution plan", id)
+			}
+			placed[id] = true
+			stage = append(stage, q)
+		}
+		if len(stage) > 0 {
+			stages = append(stages, stage)
+		}
+	}
+
+	var unplaced []SubQuestion
+	for _, q := range questions {
+		if !placed[q.ID] {
+			unplaced = append(unplaced, q)
+		}
+	}
+	if len(unplaced) > 0 {
+		if len(stages) == 0 {
+			return [][]SubQuestion{unplaced}, nil
+		}
+		stages[0] = append(unplaced, stages[0]...)
+	}
+	return stages, nil
+}
+
+// assignAgents 为未分配 Agent 或分配了未选中 Agent 的子问题分配第一个选中的 Agent，
+// 并为缺少 ID 的子问题生成不与已有 ID 冲突的 ID
+func assignAgents(questions []SubQuestion, selected []string) []SubQuestion {
+	allowed := make(map[string]bool, len(selected))
+	for _, id := range selected {
+		allowed[id] = true
+	}
+	taken := make(map[string]bool, len(questions))
+	for _, q := range questions {
+		taken[q.ID] = true
+	}
+	out := make([]SubQuestion, 0, len(questions))
+	for i, q := range questions {
+		if q.ID == "" {
+			q.ID = fmt.Sprintf("sq-%d", i+1)
+			for n := len(questions) + 1; taken[q.ID]; n++ {
+				q.ID = fmt.Sprintf("sq-%d", n)
+			}
+			taken[q.ID] = true
+		}
+		if !allowed[q.AssignedAgentID] {
+			if len(selected) == 0 {
+				continue
+			}
+			q.AssignedAgentID = selected[0]
+		}
+		out = append(out, q)
+	}
+	return out
+}
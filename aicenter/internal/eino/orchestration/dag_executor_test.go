@@ -0,0 +1,192 @@
+package orchestration
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stageIDs lists the sub-question IDs of each stage, with the agent they are
+// assigned to as "id@agent"
+func stageIDs(stages [][]SubQuestion) [][]string {
+	out := make([][]string, 0, len(stages))
+	for _, stage := range stages {
+		ids := make([]string, 0, len(stage))
+		for _, q := range stage {
+			ids = append(ids, q.ID+"@"+q.AssignedAgentID)
+		}
+		out = append(out, ids)
+	}
+	return out
+}
+
+func TestBuildStages(t *testing.T) {
+	questions := []SubQuestion{
+		{ID: "a", AssignedAgentID: "x"},
+		{ID: "b", AssignedAgentID: "y"},
+		{ID: "c", AssignedAgentID: "x"},
+	}
+
+	tests := []struct {
+		name     string
+		analysis *QueryAnalysisResult
+		want     [][]string
+		wantErr  string
+	}{
+		{
+			name:     "no sub-questions",
+			analysis: &QueryAnalysisResult{SelectedAgentIDs: []string{"x", "y"}, Workflow: WorkflowParallel},
+			want:     [][]string{{"sq-1@x", "sq-2@y"}},
+		},
+		{
+			name:     "nothing to run",
+			analysis: &QueryAnalysisResult{Workflow: WorkflowParallel},
+			want:     [][]string{},
+		},
+		{
+			name:     "parallel without plan",
+			analysis: &QueryAnalysisResult{SelectedAgentIDs: []string{"x", "y"}, Workflow: WorkflowParallel, SubQuestions: questions},
+			want:     [][]string{{"a@x", "b@y", "c@x"}},
+		},
+		{
+			name:     "sequential without plan",
+			analysis: &QueryAnalysisResult{SelectedAgentIDs: []string{"x", "y"}, Workflow: WorkflowSequential, SubQuestions: questions},
+			want:     [][]string{{"a@x"}, {"b@y"}, {"c@x"}},
+		},
+		{
+			name: "dependencies",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"x", "y"},
+				Workflow:         WorkflowHierarchical,
+				SubQuestions:     questions,
+				ExecutionPlan:    &ExecutionPlan{Dependencies: [][]string{{"a", "b"}, {"c"}}},
+			},
+			want: [][]string{{"a@x", "b@y"}, {"c@x"}},
+		},
+		{
+			name: "parallel groups when no dependencies",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"x", "y"},
+				Workflow:         WorkflowPipeline,
+				SubQuestions:     questions,
+				ExecutionPlan:    &ExecutionPlan{ParallelGroups: [][]string{{"c"}, {"a", "b"}}},
+			},
+			want: [][]string{{"c@x"}, {"a@x", "b@y"}},
+		},
+		{
+			name: "unplanned sub-questions run first, unknown IDs are ignored",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"x", "y"},
+				Workflow:         WorkflowHierarchical,
+				SubQuestions:     questions,
+				ExecutionPlan:    &ExecutionPlan{Dependencies: [][]string{{"missing"}, {"b"}, {"c"}}},
+			},
+			want: [][]string{{"a@x", "b@y"}, {"c@x"}},
+		},
+		{
+			name: "unselected agent replaced by the first selected",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"y"},
+				Workflow:         WorkflowParallel,
+				SubQuestions:     []SubQuestion{{ID: "a", AssignedAgentID: "x"}},
+			},
+			want: [][]string{{"a@y"}},
+		},
+		{
+			name: "generated IDs avoid the given ones",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"x"},
+				Workflow:         WorkflowParallel,
+				SubQuestions:     []SubQuestion{{AssignedAgentID: "x"}, {ID: "sq-1", AssignedAgentID: "x"}},
+			},
+			want: [][]string{{"sq-3@x", "sq-1@x"}},
+		},
+		{
+			name: "duplicate sub-question IDs",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"x"},
+				Workflow:         WorkflowHierarchical,
+				SubQuestions:     []SubQuestion{{ID: "a", Question: "first"}, {ID: "a", Question: "second"}},
+				ExecutionPlan:    &ExecutionPlan{Dependencies: [][]string{{"a"}}},
+			},
+			wantErr: `duplicate sub-question ID "a"`,
+		},
+		{
+			name: "duplicate sub-question IDs without plan",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"x"},
+				Workflow:         WorkflowParallel,
+				SubQuestions:     []SubQuestion{{ID: "a"}, {ID: "a"}},
+			},
+			wantErr: `duplicate sub-question ID "a"`,
+		},
+		{
+			name: "cycle between groups",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"x", "y"},
+				Workflow:         WorkflowHierarchical,
+				SubQuestions:     questions,
+				ExecutionPlan:    &ExecutionPlan{Dependencies: [][]string{{"a"}, {"b"}, {"a", "c"}}},
+			},
+			wantErr: `sub-question "a" appears more than once`,
+		},
+		{
+			name: "repeated in a group",
+			analysis: &QueryAnalysisResult{
+				SelectedAgentIDs: []string{"x", "y"},
+				Workflow:         WorkflowHierarchical,
+				SubQuestions:     questions,
+				ExecutionPlan:    &ExecutionPlan{Dependencies: [][]string{{"a", "b", "b"}, {"c"}}},
+			},
+			wantErr: `sub-question "b" appears more than once`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages, err := BuildStages(tt.analysis, "query")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BuildStages() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildStages() error = %v", err)
+			}
+			if got := stageIDs(stages); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildStages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildStagesAnswersQuery(t *testing.T) {
+	stages, err := BuildStages(&QueryAnalysisResult{SelectedAgentIDs: []string{"x"}}, "what is the refund policy?")
+	if err != nil {
+		t.Fatalf("BuildStages() error = %v", err)
+	}
+	if len(stages) != 1 || stages[0][0].Question != "what is the refund policy?" {
+		t.Errorf("BuildStages() = %+v, want the agent to answer the query", stages)
+	}
+}
+
+func TestDAGExecutorRejectsDuplicateIDs(t *testing.T) {
+	ran := false
+	run := func(context.Context, string, string) (string, error) {
+		ran = true
+		return "", nil
+	}
+	analysis := &QueryAnalysisResult{
+		SelectedAgentIDs: []string{"x"},
+		Workflow:         WorkflowParallel,
+		SubQuestions:     []SubQuestion{{ID: "a"}, {ID: "a"}},
+	}
+	if _, err := NewDAGExecutor(run, nil).Execute(context.Background(), analysis, "query"); err == nil {
+		t.Fatal("Execute() error = nil, want the duplicate ID error")
+	}
+	if ran {
+		t.Error("Execute() ran steps of an invalid plan")
+	}
+}
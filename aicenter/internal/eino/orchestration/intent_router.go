@@ -1,7 +1,9 @@
 package orchestration
 
 import (
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -21,6 +23,25 @@ type IntentRule struct {
 	Intent   IntentType
 	Keywords []string         // 关键词匹配
 	Patterns []*regexp.Regexp // 正则匹配
+
+	// 项目自定义规则
+	ID       string // 规则 ID，内置规则为空
+	Name     string // 规则名称
+	Priority int    // 优先级，数值大的先匹配；优先级相同时自定义规则先于内置规则
+	// 命中后直接路由到目标 Agent 或工作流，不调用 LLM
+	TargetAgentID  string
+	TargetWorkflow WorkflowType
+}
+
+// RuleMatch 命中的规则
+type RuleMatch struct {
+	ID             string       `json:"id,omitempty"`
+	Name           string       `json:"name,omitempty"`
+	Intent         IntentType   `json:"intent"`
+	Keyword        string       `json:"keyword,omitempty"`         // 命中的关键词
+	Pattern        string       `json:"pattern,omitempty"`         // 命中的正则
+	TargetAgentID  string       `json:"target_agent_id,omitempty"` // 目标 Agent
+	TargetWorkflow WorkflowType `json:"target_workflow,omitempty"` // 目标工作流
 }
 
 // IntentRouter 意图前置路由器
@@ -67,49 +88,101 @@ func NewIntentRouter() *IntentRouter {
 	}
 }
 
+// NewIntentRouterWithRules 创建带自定义规则的意图路由器，自定义规则与内置规则按优先级一起匹配
+func NewIntentRouterWithRules(rules ...IntentRule) *IntentRouter {
+	r := NewIntentRouter()
+	r.rules = append(r.rules, rules...)
+	r.sortRules()
+	return r
+}
+
 // QuickMatch 快速意图匹配
 // 返回匹配到的意图类型，如果无法确定则返回 IntentUnknown
 func (r *IntentRouter) QuickMatch(query string) IntentType {
+	if match := r.match(query); match != nil {
+		return match.Intent
+	}
+	return IntentUnknown
+}
+
+// match 按优先级返回第一条命中的规则
+func (r *IntentRouter) match(query string) *RuleMatch {
 	queryLower := strings.ToLower(query)
 
 	for _, rule := range r.rules {
+		match := &RuleMatch{
+			ID:             rule.ID,
+			Name:           rule.Name,
+			Intent:         rule.Intent,
+			TargetAgentID:  rule.TargetAgentID,
+			TargetWorkflow: rule.TargetWorkflow,
+		}
+
 		// 关键词匹配
 		for _, keyword := range rule.Keywords {
 			if strings.Contains(queryLower, strings.ToLower(keyword)) {
-				return rule.Intent
+				match.Keyword = keyword
+				return match
 			}
 		}
 
 		// 正则匹配
 		for _, pattern := range rule.Patterns {
 			if pattern.MatchString(query) {
-				return rule.Intent
+				match.Pattern = pattern.String()
+				return match
 			}
 		}
 	}
 
-	return IntentUnknown
+	return nil
+}
+
+// Routes 规则是否指定了路由目标
+func (m *RuleMatch) Routes() bool {
+	return m.TargetAgentID != "" || m.TargetWorkflow != ""
 }
 
 // QuickMatchResult 快速匹配结果
 type QuickMatchResult struct {
-	Intent  IntentType
-	Matched bool
-	SkipLLM bool   // 是否跳过 LLM 分析
-	Reason  string // 匹配原因
+	Intent  IntentType `json:"intent"`
+	Matched bool       `json:"matched"`
+	SkipLLM bool       `json:"skip_llm"` // 是否跳过 LLM 分析
+	Reason  string     `json:"reason"`   // 匹配原因
+	Rule    *RuleMatch `json:"rule,omitempty"`
 }
 
 // Match 执行意图匹配，返回详细结果
 func (r *IntentRouter) Match(query string) *QuickMatchResult {
-	intent := r.QuickMatch(query)
+	match := r.match(query)
+	if match == nil {
+		return &QuickMatchResult{
+			Intent:  IntentUnknown,
+			Matched: false,
+			SkipLLM: false,
+			Reason:  "需要 LLM 分析",
+		}
+	}
+
+	// 指定了路由目标的自定义规则直接路由
+	if match.Routes() {
+		return &QuickMatchResult{
+			Intent:  match.Intent,
+			Matched: true,
+			SkipLLM: true,
+			Reason:  fmt.Sprintf("规则匹配：%s", match.Name),
+			Rule:    match,
+		}
+	}
 
-	switch intent {
+	switch match.Intent {
 	case IntentHuman:
 		return &QuickMatchResult{
 			Intent:  IntentHuman,
 			Matched: true,
 			SkipLLM: true,
 			Reason:  "关键词匹配：转人工",
+			Rule:    match,
 		}
 	case IntentOrder:
 		return &QuickMatchResult{
@@ -117,6 +190,7 @@ func (r *IntentRouter) Match(query string) *QuickMatchResult {
 			Matched: true,
 			SkipLLM: false, // 订单查询仍需 LLM 判断具体操作
 			Reason:  "关键词匹配：订单相关",
+			Rule:    match,
 		}
 	case IntentGreeting:
 		return &QuickMatchResult{
@@ -124,13 +198,16 @@ func (r *IntentRouter) Match(query string) *QuickMatchResult {
 			Matched: true,
 			SkipLLM: true,
 			Reason:  "关键词匹配：打招呼",
+			Rule:    match,
 		}
 	default:
+		// 没有路由目标的其他意图仍需 LLM 选择 Agent
 		return &QuickMatchResult{
-			Intent:  IntentUnknown,
-			Matched: false,
+			Intent:  match.Intent,
+			Matched: true,
 			SkipLLM: false,
-			Reason:  "需要 LLM 分析",
+			Reason:  fmt.Sprintf("关键词匹配：%s", match.Intent),
+			Rule:    match,
 		}
 	}
 }
@@ -138,6 +215,17 @@ func (r *IntentRouter) Match(query string) *QuickMatchResult {
 // AddRule 添加自定义规则
 func (r *IntentRouter) AddRule(rule IntentRule) {
 	r.rules = append(r.rules, rule)
+	r.sortRules()
+}
+
+// sortRules 按优先级从高到低排序，优先级相同时自定义规则在前
+func (r *IntentRouter) sortRules() {
+	sort.SliceStable(r.rules, func(i, j int) bool {
+		if r.rules[i].Priority != r.rules[j].Priority {
+			return r.rules[i].Priority > r.rules[j].Priority
+		}
+		return r.rules[i].ID != "" && r.rules[j].ID == ""
+	})
 }
 
 // AddKeywords 为指定意图添加关键词
@@ -17,6 +17,9 @@ const QueryAnalyzerPrompt = `你是一个智能查询分析专家。你的任务
    - single: 单个 Agent 处理（简单查询）
    - parallel: 多个 Agent 并行处理（独立的多意图）
    - sequential: 多个 Agent 串行处理（有依赖关系）
+   - hierarchical: 分层处理，先执行一组子问题，其结果作为后续子问题的输入
+   - pipeline: 流水线处理，每一组子问题只接收上一组的输出
+5. **执行计划**: 子问题之间有依赖时，在 execution_plan.dependencies 中按执行顺序给出子问题 ID 分组，同一组内的子问题相互独立、可并行执行
 
 ## 输出要求
 
@@ -59,6 +62,27 @@ const QueryAnalyzerPrompt = `你是一个智能查询分析专家。你的任务
   ]
 }
 
+## 有依赖关系的复杂查询示例
+
+如果后一个子问题需要前一个子问题的结果（例如先比较产品，再查询所选产品的库存）：
+
+{
+  "selected_agent_ids": ["agent-1", "agent-2"],
+  "selection_reasoning": "需要产品 Agent 比较产品，再由库存 Agent 查询库存",
+  "workflow": "hierarchical",
+  "workflow_reasoning": "库存查询依赖产品比较的结果",
+  "confidence_score": 0.85,
+  "is_complex": true,
+  "sub_questions": [
+    {"id": "sq-1", "question": "比较产品 A、B、C", "intent": "产品比较", "assigned_agent_id": "agent-1"},
+    {"id": "sq-2", "question": "查询产品 A、B、C 的库存", "intent": "库存查询", "assigned_agent_id": "agent-2"}
+  ],
+  "execution_plan": {
+    "dependencies": [["sq-1"], ["sq-2"]],
+    "parallel_groups": [["sq-1"], ["sq-2"]]
+  }
+}
+
 ## 注意事项
 
 1. 如果只有一个 Agent 可用，直接选择它，workflow 为 "single"
@@ -75,3 +99,17 @@ const AgentProfileTemplate = `- ID: {id}
   名称: {name}
   描述: {description}
 `
+
+const QueryRewritePrompt = `你是一个对话理解专家。请结合对话历史，将用户的最新问题改写为一个无需上下文即可理解的独立问题。
+
+要求：
+1. 补全最新问题中的指代和省略，例如"它"、"第二个"、"那个呢"应替换为对话中提到的具体对象
+2. 保持用户的原意和语言，不要回答问题，不要添加对话中没有的信息
+3. 如果最新问题本身已经完整独立，原样输出
+4. 只输出改写后的问题，不要输出任何解释
+
+对话历史：
+{history}
+
+用户最新问题: {user_query}
+`
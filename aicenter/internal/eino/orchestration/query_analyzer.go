@@ -29,24 +29,41 @@ func NewQueryAnalyzer(chatModel model.ChatModel) *QueryAnalyzer {
 func (qa *QueryAnalyzer) Analyze(ctx context.Context, analysisCtx *AnalysisContext) (*QueryAnalysisResult, error) {
 	// 1. 先尝试关键词快速匹配（参考 eino router 模式）
 	quickResult := qa.intentRouter.Match(analysisCtx.UserQuery)
+
+	// 2. 结合会话历史将追问改写为独立问题，改写后的问题重新匹配规则
+	query := analysisCtx.UserQuery
+	if !quickResult.SkipLLM {
+		if query = qa.rewriteQuery(ctx, analysisCtx); query != analysisCtx.UserQuery {
+			quickResult = qa.intentRouter.Match(query)
+		}
+	}
+	var rewrittenQuery string
+	if query != analysisCtx.UserQuery {
+		rewrittenQuery = query
+	}
+
 	if quickResult.Matched && quickResult.SkipLLM {
 		log.Printf("[QueryAnalyzer] Quick match: intent=%s, reason=%s", quickResult.Intent, quickResult.Reason)
-		return qa.buildQuickResult(quickResult, analysisCtx), nil
+		result := qa.buildQuickResult(quickResult, analysisCtx)
+		result.Source = SourceRule
+		result.MatchedRule = quickResult.Rule
+		result.RewrittenQuery = rewrittenQuery
+		return result, nil
 	}
 
 	if quickResult.Matched {
 		log.Printf("[QueryAnalyzer] Partial match: intent=%s, continue with LLM", quickResult.Intent)
 	}
 
-	// 2. 未匹配或需要 LLM 进一步分析
+	// 3. 未匹配或需要 LLM 进一步分析
 	// 构建 Agent 简介文本
 	agentProfilesText := qa.buildAgentProfilesText(analysisCtx.AvailableAgents)
 
 	// 构建分析 prompt
 	prompt := strings.ReplaceAll(QueryAnalyzerPrompt, "{agent_profiles}", agentProfilesText)
-	prompt = strings.ReplaceAll(prompt, "{user_query}", analysisCtx.UserQuery)
+	prompt = strings.ReplaceAll(prompt, "{user_query}", query)
 
-	log.Printf("[QueryAnalyzer] Analyzing query: %s", analysisCtx.UserQuery)
+	log.Printf("[QueryAnalyzer] Analyzing query: %s", query)
 	log.Printf("[QueryAnalyzer] Available agents: %d", len(analysisCtx.AvailableAgents))
 
 	// 调用 LLM 进行分析
@@ -66,14 +83,23 @@ func (qa *QueryAnalyzer) Analyze(ctx context.Context, analysisCtx *AnalysisConte
 	if err != nil {
 		log.Printf("[QueryAnalyzer] Parse error: %v, using fallback", err)
 		// 解析失败时使用降级策略
-		return qa.fallbackResult(analysisCtx), nil
+		result = qa.fallbackResult(analysisCtx)
+		result.MatchedRule = quickResult.Rule
+		result.RewrittenQuery = rewrittenQuery
+		return result, nil
 	}
 
 	// 验证结果
 	if err := qa.validateResult(result, analysisCtx); err != nil {
 		log.Printf("[QueryAnalyzer] Validation error: %v, using fallback", err)
-		return qa.fallbackResult(analysisCtx), nil
+		result = qa.fallbackResult(analysisCtx)
+		result.MatchedRule = quickResult.Rule
+		result.RewrittenQuery = rewrittenQuery
+		return result, nil
 	}
+	result.Source = SourceLLM
+	result.MatchedRule = quickResult.Rule
+	result.RewrittenQuery = rewrittenQuery
 
 	log.Printf("[QueryAnalyzer] Analysis result: workflow=%s, agents=%v, is_complex=%v",
 		result.Workflow, result.SelectedAgentIDs, result.IsComplex)
@@ -81,6 +107,66 @@ func (qa *QueryAnalyzer) Analyze(ctx context.Context, analysisCtx *AnalysisConte
 	return result, nil
 }
 
+// rewriteQuery 结合会话历史将用户问题改写为独立问题，
+// 无历史或改写失败时返回原问题
+func (qa *QueryAnalyzer) rewriteQuery(ctx context.Context, analysisCtx *AnalysisContext) string {
+	history := formatHistory(analysisCtx.History)
+	if history == "" || qa.chatModel == nil {
+		return analysisCtx.UserQuery
+	}
+
+	prompt := strings.ReplaceAll(QueryRewritePrompt, "{history}", history)
+	prompt = strings.ReplaceAll(prompt, "{user_query}", analysisCtx.UserQuery)
+	resp, err := qa.chatModel.Generate(ctx, []*schema.Message{schema.UserMessage(prompt)})
+	if err != nil {
+		log.Printf("[QueryAnalyzer] Rewrite failed: %v, using original query", err)
+		return analysisCtx.UserQuery
+	}
+
+	rewritten := strings.TrimSpace(resp.Content)
+	if rewritten == "" {
+		return analysisCtx.UserQuery
+	}
+	if rewritten != analysisCtx.UserQuery {
+		log.Printf("[QueryAnalyzer] Rewrote query: %s -> %s", analysisCtx.UserQuery, rewritten)
+	}
+	return rewritten
+}
+
+// formatHistory 将会话历史格式化为改写 prompt 使用的文本，
+// 仅保留最近的用户与助手消息，过长的消息会被截断
+func formatHistory(history []*schema.Message) string {
+	const (
+		maxMessages = 10
+		maxRunes    = 500
+	)
+
+	var lines []string
+	for _, msg := range history {
+		content := strings.TrimSpace(msg.Content)
+		if content == "" {
+			continue
+		}
+		var role string
+		switch msg.Role {
+		case schema.User:
+			role = "用户"
+		case schema.Assistant:
+			role = "助手"
+		default:
+			continue
+		}
+		if runes := []rune(content); len(runes) > maxRunes {
+			content = string(runes[:maxRunes]) + "..."
+		}
+		lines = append(lines, role+": "+content)
+	}
+	if len(lines) > maxMessages {
+		lines = lines[len(lines)-maxMessages:]
+	}
+	return strings.Join(lines, "\n")
+}
+
 // buildAgentProfilesText 构建 Agent 简介文本
 func (qa *QueryAnalyzer) buildAgentProfilesText(agents []AgentProfile) string {
 	if len(agents) == 0 {
@@ -141,7 +227,7 @@ func (qa *QueryAnalyzer) validateResult(result *QueryAnalysisResult, ctx *Analys
 
 	// 验证 workflow 类型
 	switch result.Workflow {
-	case WorkflowSingle, WorkflowParallel, WorkflowSequential:
+	case WorkflowSingle, WorkflowParallel, WorkflowSequential, WorkflowHierarchical, WorkflowPipeline:
 		// OK
 	default:
 		return fmt.Errorf("invalid workflow type: %s", result.Workflow)
@@ -163,6 +249,7 @@ func (qa *QueryAnalyzer) fallbackResult(ctx *AnalysisContext) *QueryAnalysisResu
 		ConfidenceScore:    0.5,
 		IsComplex:          false,
 		SelectionReasoning: "Fallback: 解析失败，选择默认 Agent",
+		Source:             SourceFallback,
 	}
 
 	if len(ctx.AvailableAgents) > 0 {
@@ -185,6 +272,10 @@ func (qa *QueryAnalyzer) AnalyzeSimple(ctx context.Context, query string, agents
 // buildQuickResult 根据快速匹配结果构建分析结果
 // 用于关键词匹配成功时快速返回，无需调用 LLM
 func (qa *QueryAnalyzer) buildQuickResult(quickResult *QuickMatchResult, analysisCtx *AnalysisContext) *QueryAnalysisResult {
+	if rule := quickResult.Rule; rule != nil && rule.Routes() {
+		return qa.buildRuleResult(rule, analysisCtx)
+	}
+
 	result := &QueryAnalysisResult{
 		Workflow:        WorkflowSingle,
 		ConfidenceScore: 0.95, // 关键词匹配置信度高
@@ -238,7 +329,40 @@ func (qa *QueryAnalyzer) buildQuickResult(quickResult *QuickMatchResult, analysi
 	return result
 }
 
+// buildRuleResult 根据自定义规则的路由目标构建分析结果：
+// 指定了 Agent 时由该 Agent 执行，否则由所有可用 Agent 按目标工作流执行
+func (qa *QueryAnalyzer) buildRuleResult(rule *RuleMatch, analysisCtx *AnalysisContext) *QueryAnalysisResult {
+	result := &QueryAnalysisResult{
+		Workflow:           rule.TargetWorkflow,
+		WorkflowReasoning:  fmt.Sprintf("规则匹配：%s", rule.Name),
+		SelectionReasoning: fmt.Sprintf("规则 %s 指定的路由目标", rule.Name),
+		ConfidenceScore:    1, // 规则路由是确定的
+	}
+	if result.Workflow == "" {
+		result.Workflow = WorkflowSingle
+	}
+
+	switch {
+	case rule.TargetAgentID != "":
+		result.SelectedAgentIDs = []string{rule.TargetAgentID}
+	case result.Workflow == WorkflowSingle:
+		if len(analysisCtx.AvailableAgents) > 0 {
+			result.SelectedAgentIDs = []string{analysisCtx.AvailableAgents[0].ID}
+		}
+	default:
+		for _, agent := range analysisCtx.AvailableAgents {
+			result.SelectedAgentIDs = append(result.SelectedAgentIDs, agent.ID)
+		}
+	}
+	return result
+}
+
 // GetIntentRouter 获取意图路由器（用于添加自定义规则）
 func (qa *QueryAnalyzer) GetIntentRouter() *IntentRouter {
 	return qa.intentRouter
 }
+
+// SetIntentRouter 替换意图路由器，例如使用项目配置的规则
+func (qa *QueryAnalyzer) SetIntentRouter(router *IntentRouter) {
+	qa.intentRouter = router
+}
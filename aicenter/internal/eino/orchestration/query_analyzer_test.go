@@ -0,0 +1,150 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// scriptedModel answers the calls with replies in order and records the
+// prompts it was given
+type scriptedModel struct {
+	replies []string
+	err     error
+	prompts []string
+}
+
+func (m *scriptedModel) Generate(_ context.Context, input []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	m.prompts = append(m.prompts, input[len(input)-1].Content)
+	if m.err != nil {
+		return nil, m.err
+	}
+	if len(m.replies) == 0 {
+		return nil, errors.New("no reply scripted")
+	}
+	reply := m.replies[0]
+	m.replies = m.replies[1:]
+	return schema.AssistantMessage(reply, nil), nil
+}
+
+func (m *scriptedModel) Stream(context.Context, []*schema.Message, ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return nil, errors.New("not supported")
+}
+
+func (m *scriptedModel) BindTools([]*schema.ToolInfo) error { return nil }
+
+func TestRewriteQuery(t *testing.T) {
+	history := []*schema.Message{
+		schema.UserMessage("你们有哪些套餐？"),
+		schema.AssistantMessage("有基础版和专业版。", nil),
+	}
+
+	tests := []struct {
+		name      string
+		history   []*schema.Message
+		model     *scriptedModel
+		want      string
+		wantCalls int
+	}{
+		{name: "no history", model: &scriptedModel{replies: []string{"unused"}}, want: "第二个多少钱？"},
+		{
+			name:      "follow-up rewritten",
+			history:   history,
+			model:     &scriptedModel{replies: []string{"  专业版套餐多少钱？\n"}},
+			want:      "专业版套餐多少钱？",
+			wantCalls: 1,
+		},
+		{name: "model error", history: history, model: &scriptedModel{err: errors.New("timeout")}, want: "第二个多少钱？", wantCalls: 1},
+		{name: "empty rewrite", history: history, model: &scriptedModel{replies: []string{" "}}, want: "第二个多少钱？", wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qa := NewQueryAnalyzer(tt.model)
+			got := qa.rewriteQuery(context.Background(), &AnalysisContext{UserQuery: "第二个多少钱？", History: tt.history})
+			if got != tt.want {
+				t.Errorf("rewriteQuery() = %q, want %q", got, tt.want)
+			}
+			if len(tt.model.prompts) != tt.wantCalls {
+				t.Fatalf("rewriteQuery() called the model %d times, want %d", len(tt.model.prompts), tt.wantCalls)
+			}
+			if tt.wantCalls > 0 {
+				prompt := tt.model.prompts[0]
+				if !strings.Contains(prompt, "助手: 有基础版和专业版。") || !strings.Contains(prompt, "用户最新问题: 第二个多少钱？") {
+					t.Errorf("rewrite prompt %q does not hold the history and the query", prompt)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatHistory(t *testing.T) {
+	long := strings.Repeat("长", 600)
+	many := make([]*schema.Message, 0, 12)
+	for i := 0; i < 12; i++ {
+		many = append(many, schema.UserMessage(string(rune('a'+i))))
+	}
+
+	tests := []struct {
+		name    string
+		history []*schema.Message
+		want    string
+	}{
+		{name: "no history", want: ""},
+		{
+			name: "user and assistant messages only",
+			history: []*schema.Message{
+				schema.SystemMessage("You are helpful."),
+				schema.UserMessage("  查订单  "),
+				schema.AssistantMessage("", []schema.ToolCall{{ID: "call_1"}}),
+				schema.ToolMessage("shipped", "call_1"),
+				schema.AssistantMessage("已发货。", nil),
+			},
+			want: "用户: 查订单\n助手: 已发货。",
+		},
+		{
+			name:    "long message truncated",
+			history: []*schema.Message{schema.UserMessage(long)},
+			want:    "用户: " + strings.Repeat("长", 500) + "...",
+		},
+		{
+			name:    "latest messages kept",
+			history: many,
+			want:    "用户: c\n用户: d\n用户: e\n用户: f\n用户: g\n用户: h\n用户: i\n用户: j\n用户: k\n用户: l",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatHistory(tt.history); got != tt.want {
+				t.Errorf("formatHistory() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeRewritesFollowUps(t *testing.T) {
+	chatModel := &scriptedModel{replies: []string{"专业版套餐多少钱？", "not json"}}
+	qa := NewQueryAnalyzer(chatModel)
+	result, err := qa.Analyze(context.Background(), &AnalysisContext{
+		UserQuery: "第二个多少钱？",
+		History: []*schema.Message{
+			schema.UserMessage("你们有哪些套餐？"),
+			schema.AssistantMessage("有基础版和专业版。", nil),
+		},
+		AvailableAgents: []AgentProfile{{ID: "sales", Name: "Sales"}},
+	})
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	if result.RewrittenQuery != "专业版套餐多少钱？" {
+		t.Errorf("Analyze() rewritten query = %q, want the rewrite", result.RewrittenQuery)
+	}
+	if len(chatModel.prompts) != 2 || !strings.Contains(chatModel.prompts[1], "专业版套餐多少钱？") {
+		t.Errorf("Analyze() prompts = %q, want the analysis of the rewritten query", chatModel.prompts)
+	}
+}
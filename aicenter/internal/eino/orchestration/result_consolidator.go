@@ -12,12 +12,27 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
+// ConflictType 冲突类型
+type ConflictType string
+
+const (
+	ConflictFactual       ConflictType = "factual"       // 事实性冲突（数字、日期、名称等不一致）
+	ConflictOpinion       ConflictType = "opinion"       // 观点性矛盾（对同一问题给出相反的建议）
+	ConflictInconsistency ConflictType = "inconsistency" // 信息不一致（同一事物的不同描述）
+)
+
 // ConflictInfo 冲突信息
 type ConflictInfo struct {
-	Detected    bool     `json:"detected"`    // 是否检测到冲突
-	Description string   `json:"description"` // 冲突描述
-	AgentIDs    []string `json:"agent_ids"`   // 冲突的 Agent IDs
-	Resolution  string   `json:"resolution"`  // 解决方案
+	Detected    bool         `json:"detected"`       // 是否检测到冲突
+	Type        ConflictType `json:"type,omitempty"` // 冲突类型
+	Description string       `json:"description"`    // 冲突描述
+	AgentIDs    []string     `json:"agent_ids"`      // 冲突的 Agent IDs
+	Resolution  string       `json:"resolution"`     // 解决方案
+}
+
+// Factual 是否为事实性冲突
+func (c ConflictInfo) Factual() bool {
+	return c.Detected && c.Type == ConflictFactual
 }
 
 // ConsolidationResult 聚合结果（包含冲突检测）
@@ -65,6 +80,7 @@ const conflictDetectionSystemPrompt = `你是一个专业的信息分析助手
 ## 输出格式（JSON）
 {
   "has_conflict": true/false,
+  "conflict_type": "factual/opinion/inconsistency",  // 冲突类型，对应上面三种情况，同时存在多种时优先 factual（如无冲突则为空）
   "conflict_description": "冲突的具体描述（如无冲突则为空）",
   "conflicting_sources": [1, 2],  // 冲突的来源编号
   "resolution_suggestion": "建议的解决方案（如无冲突则为空）",
@@ -185,8 +201,11 @@ func (rc *ResultConsolidator) ConsolidateWithConflictDetection(ctx context.Conte
 	// 单结果无需冲突检测
 	if len(execResult.Results) <= 1 || successCount <= 1 {
 		content := ""
-		if len(execResult.Results) > 0 && execResult.Results[0].Error == nil {
-			content = execResult.Results[0].Content
+		for _, r := range execResult.Results {
+			if r.Error == nil {
+				content = r.Content
+				break
+			}
 		}
 		return &ConsolidationResult{
 			Content:      content,
@@ -265,11 +284,12 @@ func (rc *ResultConsolidator) parseConflictResponse(content string, execResult *
 
 	// 解析 JSON
 	var result struct {
-		HasConflict          bool     `json:"has_conflict"`
-		ConflictDescription  string   `json:"conflict_description"`
-		ConflictingSources   []int    `json:"conflicting_sources"`
-		ResolutionSuggestion string   `json:"resolution_suggestion"`
-		ConsensusPoints      []string `json:"consensus_points"`
+		HasConflict          bool         `json:"has_conflict"`
+		ConflictType         ConflictType `json:"conflict_type"`
+		ConflictDescription  string       `json:"conflict_description"`
+		ConflictingSources   []int        `json:"conflicting_sources"`
+		ResolutionSuggestion string       `json:"resolution_suggestion"`
+		ConsensusPoints      []string     `json:"consensus_points"`
 	}
 
 	if err := json.Unmarshal([]byte(content), &result); err != nil {
@@ -287,8 +307,21 @@ func (rc *ResultConsolidator) parseConflictResponse(content string, execResult *
 
 	return ConflictInfo{
 		Detected:    result.HasConflict,
+		Type:        conflictType(result.HasConflict, result.ConflictType),
 		Description: result.ConflictDescription,
 		AgentIDs:    agentIDs,
 		Resolution:  result.ResolutionSuggestion,
 	}, nil
 }
+
+// conflictType 规范化冲突类型，未知类型按事实性冲突处理
+func conflictType(detected bool, t ConflictType) ConflictType {
+	if !detected {
+		return ""
+	}
+	switch t {
+	case ConflictOpinion, ConflictInconsistency:
+		return t
+	}
+	return ConflictFactual
+}
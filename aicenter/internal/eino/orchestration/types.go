@@ -3,6 +3,8 @@ package orchestration
 import (
 	"fmt"
 	"time"
+
+	"github.com/cloudwego/eino/schema"
 )
 
 // WorkflowType 工作流类型
@@ -56,8 +58,26 @@ type QueryAnalysisResult struct {
 
 	// 执行计划
 	ExecutionPlan *ExecutionPlan `json:"execution_plan,omitempty"`
+
+	// 分析来源
+	Source AnalysisSource `json:"source,omitempty"`
+
+	// 命中的意图规则，规则直接路由或 LLM 分析前的部分匹配
+	MatchedRule *RuleMatch `json:"matched_rule,omitempty"`
+
+	// 结合会话历史改写后的独立问题，未改写时为空
+	RewrittenQuery string `json:"rewritten_query,omitempty"`
 }
 
+// AnalysisSource 分析结果的来源
+type AnalysisSource string
+
+const (
+	SourceRule     AnalysisSource = "rule"     // 意图规则匹配，未调用 LLM
+	SourceLLM      AnalysisSource = "llm"      // LLM 分析
+	SourceFallback AnalysisSource = "fallback" // LLM 分析失败后的降级结果
+)
+
 // AgentProfile Agent 简介，用于查询分析
 type AgentProfile struct {
 	ID           string   `json:"id"`
@@ -73,6 +93,9 @@ type AnalysisContext struct {
 	AvailableAgents []AgentProfile `json:"available_agents"`
 	SessionID       string         `json:"session_id,omitempty"`
 	UserID          string         `json:"user_id,omitempty"`
+
+	// 会话的窗口历史（按时间顺序），用于将追问改写为独立问题
+	History []*schema.Message `json:"-"`
 }
 
 // AgentResult 单个 Agent 执行结果
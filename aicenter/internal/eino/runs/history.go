@@ -0,0 +1,286 @@
+package runs
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of runs, they decide how a run is replayed
+const (
+	KindTeam     = "team"
+	KindAgent    = "agent"
+	KindAnalyzer = "analyzer"
+	// KindCompletion runs answer with calls of tools declared by the caller
+	KindCompletion = "completion"
+	// KindResume runs continue a run interrupted for approvals
+	KindResume = "resume"
+	// KindConsensus runs ask every agent and check their answers agree
+	KindConsensus = "consensus"
+)
+
+// EventType is the type of an event of the run timeline
+type EventType string
+
+const (
+	EventMessage    EventType = "message"
+	EventToolCall   EventType = "tool_call"
+	EventToolResult EventType = "tool_result"
+	EventTransfer   EventType = "transfer"
+	EventExit       EventType = "exit"
+	EventInterrupt  EventType = "interrupt"
+	EventError      EventType = "error"
+)
+
+const eventBatchSize = 100
+
+// staleRunError is the error of the runs whose replica stopped before
+// finishing them
+const staleRunError = "run interrupted: its replica stopped before it finished"
+
+// Record is the persisted history of a run: its input, the config it ran
+// with, its outcome and, loaded on demand, its event timeline
+type Record struct {
+	ID        string     `gorm:"size:64;primary_key" json:"id"`
+	ProjectID uuid.UUID  `gorm:"type:uuid;not null;index" json:"project_id"`
+	Kind      string     `gorm:"size:20;not null" json:"kind"`
+	SessionID string     `gorm:"size:255;index" json:"session_id,omitempty"`
+	VisitorID *uuid.UUID `gorm:"type:uuid;index" json:"visitor_id,omitempty"`
+	TeamID    *uuid.UUID `gorm:"type:uuid;index" json:"team_id,omitempty"`
+	// AgentIDs are the agents that could take part in the run
+	AgentIDs StringList `gorm:"type:jsonb" json:"agent_ids"`
+	Input    string     `gorm:"type:text" json:"input"`
+	// History is the conversation history the input was sent with
+	History Messages `gorm:"type:jsonb" json:"history,omitempty"`
+	Params  JSONMap  `gorm:"type:jsonb" json:"params,omitempty"`
+	// Config is a snapshot of the resolved team/agent config, without credentials
+	Config           JSONMap    `gorm:"type:jsonb" json:"config,omitempty"`
+	Status           Status     `gorm:"size:20;not null;index" json:"status"`
+	Output           string     `gorm:"type:text" json:"output"`
+	Error            string     `gorm:"type:text" json:"error,omitempty"`
+	Provider         string     `gorm:"size:50" json:"provider,omitempty"`
+	Model            string     `gorm:"size:100" json:"model,omitempty"`
+	PromptTokens     int        `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int        `gorm:"default:0" json:"completion_tokens"`
+	TotalTokens      int        `gorm:"default:0" json:"total_tokens"`
+	ReplayOf         *string    `gorm:"size:64;index" json:"replay_of,omitempty"`
+	ResumeOf         *string    `gorm:"size:64;index" json:"resume_of,omitempty"`
+	StartedAt        time.Time  `gorm:"not null;index" json:"started_at"`
+	EndedAt          *time.Time `json:"ended_at,omitempty"`
+	DurationMs       int64      `gorm:"default:0" json:"duration_ms"`
+
+	Events []Event `gorm:"-" json:"events,omitempty"`
+}
+
+func (Record) TableName() string {
+	return "ai_runs"
+}
+
+// Event is one step of a run timeline
+type Event struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	RunID      string    `gorm:"size:64;not null;index:idx_run_event_seq" json:"run_id"`
+	Seq        int       `gorm:"not null;index:idx_run_event_seq" json:"seq"`
+	Type       EventType `gorm:"size:20;not null" json:"type"`
+	AgentName  string    `gorm:"size:255" json:"agent_name,omitempty"`
+	Role       string    `gorm:"size:20" json:"role,omitempty"`
+	Content    string    `gorm:"type:text" json:"content,omitempty"`
+	ToolName   string    `gorm:"size:255" json:"tool_name,omitempty"`
+	ToolCallID string    `gorm:"size:255" json:"tool_call_id,omitempty"`
+	Data       JSONMap   `gorm:"type:jsonb" json:"data,omitempty"`
+	// ElapsedMs is the time since the start of the run
+	ElapsedMs int64     `gorm:"default:0" json:"elapsed_ms"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (Event) TableName() string {
+	return "ai_run_events"
+}
+
+// JSONMap for JSONB storage
+type JSONMap map[string]interface{}
+
+func (j JSONMap) Value() (driver.Value, error) {
+	if j == nil {
+		return nil, nil
+	}
+	return json.Marshal(j)
+}
+
+func (j *JSONMap) Scan(value interface{}) error {
+	return scanJSON(value, j)
+}
+
+// StringList for JSONB storage
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	return scanJSON(value, l)
+}
+
+// Messages for JSONB storage
+type Messages []*schema.Message
+
+func (m Messages) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+func (m *Messages) Scan(value interface{}) error {
+	return scanJSON(value, m)
+}
+
+func scanJSON(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	}
+	return nil
+}
+
+// ListFilter filters the run history
+type ListFilter struct {
+	SessionID string
+	VisitorID *uuid.UUID
+	AgentID   string
+	TeamID    *uuid.UUID
+	Status    Status
+	// ReplayOf lists the replays of a run
+	ReplayOf string
+}
+
+// History stores the history of runs
+type History struct {
+	db *gorm.DB
+}
+
+// NewHistory creates a run history store
+func NewHistory(db *gorm.DB) *History {
+	return &History{db: db}
+}
+
+// Create stores a run as it starts
+func (h *History) Create(ctx context.Context, record *Record) error {
+	return h.db.WithContext(ctx).Create(record).Error
+}
+
+// Save stores the outcome of a run and its event timeline
+func (h *History) Save(ctx context.Context, record *Record, events []Event) error {
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(record).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(events, eventBatchSize).Error
+	})
+}
+
+// FailStale marks as failed the runs still running after runningTTL, their
+// replica stopped before finishing them and their events are lost. It
+// returns how many runs were marked.
+func (h *History) FailStale(ctx context.Context) (int64, error) {
+	now := time.Now()
+	result := h.db.WithContext(ctx).Model(&Record{}).
+		Where("status = ? AND started_at < ?", StatusRunning, now.Add(-runningTTL)).
+		Updates(map[string]interface{}{
+			"status":   StatusFailed,
+			"error":    staleRunError,
+			"ended_at": now,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// List returns the runs of a project, newest first, without their events
+func (h *History) List(ctx context.Context, projectID uuid.UUID, filter ListFilter, limit, offset int) ([]Record, int64, error) {
+	var records []Record
+	var total int64
+
+	query := h.db.WithContext(ctx).Model(&Record{}).Where("project_id = ?", projectID)
+	if filter.SessionID != "" {
+		query = query.Where("session_id = ?", filter.SessionID)
+	}
+	if filter.VisitorID != nil {
+		query = query.Where("visitor_id = ?", *filter.VisitorID)
+	}
+	if filter.TeamID != nil {
+		query = query.Where("team_id = ?", *filter.TeamID)
+	}
+	if filter.AgentID != "" {
+		agentIDs, _ := json.Marshal([]string{filter.AgentID})
+		query = query.Where("agent_ids @> ?::jsonb", string(agentIDs))
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ReplayOf != "" {
+		query = query.Where("replay_of = ?", filter.ReplayOf)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("started_at DESC").Limit(limit).Offset(offset).Find(&records).Error
+	return records, total, err
+}
+
+// Get returns a run of the project with its event timeline
+func (h *History) Get(ctx context.Context, projectID uuid.UUID, runID string) (*Record, error) {
+	var record Record
+	if err := h.db.WithContext(ctx).First(&record, "id = ? AND project_id = ?", runID, projectID).Error; err != nil {
+		return nil, err
+	}
+	if err := h.db.WithContext(ctx).Where("run_id = ?", runID).Order("seq").Find(&record.Events).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// DeleteVisitor permanently deletes the runs of a visitor, the runs of
+// sessionIDs, the replays and resumes of those runs, and their events. It
+// returns how many runs were deleted.
+func (h *History) DeleteVisitor(ctx context.Context, projectID, visitorID uuid.UUID, sessionIDs []string) (int64, error) {
+	db := h.db.WithContext(ctx)
+	owned := db.Model(&Record{}).Select("id").
+		Where("project_id = ?", projectID).
+		Where("visitor_id = ? OR session_id IN ?", visitorID, sessionIDsOrNone(sessionIDs))
+	runs := db.Model(&Record{}).Select("id").
+		Where("project_id = ?", projectID).
+		Where("id IN (?) OR replay_of IN (?) OR resume_of IN (?)", owned, owned, owned)
+
+	// Events first, so that an erasure failing halfway can be run again
+	if err := db.Where("run_id IN (?)", runs).Delete(&Event{}).Error; err != nil {
+		return 0, err
+	}
+	result := db.Where("id IN (?)", runs).Delete(&Record{})
+	return result.RowsAffected, result.Error
+}
+
+// sessionIDsOrNone keeps an IN clause on session IDs valid when there are
+// none
+func sessionIDsOrNone(sessionIDs []string) []string {
+	if len(sessionIDs) == 0 {
+		return []string{""}
+	}
+	return sessionIDs
+}
@@ -0,0 +1,42 @@
+package runs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestHistoryFailStale(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open dry run db: %v", err)
+	}
+	var updates []string
+	capture := func(tx *gorm.DB) {
+		updates = append(updates, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("test:capture", capture); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if _, err := NewHistory(db).FailStale(context.Background()); err != nil {
+		t.Fatalf("FailStale() error = %v", err)
+	}
+	if len(updates) != 1 {
+		t.Fatalf("FailStale() ran %d updates, want 1", len(updates))
+	}
+	for _, want := range []string{`UPDATE "ai_runs"`, `"status"='failed'`, `status = 'running' AND started_at <`, "ended_at"} {
+		if !strings.Contains(updates[0], want) {
+			t.Errorf("FailStale() ran %s, want it to contain %s", updates[0], want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package runs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/flow/agent"
+	"github.com/cloudwego/eino/schema"
+	template "github.com/cloudwego/eino/utils/callbacks"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+)
+
+// saveTimeout bounds the write of a run history, it survives the run context
+const saveTimeout = 10 * time.Second
+
+type recorderKey struct{}
+type replayKey struct{}
+
+// Recorder collects the history of a run while it executes
+type Recorder struct {
+	mu      sync.Mutex
+	record  *Record
+	events  []Event
+	history *History
+}
+
+// NewRecorder starts recording a run, history may be nil to keep nothing.
+// The record must have its ID, ProjectID, Kind and Input set.
+func NewRecorder(ctx context.Context, history *History, record *Record) *Recorder {
+	record.Status = StatusRunning
+	if record.StartedAt.IsZero() {
+		record.StartedAt = time.Now()
+	}
+	if replay := ReplayFromContext(ctx); replay != nil {
+		record.ReplayOf = &replay.ID
+	}
+
+	r := &Recorder{record: record, history: history}
+	if history != nil {
+		saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), saveTimeout)
+		defer cancel()
+		if err := history.Create(saveCtx, record); err != nil {
+			log.Printf("[Runs] Failed to record start of run %s: %v", record.ID, err)
+		}
+	}
+	return r
+}
+
+// WithRecorder attaches a recorder to ctx
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// RecorderFromContext returns the recorder of the run ctx belongs to
+func RecorderFromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
+
+// WithReplay marks the runs started with ctx as replays of original
+func WithReplay(ctx context.Context, original *Record) context.Context {
+	return context.WithValue(ctx, replayKey{}, original)
+}
+
+// ReplayFromContext returns the run being replayed with ctx
+func ReplayFromContext(ctx context.Context) *Record {
+	original, _ := ctx.Value(replayKey{}).(*Record)
+	return original
+}
+
+// Observe records an ADK event with the recorder of ctx, if any. Streamed
+// messages must be observed once complete.
+func Observe(ctx context.Context, event *adk.AgentEvent) {
+	if r := RecorderFromContext(ctx); r != nil {
+		r.Observe(event)
+	}
+}
+
+// ID returns the run ID
+func (r *Recorder) ID() string {
+	return r.record.ID
+}
+
+// SetConfig adds a section to the config snapshot, e.g. "team" or "analysis"
+func (r *Recorder) SetConfig(key string, value interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.record.Config == nil {
+		r.record.Config = JSONMap{}
+	}
+	r.record.Config[key] = value
+}
+
+// SetHistory records the conversation history the input was sent with
+func (r *Recorder) SetHistory(history []*schema.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.History = history
+}
+
+// SetTeam records the team and the agents that could take part in the run
+func (r *Recorder) SetTeam(teamID *uuid.UUID, agentIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if teamID != nil {
+		r.record.TeamID = teamID
+	}
+	for _, id := range agentIDs {
+		if !slices.Contains(r.record.AgentIDs, id) {
+			r.record.AgentIDs = append(r.record.AgentIDs, id)
+		}
+	}
+}
+
+// SetOutput records the final answer of the run
+func (r *Recorder) SetOutput(content, provider, model string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.Output = content
+	r.record.Provider = provider
+	r.record.Model = model
+}
+
+// ReactOption records the model and tool calls of a ReAct agent, which does
+// not emit ADK events
+func (r *Recorder) ReactOption(agentName string) agent.AgentOption {
+	handler := template.NewHandlerHelper().
+		ChatModel(&template.ModelCallbackHandler{
+			OnEnd: func(ctx context.Context, _ *callbacks.RunInfo, output *model.CallbackOutput) context.Context {
+				if output != nil && output.Message != nil {
+					r.ObserveMessage(agentName, output.Message)
+				}
+				return ctx
+			},
+		}).
+		Tool(&template.ToolCallbackHandler{
+			OnEnd: func(ctx context.Context, info *callbacks.RunInfo, output *tool.CallbackOutput) context.Context {
+				toolName := ""
+				if info != nil {
+					toolName = info.Name
+				}
+				if output != nil {
+					r.ObserveMessage(agentName, schema.ToolMessage(output.Response, compose.GetToolCallID(ctx), schema.WithToolName(toolName)))
+				}
+				return ctx
+			},
+		}).
+		Handler()
+	return agent.WithComposeOptions(compose.WithCallbacks(handler))
+}
+
+// Observe records an ADK event
+func (r *Recorder) Observe(event *adk.AgentEvent) {
+	if event == nil {
+		return
+	}
+
+	if event.Err != nil {
+		r.add(Event{Type: EventError, AgentName: event.AgentName, Content: event.Err.Error()})
+	}
+	if event.Output != nil && event.Output.MessageOutput != nil && event.Output.MessageOutput.Message != nil {
+		r.ObserveMessage(event.AgentName, event.Output.MessageOutput.Message)
+	}
+	if event.Action != nil {
+		switch {
+		case event.Action.TransferToAgent != nil:
+			r.add(Event{Type: EventTransfer, AgentName: event.AgentName, Content: event.Action.TransferToAgent.DestAgentName})
+		case event.Action.Interrupted != nil:
+			r.add(Event{Type: EventInterrupt, AgentName: event.AgentName, Content: fmt.Sprint(event.Action.Interrupted.Data)})
+		case event.Action.Exit:
+			r.add(Event{Type: EventExit, AgentName: event.AgentName})
+		}
+	}
+}
+
+// ObserveMessage records a message, split into its tool calls and text
+func (r *Recorder) ObserveMessage(agentName string, msg *schema.Message) {
+	if msg.Role == schema.Tool {
+		r.add(Event{
+			Type:       EventToolResult,
+			AgentName:  agentName,
+			Role:       string(msg.Role),
+			Content:    msg.Content,
+			ToolName:   msg.ToolName,
+			ToolCallID: msg.ToolCallID,
+		})
+		return
+	}
+
+	if msg.Content != "" || len(msg.ToolCalls) == 0 {
+		e := Event{Type: EventMessage, AgentName: agentName, Role: string(msg.Role), Content: msg.Content}
+		if provider, model, ok := llm.AnsweredBy(msg); ok {
+			e.Data = JSONMap{"provider": provider, "model": model}
+		}
+		r.add(e)
+	}
+	for _, tc := range msg.ToolCalls {
+		r.add(Event{
+			Type:       EventToolCall,
+			AgentName:  agentName,
+			Role:       string(msg.Role),
+			Content:    tc.Function.Arguments,
+			ToolName:   tc.Function.Name,
+			ToolCallID: tc.ID,
+		})
+	}
+}
+
+func (r *Recorder) add(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.RunID = r.record.ID
+	e.Seq = len(r.events) + 1
+	e.ElapsedMs = time.Since(r.record.StartedAt).Milliseconds()
+	r.events = append(r.events, e)
+}
+
+// Finish records how the run ended and stores its history
+func (r *Recorder) Finish(ctx context.Context, run *Run, tokens usage.TokenUsage) {
+	r.mu.Lock()
+	record := r.record
+	record.Status = run.Status
+	if run.Status != StatusCompleted {
+		record.Error = run.Reason
+	}
+	record.EndedAt = run.EndedAt
+	if record.EndedAt == nil {
+		now := time.Now()
+		record.EndedAt = &now
+	}
+	record.DurationMs = record.EndedAt.Sub(record.StartedAt).Milliseconds()
+	record.PromptTokens = tokens.PromptTokens
+	record.CompletionTokens = tokens.CompletionTokens
+	record.TotalTokens = tokens.TotalTokens
+	if record.Output == "" {
+		// Streamed runs answer with their last assistant message
+		for i := len(r.events) - 1; i >= 0; i-- {
+			if e := r.events[i]; e.Type == EventMessage && e.Role == string(schema.Assistant) {
+				record.Output = e.Content
+				break
+			}
+		}
+	}
+	events := r.events
+	r.mu.Unlock()
+
+	if r.history == nil {
+		return
+	}
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), saveTimeout)
+	defer cancel()
+	if err := r.history.Save(saveCtx, record, events); err != nil {
+		log.Printf("[Runs] Failed to record run %s: %v", record.ID, err)
+	}
+}
@@ -0,0 +1,277 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	runKeyPrefix  = "aicenter:run:"
+	cancelChannel = "aicenter:runs:cancel"
+
+	// runningTTL bounds how long a crashed replica leaves a run as running
+	runningTTL = 2 * time.Hour
+	// finishedTTL keeps finished runs visible to status queries for a while
+	finishedTTL = 10 * time.Minute
+	// redisTimeout bounds the Redis calls made while starting or finishing a run
+	redisTimeout = 2 * time.Second
+)
+
+var (
+	// ErrCancelled is the cause of the context of a cancelled run
+	ErrCancelled = errors.New("run cancelled")
+	// ErrNotFound is returned for runs that are unknown or belong to another project
+	ErrNotFound = errors.New("run not found")
+)
+
+// Status is the lifecycle state of a run
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Run is an agent execution tracked by the registry
+type Run struct {
+	ID        string     `json:"run_id"`
+	ProjectID uuid.UUID  `json:"project_id"`
+	SessionID string     `json:"session_id,omitempty"`
+	Status    Status     `json:"status"`
+	Reason    string     `json:"reason,omitempty"`
+	Replica   string     `json:"replica"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+
+	cancel context.CancelCauseFunc
+}
+
+// cancelMessage is published to cancel runs on every replica. It targets a
+// single run, or every run of a session when RunID is empty.
+type cancelMessage struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	RunID     string    `json:"run_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+type runKey struct{}
+
+// Registry tracks the in-flight runs of this replica. With a Redis client
+// runs are also visible to, and cancellable from, the other replicas.
+type Registry struct {
+	mu      sync.Mutex
+	runs    map[string]*Run
+	cli     *redis.Client
+	replica string
+}
+
+// NewRegistry creates a run registry, cli may be nil for a single replica
+func NewRegistry(cli *redis.Client) *Registry {
+	host, _ := os.Hostname()
+	return &Registry{
+		runs:    make(map[string]*Run),
+		cli:     cli,
+		replica: fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
+}
+
+// Start listens for cancellations published by other replicas until ctx is done
+func (r *Registry) Start(ctx context.Context) {
+	if r.cli == nil {
+		return
+	}
+
+	pubsub := r.cli.Subscribe(ctx, cancelChannel)
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			var m cancelMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				log.Printf("[Runs] Invalid cancel message: %v", err)
+				continue
+			}
+			r.cancelLocal(m)
+		}
+	}()
+}
+
+// FromContext returns the run the context belongs to
+func FromContext(ctx context.Context) *Run {
+	run, _ := ctx.Value(runKey{}).(*Run)
+	return run
+}
+
+// Cancelled reports whether the context belongs to a cancelled run
+func Cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrCancelled)
+}
+
+// Register starts tracking a run and returns its cancellable context. An
+// empty runID is generated.
+func (r *Registry) Register(ctx context.Context, runID string, projectID uuid.UUID, sessionID string) (context.Context, *Run) {
+	if runID == "" {
+		runID = uuid.New().String()
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	run := &Run{
+		ID:        runID,
+		ProjectID: projectID,
+		SessionID: sessionID,
+		Status:    StatusRunning,
+		Replica:   r.replica,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+	}
+
+	r.mu.Lock()
+	r.runs[runID] = run
+	r.mu.Unlock()
+
+	r.store(run, runningTTL)
+	return context.WithValue(ctx, runKey{}, run), run
+}
+
+// Finish stops tracking a run and records how it ended
+func (r *Registry) Finish(run *Run, err error) {
+	r.mu.Lock()
+	delete(r.runs, run.ID)
+	now := time.Now()
+	run.EndedAt = &now
+	switch {
+	case run.Status == StatusCancelled:
+	case err != nil:
+		run.Status = StatusFailed
+		run.Reason = err.Error()
+	default:
+		run.Status = StatusCompleted
+	}
+	r.mu.Unlock()
+
+	run.cancel(nil)
+	r.store(run, finishedTTL)
+}
+
+// Get returns a run of the project, in flight on any replica or recently finished
+func (r *Registry) Get(ctx context.Context, projectID uuid.UUID, runID string) (*Run, error) {
+	r.mu.Lock()
+	if run, ok := r.runs[runID]; ok && run.ProjectID == projectID {
+		snapshot := *run
+		r.mu.Unlock()
+		return &snapshot, nil
+	}
+	r.mu.Unlock()
+
+	if r.cli == nil {
+		return nil, ErrNotFound
+	}
+
+	data, err := r.cli.Get(ctx, runKeyPrefix+runID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+	if run.ProjectID != projectID {
+		return nil, ErrNotFound
+	}
+	return &run, nil
+}
+
+// Cancel stops a run of the project. It returns false when the run has
+// already finished.
+func (r *Registry) Cancel(ctx context.Context, projectID uuid.UUID, runID, reason string) (bool, error) {
+	run, err := r.Get(ctx, projectID, runID)
+	if err != nil {
+		return false, err
+	}
+	if run.Status != StatusRunning {
+		return false, nil
+	}
+
+	m := cancelMessage{ProjectID: projectID, RunID: runID, Reason: reason}
+	if run.Replica == r.replica {
+		return r.cancelLocal(m) > 0, nil
+	}
+	return true, r.publish(ctx, m)
+}
+
+// CancelSession stops every run of a session, e.g. when staff take over the
+// conversation. It returns the number of runs cancelled on this replica.
+func (r *Registry) CancelSession(ctx context.Context, projectID uuid.UUID, sessionID, reason string) (int, error) {
+	m := cancelMessage{ProjectID: projectID, SessionID: sessionID, Reason: reason}
+	cancelled := r.cancelLocal(m)
+	if r.cli == nil {
+		return cancelled, nil
+	}
+	return cancelled, r.publish(ctx, m)
+}
+
+// cancelLocal cancels the matching runs of this replica
+func (r *Registry) cancelLocal(m cancelMessage) int {
+	r.mu.Lock()
+	var matched []*Run
+	for _, run := range r.runs {
+		if run.ProjectID != m.ProjectID || run.Status != StatusRunning {
+			continue
+		}
+		if (m.RunID != "" && run.ID == m.RunID) || (m.RunID == "" && m.SessionID != "" && run.SessionID == m.SessionID) {
+			run.Status = StatusCancelled
+			run.Reason = m.Reason
+			matched = append(matched, run)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, run := range matched {
+		log.Printf("[Runs] Cancelling run %s (session=%s): %s", run.ID, run.SessionID, m.Reason)
+		run.cancel(ErrCancelled)
+	}
+	return len(matched)
+}
+
+func (r *Registry) publish(ctx context.Context, m cancelMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return r.cli.Publish(ctx, cancelChannel, data).Err()
+}
+
+// store saves the run state for other replicas, failures only degrade
+// cross-replica cancellation so they are logged
+func (r *Registry) store(run *Run, ttl time.Duration) {
+	if r.cli == nil {
+		return
+	}
+
+	r.mu.Lock()
+	data, err := json.Marshal(run)
+	r.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.cli.Set(ctx, runKeyPrefix+run.ID, data, ttl).Err(); err != nil {
+		log.Printf("[Runs] Failed to store run %s: %v", run.ID, err)
+	}
+}
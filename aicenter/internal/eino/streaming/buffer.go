@@ -0,0 +1,382 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	streamKeyPrefix = "aicenter:stream:"
+	// bufferTTL keeps the events of a session resumable after it ends
+	bufferTTL = time.Hour
+	// bufferTimeout bounds each Redis call made while emitting
+	bufferTimeout = 2 * time.Second
+	// ownerTTL is how long a session is considered running without news of
+	// the replica running it, which refreshes it every heartbeatInterval
+	ownerTTL          = 30 * time.Second
+	heartbeatInterval = 10 * time.Second
+	// followPollInterval is how often followers reread the buffered events,
+	// in case live ones were missed, and check that the session is running
+	followPollInterval = 10 * time.Second
+)
+
+// Error codes of the failed event ending a stream that cannot be followed
+const (
+	// ErrCodeEventsExpired means events after the last received one are no
+	// longer buffered, the run has to be fetched again
+	ErrCodeEventsExpired = "events_expired"
+	// ErrCodeStreamLost means the replica running the session stopped
+	// without ending it
+	ErrCodeStreamLost = "stream_lost"
+)
+
+// Buffer keeps the events of sessions so that subscribers on any replica can
+// catch up on the events they missed and follow the live ones
+type Buffer interface {
+	// Open records the project a session belongs to
+	Open(ctx context.Context, requestID string, projectID uuid.UUID) error
+	// Append stores and publishes events of the session, in order, and
+	// marks the session as running
+	Append(ctx context.Context, requestID string, events []Event) error
+	// KeepAlive marks the session as running
+	KeepAlive(ctx context.Context, requestID string) error
+	// Project returns the project of a session, ErrSessionNotFound if unknown
+	Project(ctx context.Context, requestID string) (uuid.UUID, error)
+	// Follow returns the events after lastID, then the live ones until the
+	// terminal event or until ctx is done. When events after lastID are no
+	// longer buffered, or the session stops without ending, the channel
+	// yields a failed event and a done event instead.
+	Follow(ctx context.Context, requestID string, lastID int64) (<-chan Event, error)
+}
+
+// RedisBuffer is a Buffer backed by a Redis list per session, live events
+// are published on a channel per session
+type RedisBuffer struct {
+	cli       *redis.Client
+	maxEvents int64
+}
+
+// NewRedisBuffer creates a Redis backed buffer keeping up to maxEvents events
+// per session
+func NewRedisBuffer(cli *redis.Client, maxEvents int) *RedisBuffer {
+	return &RedisBuffer{cli: cli, maxEvents: int64(maxEvents)}
+}
+
+func (b *RedisBuffer) projectKey(requestID string) string {
+	return streamKeyPrefix + requestID + ":project"
+}
+
+func (b *RedisBuffer) eventsKey(requestID string) string {
+	return streamKeyPrefix + requestID + ":events"
+}
+
+func (b *RedisBuffer) ownerKey(requestID string) string {
+	return streamKeyPrefix + requestID + ":owner"
+}
+
+func (b *RedisBuffer) channel(requestID string) string {
+	return streamKeyPrefix + requestID
+}
+
+// Open records the project a session belongs to
+func (b *RedisBuffer) Open(ctx context.Context, requestID string, projectID uuid.UUID) error {
+	pipe := b.cli.TxPipeline()
+	pipe.Set(ctx, b.projectKey(requestID), projectID.String(), bufferTTL)
+	pipe.Set(ctx, b.ownerKey(requestID), 1, ownerTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Append stores and publishes events of the session
+func (b *RedisBuffer) Append(ctx context.Context, requestID string, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	data := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		d, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		data = append(data, d)
+	}
+
+	key := b.eventsKey(requestID)
+	pipe := b.cli.TxPipeline()
+	pipe.RPush(ctx, key, data...)
+	pipe.LTrim(ctx, key, -b.maxEvents, -1)
+	pipe.Expire(ctx, key, bufferTTL)
+	pipe.Expire(ctx, b.projectKey(requestID), bufferTTL)
+	pipe.Set(ctx, b.ownerKey(requestID), 1, ownerTTL)
+	for _, d := range data {
+		pipe.Publish(ctx, b.channel(requestID), d)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// KeepAlive marks the session as running
+func (b *RedisBuffer) KeepAlive(ctx context.Context, requestID string) error {
+	return b.cli.Set(ctx, b.ownerKey(requestID), 1, ownerTTL).Err()
+}
+
+// Project returns the project of a session
+func (b *RedisBuffer) Project(ctx context.Context, requestID string) (uuid.UUID, error) {
+	v, err := b.cli.Get(ctx, b.projectKey(requestID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return uuid.Nil, ErrSessionNotFound
+		}
+		return uuid.Nil, err
+	}
+	return uuid.Parse(v)
+}
+
+// buffered reads the events buffered for a session
+func (b *RedisBuffer) buffered(ctx context.Context, requestID string) ([]Event, error) {
+	raw, err := b.cli.LRange(ctx, b.eventsKey(requestID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(raw))
+	for _, data := range raw {
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			log.Printf("[Streaming] Invalid buffered event of %s: %v", requestID, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Follow returns the events after lastID, then the live ones until the
+// terminal event or until ctx is done
+func (b *RedisBuffer) Follow(ctx context.Context, requestID string, lastID int64) (<-chan Event, error) {
+	// Subscribe before reading the list so no event falls in between
+	pubsub := b.cli.Subscribe(ctx, b.channel(requestID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	events, err := b.buffered(ctx, requestID)
+	if err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	ch := make(chan Event, subscriberBufferSize)
+	go func() {
+		defer close(ch)
+		defer pubsub.Close()
+
+		f := &follower{ch: ch, runID: requestID, lastID: lastID}
+		if !f.catchUp(ctx, events) {
+			return
+		}
+		live := pubsub.Channel()
+		poll := time.NewTicker(followPollInterval)
+		defer poll.Stop()
+		for {
+			select {
+			case msg, ok := <-live:
+				if !ok {
+					return
+				}
+				var event Event
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					log.Printf("[Streaming] Invalid live event of %s: %v", requestID, err)
+					continue
+				}
+				if event.ID <= f.lastID+1 {
+					if !f.send(ctx, event) {
+						return
+					}
+					continue
+				}
+				// Live events were missed, they are in the list
+				if events, err = b.buffered(ctx, requestID); err == nil && !f.catchUp(ctx, events) {
+					return
+				}
+			case <-poll.C:
+				if events, err = b.buffered(ctx, requestID); err != nil {
+					continue
+				}
+				if !f.catchUp(ctx, events) {
+					return
+				}
+				if n, err := b.cli.Exists(ctx, b.ownerKey(requestID)).Result(); err == nil && n == 0 {
+					f.end(ctx, "the run stopped without ending its stream", ErrCodeStreamLost)
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// follower sends the events of a session after the last one it sent
+type follower struct {
+	ch     chan<- Event
+	runID  string
+	lastID int64
+}
+
+// send sends an event after lastID, it returns false once the terminal event
+// was sent or ctx is done
+func (f *follower) send(ctx context.Context, event Event) bool {
+	if event.ID <= f.lastID {
+		return true
+	}
+	f.lastID = event.ID
+	select {
+	case f.ch <- event:
+	case <-ctx.Done():
+		return false
+	}
+	return !event.Terminal()
+}
+
+// catchUp sends the buffered events after lastID, it returns false when the
+// stream is over: the terminal event was sent before or now, or events
+// after lastID were trimmed from the buffer
+func (f *follower) catchUp(ctx context.Context, events []Event) bool {
+	if len(events) > 0 && events[0].ID > f.lastID+1 {
+		f.end(ctx, "events after the last received one are no longer available", ErrCodeEventsExpired)
+		return false
+	}
+	for _, event := range events {
+		if event.ID <= f.lastID {
+			if event.Terminal() {
+				return false
+			}
+			continue
+		}
+		if !f.send(ctx, event) {
+			return false
+		}
+	}
+	return true
+}
+
+// end ends a stream that cannot be followed with a failed and a done event,
+// numbered as the last event sent so that resuming does not skip any
+func (f *follower) end(ctx context.Context, message, code string) {
+	for _, event := range []Event{NewFailedEvent(message, code, nil), NewDoneEvent(f.runID)} {
+		event.ID = f.lastID
+		select {
+		case f.ch <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// bufferWriter writes the events of a session to its Buffer in order and off
+// the goroutine emitting them. Events emitted while a write is running are
+// written together by the next one. While the session is running, the
+// buffer is told so every heartbeatInterval.
+type bufferWriter struct {
+	buffer    Buffer
+	requestID string
+	// maxEvents bounds the pending events, the older ones would be trimmed
+	// from the buffer anyway
+	maxEvents int
+
+	mu      sync.Mutex
+	pending []Event
+	closed  bool
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func newBufferWriter(buffer Buffer, requestID string, maxEvents int) *bufferWriter {
+	w := &bufferWriter{
+		buffer:    buffer,
+		requestID: requestID,
+		maxEvents: maxEvents,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// add queues an event, the writer stops after writing a terminal event
+func (w *bufferWriter) add(event Event) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.pending = append(w.pending, event)
+	if w.maxEvents > 0 && len(w.pending) > w.maxEvents {
+		w.pending = append([]Event(nil), w.pending[len(w.pending)-w.maxEvents:]...)
+	}
+	if event.Terminal() {
+		w.closed = true
+	}
+	w.mu.Unlock()
+	w.signal()
+}
+
+// close stops the writer once the queued events are written
+func (w *bufferWriter) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.signal()
+}
+
+func (w *bufferWriter) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *bufferWriter) run() {
+	defer close(w.done)
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-w.wake:
+		case <-heartbeat.C:
+			ctx, cancel := context.WithTimeout(context.Background(), bufferTimeout)
+			if err := w.buffer.KeepAlive(ctx, w.requestID); err != nil {
+				log.Printf("[Streaming] Failed to refresh session %s: %v", w.requestID, err)
+			}
+			cancel()
+			continue
+		}
+
+		w.mu.Lock()
+		batch, closed := w.pending, w.closed
+		w.pending = nil
+		w.mu.Unlock()
+
+		if len(batch) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), bufferTimeout)
+			if err := w.buffer.Append(ctx, w.requestID, batch); err != nil {
+				log.Printf("[Streaming] Failed to buffer events %d-%d of %s: %v", batch[0].ID, batch[len(batch)-1].ID, w.requestID, err)
+			}
+			cancel()
+		}
+		if closed {
+			return
+		}
+	}
+}
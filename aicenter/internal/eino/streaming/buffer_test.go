@@ -0,0 +1,156 @@
+package streaming
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// recordingBuffer records the batches appended to it, each Append blocks
+// until release is closed
+type recordingBuffer struct {
+	mu      sync.Mutex
+	batches [][]Event
+	release chan struct{}
+}
+
+func (b *recordingBuffer) Open(context.Context, string, uuid.UUID) error { return nil }
+
+func (b *recordingBuffer) Append(_ context.Context, _ string, events []Event) error {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, events)
+	return nil
+}
+
+func (b *recordingBuffer) KeepAlive(context.Context, string) error { return nil }
+
+func (b *recordingBuffer) Project(context.Context, string) (uuid.UUID, error) {
+	return uuid.Nil, ErrSessionNotFound
+}
+
+func (b *recordingBuffer) Follow(context.Context, string, int64) (<-chan Event, error) {
+	return nil, ErrSessionNotFound
+}
+
+func TestSessionWritesEventsInOrderInBatches(t *testing.T) {
+	buffer := &recordingBuffer{release: make(chan struct{})}
+	m := NewManager(nil)
+	m.SetBuffer(buffer)
+	session := m.CreateSession("run-1", uuid.New())
+
+	// Emitting does not wait for the buffer
+	for i := 0; i < 50; i++ {
+		session.Emit(NewMessageEvent("agent", "delta"))
+	}
+	session.Emit(NewDoneEvent("run-1"))
+	close(buffer.release)
+
+	select {
+	case <-session.writer.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the writer did not stop after the terminal event")
+	}
+
+	var ids []int64
+	for _, batch := range buffer.batches {
+		for _, event := range batch {
+			ids = append(ids, event.ID)
+		}
+	}
+	if len(ids) != 51 {
+		t.Fatalf("buffered %d events, want 51", len(ids))
+	}
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Fatalf("buffered event %d has ID %d, want %d", i, id, i+1)
+		}
+	}
+	if len(buffer.batches) >= len(ids) {
+		t.Errorf("the events were written in %d batches, want them batched", len(buffer.batches))
+	}
+}
+
+func TestBufferWriterKeepsLatestEvents(t *testing.T) {
+	buffer := &recordingBuffer{release: make(chan struct{})}
+	w := newBufferWriter(buffer, "run-1", 3)
+	for i := int64(1); i <= 10; i++ {
+		w.add(Event{ID: i, Type: EventTypeMessage})
+	}
+	w.close()
+	close(buffer.release)
+	<-w.done
+
+	var ids []int64
+	for _, batch := range buffer.batches {
+		for _, event := range batch {
+			ids = append(ids, event.ID)
+		}
+	}
+	// The first event may be taken before the others are queued
+	if n := len(ids); n < 3 || ids[n-3] != 8 || ids[n-1] != 10 {
+		t.Errorf("buffered events %v, want them to end with 8, 9, 10", ids)
+	}
+}
+
+func TestFollowerCatchUp(t *testing.T) {
+	events := func(ids ...int64) []Event {
+		out := make([]Event, 0, len(ids))
+		for _, id := range ids {
+			out = append(out, Event{ID: id, Type: EventTypeMessage})
+		}
+		return out
+	}
+	done := Event{ID: 4, Type: EventTypeDone}
+
+	tests := []struct {
+		name     string
+		buffered []Event
+		lastID   int64
+		want     []int64
+		wantCode string
+		wantMore bool
+	}{
+		{name: "from the start", buffered: events(1, 2, 3), want: []int64{1, 2, 3}, wantMore: true},
+		{name: "after the last received", buffered: events(1, 2, 3), lastID: 2, want: []int64{3}, wantMore: true},
+		{name: "nothing buffered yet", lastID: 0, wantMore: true},
+		{name: "terminal event", buffered: append(events(1, 2, 3), done), lastID: 2, want: []int64{3, 4}},
+		{name: "terminal event already received", buffered: append(events(1, 2, 3), done), lastID: 4},
+		{name: "trimmed events", buffered: events(5, 6), lastID: 2, want: []int64{2, 2}, wantCode: ErrCodeEventsExpired},
+		{name: "trimmed from the start", buffered: events(5, 6), want: []int64{0, 0}, wantCode: ErrCodeEventsExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan Event, 16)
+			f := &follower{ch: ch, runID: "run-1", lastID: tt.lastID}
+			more := f.catchUp(context.Background(), tt.buffered)
+			close(ch)
+			if more != tt.wantMore {
+				t.Errorf("catchUp() = %v, want %v", more, tt.wantMore)
+			}
+
+			var got []Event
+			for event := range ch {
+				got = append(got, event)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("catchUp() sent %d events, want %v", len(got), tt.want)
+			}
+			for i, event := range got {
+				if event.ID != tt.want[i] {
+					t.Errorf("event %d has ID %d, want %d", i, event.ID, tt.want[i])
+				}
+			}
+			if tt.wantCode != "" {
+				if got[0].Type != EventTypeFailed || got[0].Code != tt.wantCode || !got[1].Terminal() {
+					t.Errorf("catchUp() sent %+v, want a %s failed event and a terminal event", got, tt.wantCode)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package streaming
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -9,24 +10,72 @@ type EventType string
 
 const (
 	EventTypeMessage    EventType = "message"
+	EventTypeMessageEnd EventType = "message_end"
 	EventTypeToolCall   EventType = "tool_call"
 	EventTypeToolResult EventType = "tool_result"
 	EventTypeTransfer   EventType = "transfer"
-	EventTypeError      EventType = "error"
-	EventTypeComplete   EventType = "complete"
-	EventTypePing       EventType = "ping"
+	EventTypeExit       EventType = "exit"
+	// EventTypeApprovalRequired reports the run paused on tool calls waiting
+	// for approval
+	EventTypeApprovalRequired EventType = "approval_required"
+	// EventTypeOutput carries the answer of a run decoded as its output schema
+	EventTypeOutput EventType = "output"
+	// EventTypePlan reports the plan of a plan-execute team, sent again each
+	// time the plan is revised
+	EventTypePlan EventType = "plan"
+	// EventTypeStep reports a plan step starting or completing
+	EventTypeStep     EventType = "step"
+	EventTypeError    EventType = "error"
+	EventTypeComplete EventType = "complete"
+	EventTypePing     EventType = "ping"
+
+	// EventTypeConsensus reports whether the agents of a run requiring
+	// consensus agreed, and the conflicts found between their answers
+	EventTypeConsensus EventType = "consensus"
+
+	// Lifecycle events of a run, each is sent as its own SSE event
+	EventTypeConnected EventType = "connected"
+	EventTypeCancelled EventType = "cancelled"
+	EventTypeFailed    EventType = "failed"
+	EventTypeDone      EventType = "done"
 )
 
 // Event represents a streaming event
 type Event struct {
+	// ID orders the events of a session, it is sent as the SSE event id
+	ID        int64                  `json:"id,omitempty"`
 	Type      EventType              `json:"type"`
 	Timestamp time.Time              `json:"timestamp"`
+	RunID     string                 `json:"run_id,omitempty"`
+	Status    string                 `json:"status,omitempty"`
 	AgentName string                 `json:"agent_name,omitempty"`
+	MessageID string                 `json:"message_id,omitempty"`
+	Role      string                 `json:"role,omitempty"`
+	Delta     bool                   `json:"delta,omitempty"`
 	Content   string                 `json:"content,omitempty"`
 	Error     string                 `json:"error,omitempty"`
+	Code      string                 `json:"code,omitempty"`
+	Details   interface{}            `json:"details,omitempty"`
 	Data      map[string]interface{} `json:"data,omitempty"`
 }
 
+// SSEName returns the SSE event name of the event: lifecycle events use their
+// type, agent events are all sent as "event"
+func (e Event) SSEName() string {
+	switch e.Type {
+	case EventTypeConnected, EventTypeCancelled, EventTypeDone:
+		return string(e.Type)
+	case EventTypeFailed:
+		return "error"
+	}
+	return "event"
+}
+
+// Terminal reports whether no event follows e in its session
+func (e Event) Terminal() bool {
+	return e.Type == EventTypeDone || e.Type == EventTypeCancelled
+}
+
 // NewMessageEvent creates a new message event
 func NewMessageEvent(agentName, content string) Event {
 	return Event{
@@ -38,29 +87,39 @@ func NewMessageEvent(agentName, content string) Event {
 }
 
 // NewToolCallEvent creates a new tool call event
-func NewToolCallEvent(agentName, toolName string, args map[string]interface{}) Event {
+func NewToolCallEvent(agentName, toolName, toolCallID string, args map[string]interface{}) Event {
 	return Event{
 		Type:      EventTypeToolCall,
 		Timestamp: time.Now(),
 		AgentName: agentName,
 		Data: map[string]interface{}{
-			"tool_name": toolName,
-			"arguments": args,
+			"tool_name":    toolName,
+			"tool_call_id": toolCallID,
+			"arguments":    args,
 		},
 	}
 }
 
-// NewToolResultEvent creates a new tool result event
-func NewToolResultEvent(agentName, toolName, result string) Event {
-	return Event{
+// NewToolResultEvent creates a new tool result event, the result is truncated
+// to MaxToolResultLength characters
+func NewToolResultEvent(agentName, toolName, toolCallID, result string, duration time.Duration, err error) Event {
+	result, truncated := truncate(result, MaxToolResultLength)
+	event := Event{
 		Type:      EventTypeToolResult,
 		Timestamp: time.Now(),
 		AgentName: agentName,
 		Data: map[string]interface{}{
-			"tool_name": toolName,
-			"result":    result,
+			"tool_name":    toolName,
+			"tool_call_id": toolCallID,
+			"result":       result,
+			"truncated":    truncated,
+			"duration_ms":  duration.Milliseconds(),
 		},
 	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	return event
 }
 
 // NewTransferEvent creates a new transfer event
@@ -70,7 +129,89 @@ func NewTransferEvent(fromAgent, toAgent string) Event {
 		Timestamp: time.Now(),
 		AgentName: fromAgent,
 		Data: map[string]interface{}{
-			"to_agent": toAgent,
+			"from_agent": fromAgent,
+			"to_agent":   toAgent,
+		},
+	}
+}
+
+// NewApprovalRequiredEvent creates an event for a run paused on tool calls
+// waiting for approval, content tells the user to wait for staff
+func NewApprovalRequiredEvent(agentName, content string, approvals []map[string]interface{}) Event {
+	return Event{
+		Type:      EventTypeApprovalRequired,
+		Timestamp: time.Now(),
+		AgentName: agentName,
+		Content:   content,
+		Data: map[string]interface{}{
+			"approvals": approvals,
+		},
+	}
+}
+
+// NewOutputEvent creates an output event, data conforms to the output schema
+// of the run
+func NewOutputEvent(agentName string, data json.RawMessage) Event {
+	return Event{
+		Type:      EventTypeOutput,
+		Timestamp: time.Now(),
+		AgentName: agentName,
+		Data: map[string]interface{}{
+			"data": data,
+		},
+	}
+}
+
+// Status of the plan steps in step events
+const (
+	StepStarted   = "started"
+	StepCompleted = "completed"
+)
+
+// NewPlanEvent creates a plan event, steps are the steps left to execute
+// after the completed ones. revision counts the plans of the run from 1.
+func NewPlanEvent(agentName string, steps []string, revision, completed int) Event {
+	return Event{
+		Type:      EventTypePlan,
+		Timestamp: time.Now(),
+		AgentName: agentName,
+		Data: map[string]interface{}{
+			"steps":     steps,
+			"revision":  revision,
+			"completed": completed,
+		},
+	}
+}
+
+// NewStepEvent creates a step event, index numbers the executed steps of the
+// run from 1 and result is set once the step completed
+func NewStepEvent(agentName string, index int, step, status, result string) Event {
+	data := map[string]interface{}{
+		"index": index,
+		"step":  step,
+	}
+	if result != "" {
+		data["result"] = result
+	}
+	return Event{
+		Type:      EventTypeStep,
+		Timestamp: time.Now(),
+		AgentName: agentName,
+		Status:    status,
+		Data:      data,
+	}
+}
+
+// NewConsensusEvent creates a consensus event, status is "reached",
+// "conflict" or "escalated"
+func NewConsensusEvent(agentName, status string, consensus interface{}) Event {
+	return Event{
+		Type:      EventTypeConsensus,
+		Timestamp: time.Now(),
+		AgentName: agentName,
+		Status:    status,
+		Data: map[string]interface{}{
+			"consensus": consensus,
 		},
 	}
 }
@@ -101,3 +242,45 @@ func NewPingEvent() Event {
 		Timestamp: time.Now(),
 	}
 }
+
+// NewConnectedEvent creates the first event of a run stream
+func NewConnectedEvent(runID string) Event {
+	return Event{
+		Type:      EventTypeConnected,
+		Timestamp: time.Now(),
+		RunID:     runID,
+		Status:    "connected",
+	}
+}
+
+// NewCancelledEvent creates the last event of a cancelled run
+func NewCancelledEvent(runID string) Event {
+	return Event{
+		Type:      EventTypeCancelled,
+		Timestamp: time.Now(),
+		RunID:     runID,
+		Status:    "cancelled",
+	}
+}
+
+// NewFailedEvent creates the event of a run that failed, it is followed by
+// the done event
+func NewFailedEvent(err, code string, details interface{}) Event {
+	return Event{
+		Type:      EventTypeFailed,
+		Timestamp: time.Now(),
+		Error:     err,
+		Code:      code,
+		Details:   details,
+	}
+}
+
+// NewDoneEvent creates the last event of a run that was not cancelled
+func NewDoneEvent(runID string) Event {
+	return Event{
+		Type:      EventTypeDone,
+		Timestamp: time.Now(),
+		RunID:     runID,
+		Status:    "done",
+	}
+}
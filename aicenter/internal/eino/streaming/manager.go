@@ -2,6 +2,7 @@ package streaming
 
 import (
 	"context"
+	"log"
 	"sync"
 	"time"
 
@@ -16,6 +17,8 @@ type ManagerConfig struct {
 	InactiveTimeout time.Duration
 	// CleanupInterval is the interval for running cleanup
 	CleanupInterval time.Duration
+	// BufferSize is the number of events kept per session for resuming subscribers
+	BufferSize int
 }
 
 // DefaultManagerConfig returns default configuration
@@ -24,6 +27,7 @@ func DefaultManagerConfig() *ManagerConfig {
 		SessionTimeout:  time.Hour,
 		InactiveTimeout: 10 * time.Minute,
 		CleanupInterval: 5 * time.Minute,
+		BufferSize:      1000,
 	}
 }
 
@@ -36,6 +40,9 @@ type Manager struct {
 	// Maps request ID to session ID for lookup
 	requestToSession map[string]string
 
+	// buffer shares the session events with the other replicas, may be nil
+	buffer Buffer
+
 	stopCleanup chan struct{}
 	wg          sync.WaitGroup
 }
@@ -54,6 +61,14 @@ func NewManager(config *ManagerConfig) *Manager {
 	}
 }
 
+// SetBuffer shares the events of the sessions created from now on through b,
+// so they can be resumed on any replica
+func (m *Manager) SetBuffer(b Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buffer = b
+}
+
 // Start starts the stream manager background tasks
 func (m *Manager) Start() {
 	m.wg.Add(1)
@@ -82,9 +97,21 @@ func (m *Manager) CreateSession(requestID string, projectID uuid.UUID) *Session
 	defer m.mu.Unlock()
 
 	session := NewSession(requestID, projectID)
+	if m.config.BufferSize > 0 {
+		session.bufferSize = m.config.BufferSize
+	}
 	m.sessions[session.ID] = session
 	m.requestToSession[requestID] = session.ID
 
+	if m.buffer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), bufferTimeout)
+		defer cancel()
+		if err := m.buffer.Open(ctx, requestID, projectID); err != nil {
+			log.Printf("[Streaming] Failed to share session %s: %v", requestID, err)
+		}
+		session.writer = newBufferWriter(m.buffer, requestID, session.bufferSize)
+	}
+
 	return session
 }
 
@@ -256,3 +283,60 @@ func (m *Manager) Unsubscribe(sessionID, subscriberID string) {
 		session.RemoveSubscriber(subscriberID)
 	}
 }
+
+// Resume follows the session of a request of the project, on this replica or,
+// with a buffer, on any other one. The returned channel yields the events
+// after lastID, then the live ones, and is closed when the session ends, when
+// ctx is done, or when the subscriber falls too far behind; in that case the
+// caller resumes from the last event it received.
+func (m *Manager) Resume(ctx context.Context, requestID string, projectID uuid.UUID, lastID int64) (<-chan Event, error) {
+	if session, ok := m.GetSessionByRequest(requestID); ok {
+		if session.ProjectID != projectID {
+			return nil, ErrSessionNotFound
+		}
+		subscriberID := uuid.New().String()
+		if missed, live, ok := session.Resume(subscriberID, lastID); ok {
+			ch := make(chan Event)
+			go func() {
+				defer close(ch)
+				defer session.RemoveSubscriber(subscriberID)
+				for _, event := range missed {
+					select {
+					case ch <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+				for {
+					select {
+					case event, ok := <-live:
+						if !ok {
+							return
+						}
+						select {
+						case ch <- event:
+						case <-ctx.Done():
+							return
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return ch, nil
+		}
+	}
+
+	// Started on another replica, or no longer buffered locally
+	if m.buffer == nil {
+		return nil, ErrSessionNotFound
+	}
+	owner, err := m.buffer.Project(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if owner != projectID {
+		return nil, ErrSessionNotFound
+	}
+	return m.buffer.Follow(ctx, requestID, lastID)
+}
@@ -33,8 +33,15 @@ type Session struct {
 	subscribers map[string]chan Event
 	eventBuffer []Event
 	bufferSize  int
+	// writer buffers the events for subscribers of other replicas, may be
+	// nil
+	writer *bufferWriter
 }
 
+// subscriberBufferSize is the number of events a subscriber may lag behind
+// before it is dropped and has to resume
+const subscriberBufferSize = 256
+
 // NewSession creates a new streaming session
 func NewSession(requestID string, projectID uuid.UUID) *Session {
 	now := time.Now()
@@ -56,7 +63,7 @@ func (s *Session) AddSubscriber(subscriberID string) <-chan Event {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	ch := make(chan Event, 50)
+	ch := make(chan Event, subscriberBufferSize)
 	s.subscribers[subscriberID] = ch
 	s.LastActivity = time.Now()
 	return ch
@@ -88,13 +95,16 @@ func (s *Session) SubscriberCount() int {
 	return len(s.subscribers)
 }
 
-// Emit sends an event to all subscribers
+// Emit numbers an event and sends it to all subscribers. A subscriber too
+// slow to keep up is dropped, it resumes from the last event it received.
+// The event is queued for the buffer of the session, which writes it in the
+// background.
 func (s *Session) Emit(event Event) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 
 	s.LastActivity = time.Now()
 	s.MessageCount++
+	event.ID = int64(s.MessageCount)
 
 	// Buffer the event
 	if len(s.eventBuffer) >= s.bufferSize {
@@ -103,13 +113,44 @@ func (s *Session) Emit(event Event) {
 	s.eventBuffer = append(s.eventBuffer, event)
 
 	// Send to all subscribers
-	for _, ch := range s.subscribers {
+	for id, ch := range s.subscribers {
 		select {
 		case ch <- event:
 		default:
-			// Channel full, skip
+			close(ch)
+			delete(s.subscribers, id)
 		}
 	}
+	if s.writer != nil {
+		s.writer.add(event)
+	}
+	s.mu.Unlock()
+}
+
+// Resume returns the buffered events after lastID and, while the session is
+// active, subscribes to the following ones. ok is false when events after
+// lastID are no longer buffered.
+func (s *Session) Resume(subscriberID string, lastID int64) (missed []Event, ch <-chan Event, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.eventBuffer) > 0 && s.eventBuffer[0].ID > lastID+1 {
+		return nil, nil, false
+	}
+	for _, event := range s.eventBuffer {
+		if event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+
+	sub := make(chan Event, subscriberBufferSize)
+	if s.State == SessionStateActive {
+		s.subscribers[subscriberID] = sub
+	} else {
+		close(sub)
+	}
+	s.LastActivity = time.Now()
+	return missed, sub, true
 }
 
 // Complete marks the session as complete
@@ -125,6 +166,9 @@ func (s *Session) Complete() {
 		close(ch)
 		delete(s.subscribers, id)
 	}
+	if s.writer != nil {
+		s.writer.close()
+	}
 }
 
 // Cancel marks the session as canceled
@@ -140,6 +184,9 @@ func (s *Session) Cancel() {
 		close(ch)
 		delete(s.subscribers, id)
 	}
+	if s.writer != nil {
+		s.writer.close()
+	}
 }
 
 // SetError marks the session as errored
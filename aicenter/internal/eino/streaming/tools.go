@@ -0,0 +1,136 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	template "github.com/cloudwego/eino/utils/callbacks"
+)
+
+// MaxToolResultLength is the number of characters of a tool result sent to
+// clients, longer results are truncated
+const MaxToolResultLength = 1000
+
+// Emitter receives the events produced while a run executes. It may be called
+// from several goroutines, e.g. for tools running in parallel.
+type Emitter func(event Event)
+
+type emitterKey struct{}
+type agentKey struct{}
+type toolStartKey struct{}
+
+// WithEmitter attaches an emitter to ctx, the tool calls made with ctx are
+// reported to it
+func WithEmitter(ctx context.Context, emit Emitter) context.Context {
+	return context.WithValue(ctx, emitterKey{}, emit)
+}
+
+func emitterFromContext(ctx context.Context) Emitter {
+	emit, _ := ctx.Value(emitterKey{}).(Emitter)
+	return emit
+}
+
+// NewToolCallbackHandler returns an eino callback handler that reports every
+// tool invocation to the emitter of its context. Register it with
+// callbacks.AppendGlobalHandlers.
+func NewToolCallbackHandler() callbacks.Handler {
+	graphHandler := callbacks.NewHandlerBuilder().
+		OnStartFn(onGraphStart).
+		Build()
+
+	return template.NewHandlerHelper().
+		Tool(&template.ToolCallbackHandler{
+			OnStart: onToolStart,
+			OnEnd:   onToolEnd,
+			OnError: onToolError,
+		}).
+		Graph(graphHandler).
+		Handler()
+}
+
+// onGraphStart tags the context with the agent whose graph is starting;
+// ADK agents compile their graph under the agent name
+func onGraphStart(ctx context.Context, info *callbacks.RunInfo, _ callbacks.CallbackInput) context.Context {
+	if emitterFromContext(ctx) == nil || info == nil || info.Name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, agentKey{}, info.Name)
+}
+
+func onToolStart(ctx context.Context, info *callbacks.RunInfo, input *tool.CallbackInput) context.Context {
+	emit := emitterFromContext(ctx)
+	if emit == nil {
+		return ctx
+	}
+
+	var args map[string]interface{}
+	if input != nil && input.ArgumentsInJSON != "" {
+		if err := json.Unmarshal([]byte(input.ArgumentsInJSON), &args); err != nil {
+			args = map[string]interface{}{"input": input.ArgumentsInJSON}
+		}
+	}
+	emit(NewToolCallEvent(agentName(ctx), toolName(info), compose.GetToolCallID(ctx), args))
+	return context.WithValue(ctx, toolStartKey{}, time.Now())
+}
+
+func onToolEnd(ctx context.Context, info *callbacks.RunInfo, output *tool.CallbackOutput) context.Context {
+	emit := emitterFromContext(ctx)
+	if emit == nil {
+		return ctx
+	}
+
+	var result string
+	if output != nil {
+		result = output.Response
+	}
+	emit(NewToolResultEvent(agentName(ctx), toolName(info), compose.GetToolCallID(ctx), result, toolDuration(ctx), nil))
+	return ctx
+}
+
+func onToolError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	emit := emitterFromContext(ctx)
+	if emit == nil {
+		return ctx
+	}
+	// An interrupted call, e.g. waiting for approval, has no result yet
+	if _, ok := compose.IsInterruptRerunError(err); ok {
+		return ctx
+	}
+
+	emit(NewToolResultEvent(agentName(ctx), toolName(info), compose.GetToolCallID(ctx), "", toolDuration(ctx), err))
+	return ctx
+}
+
+func agentName(ctx context.Context) string {
+	name, _ := ctx.Value(agentKey{}).(string)
+	return name
+}
+
+func toolName(info *callbacks.RunInfo) string {
+	if info == nil {
+		return ""
+	}
+	return info.Name
+}
+
+func toolDuration(ctx context.Context) time.Duration {
+	start, ok := ctx.Value(toolStartKey{}).(time.Time)
+	if !ok {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// truncate shortens s to max characters, reporting whether it did
+func truncate(s string, max int) (string, bool) {
+	if utf8.RuneCountInString(s) <= max {
+		return s, false
+	}
+	runes := []rune(s)
+	return string(runes[:max]), true
+}
@@ -0,0 +1,181 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// fakeTool answers every call with result, or fails with err
+type fakeTool struct {
+	result string
+	err    error
+}
+
+func (t *fakeTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: "lookup_order", Desc: "Looks up an order"}, nil
+}
+
+func (t *fakeTool) InvokableRun(context.Context, string, ...tool.Option) (string, error) {
+	return t.result, t.err
+}
+
+// toolGraph compiles a graph calling the tool, named like the graphs of ADK
+// agents are after their agent
+func toolGraph(t *testing.T, tl tool.InvokableTool, name string) compose.Runnable[*schema.Message, []*schema.Message] {
+	t.Helper()
+	ctx := context.Background()
+	node, err := compose.NewToolNode(ctx, &compose.ToolsNodeConfig{Tools: []tool.BaseTool{tl}})
+	if err != nil {
+		t.Fatalf("NewToolNode() error = %v", err)
+	}
+	g := compose.NewGraph[*schema.Message, []*schema.Message]()
+	_ = g.AddToolsNode("tools", node)
+	_ = g.AddEdge(compose.START, "tools")
+	_ = g.AddEdge("tools", compose.END)
+	runnable, err := g.Compile(ctx, compose.WithGraphName(name))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	return runnable
+}
+
+// toolCall is the assistant message calling lookup_order with arguments
+func toolCall(arguments string) *schema.Message {
+	return schema.AssistantMessage("", []schema.ToolCall{{
+		ID:       "call_1",
+		Function: schema.FunctionCall{Name: "lookup_order", Arguments: arguments},
+	}})
+}
+
+// callTool calls the tool in the graph of the support agent and returns the
+// events reported to the emitter of the run
+func callTool(t *testing.T, tl tool.InvokableTool, arguments string) ([]Event, error) {
+	t.Helper()
+	runnable := toolGraph(t, tl, "support")
+
+	var mu sync.Mutex
+	var events []Event
+	ctx := WithEmitter(context.Background(), func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+	_, err := runnable.Invoke(ctx, toolCall(arguments), compose.WithCallbacks(NewToolCallbackHandler()))
+	return events, err
+}
+
+func TestToolCallbackHandler(t *testing.T) {
+	long := strings.Repeat("é", MaxToolResultLength+10)
+	interrupt, _ := utils.InferTool("lookup_order", "Looks up an order", func(context.Context, struct{}) (string, error) {
+		return "", compose.NewInterruptAndRerunErr("approval required")
+	})
+
+	tests := []struct {
+		name          string
+		tool          tool.InvokableTool
+		arguments     string
+		wantArgs      map[string]interface{}
+		wantResult    bool
+		wantContent   string
+		wantTruncated bool
+		wantError     string
+	}{
+		{
+			name:        "result",
+			tool:        &fakeTool{result: "shipped"},
+			arguments:   `{"id": "42"}`,
+			wantArgs:    map[string]interface{}{"id": "42"},
+			wantResult:  true,
+			wantContent: "shipped",
+		},
+		{
+			name:          "long result",
+			tool:          &fakeTool{result: long},
+			arguments:     `{}`,
+			wantArgs:      map[string]interface{}{},
+			wantResult:    true,
+			wantContent:   long[:2*MaxToolResultLength],
+			wantTruncated: true,
+		},
+		{
+			name:        "arguments that are not an object",
+			tool:        &fakeTool{result: "shipped"},
+			arguments:   `42`,
+			wantArgs:    map[string]interface{}{"input": "42"},
+			wantResult:  true,
+			wantContent: "shipped",
+		},
+		{
+			name:       "error",
+			tool:       &fakeTool{err: errors.New("order service down")},
+			arguments:  `{}`,
+			wantArgs:   map[string]interface{}{},
+			wantResult: true,
+			wantError:  "order service down",
+		},
+		{name: "interrupted", tool: interrupt, arguments: `{}`, wantArgs: map[string]interface{}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, _ := callTool(t, tt.tool, tt.arguments)
+			wantEvents := 1
+			if tt.wantResult {
+				wantEvents = 2
+			}
+			if len(events) != wantEvents {
+				t.Fatalf("emitted %d events, want %d", len(events), wantEvents)
+			}
+
+			call := events[0]
+			if call.Type != EventTypeToolCall || call.AgentName != "support" {
+				t.Errorf("first event = %s of %q, want a tool_call of support", call.Type, call.AgentName)
+			}
+			if call.Data["tool_name"] != "lookup_order" || call.Data["tool_call_id"] != "call_1" {
+				t.Errorf("tool_call data = %v, want the tool name and call id", call.Data)
+			}
+			args, _ := call.Data["arguments"].(map[string]interface{})
+			if len(args) != len(tt.wantArgs) {
+				t.Errorf("tool_call arguments = %v, want %v", call.Data["arguments"], tt.wantArgs)
+			}
+			for key, want := range tt.wantArgs {
+				if args[key] != want {
+					t.Errorf("tool_call argument %s = %v, want %v", key, args[key], want)
+				}
+			}
+			if !tt.wantResult {
+				return
+			}
+
+			result := events[1]
+			if result.Type != EventTypeToolResult || result.AgentName != "support" || result.Data["tool_call_id"] != "call_1" {
+				t.Errorf("second event = %s of %q for %v, want the tool_result of call_1 of support", result.Type, result.AgentName, result.Data["tool_call_id"])
+			}
+			if result.Data["result"] != tt.wantContent || result.Data["truncated"] != tt.wantTruncated {
+				t.Errorf("tool_result = %.20q truncated %v, want %.20q truncated %v",
+					result.Data["result"], result.Data["truncated"], tt.wantContent, tt.wantTruncated)
+			}
+			if result.Error != tt.wantError {
+				t.Errorf("tool_result error = %q, want %q", result.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestToolCallbackHandlerWithoutEmitter(t *testing.T) {
+	// Runs without emitter, e.g. non-streaming ones, report nothing and are
+	// not affected by the handler
+	runnable := toolGraph(t, &fakeTool{result: "shipped"}, "support")
+	out, err := runnable.Invoke(context.Background(), toolCall(`{}`), compose.WithCallbacks(NewToolCallbackHandler()))
+	if err != nil || len(out) != 1 || out[0].Content != "shipped" {
+		t.Errorf("Invoke() = %v, %v, want the tool result", out, err)
+	}
+}
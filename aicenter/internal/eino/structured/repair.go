@@ -0,0 +1,108 @@
+package structured
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// DefaultRepairAttempts is how many times a non-conforming answer is sent
+// back to the model to be repaired
+const DefaultRepairAttempts = 2
+
+const repairInstruction = "You fix JSON documents so that they conform to a JSON Schema. " +
+	"Keep the information of the document, only change what is needed to satisfy the schema. " +
+	"Respond only with the fixed JSON value, without code fences or any other text."
+
+// Error reports an answer that still does not conform to the output schema
+// once the repair attempts are exhausted
+type Error struct {
+	// Errors are the violations of the last answer
+	Errors []string
+	// Content is the last answer of the model
+	Content string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("answer does not conform to the output schema: %s", strings.Join(e.Errors, "; "))
+}
+
+// Extract returns the JSON value of an answer, dropping the code fences and
+// the text models tend to add around it
+func Extract(content string) string {
+	text := strings.TrimSpace(content)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+	if json.Valid([]byte(text)) {
+		return text
+	}
+
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return text
+	}
+	closing := "}"
+	if text[start] == '[' {
+		closing = "]"
+	}
+	if end := strings.LastIndex(text, closing); end > start {
+		return text[start : end+1]
+	}
+	return text
+}
+
+// Check extracts the JSON value of an answer and validates it, it returns the
+// value and the violations found
+func (s *Schema) Check(content string) (json.RawMessage, []string) {
+	data := Extract(content)
+	if errs := s.Validate([]byte(data)); len(errs) > 0 {
+		return nil, errs
+	}
+	return json.RawMessage(data), nil
+}
+
+// Repair validates an answer against the schema and, while it does not
+// conform, asks the model to fix it, up to attempts times. It returns the
+// conforming JSON value, or an *Error carrying the last violations.
+func Repair(ctx context.Context, chatModel model.BaseChatModel, s *Schema, content string, attempts int) (json.RawMessage, error) {
+	data, errs := s.Check(content)
+	for attempt := 0; len(errs) > 0 && attempt < attempts; attempt++ {
+		msg, err := chatModel.Generate(ctx, []*schema.Message{
+			schema.SystemMessage(repairInstruction),
+			schema.UserMessage(repairPrompt(s, content, errs)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("repair answer: %w", err)
+		}
+		content = msg.Content
+		data, errs = s.Check(content)
+	}
+	if len(errs) > 0 {
+		return nil, &Error{Errors: errs, Content: content}
+	}
+	return data, nil
+}
+
+func repairPrompt(s *Schema, content string, errs []string) string {
+	var b strings.Builder
+	b.WriteString("JSON Schema:\n")
+	b.Write(s.Raw)
+	b.WriteString("\n\nDocument:\n")
+	b.WriteString(content)
+	b.WriteString("\n\nViolations:\n")
+	for _, e := range errs {
+		b.WriteString("- ")
+		b.WriteString(e)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+)
+
+// defaultName names the schemas that do not have a usable title
+const defaultName = "output"
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Schema is the JSON Schema the answer of a run must conform to
+type Schema struct {
+	// Name identifies the schema in native response formats
+	Name string
+	// Raw is the schema document as declared
+	Raw json.RawMessage
+
+	root map[string]interface{}
+}
+
+// Parse parses a JSON Schema document. name is used for native response
+// formats, the schema title or "output" is used when it is empty.
+func Parse(name string, raw json.RawMessage) (*Schema, error) {
+	raw = bytes.TrimSpace(raw)
+	var root map[string]interface{}
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("output schema must be a JSON object: %w", err)
+	}
+	if len(root) == 0 {
+		return nil, fmt.Errorf("output schema is empty")
+	}
+
+	if name == "" {
+		name, _ = root["title"].(string)
+	}
+	if !namePattern.MatchString(name) {
+		name = defaultName
+	}
+	return &Schema{Name: name, Raw: raw, root: root}, nil
+}
+
+// FromConfig parses the "output_schema" of an agent or team config, it
+// returns nil when the config declares none
+func FromConfig(cfg map[string]interface{}) (*Schema, error) {
+	value, ok := cfg["output_schema"]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("encode output_schema: %w", err)
+	}
+	return Parse("", raw)
+}
+
+// Output returns the schema as the native response format of providers
+func (s *Schema) Output() *llm.OutputSchema {
+	if s == nil {
+		return nil
+	}
+	return &llm.OutputSchema{Name: s.Name, Schema: s.Raw}
+}
+
+// Instruction tells the model to answer with JSON conforming to the schema,
+// for the providers without a native response format
+func (s *Schema) Instruction() string {
+	var b strings.Builder
+	b.WriteString("Respond only with a JSON value that conforms to the following JSON Schema. ")
+	b.WriteString("Do not wrap it in code fences and do not add any text before or after it.\n")
+	b.Write(s.Raw)
+	return b.String()
+}
@@ -0,0 +1,387 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxErrors bounds the violations reported for an answer, they are sent back
+// to the model when repairing it
+const maxErrors = 20
+
+// Validate checks a JSON document against the schema and returns the
+// violations found, none when it conforms. The common keywords of JSON Schema
+// are supported: type, enum, const, properties, required,
+// additionalProperties, items, prefixItems, the length and range bounds,
+// pattern, allOf, anyOf, oneOf, not and local $ref. Other keywords are
+// ignored.
+func (s *Schema) Validate(data []byte) []string {
+	value, err := decode(data)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+	v := &validator{root: s.root}
+	v.validate(s.root, value, "$")
+	return v.errs
+}
+
+// decode decodes JSON keeping numbers as json.Number, so that integers can be
+// told from other numbers
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	// More misses a stray closing bracket, only EOF ends the document
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+type validator struct {
+	root map[string]interface{}
+	errs []string
+	// depth guards against recursive $ref cycles
+	depth int
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	if len(v.errs) < maxErrors {
+		v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+// valid reports whether value conforms to schema, without recording errors
+func (v *validator) valid(schema interface{}, value interface{}, path string) bool {
+	sub := &validator{root: v.root, depth: v.depth}
+	sub.validate(schema, value, path)
+	return len(sub.errs) == 0
+}
+
+func (v *validator) validate(schemaValue interface{}, value interface{}, path string) {
+	switch schema := schemaValue.(type) {
+	case bool:
+		if !schema {
+			v.fail(path, "no value is allowed")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObject(schema, value, path)
+	}
+}
+
+func (v *validator) validateObject(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		if v.depth >= 32 {
+			v.fail(path, "schema $ref nesting is too deep")
+			return
+		}
+		v.depth++
+		v.validate(target, value, path)
+		v.depth--
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !matchesType(types, value) {
+		v.fail(path, "expected %s, got %s", strings.Join(types, " or "), typeOf(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if equal(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "must be one of %s", compact(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !equal(c, value) {
+		v.fail(path, "must be %s", compact(c))
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateProperties(schema, val, path)
+	case []interface{}:
+		v.validateItems(schema, val, path)
+	case string:
+		v.validateString(schema, val, path)
+	case json.Number:
+		v.validateNumber(schema, val, path)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(sub, value, path)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if v.valid(sub, value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "must match at least one of the anyOf schemas")
+		}
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, sub := range one {
+			if v.valid(sub, value, path) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(path, "must match exactly one of the oneOf schemas, matched %d", matched)
+		}
+	}
+	if not, ok := schema["not"]; ok && v.valid(not, value, path) {
+		v.fail(path, "must not match the not schema")
+	}
+}
+
+func (v *validator) validateProperties(schema map[string]interface{}, value map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := value[name]; !ok {
+				v.fail(path, "missing required property %q", name)
+			}
+		}
+	}
+	if n, ok := intKeyword(schema, "minProperties"); ok && len(value) < n {
+		v.fail(path, "must have at least %d properties", n)
+	}
+	if n, ok := intKeyword(schema, "maxProperties"); ok && len(value) > n {
+		v.fail(path, "must have at most %d properties", n)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propPath := path + "." + name
+		if prop, ok := properties[name]; ok {
+			v.validate(prop, value[name], propPath)
+			continue
+		}
+		if hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				v.fail(path, "property %q is not allowed", name)
+				continue
+			}
+			v.validate(additional, value[name], propPath)
+		}
+	}
+}
+
+func (v *validator) validateItems(schema map[string]interface{}, value []interface{}, path string) {
+	if n, ok := intKeyword(schema, "minItems"); ok && len(value) < n {
+		v.fail(path, "must have at least %d items", n)
+	}
+	if n, ok := intKeyword(schema, "maxItems"); ok && len(value) > n {
+		v.fail(path, "must have at most %d items", n)
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := 0; i < len(value); i++ {
+			for j := i + 1; j < len(value); j++ {
+				if equal(value[i], value[j]) {
+					v.fail(path, "items %d and %d are equal, items must be unique", i, j)
+				}
+			}
+		}
+	}
+
+	prefix, _ := schema["prefixItems"].([]interface{})
+	for i, item := range value {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefix) {
+			v.validate(prefix[i], item, itemPath)
+			continue
+		}
+		if items, ok := schema["items"]; ok {
+			v.validate(items, item, itemPath)
+		}
+	}
+}
+
+func (v *validator) validateString(schema map[string]interface{}, value string, path string) {
+	length := utf8.RuneCountInString(value)
+	if n, ok := intKeyword(schema, "minLength"); ok && length < n {
+		v.fail(path, "must be at least %d characters long", n)
+	}
+	if n, ok := intKeyword(schema, "maxLength"); ok && length > n {
+		v.fail(path, "must be at most %d characters long", n)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err == nil && !re.MatchString(value) {
+			v.fail(path, "must match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(schema map[string]interface{}, value json.Number, path string) {
+	f, err := value.Float64()
+	if err != nil {
+		v.fail(path, "invalid number %s", value)
+		return
+	}
+	if min, ok := floatKeyword(schema, "minimum"); ok && f < min {
+		v.fail(path, "must be >= %v", min)
+	}
+	if max, ok := floatKeyword(schema, "maximum"); ok && f > max {
+		v.fail(path, "must be <= %v", max)
+	}
+	if min, ok := floatKeyword(schema, "exclusiveMinimum"); ok && f <= min {
+		v.fail(path, "must be > %v", min)
+	}
+	if max, ok := floatKeyword(schema, "exclusiveMaximum"); ok && f >= max {
+		v.fail(path, "must be < %v", max)
+	}
+	if m, ok := floatKeyword(schema, "multipleOf"); ok && m > 0 {
+		if q := f / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "must be a multiple of %v", m)
+		}
+	}
+}
+
+// resolve returns the schema of a local $ref such as "#/$defs/Ticket"
+func (v *validator) resolve(ref string) (interface{}, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q, only local references are supported", ref)
+	}
+	var current interface{} = v.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if current, ok = obj[token]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return current, nil
+}
+
+func schemaTypes(value interface{}) []string {
+	switch t := value.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesType(types []string, value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(value interface{}) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := val.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func intKeyword(schema map[string]interface{}, key string) (int, bool) {
+	f, ok := floatKeyword(schema, key)
+	return int(f), ok
+}
+
+func floatKeyword(schema map[string]interface{}, key string) (float64, bool) {
+	f, ok := schema[key].(float64)
+	return f, ok
+}
+
+// equal compares JSON values, numbers by value
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func normalize(value interface{}) interface{} {
+	switch val := value.(type) {
+	case json.Number:
+		f, _ := val.Float64()
+		return f
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalize(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = normalize(item)
+		}
+		return out
+	}
+	return value
+}
+
+func compact(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,157 @@
+package structured
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		data   string
+		// wantErrs are substrings of the expected violations, in order. None
+		// means the document conforms.
+		wantErrs []string
+	}{
+		// Documents
+		{name: "invalid JSON", schema: `{"type":"object"}`, data: `{"a":`, wantErrs: []string{"invalid JSON"}},
+		{name: "trailing data", schema: `{"type":"object"}`, data: `{} {}`, wantErrs: []string{"invalid JSON"}},
+		{name: "trailing brace", schema: `{"type":"object"}`, data: `{}}`, wantErrs: []string{"invalid JSON"}},
+		{name: "trailing whitespace", schema: `{"type":"object"}`, data: "{}\n"},
+
+		// type
+		{name: "string", schema: `{"type":"string"}`, data: `"a"`},
+		{name: "string mismatch", schema: `{"type":"string"}`, data: `1`, wantErrs: []string{"$: expected string, got integer"}},
+		{name: "type list", schema: `{"type":["string","null"]}`, data: `null`},
+		{name: "type list mismatch", schema: `{"type":["string","null"]}`, data: `true`, wantErrs: []string{"expected string or null, got boolean"}},
+		{name: "boolean schema true", schema: `{"properties":{"a":true}}`, data: `{"a":1}`},
+		{name: "boolean schema false", schema: `{"properties":{"a":false}}`, data: `{"a":1}`, wantErrs: []string{"$.a: no value is allowed"}},
+
+		// number and integer
+		{name: "integer", schema: `{"type":"integer"}`, data: `3`},
+		{name: "integer with zero fraction", schema: `{"type":"integer"}`, data: `3.0`},
+		{name: "integer exponent", schema: `{"type":"integer"}`, data: `1e3`},
+		{name: "integer fraction", schema: `{"type":"integer"}`, data: `3.5`, wantErrs: []string{"expected integer, got number"}},
+		{name: "integer out of float range", schema: `{"type":"integer"}`, data: `1e400`, wantErrs: []string{"expected integer, got number"}},
+		{name: "number accepts integer", schema: `{"type":"number"}`, data: `3`},
+		{name: "number", schema: `{"type":"number"}`, data: `-0.25`},
+		{name: "minimum", schema: `{"minimum":1}`, data: `1`},
+		{name: "below minimum", schema: `{"minimum":1}`, data: `0.5`, wantErrs: []string{"must be >= 1"}},
+		{name: "above maximum", schema: `{"maximum":10}`, data: `11`, wantErrs: []string{"must be <= 10"}},
+		{name: "exclusive minimum", schema: `{"exclusiveMinimum":0}`, data: `0`, wantErrs: []string{"must be > 0"}},
+		{name: "exclusive maximum", schema: `{"exclusiveMaximum":1}`, data: `0.99`},
+		{name: "multiple of decimal", schema: `{"multipleOf":0.1}`, data: `0.3`},
+		{name: "not a multiple", schema: `{"multipleOf":2}`, data: `3`, wantErrs: []string{"must be a multiple of 2"}},
+		{name: "number bounds ignore strings", schema: `{"minimum":5}`, data: `"1"`},
+
+		// enum and const
+		{name: "enum", schema: `{"enum":["low","high"]}`, data: `"high"`},
+		{name: "enum mismatch", schema: `{"enum":["low","high"]}`, data: `"medium"`, wantErrs: []string{`must be one of ["low","high"]`}},
+		{name: "enum number by value", schema: `{"enum":[1,2]}`, data: `2.0`},
+		{name: "enum null", schema: `{"enum":["a",null]}`, data: `null`},
+		{name: "enum object", schema: `{"enum":[{"a":[1,2]}]}`, data: `{"a":[1,2]}`},
+		{name: "enum object mismatch", schema: `{"enum":[{"a":[1,2]}]}`, data: `{"a":[2,1]}`, wantErrs: []string{"must be one of"}},
+		{name: "const", schema: `{"const":"fixed"}`, data: `"other"`, wantErrs: []string{`must be "fixed"`}},
+
+		// objects
+		{name: "required", schema: `{"type":"object","required":["id","name"]}`, data: `{"id":1}`, wantErrs: []string{`$: missing required property "name"`}},
+		{name: "nested property", schema: `{"properties":{"user":{"properties":{"age":{"type":"integer"}}}}}`, data: `{"user":{"age":"x"}}`, wantErrs: []string{"$.user.age: expected integer, got string"}},
+		{name: "additional properties allowed by default", schema: `{"properties":{"a":{}}}`, data: `{"a":1,"b":2}`},
+		{name: "additional properties false", schema: `{"properties":{"a":{}},"additionalProperties":false}`, data: `{"a":1,"c":2,"b":3}`, wantErrs: []string{`property "b" is not allowed`, `property "c" is not allowed`}},
+		{name: "additional properties schema", schema: `{"properties":{"a":{}},"additionalProperties":{"type":"string"}}`, data: `{"a":1,"b":"x","c":2}`, wantErrs: []string{"$.c: expected string, got integer"}},
+		{name: "additional properties true", schema: `{"additionalProperties":true}`, data: `{"b":1}`},
+		{name: "min properties", schema: `{"minProperties":2}`, data: `{"a":1}`, wantErrs: []string{"at least 2 properties"}},
+		{name: "max properties", schema: `{"maxProperties":1}`, data: `{"a":1,"b":2}`, wantErrs: []string{"at most 1 properties"}},
+
+		// arrays
+		{name: "items", schema: `{"items":{"type":"string"}}`, data: `["a",1]`, wantErrs: []string{"$[1]: expected string, got integer"}},
+		{name: "prefix items", schema: `{"prefixItems":[{"type":"integer"}],"items":{"type":"string"}}`, data: `[1,"a","b"]`},
+		{name: "prefix items mismatch", schema: `{"prefixItems":[{"type":"integer"}],"items":{"type":"string"}}`, data: `["a",2]`, wantErrs: []string{"$[0]: expected integer", "$[1]: expected string"}},
+		{name: "min items", schema: `{"minItems":1}`, data: `[]`, wantErrs: []string{"at least 1 items"}},
+		{name: "max items", schema: `{"maxItems":1}`, data: `[1,2]`, wantErrs: []string{"at most 1 items"}},
+		{name: "unique items", schema: `{"uniqueItems":true}`, data: `[1,1.0]`, wantErrs: []string{"items 0 and 1 are equal"}},
+
+		// strings
+		{name: "min length counts characters", schema: `{"minLength":2}`, data: `"你好"`},
+		{name: "max length", schema: `{"maxLength":2}`, data: `"abc"`, wantErrs: []string{"at most 2 characters"}},
+		{name: "pattern", schema: `{"pattern":"^[A-Z]{3}-\\d+$"}`, data: `"ABC-12"`},
+		{name: "pattern mismatch", schema: `{"pattern":"^[A-Z]{3}-\\d+$"}`, data: `"abc-12"`, wantErrs: []string{"must match pattern"}},
+
+		// combinators
+		{name: "allOf", schema: `{"allOf":[{"minimum":1},{"maximum":3}]}`, data: `4`, wantErrs: []string{"must be <= 3"}},
+		{name: "anyOf", schema: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, data: `2`},
+		{name: "anyOf none", schema: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, data: `2.5`, wantErrs: []string{"must match at least one of the anyOf schemas"}},
+		{name: "oneOf", schema: `{"oneOf":[{"type":"string"},{"type":"integer"}]}`, data: `"a"`},
+		{name: "oneOf none", schema: `{"oneOf":[{"type":"string"},{"type":"integer"}]}`, data: `true`, wantErrs: []string{"matched 0"}},
+		{name: "oneOf several", schema: `{"oneOf":[{"type":"number"},{"type":"integer"}]}`, data: `2`, wantErrs: []string{"matched 2"}},
+		{name: "not", schema: `{"not":{"type":"null"}}`, data: `null`, wantErrs: []string{"must not match the not schema"}},
+
+		// $ref
+		{
+			name:   "ref to defs",
+			schema: `{"$defs":{"Ticket":{"type":"object","required":["id"]}},"properties":{"ticket":{"$ref":"#/$defs/Ticket"}}}`,
+			data:   `{"ticket":{"id":1}}`,
+		},
+		{
+			name:     "ref to defs mismatch",
+			schema:   `{"$defs":{"Ticket":{"type":"object","required":["id"]}},"properties":{"ticket":{"$ref":"#/$defs/Ticket"}}}`,
+			data:     `{"ticket":{}}`,
+			wantErrs: []string{`$.ticket: missing required property "id"`},
+		},
+		{
+			name:   "ref to definitions with escaped token",
+			schema: `{"definitions":{"a/b":{"type":"string"}},"items":{"$ref":"#/definitions/a~1b"}}`,
+			data:   `["x"]`,
+		},
+		{
+			name:     "ref with sibling keywords",
+			schema:   `{"$defs":{"n":{"type":"integer"}},"$ref":"#/$defs/n","maximum":5}`,
+			data:     `6`,
+			wantErrs: []string{"must be <= 5"},
+		},
+		{
+			name:   "recursive ref",
+			schema: `{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#"}}}}`,
+			data:   `{"children":[{"children":[{"children":[]}]}]}`,
+		},
+		{
+			name:     "recursive ref mismatch",
+			schema:   `{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#"}}}}`,
+			data:     `{"children":[{"children":[1]}]}`,
+			wantErrs: []string{"$.children[0].children[0]: expected object, got integer"},
+		},
+		{name: "ref cycle", schema: `{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`, data: `1`, wantErrs: []string{"nesting is too deep"}},
+		{name: "unresolvable ref", schema: `{"$ref":"#/$defs/missing"}`, data: `1`, wantErrs: []string{`unresolvable $ref "#/$defs/missing"`}},
+		{name: "remote ref", schema: `{"$ref":"https://example.com/schema.json"}`, data: `1`, wantErrs: []string{"only local references are supported"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse("", []byte(tt.schema))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			errs := s.Validate([]byte(tt.data))
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("Validate() = %q, want %d violations %q", errs, len(tt.wantErrs), tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if !strings.Contains(errs[i], want) {
+					t.Errorf("Validate()[%d] = %q, want it to contain %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaValidateMaxErrors(t *testing.T) {
+	s, err := Parse("", []byte(`{"items":{"type":"string"}}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	data := "[" + strings.TrimSuffix(strings.Repeat("1,", 2*maxErrors), ",") + "]"
+	if errs := s.Validate([]byte(data)); len(errs) != maxErrors {
+		t.Errorf("Validate() reported %d violations, want %d", len(errs), maxErrors)
+	}
+}
@@ -0,0 +1,88 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	checkPointKeyPrefix = "aicenter:checkpoint:"
+	// checkPointTTL bounds how long an interrupted run can wait to be resumed
+	checkPointTTL = 72 * time.Hour
+)
+
+// CheckPointStore keeps the checkpoints of interrupted runs until they are
+// resumed, checkpoints are keyed by run ID
+type CheckPointStore interface {
+	compose.CheckPointStore
+	// Delete drops the checkpoint of a run once it is no longer resumable
+	Delete(ctx context.Context, checkPointID string) error
+}
+
+// MemoryCheckPointStore keeps checkpoints in memory, runs can only be resumed
+// on the replica they were interrupted on
+type MemoryCheckPointStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+// NewMemoryCheckPointStore creates an in-memory checkpoint store
+func NewMemoryCheckPointStore() *MemoryCheckPointStore {
+	return &MemoryCheckPointStore{data: make(map[string][]byte)}
+}
+
+func (s *MemoryCheckPointStore) Get(_ context.Context, checkPointID string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[checkPointID]
+	return data, ok, nil
+}
+
+func (s *MemoryCheckPointStore) Set(_ context.Context, checkPointID string, checkPoint []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[checkPointID] = checkPoint
+	return nil
+}
+
+func (s *MemoryCheckPointStore) Delete(_ context.Context, checkPointID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, checkPointID)
+	return nil
+}
+
+// RedisCheckPointStore keeps checkpoints in Redis, so that any replica can
+// resume a run
+type RedisCheckPointStore struct {
+	cli *redis.Client
+}
+
+// NewRedisCheckPointStore creates a Redis backed checkpoint store
+func NewRedisCheckPointStore(cli *redis.Client) *RedisCheckPointStore {
+	return &RedisCheckPointStore{cli: cli}
+}
+
+func (s *RedisCheckPointStore) Get(ctx context.Context, checkPointID string) ([]byte, bool, error) {
+	data, err := s.cli.Get(ctx, checkPointKeyPrefix+checkPointID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (s *RedisCheckPointStore) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
+	return s.cli.Set(ctx, checkPointKeyPrefix+checkPointID, checkPoint, checkPointTTL).Err()
+}
+
+func (s *RedisCheckPointStore) Delete(ctx context.Context, checkPointID string) error {
+	return s.cli.Del(ctx, checkPointKeyPrefix+checkPointID).Err()
+}
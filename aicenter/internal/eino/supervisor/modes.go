@@ -0,0 +1,115 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/components/tool"
+)
+
+// Mode is how the agents of a team work together on a run
+type Mode string
+
+const (
+	// ModeSupervisor lets a supervisor hand the run over to the agents
+	ModeSupervisor Mode = "supervisor"
+	// ModePlanExecute plans the run in steps, executes them with the agents
+	// as tools and revises the plan after each step
+	ModePlanExecute Mode = "plan_execute"
+	// ModeSequential runs the agents one after the other, each seeing the
+	// answers of the previous ones
+	ModeSequential Mode = "sequential"
+	// ModeParallel runs the agents concurrently and merges their answers
+	ModeParallel Mode = "parallel"
+)
+
+// planMaxIterations bounds the execute-replan rounds of a plan-execute team
+const planMaxIterations = 10
+
+const consolidatorInstruction = `You merge the answers several specialists gave to the same user request.
+
+INSTRUCTIONS:
+1. Combine the relevant information of every answer into a single, coherent answer
+2. When answers contradict each other, say so instead of picking one silently
+3. Do not mention the specialists, answer the user directly
+4. Answer in the language of the user`
+
+// buildSequential runs the agents one after the other
+func (b *SupervisorBuilder) buildSequential(ctx context.Context, cfg *SupervisorConfig, subAgents []adk.Agent) (adk.Agent, error) {
+	return adk.NewSequentialAgent(ctx, &adk.SequentialAgentConfig{
+		Name:        cfg.Name,
+		Description: fmt.Sprintf("Sequential team: %s", cfg.Name),
+		SubAgents:   subAgents,
+	})
+}
+
+// buildParallel runs the agents concurrently, then merges their answers with
+// the supervisor model
+func (b *SupervisorBuilder) buildParallel(ctx context.Context, cfg *SupervisorConfig, subAgents []adk.Agent) (adk.Agent, error) {
+	members, err := adk.NewParallelAgent(ctx, &adk.ParallelAgentConfig{
+		Name:        cfg.Name + "_members",
+		Description: fmt.Sprintf("Members of team: %s", cfg.Name),
+		SubAgents:   subAgents,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create parallel agent: %w", err)
+	}
+
+	consolidatorModel, err := b.llmFactory.CreateToolCalling(ctx, cfg.SupervisorProvider)
+	if err != nil {
+		return nil, fmt.Errorf("create consolidator model: %w", err)
+	}
+	instruction := consolidatorInstruction
+	if cfg.SupervisorInstruction != "" {
+		instruction += "\n\nADDITIONAL INSTRUCTIONS:\n" + cfg.SupervisorInstruction
+	}
+	consolidator, err := adk.NewChatModelAgent(ctx, &adk.ChatModelAgentConfig{
+		Name:        cfg.Name + "_consolidator",
+		Description: fmt.Sprintf("Merges the answers of team: %s", cfg.Name),
+		Instruction: instruction,
+		Model:       consolidatorModel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create consolidator agent: %w", err)
+	}
+
+	return adk.NewSequentialAgent(ctx, &adk.SequentialAgentConfig{
+		Name:        cfg.Name,
+		Description: fmt.Sprintf("Parallel team: %s", cfg.Name),
+		SubAgents:   []adk.Agent{members, consolidator},
+	})
+}
+
+// buildPlanExecute plans the run with the supervisor model, whose executor
+// calls the agents as tools
+func (b *SupervisorBuilder) buildPlanExecute(ctx context.Context, cfg *SupervisorConfig, subAgents []adk.Agent) (adk.Agent, error) {
+	var members strings.Builder
+	members.WriteString("TEAM MEMBERS, available as tools to execute the steps:\n")
+	for _, agentCfg := range cfg.Agents {
+		members.WriteString(fmt.Sprintf("- **%s**: %s\n", agentCfg.Name, agentCfg.Description))
+	}
+	instruction := members.String()
+	if cfg.SupervisorInstruction != "" {
+		instruction += "\nADDITIONAL INSTRUCTIONS:\n" + cfg.SupervisorInstruction
+	}
+
+	builder := NewPlanExecuteBuilder(b.llmFactory)
+	return builder.Build(ctx, &PlanExecuteConfig{
+		Name:          cfg.Name,
+		Instruction:   instruction,
+		Provider:      cfg.SupervisorProvider,
+		Tools:         agentTools(ctx, subAgents),
+		MaxIterations: planMaxIterations,
+	})
+}
+
+// agentTools exposes agents as tools, for the executor of a plan
+func agentTools(ctx context.Context, agents []adk.Agent) []tool.BaseTool {
+	tools := make([]tool.BaseTool, 0, len(agents))
+	for _, a := range agents {
+		tools = append(tools, adk.NewAgentTool(ctx, a))
+	}
+	return tools
+}
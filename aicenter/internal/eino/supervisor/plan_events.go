@@ -0,0 +1,144 @@
+package supervisor
+
+import (
+	"encoding/json"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+)
+
+// Names of the agents of the eino plan-execute prebuilt
+const (
+	plannerAgent   = "planner"
+	executorAgent  = "executor"
+	replannerAgent = "replanner"
+)
+
+// planMessage is the output of the planner and replanner: a plan, or the
+// final response of the run
+type planMessage struct {
+	Steps    []string `json:"steps"`
+	Response *string  `json:"response"`
+}
+
+func parsePlanMessage(content string) (*planMessage, bool) {
+	var msg planMessage
+	if err := json.Unmarshal([]byte(content), &msg); err != nil {
+		return nil, false
+	}
+	if msg.Response == nil && msg.Steps == nil {
+		return nil, false
+	}
+	return &msg, true
+}
+
+// planResponse returns the final response of a plan-execute run from the
+// last message of the replanner
+func planResponse(content string) string {
+	if msg, ok := parsePlanMessage(content); ok && msg.Response != nil {
+		return *msg.Response
+	}
+	return content
+}
+
+// planProgress turns the events of a plan-execute team into plan and step
+// events. The plans and the results of the steps are not part of the answer,
+// only the final response of the replanner is streamed as a message.
+type planProgress struct {
+	team     string
+	steps    []string
+	revision int
+	executed int
+	running  bool
+}
+
+func newPlanProgress(team string) *planProgress {
+	return &planProgress{team: team}
+}
+
+// wrap returns the callback reporting the progress of the plan to callback
+func (p *planProgress) wrap(callback StreamCallback) StreamCallback {
+	return func(event *Event) error {
+		if event.AgentEvent == nil {
+			return callback(event)
+		}
+		switch event.AgentName {
+		case plannerAgent, replannerAgent:
+			return p.plan(event, callback)
+		case executorAgent:
+			return p.execute(event, callback)
+		}
+		return callback(event)
+	}
+}
+
+// plan reports the plans, and the final response as the answer of the team
+func (p *planProgress) plan(event *Event, callback StreamCallback) error {
+	if event.Err != nil {
+		return callback(event)
+	}
+	msg := event.Message()
+	if msg == nil || event.Delta {
+		return nil
+	}
+	parsed, ok := parsePlanMessage(msg.Content)
+	if !ok {
+		return callback(event)
+	}
+
+	if parsed.Response != nil {
+		answer := schema.AssistantMessage(*parsed.Response, nil)
+		answer.ResponseMeta = msg.ResponseMeta
+		answer.Extra = msg.Extra
+		return callback(&Event{
+			AgentEvent: &adk.AgentEvent{
+				AgentName: p.team,
+				RunPath:   event.RunPath,
+				Output: &adk.AgentOutput{
+					MessageOutput: &adk.MessageVariant{Message: answer, Role: schema.Assistant},
+				},
+			},
+			MessageID: uuid.New().String(),
+		})
+	}
+
+	p.steps = parsed.Steps
+	p.revision++
+	planEvent := streaming.NewPlanEvent(p.team, p.steps, p.revision, p.executed)
+	return callback(&Event{Tool: &planEvent})
+}
+
+// execute reports the steps starting and completing, the messages of the
+// executor are only recorded
+func (p *planProgress) execute(event *Event, callback StreamCallback) error {
+	if event.Err != nil {
+		return callback(event)
+	}
+	if !p.running {
+		p.running = true
+		started := streaming.NewStepEvent(p.team, p.executed+1, p.currentStep(), streaming.StepStarted, "")
+		if err := callback(&Event{Tool: &started}); err != nil {
+			return err
+		}
+	}
+
+	msg := event.Message()
+	if msg == nil || event.Delta || msg.Role != schema.Assistant || len(msg.ToolCalls) > 0 {
+		return nil
+	}
+	// The answer of the executor without tool calls ends the step
+	p.running = false
+	p.executed++
+	completed := streaming.NewStepEvent(p.team, p.executed, p.currentStep(), streaming.StepCompleted, msg.Content)
+	return callback(&Event{Tool: &completed})
+}
+
+func (p *planProgress) currentStep() string {
+	if len(p.steps) == 0 {
+		return ""
+	}
+	return p.steps[0]
+}
@@ -50,11 +50,36 @@ If a tool fails, try alternative approaches or report the issue.`),
 ## Your task is to execute the first step, which is: 
 {step}`))
 
+// formatInput returns the text of the user input, the last user message of
+// the run messages
 func formatInput(in []adk.Message) string {
-	if len(in) == 0 {
-		return ""
+	for i := len(in) - 1; i >= 0; i-- {
+		if in[i].Role != schema.User {
+			continue
+		}
+		if in[i].Content != "" {
+			return in[i].Content
+		}
+		var texts []string
+		for _, part := range in[i].UserInputMultiContent {
+			if part.Type == schema.ChatMessagePartTypeText {
+				texts = append(texts, part.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
 	}
-	return in[0].Content
+	return ""
+}
+
+// withInstruction appends the instruction of the config to the system
+// message of the formatted prompt
+func withInstruction(msgs []adk.Message, instruction string) []adk.Message {
+	if instruction == "" || len(msgs) == 0 || msgs[0].Role != schema.System {
+		return msgs
+	}
+	system := *msgs[0]
+	system.Content += "\n\n" + instruction
+	return append([]adk.Message{&system}, msgs[1:]...)
 }
 
 func formatExecutedSteps(in []planexecute.ExecutedStep) string {
@@ -75,6 +100,15 @@ func (b *PlanExecuteBuilder) Build(ctx context.Context, cfg *PlanExecuteConfig)
 
 	planAgent, err := planexecute.NewPlanner(ctx, &planexecute.PlannerConfig{
 		ToolCallingChatModel: plannerModel,
+		GenInputFn: func(ctx context.Context, userInput []adk.Message) ([]adk.Message, error) {
+			msgs, err := planexecute.PlannerPrompt.Format(ctx, map[string]any{
+				"input": userInput,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return withInstruction(msgs, cfg.Instruction), nil
+		},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create planner: %w", err)
@@ -111,7 +145,7 @@ func (b *PlanExecuteBuilder) Build(ctx context.Context, cfg *PlanExecuteConfig)
 				return nil, err
 			}
 
-			return msgs, nil
+			return withInstruction(msgs, cfg.Instruction), nil
 		},
 	})
 	if err != nil {
@@ -0,0 +1,91 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestFormatInput(t *testing.T) {
+	multimodal := &schema.Message{
+		Role: schema.User,
+		UserInputMultiContent: []schema.MessageInputPart{
+			{Type: schema.ChatMessagePartTypeText, Text: "What is wrong with this invoice?"},
+			{Type: schema.ChatMessagePartTypeImageURL, Image: &schema.MessageInputImage{}},
+			{Type: schema.ChatMessagePartTypeText, Text: "It was due last week."},
+		},
+	}
+
+	tests := []struct {
+		name string
+		in   []adk.Message
+		want string
+	}{
+		{name: "no messages", want: ""},
+		{name: "text", in: []adk.Message{schema.UserMessage("Where is my order?")}, want: "Where is my order?"},
+		{
+			name: "last user message",
+			in: []adk.Message{
+				schema.UserMessage("Hi"),
+				schema.AssistantMessage("Hello, how can I help?", nil),
+				schema.UserMessage("Where is my order?"),
+				schema.AssistantMessage("Let me check.", nil),
+			},
+			want: "Where is my order?",
+		},
+		{name: "multimodal", in: []adk.Message{multimodal}, want: "What is wrong with this invoice?\nIt was due last week."},
+		{name: "no user message", in: []adk.Message{schema.SystemMessage("Be brief.")}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatInput(tt.in); got != tt.want {
+				t.Errorf("formatInput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithInstruction(t *testing.T) {
+	tests := []struct {
+		name        string
+		msgs        []adk.Message
+		instruction string
+		want        string
+	}{
+		{
+			name:        "appended to the system message",
+			msgs:        []adk.Message{schema.SystemMessage("You are a planner."), schema.UserMessage("Plan it")},
+			instruction: "Answer in French.",
+			want:        "You are a planner.\n\nAnswer in French.",
+		},
+		{
+			name: "no instruction",
+			msgs: []adk.Message{schema.SystemMessage("You are a planner."), schema.UserMessage("Plan it")},
+			want: "You are a planner.",
+		},
+		{
+			name:        "no system message",
+			msgs:        []adk.Message{schema.UserMessage("Plan it")},
+			instruction: "Answer in French.",
+			want:        "Plan it",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.msgs[0].Content
+			got := withInstruction(tt.msgs, tt.instruction)
+			if len(got) != len(tt.msgs) {
+				t.Fatalf("withInstruction() = %d messages, want %d", len(got), len(tt.msgs))
+			}
+			if got[0].Content != tt.want {
+				t.Errorf("withInstruction() first message = %q, want %q", got[0].Content, tt.want)
+			}
+			if tt.msgs[0].Content != original {
+				t.Errorf("withInstruction() changed the formatted message to %q", tt.msgs[0].Content)
+			}
+		})
+	}
+}
@@ -2,22 +2,93 @@ package supervisor
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sync"
 
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
 )
 
 type Runner struct {
 	supervisorBuilder *SupervisorBuilder
+	checkPoints       CheckPointStore
 }
 
 func NewRunner(supervisorBuilder *SupervisorBuilder) *Runner {
-	return &Runner{supervisorBuilder: supervisorBuilder}
+	return &Runner{
+		supervisorBuilder: supervisorBuilder,
+		checkPoints:       NewMemoryCheckPointStore(),
+	}
+}
+
+// SetCheckPointStore sets where interrupted runs are checkpointed, e.g. a
+// store shared across replicas
+func (r *Runner) SetCheckPointStore(store CheckPointStore) {
+	r.checkPoints = store
+}
+
+// CheckPoints returns the checkpoint store of interrupted runs
+func (r *Runner) CheckPoints() CheckPointStore {
+	return r.checkPoints
 }
 
 type RunResult struct {
 	Content   string
 	TotalTime float64
+	// Provider and Model that produced the final answer, empty when unknown
+	Provider string
+	Model    string
+	// Interrupts are set when the run paused, e.g. on tool calls waiting for
+	// approval. The run is checkpointed under its run ID.
+	Interrupts []Interrupt
+}
+
+// Interrupt is a point an interrupted run paused at
+type Interrupt struct {
+	// ID addresses the interrupt when resuming the run
+	ID string
+	// AgentName is the agent that was interrupted
+	AgentName string
+	// Info describes the interrupt, e.g. a *tool.ApprovalRequest
+	Info any
+}
+
+// Interrupts returns the points an event reports the run paused at
+func Interrupts(event *adk.AgentEvent) []Interrupt {
+	if event == nil || event.Action == nil || event.Action.Interrupted == nil {
+		return nil
+	}
+
+	var interrupts []Interrupt
+	for _, ic := range event.Action.Interrupted.InterruptContexts {
+		if !ic.IsRootCause {
+			continue
+		}
+		interrupt := Interrupt{ID: ic.ID, AgentName: event.AgentName, Info: ic.Info}
+		for _, seg := range ic.Address {
+			if seg.Type == adk.AddressSegmentAgent {
+				interrupt.AgentName = seg.ID
+			}
+		}
+		interrupts = append(interrupts, interrupt)
+	}
+	return interrupts
+}
+
+// runOptions checkpoints the run under its run ID, so that it can be resumed
+// if interrupted
+func runOptions(ctx context.Context) []adk.AgentRunOption {
+	run := runs.FromContext(ctx)
+	if run == nil {
+		return nil
+	}
+	return []adk.AgentRunOption{adk.WithCheckPointID(run.ID)}
 }
 
 // Run executes the team in non-streaming mode
@@ -27,6 +98,31 @@ func (r *Runner) Run(ctx context.Context, cfg *SupervisorConfig, query string) (
 
 // RunWithHistory executes the team with conversation history
 func (r *Runner) RunWithHistory(ctx context.Context, cfg *SupervisorConfig, query string, history []*schema.Message) (*RunResult, error) {
+	messages := append(append([]*schema.Message{}, history...), schema.UserMessage(query))
+	return r.RunMessages(ctx, cfg, messages)
+}
+
+// RunMessages executes the team on the given messages, the last one being
+// the user input. It lets the input carry more than text, such as images.
+func (r *Runner) RunMessages(ctx context.Context, cfg *SupervisorConfig, messages []*schema.Message) (*RunResult, error) {
+	agent, err := r.supervisorBuilder.Build(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	runner := adk.NewRunner(ctx, adk.RunnerConfig{
+		EnableStreaming: false,
+		Agent:           agent,
+		CheckPointStore: r.checkPoints,
+	})
+
+	return cfg.answer(collect(ctx, runner.Run(ctx, messages, runOptions(ctx)...)))
+}
+
+// Resume continues an interrupted run from its checkpoint in non-streaming
+// mode. targets maps the IDs of the interrupts to their resume data, cfg must
+// build the team the run was interrupted in.
+func (r *Runner) Resume(ctx context.Context, cfg *SupervisorConfig, checkPointID string, targets map[string]any) (*RunResult, error) {
 	agent, err := r.supervisorBuilder.Build(ctx, cfg)
 	if err != nil {
 		return nil, err
@@ -35,30 +131,50 @@ func (r *Runner) RunWithHistory(ctx context.Context, cfg *SupervisorConfig, quer
 	runner := adk.NewRunner(ctx, adk.RunnerConfig{
 		EnableStreaming: false,
 		Agent:           agent,
+		CheckPointStore: r.checkPoints,
 	})
 
-	// Build messages: history + current query
-	var messages []*schema.Message
-	if len(history) > 0 {
-		messages = append(messages, history...)
+	iter, err := runner.ResumeWithParams(ctx, checkPointID, &adk.ResumeParams{Targets: targets})
+	if err != nil {
+		return nil, err
+	}
+	return cfg.answer(collect(ctx, iter))
+}
+
+// answer unwraps the final response of plan-execute teams, which answer
+// through the respond tool of the replanner
+func (c *SupervisorConfig) answer(result *RunResult, err error) (*RunResult, error) {
+	if err == nil && c.mode() == ModePlanExecute {
+		result.Content = planResponse(result.Content)
 	}
-	messages = append(messages, schema.UserMessage(query))
+	return result, err
+}
 
-	iter := runner.Run(ctx, messages)
+// collect consumes the events of a non-streaming run
+func collect(ctx context.Context, iter *adk.AsyncIterator[*adk.AgentEvent]) (*RunResult, error) {
 	var lastMsg adk.Message
 	var lastErr error
+	result := &RunResult{}
 
 	for {
 		event, ok := iter.Next()
 		if !ok {
 			break
 		}
+		runs.Observe(ctx, event)
 		if event.Err != nil {
 			lastErr = event.Err
 			continue
 		}
+		// The interrupt bubbles up the agents, the last event holds every cause
+		if interrupts := Interrupts(event); len(interrupts) > 0 {
+			result.Interrupts = interrupts
+		}
 		if event.Output != nil {
 			lastMsg, _, _ = adk.GetMessage(event)
+			if provider, model, ok := llm.AnsweredBy(lastMsg); ok {
+				result.Provider, result.Model = provider, model
+			}
 		}
 	}
 
@@ -66,28 +182,80 @@ func (r *Runner) RunWithHistory(ctx context.Context, cfg *SupervisorConfig, quer
 		return nil, lastErr
 	}
 
-	return &RunResult{
-		Content: lastMsg.Content,
-	}, nil
+	if lastMsg != nil {
+		result.Content = lastMsg.Content
+	}
+	return result, nil
+}
+
+// Event is an ADK event emitted while streaming. A streamed message is
+// emitted as one Event per delta, all sharing its MessageID, followed by an
+// Event with MessageDone set that carries the complete message and the
+// action of the original ADK event. Tool invocations are emitted as Events
+// with only Tool set.
+type Event struct {
+	*adk.AgentEvent
+	// Tool is a tool_call or tool_result event, reported by the tool callbacks
+	Tool *streaming.Event
+	// MessageID identifies the message of the event, empty without message
+	MessageID string
+	// Delta is set when the message output only holds the next chunk
+	Delta bool
+	// MessageDone is set once all deltas of a message have been emitted
+	MessageDone bool
+}
+
+// Message returns the message of the event, nil if it has none
+func (e *Event) Message() *schema.Message {
+	if e.AgentEvent == nil || e.Output == nil || e.Output.MessageOutput == nil {
+		return nil
+	}
+	return e.Output.MessageOutput.Message
 }
 
 // StreamCallback is called for each event during streaming
-type StreamCallback func(event *adk.AgentEvent) error
+type StreamCallback func(event *Event) error
 
-// Stream executes the team in streaming mode and calls the callback for each event
+// Stream executes the team in streaming mode and calls the callback for each
+// event, streamed messages are forwarded delta by delta. The callback is
+// never called concurrently, nor after Stream returns.
 func (r *Runner) Stream(ctx context.Context, cfg *SupervisorConfig, query string, callback StreamCallback) error {
+	return r.StreamWithHistory(ctx, cfg, query, nil, callback)
+}
+
+// StreamWithHistory executes the team in streaming mode with conversation history
+func (r *Runner) StreamWithHistory(ctx context.Context, cfg *SupervisorConfig, query string, history []*schema.Message, callback StreamCallback) error {
+	messages := append(append([]*schema.Message{}, history...), schema.UserMessage(query))
+	return r.StreamMessages(ctx, cfg, messages, callback)
+}
+
+// StreamMessages executes the team in streaming mode on the given messages,
+// the last one being the user input
+func (r *Runner) StreamMessages(ctx context.Context, cfg *SupervisorConfig, messages []*schema.Message, callback StreamCallback) error {
 	agent, err := r.supervisorBuilder.Build(ctx, cfg)
 	if err != nil {
 		return err
 	}
 
+	ctx, callback, stop := Forward(ctx, callback)
+	defer stop()
+	if cfg.mode() == ModePlanExecute {
+		callback = newPlanProgress(cfg.Name).wrap(callback)
+	}
+
 	runner := adk.NewRunner(ctx, adk.RunnerConfig{
 		EnableStreaming: true,
 		Agent:           agent,
+		CheckPointStore: r.checkPoints,
 	})
 
-	iter := runner.Query(ctx, query)
+	iter := runner.Run(ctx, messages, runOptions(ctx)...)
 	for {
+		// Stop as soon as the run is cancelled
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
 		event, ok := iter.Next()
 		if !ok {
 			break
@@ -97,33 +265,101 @@ func (r *Runner) Stream(ctx context.Context, cfg *SupervisorConfig, query string
 		if event.Output != nil && event.Output.MessageOutput != nil {
 			mo := event.Output.MessageOutput
 			if mo.IsStreaming && mo.MessageStream != nil {
-				// Read from stream and emit message events
-				for {
-					msg, err := mo.MessageStream.Recv()
-					if err != nil {
-						break // Stream ended
-					}
-					// Create a new event with the message content
-					streamEvent := &adk.AgentEvent{
-						AgentName: event.AgentName,
-						Output: &adk.AgentOutput{
-							MessageOutput: &adk.MessageVariant{
-								Message: msg,
-							},
-						},
-					}
-					if err := callback(streamEvent); err != nil {
-						return err
-					}
+				if err := StreamMessage(ctx, event, callback); err != nil {
+					return err
 				}
 				continue
 			}
 		}
 
 		// Forward non-streaming events directly
-		if err := callback(event); err != nil {
+		runs.Observe(ctx, event)
+		streamEvent := &Event{AgentEvent: event}
+		if streamEvent.Message() != nil {
+			streamEvent.MessageID = uuid.New().String()
+		}
+		if err := callback(streamEvent); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// Forward serializes the callback and reports to it the tool invocations
+// made with the returned ctx, which run in their own goroutines. stop must be
+// called once streaming is over, the callback is not called afterwards.
+func Forward(ctx context.Context, callback StreamCallback) (context.Context, StreamCallback, func()) {
+	var mu sync.Mutex
+	closed := false
+	forward := func(event *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return nil
+		}
+		return callback(event)
+	}
+	stop := func() {
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+	}
+	ctx = streaming.WithEmitter(ctx, func(event streaming.Event) {
+		_ = forward(&Event{Tool: &event})
+	})
+	return ctx, forward, stop
+}
+
+// StreamMessage forwards the deltas of the streamed message of an ADK event,
+// then the complete message once the stream ends
+func StreamMessage(ctx context.Context, event *adk.AgentEvent, callback StreamCallback) error {
+	mo := event.Output.MessageOutput
+	defer mo.MessageStream.Close()
+
+	messageID := uuid.New().String()
+	var chunks []*schema.Message
+	done := func() error {
+		msg, err := schema.ConcatMessages(chunks)
+		if err != nil || len(chunks) == 0 {
+			msg = &schema.Message{Role: mo.Role}
+		}
+		complete := &adk.AgentEvent{
+			AgentName: event.AgentName,
+			RunPath:   event.RunPath,
+			Action:    event.Action,
+			Output: &adk.AgentOutput{
+				MessageOutput: &adk.MessageVariant{Message: msg, Role: msg.Role, ToolName: mo.ToolName},
+			},
+		}
+		runs.Observe(ctx, complete)
+		return callback(&Event{AgentEvent: complete, MessageID: messageID, MessageDone: true})
+	}
+
+	for {
+		if ctx.Err() != nil {
+			_ = done()
+			return context.Cause(ctx)
+		}
+		msg, err := mo.MessageStream.Recv()
+		if errors.Is(err, io.EOF) {
+			return done()
+		}
+		if err != nil {
+			_ = done()
+			return err
+		}
+		chunks = append(chunks, msg)
+
+		delta := &adk.AgentEvent{
+			AgentName: event.AgentName,
+			RunPath:   event.RunPath,
+			Output: &adk.AgentOutput{
+				MessageOutput: &adk.MessageVariant{Message: msg, Role: mo.Role, ToolName: mo.ToolName},
+			},
+		}
+		if err := callback(&Event{AgentEvent: delta, MessageID: messageID, Delta: true}); err != nil {
+			_ = done()
+			return err
+		}
+	}
+}
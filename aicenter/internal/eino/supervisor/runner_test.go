@@ -0,0 +1,128 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+)
+
+// streamedEvent returns an ADK event streaming an assistant message in chunks
+func streamedEvent(chunks ...string) *adk.AgentEvent {
+	msgs := make([]*schema.Message, 0, len(chunks))
+	for _, chunk := range chunks {
+		msgs = append(msgs, schema.AssistantMessage(chunk, nil))
+	}
+	return &adk.AgentEvent{
+		AgentName: "support",
+		Action:    &adk.AgentAction{Exit: true},
+		Output: &adk.AgentOutput{
+			MessageOutput: &adk.MessageVariant{
+				IsStreaming:   true,
+				MessageStream: schema.StreamReaderFromArray(msgs),
+				Role:          schema.Assistant,
+			},
+		},
+	}
+}
+
+func TestStreamMessage(t *testing.T) {
+	var events []*Event
+	err := StreamMessage(context.Background(), streamedEvent("Your order ", "ships ", "today."), func(event *Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamMessage() error = %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("StreamMessage() emitted %d events, want 3 deltas and the complete message", len(events))
+	}
+
+	messageID := events[0].MessageID
+	if messageID == "" {
+		t.Fatal("StreamMessage() emitted a delta without message id")
+	}
+	for i, want := range []string{"Your order ", "ships ", "today."} {
+		event := events[i]
+		if !event.Delta || event.MessageDone || event.MessageID != messageID {
+			t.Errorf("event %d = %+v, want a delta of message %s", i, event, messageID)
+		}
+		if event.Message().Content != want || event.AgentName != "support" {
+			t.Errorf("event %d has content %q of %s, want %q of support", i, event.Message().Content, event.AgentName, want)
+		}
+		if event.Action != nil {
+			t.Errorf("event %d carries the action, want only the complete message to", i)
+		}
+	}
+
+	done := events[3]
+	if done.Delta || !done.MessageDone || done.MessageID != messageID {
+		t.Errorf("last event = %+v, want the complete message %s", done, messageID)
+	}
+	if done.Message().Content != "Your order ships today." {
+		t.Errorf("complete message content = %q", done.Message().Content)
+	}
+	if done.Action == nil || !done.Action.Exit {
+		t.Error("the complete message does not carry the action of the ADK event")
+	}
+}
+
+func TestStreamMessageCallbackError(t *testing.T) {
+	errClosed := errors.New("client gone")
+	var events []*Event
+	err := StreamMessage(context.Background(), streamedEvent("one", "two", "three"), func(event *Event) error {
+		events = append(events, event)
+		if event.Delta {
+			return errClosed
+		}
+		return nil
+	})
+	if !errors.Is(err, errClosed) {
+		t.Fatalf("StreamMessage() error = %v, want the callback error", err)
+	}
+	if len(events) != 2 || !events[1].MessageDone || events[1].Message().Content != "one" {
+		t.Errorf("StreamMessage() emitted %+v, want the first delta then the message received so far", events)
+	}
+}
+
+func TestForward(t *testing.T) {
+	var events []*Event
+	ctx, callback, stop := Forward(context.Background(), func(event *Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	// A tool invoked with the context, as the tool callbacks see it
+	tools := streaming.NewToolCallbackHandler()
+	info := &callbacks.RunInfo{Name: "lookup_order", Component: components.ComponentOfTool}
+	invoke := func() {
+		toolCtx := tools.OnStart(ctx, info, &tool.CallbackInput{ArgumentsInJSON: `{"id": "42"}`})
+		tools.OnEnd(toolCtx, info, &tool.CallbackOutput{Response: "shipped"})
+	}
+
+	invoke()
+	_ = callback(&Event{AgentEvent: &adk.AgentEvent{AgentName: "support"}})
+	stop()
+	invoke()
+	_ = callback(&Event{AgentEvent: &adk.AgentEvent{AgentName: "support"}})
+
+	if len(events) != 3 {
+		t.Fatalf("Forward() passed %d events, want the 3 before stop", len(events))
+	}
+	for i, want := range []streaming.EventType{streaming.EventTypeToolCall, streaming.EventTypeToolResult} {
+		if events[i].Tool == nil || events[i].Tool.Type != want {
+			t.Errorf("event %d = %+v, want a %s", i, events[i], want)
+		}
+	}
+	if events[2].Tool != nil || events[2].AgentEvent == nil {
+		t.Errorf("last event = %+v, want the agent event", events[2])
+	}
+}
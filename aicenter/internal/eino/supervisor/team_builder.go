@@ -27,6 +27,45 @@ type SupervisorConfig struct {
 	SupervisorInstruction string
 	SupervisorProvider    *llm.ProviderConfig
 	Agents                []*agent.AgentConfig
+	// Mode is how the agents work together, ModeSupervisor when empty
+	Mode Mode
+}
+
+// Snapshot describes the team config, without provider credentials
+func (c *SupervisorConfig) Snapshot(ctx context.Context) map[string]interface{} {
+	agents := make([]map[string]interface{}, 0, len(c.Agents))
+	for _, a := range c.Agents {
+		agents = append(agents, a.Snapshot(ctx))
+	}
+	return map[string]interface{}{
+		"name":                   c.Name,
+		"supervisor_instruction": c.SupervisorInstruction,
+		"supervisor_provider":    c.SupervisorProvider.Snapshot(),
+		"agents":                 agents,
+		"mode":                   c.mode(),
+	}
+}
+
+// mode returns the mode of the team, defaulting to ModeSupervisor
+func (c *SupervisorConfig) mode() Mode {
+	if c.Mode == "" {
+		return ModeSupervisor
+	}
+	return c.Mode
+}
+
+// SupportsVision reports whether the supervisor and every agent of the team
+// accept images, all of them see the user input
+func (c *SupervisorConfig) SupportsVision() bool {
+	if !c.SupervisorProvider.SupportsVision() {
+		return false
+	}
+	for _, a := range c.Agents {
+		if !a.Provider.SupportsVision() {
+			return false
+		}
+	}
+	return true
 }
 
 type SupervisorBuilder struct {
@@ -52,6 +91,18 @@ func (b *SupervisorBuilder) Build(ctx context.Context, cfg *SupervisorConfig) (a
 		subAgents = append(subAgents, agent)
 	}
 
+	switch cfg.mode() {
+	case ModeSupervisor:
+	case ModePlanExecute:
+		return b.buildPlanExecute(ctx, cfg, subAgents)
+	case ModeSequential:
+		return b.buildSequential(ctx, cfg, subAgents)
+	case ModeParallel:
+		return b.buildParallel(ctx, cfg, subAgents)
+	default:
+		return nil, fmt.Errorf("unknown team execution mode %q", cfg.Mode)
+	}
+
 	// Build supervisor model
 	supervisorModel, err := b.llmFactory.CreateToolCalling(ctx, cfg.SupervisorProvider)
 	if err != nil {
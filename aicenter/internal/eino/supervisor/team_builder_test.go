@@ -0,0 +1,60 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tgo/captain/aicenter/internal/eino/agent"
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+)
+
+func TestBuildModes(t *testing.T) {
+	// Building a team creates the models without calling them
+	provider := &llm.ProviderConfig{Kind: llm.ProviderKind("openai"), APIKey: "test-key", Model: "gpt-test", BaseURL: "http://127.0.0.1:1/v1"}
+	factory := llm.NewFactory()
+	builder := NewSupervisorBuilder(agent.NewBuilder(factory), factory)
+
+	tests := []struct {
+		mode            Mode
+		wantName        string
+		wantDescription string
+		wantErr         bool
+	}{
+		{mode: "", wantName: "team_supervisor", wantDescription: "Supervisor for team: team"},
+		{mode: ModeSupervisor, wantName: "team_supervisor", wantDescription: "Supervisor for team: team"},
+		{mode: ModePlanExecute, wantName: "plan_execute_replan"},
+		{mode: ModeSequential, wantName: "team", wantDescription: "Sequential team: team"},
+		{mode: ModeParallel, wantName: "team", wantDescription: "Parallel team: team"},
+		{mode: "round_robin", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			ctx := context.Background()
+			team, err := builder.Build(ctx, &SupervisorConfig{
+				Name:               "team",
+				SupervisorProvider: provider,
+				Mode:               tt.mode,
+				Agents: []*agent.AgentConfig{
+					{Name: "billing", Description: "Answers billing questions", Provider: provider},
+					{Name: "shipping", Description: "Tracks orders", Provider: provider},
+				},
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Build() built %s, want an error", team.Name(ctx))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if name := team.Name(ctx); name != tt.wantName {
+				t.Errorf("Build() agent name = %q, want %q", name, tt.wantName)
+			}
+			if description := team.Description(ctx); description != tt.wantDescription {
+				t.Errorf("Build() agent description = %q, want %q", description, tt.wantDescription)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ApprovalRequest describes a tool call waiting for approval, it is the info
+// of the interrupt raised by the call
+type ApprovalRequest struct {
+	ToolName   string `json:"tool_name"`
+	ToolCallID string `json:"tool_call_id"`
+	Arguments  string `json:"arguments"`
+}
+
+// ApprovalDecision is the resume data of an interrupted tool call
+type ApprovalDecision struct {
+	Approved bool   `json:"approved"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+func init() {
+	schema.RegisterName[*ApprovalRequest]("captain_tool_approval_request")
+	schema.RegisterName[*ApprovalDecision]("captain_tool_approval_decision")
+}
+
+// approvalTool pauses the run before each call of the wrapped tool. The call
+// runs once the run is resumed with an approving decision, a rejected call is
+// reported to the model instead.
+type approvalTool struct {
+	tool.InvokableTool
+}
+
+// RequireApproval wraps a tool so that its calls wait for approval. Tools
+// that are not invokable are returned as is.
+func RequireApproval(t tool.BaseTool) tool.BaseTool {
+	invokable, ok := t.(tool.InvokableTool)
+	if !ok {
+		return t
+	}
+	return &approvalTool{InvokableTool: invokable}
+}
+
+func (t *approvalTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	info, err := t.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	wasInterrupted, _, arguments := compose.GetInterruptState[string](ctx)
+	if !wasInterrupted {
+		arguments = argumentsInJSON
+	}
+	request := &ApprovalRequest{
+		ToolName:   info.Name,
+		ToolCallID: compose.GetToolCallID(ctx),
+		Arguments:  arguments,
+	}
+	if !wasInterrupted {
+		return "", compose.StatefulInterrupt(ctx, request, arguments)
+	}
+
+	// Another call of the run was resumed, keep waiting
+	isResumeTarget, hasData, decision := compose.GetResumeContext[*ApprovalDecision](ctx)
+	if !isResumeTarget {
+		return "", compose.StatefulInterrupt(ctx, request, arguments)
+	}
+	if !hasData || decision == nil {
+		return "", fmt.Errorf("tool %s resumed without a decision", info.Name)
+	}
+
+	if !decision.Approved {
+		result := fmt.Sprintf("The call of %s was rejected by staff and was not executed.", info.Name)
+		if decision.Comment != "" {
+			result += " Reason: " + decision.Comment
+		}
+		return result, nil
+	}
+	return t.InvokableTool.InvokableRun(ctx, arguments, opts...)
+}
+
+// refusedTool refuses the calls of a tool that require approval in runs that
+// cannot pause for it
+type refusedTool struct {
+	tool.InvokableTool
+}
+
+// RefuseUnapproved wraps a tool whose calls require approval, for runs that
+// cannot pause until staff decide them: its calls are not executed and the
+// model is told so. Tools that are not invokable are returned as is.
+func RefuseUnapproved(t tool.BaseTool) tool.BaseTool {
+	invokable, ok := t.(tool.InvokableTool)
+	if !ok {
+		return t
+	}
+	return &refusedTool{InvokableTool: invokable}
+}
+
+func (t *refusedTool) InvokableRun(ctx context.Context, _ string, _ ...tool.Option) (string, error) {
+	info, err := t.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("The call of %s requires approval by staff and was not executed. "+
+		"Tell the user that staff have to handle this request, and offer to transfer them to a human agent.", info.Name), nil
+}
@@ -0,0 +1,33 @@
+package tool
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+)
+
+func TestRefuseUnapproved(t *testing.T) {
+	inner := &sideEffectTool{name: "refund"}
+	refused, ok := RefuseUnapproved(inner).(tool.InvokableTool)
+	if !ok {
+		t.Fatal("RefuseUnapproved() is not invokable")
+	}
+
+	got, err := refused.InvokableRun(context.Background(), `{"order":"1"}`)
+	if err != nil {
+		t.Fatalf("InvokableRun() error = %v", err)
+	}
+	if inner.calls != 0 {
+		t.Errorf("the refused tool was called %d times", inner.calls)
+	}
+	if !strings.Contains(got, "refund") || !strings.Contains(got, "not executed") {
+		t.Errorf("InvokableRun() = %q, want the model told the call was not executed", got)
+	}
+
+	info, err := refused.Info(context.Background())
+	if err != nil || info.Name != "refund" {
+		t.Errorf("Info() = %v, %v, want the info of the wrapped tool", info, err)
+	}
+}
@@ -36,6 +36,11 @@ func NewCalculatorTool() *CalculatorTool {
 	}
 }
 
+// ReadOnly is true, calculations have no side effects
+func (t *CalculatorTool) ReadOnly() bool {
+	return true
+}
+
 func (t *CalculatorTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
 	return t.toolInfo, nil
 }
@@ -32,6 +32,11 @@ func NewDateTimeTool() *DateTimeTool {
 	}
 }
 
+// ReadOnly is true, reading the time has no side effects
+func (t *DateTimeTool) ReadOnly() bool {
+	return true
+}
+
 func (t *DateTimeTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
 	return t.toolInfo, nil
 }
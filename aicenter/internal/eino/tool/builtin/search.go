@@ -38,6 +38,11 @@ func NewDuckDuckGoSearchTool() *DuckDuckGoSearchTool {
 	}
 }
 
+// ReadOnly is true, searching has no side effects
+func (t *DuckDuckGoSearchTool) ReadOnly() bool {
+	return true
+}
+
 func (t *DuckDuckGoSearchTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
 	return t.toolInfo, nil
 }
@@ -45,6 +45,11 @@ func NewRAGRetrieveTool(client *rag.Client, collectionID, collectionName string)
 	}
 }
 
+// ReadOnly is true, retrieval has no side effects
+func (t *RAGRetrieveTool) ReadOnly() bool {
+	return true
+}
+
 func (t *RAGRetrieveTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
 	return t.toolInfo, nil
 }
@@ -0,0 +1,96 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ReadOnlyTool is implemented by tools whose calls have no side effects, so
+// they may run again when a run is replayed
+type ReadOnlyTool interface {
+	ReadOnly() bool
+}
+
+// IsReadOnly reports whether the calls of a tool have no side effects
+func IsReadOnly(t tool.BaseTool) bool {
+	readOnly, ok := t.(ReadOnlyTool)
+	return ok && readOnly.ReadOnly()
+}
+
+// RecordedCall is a tool call of a recorded run with the result it returned
+type RecordedCall struct {
+	Name      string
+	Arguments string
+	Result    string
+}
+
+// RecordedCalls hands out the recorded results of the tool calls of a run,
+// each at most once
+type RecordedCalls struct {
+	mu    sync.Mutex
+	calls []RecordedCall
+	used  []bool
+}
+
+// NewRecordedCalls creates the recorded results of a run, in call order
+func NewRecordedCalls(calls []RecordedCall) *RecordedCalls {
+	return &RecordedCalls{calls: calls, used: make([]bool, len(calls))}
+}
+
+// Take returns the result of the first unused call of the tool with the same
+// arguments, or else of the first unused call of the tool
+func (r *RecordedCalls) Take(name, arguments string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := -1
+	for i, call := range r.calls {
+		if r.used[i] || call.Name != name {
+			continue
+		}
+		if call.Arguments == arguments {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return "", false
+	}
+	r.used[match] = true
+	return r.calls[match].Result, true
+}
+
+// replayedTool answers the calls of a tool with the results recorded by the
+// run being replayed, without running the tool
+type replayedTool struct {
+	tool     tool.BaseTool
+	recorded *RecordedCalls
+}
+
+// Replayed wraps a tool so that its calls return the recorded results instead
+// of running again. Calls the recorded run did not make are not executed.
+func Replayed(t tool.BaseTool, recorded *RecordedCalls) tool.BaseTool {
+	return &replayedTool{tool: t, recorded: recorded}
+}
+
+func (t *replayedTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return t.tool.Info(ctx)
+}
+
+func (t *replayedTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	info, err := t.tool.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	if result, ok := t.recorded.Take(info.Name, argumentsInJSON); ok {
+		return result, nil
+	}
+	return fmt.Sprintf("The call of %s was not executed: this run is a replay and the recorded run has no result for it.", info.Name), nil
+}
@@ -0,0 +1,90 @@
+package tool
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/tgo/captain/aicenter/pkg/external/rag"
+)
+
+// sideEffectTool counts its calls, like a tool creating tickets
+type sideEffectTool struct {
+	name  string
+	calls int
+}
+
+func (t *sideEffectTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name}, nil
+}
+
+func (t *sideEffectTool) InvokableRun(context.Context, string, ...tool.Option) (string, error) {
+	t.calls++
+	return "executed", nil
+}
+
+func TestRecordedCallsTake(t *testing.T) {
+	recorded := NewRecordedCalls([]RecordedCall{
+		{Name: "refund", Arguments: `{"order":"1"}`, Result: "refunded 1"},
+		{Name: "refund", Arguments: `{"order":"2"}`, Result: "refunded 2"},
+		{Name: "create_ticket", Arguments: `{}`, Result: "ticket 7"},
+	})
+
+	steps := []struct {
+		name      string
+		arguments string
+		want      string
+		wantOK    bool
+	}{
+		{name: "refund", arguments: `{"order":"2"}`, want: "refunded 2", wantOK: true},
+		{name: "refund", arguments: `{"order":"3"}`, want: "refunded 1", wantOK: true},
+		{name: "refund", arguments: `{"order":"2"}`, wantOK: false},
+		{name: "create_ticket", arguments: `{"title":"x"}`, want: "ticket 7", wantOK: true},
+		{name: "unknown", arguments: `{}`, wantOK: false},
+	}
+	for i, step := range steps {
+		got, ok := recorded.Take(step.name, step.arguments)
+		if ok != step.wantOK || got != step.want {
+			t.Errorf("step %d: Take(%s, %s) = %q, %v, want %q, %v", i, step.name, step.arguments, got, ok, step.want, step.wantOK)
+		}
+	}
+}
+
+func TestReplayedDoesNotRunTool(t *testing.T) {
+	ctx := context.Background()
+	refund := &sideEffectTool{name: "refund"}
+	recorded := NewRecordedCalls([]RecordedCall{{Name: "refund", Arguments: `{"order":"1"}`, Result: "refunded 1"}})
+	replayed := Replayed(refund, recorded).(tool.InvokableTool)
+
+	info, err := replayed.Info(ctx)
+	if err != nil || info.Name != "refund" {
+		t.Fatalf("Info() = %v, %v, want the wrapped tool info", info, err)
+	}
+
+	got, err := replayed.InvokableRun(ctx, `{"order":"1"}`)
+	if err != nil || got != "refunded 1" {
+		t.Errorf("InvokableRun() = %q, %v, want the recorded result", got, err)
+	}
+	got, err = replayed.InvokableRun(ctx, `{"order":"1"}`)
+	if err != nil || !strings.Contains(got, "not executed") {
+		t.Errorf("InvokableRun() of an unrecorded call = %q, %v, want a not executed notice", got, err)
+	}
+	if refund.calls != 0 {
+		t.Errorf("the replayed tool ran %d times", refund.calls)
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	if IsReadOnly(&sideEffectTool{name: "refund"}) {
+		t.Error("IsReadOnly() = true for a tool with side effects")
+	}
+	if !IsReadOnly(NewRAGRetrieveTool(rag.NewClient("http://localhost"), "c", "docs")) {
+		t.Error("IsReadOnly() = false for a retrieval tool")
+	}
+	if !IsReadOnly(NewGetVisitorInfoTool(nil, "", "")) {
+		t.Error("IsReadOnly() = false for get_visitor_info")
+	}
+}
@@ -162,6 +162,11 @@ func (t *GetVisitorInfoTool) Info(ctx context.Context) (*schema.ToolInfo, error)
 	}, nil
 }
 
+// ReadOnly 只读取访客资料，没有副作用
+func (t *GetVisitorInfoTool) ReadOnly() bool {
+	return true
+}
+
 // InvokableRun 执行工具
 func (t *GetVisitorInfoTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
 	if t.visitorID == "" {
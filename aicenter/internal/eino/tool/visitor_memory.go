@@ -0,0 +1,73 @@
+package tool
+
+import (
+	"context"
+	"log"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+)
+
+// RememberVisitorFactRequest is the input schema for remember visitor fact tool
+type RememberVisitorFactRequest struct {
+	Content  string `json:"content" jsonschema_description:"The fact to remember, short and self-contained, e.g. 'Has order #123', 'Prefers English'"`
+	Category string `json:"category,omitempty" jsonschema_description:"One of 'fact', 'preference' or 'status', e.g. 'status' for 'VIP'" jsonschema:"enum=fact,enum=preference,enum=status"`
+}
+
+// RememberVisitorFactResponse is the output schema for remember visitor fact tool
+type RememberVisitorFactResponse struct {
+	Success bool   `json:"success" jsonschema_description:"Whether the fact was remembered"`
+	Message string `json:"message" jsonschema_description:"A message describing the result"`
+}
+
+// RememberVisitorFactCallback is the callback function type for remembering a visitor fact
+type RememberVisitorFactCallback func(ctx context.Context, content, category string) error
+
+// RememberVisitorFactToolImpl implements the remember visitor fact logic
+type RememberVisitorFactToolImpl struct {
+	callback RememberVisitorFactCallback
+}
+
+const rememberVisitorFactDesc = `Remember a fact about the visitor for future conversations.
+Call this tool when the visitor tells you something worth knowing next time, such as:
+- Facts: orders, purchased products, account details, their city
+- Preferences: language, contact method, communication style
+- Status: VIP, business customer
+
+Do NOT remember small talk or details only relevant to the current question.`
+
+// NewRememberVisitorFactTool creates a new remember visitor fact tool using eino's InferTool
+func NewRememberVisitorFactTool(callback RememberVisitorFactCallback) tool.BaseTool {
+	impl := &RememberVisitorFactToolImpl{callback: callback}
+	t, err := utils.InferTool("remember_visitor_fact", rememberVisitorFactDesc, impl.Invoke)
+	if err != nil {
+		log.Printf("[RememberVisitorFactTool] Failed to create tool: %v", err)
+		return nil
+	}
+	return t
+}
+
+// Invoke is the main function that will be called when the tool is invoked
+func (t *RememberVisitorFactToolImpl) Invoke(ctx context.Context, req *RememberVisitorFactRequest) (*RememberVisitorFactResponse, error) {
+	if req.Content == "" {
+		return &RememberVisitorFactResponse{
+			Success: false,
+			Message: "The content of the fact is required.",
+		}, nil
+	}
+
+	if t.callback != nil {
+		if err := t.callback(ctx, req.Content, req.Category); err != nil {
+			log.Printf("[RememberVisitorFactTool] Callback failed: %v", err)
+			return &RememberVisitorFactResponse{
+				Success: false,
+				Message: "Failed to remember: " + err.Error(),
+			}, nil
+		}
+	}
+
+	return &RememberVisitorFactResponse{
+		Success: true,
+		Message: "Remembered: " + req.Content,
+	}, nil
+}
@@ -0,0 +1,374 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Budget periods, metrics and alert levels
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+
+	MetricTokens   = "tokens"
+	MetricCost     = "cost"
+	MetricRequests = "requests"
+
+	AlertLevelSoft = "soft"
+	AlertLevelHard = "hard"
+)
+
+// Actions the apiserver takes when a run is refused
+const (
+	ActionFallbackMessage = "fallback_message"
+	ActionTransferToHuman = "transfer_to_human"
+)
+
+// DefaultSoftThreshold is the share of a limit that raises a soft alert
+const DefaultSoftThreshold = 0.8
+
+// notifyTimeout bounds the notification of an alert, it survives the run
+// context
+const notifyTimeout = 10 * time.Second
+
+// ErrBudgetExceeded is matched by every *BudgetExceededError
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget limits the usage of a project. Nil limits are unlimited, cost limits
+// are in the currency of the price catalog.
+type Budget struct {
+	ID                  uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID           uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"project_id"`
+	Enabled             bool      `gorm:"not null" json:"enabled"`
+	DailyTokenLimit     *int64    `json:"daily_token_limit"`
+	DailyCostLimit      *float64  `gorm:"type:decimal(12,4)" json:"daily_cost_limit"`
+	DailyRequestLimit   *int64    `json:"daily_request_limit"`
+	MonthlyTokenLimit   *int64    `json:"monthly_token_limit"`
+	MonthlyCostLimit    *float64  `gorm:"type:decimal(12,4)" json:"monthly_cost_limit"`
+	MonthlyRequestLimit *int64    `json:"monthly_request_limit"`
+	// SoftThreshold is the share (0-1] of a limit that raises a soft alert
+	SoftThreshold float64 `gorm:"default:0.8" json:"soft_threshold"`
+	// ExceededAction tells the apiserver what to do with refused runs
+	ExceededAction  string    `gorm:"size:50;default:'fallback_message'" json:"exceeded_action"`
+	FallbackMessage string    `gorm:"type:text" json:"fallback_message"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (Budget) TableName() string {
+	return "usage_budgets"
+}
+
+// Validate checks the limits and action of the budget
+func (b *Budget) Validate() error {
+	for _, l := range []*int64{b.DailyTokenLimit, b.DailyRequestLimit, b.MonthlyTokenLimit, b.MonthlyRequestLimit} {
+		if l != nil && *l < 0 {
+			return fmt.Errorf("limits must not be negative")
+		}
+	}
+	for _, l := range []*float64{b.DailyCostLimit, b.MonthlyCostLimit} {
+		if l != nil && *l < 0 {
+			return fmt.Errorf("limits must not be negative")
+		}
+	}
+	if b.SoftThreshold <= 0 || b.SoftThreshold > 1 {
+		return fmt.Errorf("soft_threshold must be greater than 0 and at most 1")
+	}
+	switch b.ExceededAction {
+	case ActionFallbackMessage, ActionTransferToHuman:
+	default:
+		return fmt.Errorf("exceeded_action must be %q or %q", ActionFallbackMessage, ActionTransferToHuman)
+	}
+	return nil
+}
+
+// BudgetAlert is raised once per period, metric and level
+type BudgetAlert struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProjectID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_budget_alert_once" json:"project_id"`
+	Period      string    `gorm:"size:20;not null;uniqueIndex:idx_budget_alert_once" json:"period"`
+	PeriodStart time.Time `gorm:"not null;uniqueIndex:idx_budget_alert_once" json:"period_start"`
+	Metric      string    `gorm:"size:20;not null;uniqueIndex:idx_budget_alert_once" json:"metric"`
+	Level       string    `gorm:"size:20;not null;uniqueIndex:idx_budget_alert_once" json:"level"`
+	Limit       float64   `gorm:"type:decimal(20,6)" json:"limit"`
+	Used        float64   `gorm:"type:decimal(20,6)" json:"used"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (BudgetAlert) TableName() string {
+	return "usage_budget_alerts"
+}
+
+// BudgetExceededError is returned when a hard limit of the project is reached
+type BudgetExceededError struct {
+	Period          string  `json:"period"`
+	Metric          string  `json:"metric"`
+	Limit           float64 `json:"limit"`
+	Used            float64 `json:"used"`
+	Action          string  `json:"action"`
+	FallbackMessage string  `json:"fallback_message,omitempty"`
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("%s %s budget exceeded: used %g of %g", e.Period, e.Metric, e.Used, e.Limit)
+}
+
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// PeriodUsage is the usage of a project in a budget period
+type PeriodUsage struct {
+	PeriodStart time.Time `json:"period_start"`
+	Tokens      int64     `json:"tokens"`
+	Cost        float64   `json:"cost"`
+	Requests    int64     `json:"requests"`
+}
+
+func (u *PeriodUsage) value(metric string) float64 {
+	switch metric {
+	case MetricTokens:
+		return float64(u.Tokens)
+	case MetricCost:
+		return u.Cost
+	default:
+		return float64(u.Requests)
+	}
+}
+
+// BudgetStatus is a budget with the usage of the current periods
+type BudgetStatus struct {
+	Budget  *Budget      `json:"budget"`
+	Daily   *PeriodUsage `json:"daily"`
+	Monthly *PeriodUsage `json:"monthly"`
+}
+
+type budgetLimit struct {
+	period string
+	metric string
+	limit  float64
+}
+
+func (b *Budget) limits() []budgetLimit {
+	var out []budgetLimit
+	addInt := func(period, metric string, l *int64) {
+		if l != nil {
+			out = append(out, budgetLimit{period, metric, float64(*l)})
+		}
+	}
+	addFloat := func(period, metric string, l *float64) {
+		if l != nil {
+			out = append(out, budgetLimit{period, metric, *l})
+		}
+	}
+	addInt(PeriodDaily, MetricTokens, b.DailyTokenLimit)
+	addFloat(PeriodDaily, MetricCost, b.DailyCostLimit)
+	addInt(PeriodDaily, MetricRequests, b.DailyRequestLimit)
+	addInt(PeriodMonthly, MetricTokens, b.MonthlyTokenLimit)
+	addFloat(PeriodMonthly, MetricCost, b.MonthlyCostLimit)
+	addInt(PeriodMonthly, MetricRequests, b.MonthlyRequestLimit)
+	return out
+}
+
+// AlertNotifier tells the project about its budget alerts
+type AlertNotifier interface {
+	NotifyBudgetAlert(ctx context.Context, alert *BudgetAlert) error
+}
+
+// BudgetGuard stores project budgets and enforces them before runs
+type BudgetGuard struct {
+	db       *gorm.DB
+	notifier AlertNotifier
+}
+
+// NewBudgetGuard creates a budget guard
+func NewBudgetGuard(db *gorm.DB) *BudgetGuard {
+	return &BudgetGuard{db: db}
+}
+
+// SetNotifier sends every alert to notifier the first time it is raised,
+// alerts are only recorded without one
+func (g *BudgetGuard) SetNotifier(notifier AlertNotifier) {
+	g.notifier = notifier
+}
+
+// Get returns the budget of a project
+func (g *BudgetGuard) Get(ctx context.Context, projectID uuid.UUID) (*Budget, error) {
+	var budget Budget
+	if err := g.db.WithContext(ctx).First(&budget, "project_id = ?", projectID).Error; err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// Save creates or updates the budget of a project
+func (g *BudgetGuard) Save(ctx context.Context, budget *Budget) error {
+	if budget.ID == uuid.Nil {
+		budget.ID = uuid.New()
+	}
+	return g.db.WithContext(ctx).Save(budget).Error
+}
+
+// Delete removes the budget of a project
+func (g *BudgetGuard) Delete(ctx context.Context, projectID uuid.UUID) error {
+	return g.db.WithContext(ctx).Where("project_id = ?", projectID).Delete(&Budget{}).Error
+}
+
+// ListAlerts returns the alerts of a project, newest first
+func (g *BudgetGuard) ListAlerts(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]BudgetAlert, int64, error) {
+	var alerts []BudgetAlert
+	var total int64
+
+	query := g.db.WithContext(ctx).Model(&BudgetAlert{}).Where("project_id = ?", projectID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&alerts).Error
+	return alerts, total, err
+}
+
+// Status returns the budget of a project with the usage of the current day and month
+func (g *BudgetGuard) Status(ctx context.Context, projectID uuid.UUID) (*BudgetStatus, error) {
+	budget, err := g.Get(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	dayStart, monthStart := periodStarts(time.Now())
+	daily, err := g.periodUsage(ctx, projectID, dayStart)
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := g.periodUsage(ctx, projectID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+	return &BudgetStatus{Budget: budget, Daily: daily, Monthly: monthly}, nil
+}
+
+// Check returns a *BudgetExceededError when a hard limit of the project is
+// reached, and records an alert for every limit past its soft threshold.
+// Usage lookups that fail let the run through.
+func (g *BudgetGuard) Check(ctx context.Context, projectID uuid.UUID) error {
+	budget, err := g.Get(ctx, projectID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[Budget] Failed to load budget of project %s: %v", projectID, err)
+		}
+		return nil
+	}
+	if !budget.Enabled {
+		return nil
+	}
+	limits := budget.limits()
+	if len(limits) == 0 {
+		return nil
+	}
+
+	dayStart, monthStart := periodStarts(time.Now())
+	usageByPeriod := make(map[string]*PeriodUsage, 2)
+	var exceeded *BudgetExceededError
+	for _, l := range limits {
+		start := dayStart
+		if l.period == PeriodMonthly {
+			start = monthStart
+		}
+		u, ok := usageByPeriod[l.period]
+		if !ok {
+			u, err = g.periodUsage(ctx, projectID, start)
+			if err != nil {
+				log.Printf("[Budget] Failed to load %s usage of project %s: %v", l.period, projectID, err)
+				return nil
+			}
+			usageByPeriod[l.period] = u
+		}
+
+		used := u.value(l.metric)
+		switch {
+		case used >= l.limit:
+			g.alert(ctx, projectID, l, start, used, AlertLevelHard)
+			if exceeded == nil {
+				exceeded = &BudgetExceededError{
+					Period:          l.period,
+					Metric:          l.metric,
+					Limit:           l.limit,
+					Used:            used,
+					Action:          budget.ExceededAction,
+					FallbackMessage: budget.FallbackMessage,
+				}
+			}
+		case used >= l.limit*budget.SoftThreshold:
+			g.alert(ctx, projectID, l, start, used, AlertLevelSoft)
+		}
+	}
+
+	if exceeded != nil {
+		return exceeded
+	}
+	return nil
+}
+
+// alert records an alert the first time a level is reached in a period
+func (g *BudgetGuard) alert(ctx context.Context, projectID uuid.UUID, l budgetLimit, periodStart time.Time, used float64, level string) {
+	alert := &BudgetAlert{
+		ID:          uuid.New(),
+		ProjectID:   projectID,
+		Period:      l.period,
+		PeriodStart: periodStart,
+		Metric:      l.metric,
+		Level:       level,
+		Limit:       l.limit,
+		Used:        used,
+	}
+	result := g.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+	if result.Error != nil {
+		log.Printf("[Budget] Failed to record %s alert for project %s: %v", level, projectID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	log.Printf("[Budget] Project %s reached the %s %s %s limit: %g of %g", projectID, level, l.period, l.metric, used, l.limit)
+	if g.notifier == nil {
+		return
+	}
+	go func() {
+		notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+		defer cancel()
+		if err := g.notifier.NotifyBudgetAlert(notifyCtx, alert); err != nil {
+			log.Printf("[Budget] Failed to notify the %s alert of project %s: %v", level, projectID, err)
+		}
+	}()
+}
+
+func (g *BudgetGuard) periodUsage(ctx context.Context, projectID uuid.UUID, start time.Time) (*PeriodUsage, error) {
+	var result PeriodUsage
+	err := g.db.WithContext(ctx).
+		Model(&UsageRecord{}).
+		Select(`
+			COALESCE(SUM(total_tokens), 0) as tokens,
+			COALESCE(SUM(cost), 0) as cost,
+			COUNT(DISTINCT request_id) as requests
+		`).
+		Where("project_id = ? AND created_at >= ?", projectID, start).
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	result.PeriodStart = start
+	return &result, nil
+}
+
+func periodStarts(now time.Time) (day, month time.Time) {
+	day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return day, month
+}
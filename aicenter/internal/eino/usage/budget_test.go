@@ -0,0 +1,65 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// recordingNotifier passes the alerts it is told about to a channel
+type recordingNotifier struct {
+	alerts chan *BudgetAlert
+}
+
+func (n *recordingNotifier) NotifyBudgetAlert(_ context.Context, alert *BudgetAlert) error {
+	n.alerts <- alert
+	return nil
+}
+
+func TestBudgetGuardNotifiesNewAlerts(t *testing.T) {
+	tests := []struct {
+		name       string
+		inserted   int64
+		wantNotify bool
+	}{
+		{name: "first alert of the period", inserted: 1, wantNotify: true},
+		{name: "alert already raised", inserted: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dryRunDB(t)
+			// The dry run inserts nothing, report the rows the insert would add
+			if err := db.Callback().Create().After("gorm:create").Register("test:rows", func(tx *gorm.DB) {
+				tx.RowsAffected = tt.inserted
+			}); err != nil {
+				t.Fatalf("register callback: %v", err)
+			}
+			notifier := &recordingNotifier{alerts: make(chan *BudgetAlert, 1)}
+			g := NewBudgetGuard(db)
+			g.SetNotifier(notifier)
+
+			projectID := uuid.New()
+			periodStart := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+			g.alert(context.Background(), projectID, budgetLimit{period: PeriodDaily, metric: MetricCost, limit: 10}, periodStart, 8.5, AlertLevelSoft)
+
+			select {
+			case alert := <-notifier.alerts:
+				if !tt.wantNotify {
+					t.Fatalf("notified %+v, want no notification", alert)
+				}
+				if alert.ProjectID != projectID || alert.Level != AlertLevelSoft || alert.Metric != MetricCost ||
+					alert.Period != PeriodDaily || alert.Limit != 10 || alert.Used != 8.5 {
+					t.Errorf("notified %+v", alert)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantNotify {
+					t.Fatal("the alert was not notified")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	template "github.com/cloudwego/eino/utils/callbacks"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+)
+
+const (
+	// trackTimeout bounds the write of a single usage record
+	trackTimeout = 5 * time.Second
+	// streamDrainTimeout bounds how long Counter.Usage waits for streams
+	// still being counted
+	streamDrainTimeout = 2 * time.Second
+)
+
+// Scope identifies who a model call is made for. Model calls made outside of
+// a Scope are not recorded.
+type Scope struct {
+	ProjectID uuid.UUID
+	TeamID    *uuid.UUID
+	// AgentID is used when the call is not made inside one of Agents
+	AgentID   *uuid.UUID
+	SessionID string
+	RequestID string
+	// Agents maps agent names to ids, so calls made by an ADK agent are
+	// attributed to it
+	Agents map[string]uuid.UUID
+}
+
+type scopeKey struct{}
+type counterKey struct{}
+type agentKey struct{}
+type startKey struct{}
+
+// WithScope attaches a usage scope to ctx. Fields left empty are inherited
+// from the scope already in ctx.
+func WithScope(ctx context.Context, scope *Scope) context.Context {
+	if parent := scopeFromContext(ctx); parent != nil {
+		merged := *scope
+		if merged.ProjectID == uuid.Nil {
+			merged.ProjectID = parent.ProjectID
+		}
+		if merged.TeamID == nil {
+			merged.TeamID = parent.TeamID
+		}
+		if merged.AgentID == nil {
+			merged.AgentID = parent.AgentID
+		}
+		if merged.SessionID == "" {
+			merged.SessionID = parent.SessionID
+		}
+		if merged.RequestID == "" {
+			merged.RequestID = parent.RequestID
+		}
+		if merged.Agents == nil {
+			merged.Agents = parent.Agents
+		}
+		scope = &merged
+	}
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+func scopeFromContext(ctx context.Context) *Scope {
+	scope, _ := ctx.Value(scopeKey{}).(*Scope)
+	return scope
+}
+
+// Counter sums the token usage of the model calls made with its context
+type Counter struct {
+	mu      sync.Mutex
+	usage   TokenUsage
+	streams sync.WaitGroup
+}
+
+// WithCounter attaches a Counter to ctx, reusing the one already attached
+func WithCounter(ctx context.Context) (context.Context, *Counter) {
+	if c, ok := ctx.Value(counterKey{}).(*Counter); ok {
+		return ctx, c
+	}
+	c := &Counter{}
+	return context.WithValue(ctx, counterKey{}, c), c
+}
+
+func (c *Counter) add(promptTokens, completionTokens int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usage.PromptTokens += promptTokens
+	c.usage.CompletionTokens += completionTokens
+	c.usage.TotalTokens += promptTokens + completionTokens
+}
+
+// Usage returns the tokens counted so far. It briefly waits for streamed
+// calls whose usage has not been read yet.
+func (c *Counter) Usage() TokenUsage {
+	done := make(chan struct{})
+	go func() {
+		c.streams.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(streamDrainTimeout):
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage
+}
+
+// callbackHandler records the usage of every chat model call
+type callbackHandler struct {
+	tracker *Tracker
+}
+
+// NewCallbackHandler returns an eino callback handler that records token usage
+// of chat model calls. Register it with callbacks.AppendGlobalHandlers.
+func NewCallbackHandler(tracker *Tracker) callbacks.Handler {
+	h := &callbackHandler{tracker: tracker}
+
+	graphHandler := callbacks.NewHandlerBuilder().
+		OnStartFn(h.onGraphStart).
+		Build()
+
+	return template.NewHandlerHelper().
+		ChatModel(&template.ModelCallbackHandler{
+			OnStart:               h.onStart,
+			OnEnd:                 h.onEnd,
+			OnEndWithStreamOutput: h.onEndWithStreamOutput,
+			OnError:               h.onError,
+		}).
+		Graph(graphHandler).
+		Handler()
+}
+
+// onGraphStart tags the context with the agent whose graph is starting;
+// ADK agents compile their graph under the agent name
+func (h *callbackHandler) onGraphStart(ctx context.Context, info *callbacks.RunInfo, _ callbacks.CallbackInput) context.Context {
+	scope := scopeFromContext(ctx)
+	if scope == nil || info == nil || len(scope.Agents) == 0 {
+		return ctx
+	}
+	if id, ok := scope.Agents[info.Name]; ok {
+		return context.WithValue(ctx, agentKey{}, id)
+	}
+	return ctx
+}
+
+func (h *callbackHandler) onStart(ctx context.Context, _ *callbacks.RunInfo, _ *model.CallbackInput) context.Context {
+	if scopeFromContext(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, startKey{}, time.Now())
+}
+
+func (h *callbackHandler) onEnd(ctx context.Context, info *callbacks.RunInfo, output *model.CallbackOutput) context.Context {
+	if scopeFromContext(ctx) == nil || output == nil {
+		return ctx
+	}
+	var modelName string
+	if output.Config != nil {
+		modelName = output.Config.Model
+	}
+	h.record(ctx, info, modelName, output.TokenUsage, nil)
+	return ctx
+}
+
+// onEndWithStreamOutput drains the stream copy in the background; providers
+// report usage in the last chunk
+func (h *callbackHandler) onEndWithStreamOutput(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[*model.CallbackOutput]) context.Context {
+	if scopeFromContext(ctx) == nil {
+		output.Close()
+		return ctx
+	}
+
+	counter, _ := ctx.Value(counterKey{}).(*Counter)
+	if counter != nil {
+		counter.streams.Add(1)
+	}
+
+	go func() {
+		defer output.Close()
+		if counter != nil {
+			defer counter.streams.Done()
+		}
+
+		var modelName string
+		var tokenUsage *model.TokenUsage
+		var streamErr error
+		for {
+			chunk, err := output.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				streamErr = err
+				break
+			}
+			if chunk == nil {
+				continue
+			}
+			if chunk.Config != nil && chunk.Config.Model != "" {
+				modelName = chunk.Config.Model
+			}
+			tokenUsage = mergeTokenUsage(tokenUsage, chunk.TokenUsage)
+		}
+		h.record(ctx, info, modelName, tokenUsage, streamErr)
+	}()
+	return ctx
+}
+
+func (h *callbackHandler) onError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	if scopeFromContext(ctx) == nil {
+		return ctx
+	}
+	h.record(ctx, info, "", nil, err)
+	return ctx
+}
+
+func (h *callbackHandler) record(ctx context.Context, info *callbacks.RunInfo, modelName string, tokenUsage *model.TokenUsage, callErr error) {
+	scope := scopeFromContext(ctx)
+
+	var promptTokens, completionTokens int
+	if tokenUsage != nil {
+		promptTokens = tokenUsage.PromptTokens
+		completionTokens = tokenUsage.CompletionTokens
+	}
+	if c, ok := ctx.Value(counterKey{}).(*Counter); ok {
+		c.add(promptTokens, completionTokens)
+	}
+
+	req := &TrackRequest{
+		ProjectID:        scope.ProjectID,
+		AgentID:          scope.AgentID,
+		TeamID:           scope.TeamID,
+		SessionID:        scope.SessionID,
+		RequestID:        scope.RequestID,
+		Model:            modelName,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Success:          callErr == nil,
+	}
+	if tokenUsage != nil {
+		req.CachedTokens = tokenUsage.PromptTokenDetails.CachedTokens
+		req.ReasoningTokens = tokenUsage.CompletionTokensDetails.ReasoningTokens
+	}
+	if id, ok := ctx.Value(agentKey{}).(uuid.UUID); ok {
+		req.AgentID = &id
+	}
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		req.LatencyMs = time.Since(start).Milliseconds()
+	}
+	if kind, callModel, ok := llm.CallProvider(ctx); ok {
+		req.ProviderKind = kind
+		if req.Model == "" {
+			req.Model = callModel
+		}
+	} else if info != nil {
+		req.ProviderKind = string(llm.NormalizeProviderKind(info.Type))
+	}
+	if callErr != nil {
+		req.ErrorMessage = callErr.Error()
+	}
+
+	// Persist outside of the call path so a slow database does not delay the run
+	go func() {
+		trackCtx, cancel := context.WithTimeout(context.Background(), trackTimeout)
+		defer cancel()
+		if err := h.tracker.Track(trackCtx, req); err != nil {
+			log.Printf("[Usage] Failed to record usage for %s/%s: %v", req.ProviderKind, req.Model, err)
+		}
+	}()
+}
+
+// mergeTokenUsage keeps the largest count of each field, since providers
+// report either cumulative or final usage on stream chunks
+func mergeTokenUsage(acc, next *model.TokenUsage) *model.TokenUsage {
+	if next == nil {
+		return acc
+	}
+	if acc == nil {
+		out := *next
+		return &out
+	}
+	acc.PromptTokens = max(acc.PromptTokens, next.PromptTokens)
+	acc.PromptTokenDetails.CachedTokens = max(acc.PromptTokenDetails.CachedTokens, next.PromptTokenDetails.CachedTokens)
+	acc.CompletionTokens = max(acc.CompletionTokens, next.CompletionTokens)
+	acc.CompletionTokensDetails.ReasoningTokens = max(acc.CompletionTokensDetails.ReasoningTokens, next.CompletionTokensDetails.ReasoningTokens)
+	acc.TotalTokens = max(acc.TotalTokens, next.TotalTokens)
+	return acc
+}
@@ -1,6 +1,8 @@
 package usage
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,11 +20,15 @@ type UsageRecord struct {
 	ProviderKind     string         `gorm:"size:50"`
 	Model            string         `gorm:"size:100"`
 	PromptTokens     int            `gorm:"default:0"`
+	CachedTokens     int            `gorm:"default:0"` // part of PromptTokens
 	CompletionTokens int            `gorm:"default:0"`
+	ReasoningTokens  int            `gorm:"default:0"` // part of CompletionTokens
 	TotalTokens      int            `gorm:"default:0"`
 	Cost             float64        `gorm:"type:decimal(10,6);default:0"`
+	Currency         string         `gorm:"size:3"`
+	PriceID          *uuid.UUID     `gorm:"type:uuid;index"` // nil when no price was configured
 	LatencyMs        int64          `gorm:"default:0"`
-	Success          bool           `gorm:"default:true"`
+	Success          bool           `gorm:"not null"` // no default, GORM would omit false from inserts
 	ErrorMessage     string         `gorm:"type:text"`
 	Metadata         JSONMap        `gorm:"type:jsonb"`
 	CreatedAt        time.Time      `gorm:"autoCreateTime"`
@@ -36,6 +42,32 @@ func (UsageRecord) TableName() string {
 // JSONMap for JSONB storage
 type JSONMap map[string]interface{}
 
+func (j JSONMap) Value() (driver.Value, error) {
+	if j == nil {
+		return nil, nil
+	}
+	return json.Marshal(j)
+}
+
+func (j *JSONMap) Scan(value interface{}) error {
+	if value == nil {
+		*j = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, j)
+}
+
+// TokenUsage is the token count of one or more model calls
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
 // UsageSummary represents aggregated usage statistics
 type UsageSummary struct {
 	ProjectID             uuid.UUID `json:"project_id"`
@@ -46,6 +78,7 @@ type UsageSummary struct {
 	TotalCompletionTokens int64     `json:"total_completion_tokens"`
 	TotalTokens           int64     `json:"total_tokens"`
 	TotalCost             float64   `json:"total_cost"`
+	UnpricedRequests      int64     `json:"unpriced_requests"` // successful calls without a configured price
 	AvgLatencyMs          float64   `json:"avg_latency_ms"`
 	PeriodStart           time.Time `json:"period_start"`
 	PeriodEnd             time.Time `json:"period_end"`
@@ -55,6 +88,7 @@ type UsageSummary struct {
 type UsageByModel struct {
 	Model        string  `json:"model"`
 	ProviderKind string  `json:"provider_kind"`
+	Currency     string  `json:"currency"`
 	RequestCount int64   `json:"request_count"`
 	TotalTokens  int64   `json:"total_tokens"`
 	TotalCost    float64 `json:"total_cost"`
@@ -68,3 +102,13 @@ type UsageByAgent struct {
 	TotalTokens  int64     `json:"total_tokens"`
 	TotalCost    float64   `json:"total_cost"`
 }
+
+// DailyUsage represents usage aggregated per day
+type DailyUsage struct {
+	Date             time.Time `json:"date"`
+	RequestCount     int64     `json:"request_count"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	TotalTokens      int64     `json:"total_tokens"`
+	TotalCost        float64   `json:"total_cost"`
+}
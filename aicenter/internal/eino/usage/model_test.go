@@ -0,0 +1,73 @@
+package usage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB returns a PostgreSQL session that builds statements without
+// running them
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open dry run db: %v", err)
+	}
+	return db
+}
+
+func TestRepositoryCreateFailedRecord(t *testing.T) {
+	for _, success := range []bool{false, true} {
+		db := dryRunDB(t)
+		var stmt *gorm.Statement
+		if err := db.Callback().Create().After("gorm:create").Register("test:capture", func(tx *gorm.DB) {
+			stmt = tx.Statement
+		}); err != nil {
+			t.Fatalf("register callback: %v", err)
+		}
+
+		record := &UsageRecord{
+			ID:           uuid.New(),
+			ProjectID:    uuid.New(),
+			Model:        "gpt-4o",
+			Success:      success,
+			ErrorMessage: "upstream error",
+		}
+		if err := NewRepository(db).Create(context.Background(), record); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+
+		vars := insertVars(stmt)
+		got, ok := vars["success"]
+		if !ok {
+			t.Fatalf("success=%v: INSERT omits the success column: %s", success, stmt.SQL.String())
+		}
+		if got != success {
+			t.Errorf("success=%v: INSERT stores success = %v", success, got)
+		}
+	}
+}
+
+// insertVars maps the columns of a single row INSERT to their values
+func insertVars(stmt *gorm.Statement) map[string]interface{} {
+	vars := make(map[string]interface{})
+	values, ok := stmt.Clauses["VALUES"].Expression.(clause.Values)
+	if !ok || len(values.Values) != 1 {
+		return vars
+	}
+	for i, column := range values.Columns {
+		vars[column.Name] = values.Values[0][i]
+	}
+	return vars
+}
@@ -0,0 +1,301 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultCurrency is used for prices created without a currency
+	DefaultCurrency = "USD"
+	// WildcardPattern matches any provider kind, or any model when used as a
+	// model suffix (e.g. "gpt-4o*")
+	WildcardPattern = "*"
+
+	recomputeBatchSize = 500
+	// costScale is the precision costs are stored with, decimal(10,6)
+	costScale = 1e6
+)
+
+// ModelPrice is the price of a model, per 1M tokens, from EffectiveFrom until
+// a later price for the same provider kind and model takes over
+type ModelPrice struct {
+	ID uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	// ProviderKind is a provider kind (e.g. openai, anthropic) or "*"
+	ProviderKind string `gorm:"size:50;not null;index:idx_model_price_lookup" json:"provider_kind"`
+	// Model is an exact model name, a prefix ending with "*", or "*"
+	Model string `gorm:"size:100;not null;index:idx_model_price_lookup" json:"model"`
+	// InputPrice applies to prompt tokens that were not served from cache
+	InputPrice float64 `gorm:"type:decimal(12,6);not null;default:0" json:"input_price"`
+	// CachedInputPrice applies to cached prompt tokens, InputPrice if nil
+	CachedInputPrice *float64 `gorm:"type:decimal(12,6)" json:"cached_input_price"`
+	// OutputPrice applies to completion tokens other than reasoning tokens
+	OutputPrice float64 `gorm:"type:decimal(12,6);not null;default:0" json:"output_price"`
+	// ReasoningPrice applies to reasoning tokens, OutputPrice if nil
+	ReasoningPrice *float64       `gorm:"type:decimal(12,6)" json:"reasoning_price"`
+	Currency       string         `gorm:"size:3;not null;default:'USD'" json:"currency"`
+	EffectiveFrom  time.Time      `gorm:"not null;index:idx_model_price_lookup" json:"effective_from"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (ModelPrice) TableName() string {
+	return "usage_model_prices"
+}
+
+// Validate checks the price can be stored
+func (p *ModelPrice) Validate() error {
+	if p.ProviderKind == "" {
+		return fmt.Errorf("provider_kind is required")
+	}
+	if p.Model == "" {
+		return fmt.Errorf("model is required")
+	}
+	if strings.Contains(strings.TrimSuffix(p.Model, WildcardPattern), WildcardPattern) {
+		return fmt.Errorf("model may only contain a trailing %q", WildcardPattern)
+	}
+	if p.InputPrice < 0 || p.OutputPrice < 0 {
+		return fmt.Errorf("prices must not be negative")
+	}
+	if (p.CachedInputPrice != nil && *p.CachedInputPrice < 0) || (p.ReasoningPrice != nil && *p.ReasoningPrice < 0) {
+		return fmt.Errorf("prices must not be negative")
+	}
+	if len(p.Currency) != 3 {
+		return fmt.Errorf("currency must be a 3-letter ISO 4217 code")
+	}
+	return nil
+}
+
+// Cost returns the cost of a call, rounded to the precision it is stored with.
+// Reasoning tokens are part of completionTokens and cached tokens part of
+// promptTokens.
+func (p *ModelPrice) Cost(promptTokens, cachedTokens, completionTokens, reasoningTokens int) float64 {
+	cachedTokens = min(cachedTokens, promptTokens)
+	reasoningTokens = min(reasoningTokens, completionTokens)
+
+	cachedPrice := p.InputPrice
+	if p.CachedInputPrice != nil {
+		cachedPrice = *p.CachedInputPrice
+	}
+	reasoningPrice := p.OutputPrice
+	if p.ReasoningPrice != nil {
+		reasoningPrice = *p.ReasoningPrice
+	}
+
+	// Prices are per 1M tokens
+	cost := (float64(promptTokens-cachedTokens)*p.InputPrice +
+		float64(cachedTokens)*cachedPrice +
+		float64(completionTokens-reasoningTokens)*p.OutputPrice +
+		float64(reasoningTokens)*reasoningPrice) / 1000000
+	return math.Round(cost*costScale) / costScale
+}
+
+// matches returns how specifically the price matches a call, or -1
+func (p *ModelPrice) matches(providerKind, model string) int {
+	score := 0
+	switch p.ProviderKind {
+	case providerKind:
+		score += 1 << 20
+	case WildcardPattern:
+	default:
+		return -1
+	}
+
+	if p.Model == model {
+		return score + 1<<19
+	}
+	if prefix, ok := strings.CutSuffix(p.Model, WildcardPattern); ok && strings.HasPrefix(model, prefix) {
+		return score + len(prefix)
+	}
+	return -1
+}
+
+// resolvePrice picks the most specific price in effect at the given time
+func resolvePrice(prices []ModelPrice, providerKind, model string, at time.Time) *ModelPrice {
+	var best *ModelPrice
+	bestScore := -1
+	for i := range prices {
+		p := &prices[i]
+		if p.EffectiveFrom.After(at) {
+			continue
+		}
+		score := p.matches(providerKind, model)
+		if score < 0 {
+			continue
+		}
+		if score > bestScore || (score == bestScore && p.EffectiveFrom.After(best.EffectiveFrom)) {
+			best, bestScore = p, score
+		}
+	}
+	return best
+}
+
+// ListPricesFilter filters the price catalog
+type ListPricesFilter struct {
+	ProviderKind string
+	Model        string
+}
+
+// Catalog stores model prices and prices usage records
+type Catalog struct {
+	db *gorm.DB
+}
+
+// NewCatalog creates a price catalog
+func NewCatalog(db *gorm.DB) *Catalog {
+	return &Catalog{db: db}
+}
+
+// List returns prices, newest effective date first
+func (c *Catalog) List(ctx context.Context, filter ListPricesFilter, limit, offset int) ([]ModelPrice, int64, error) {
+	var prices []ModelPrice
+	var total int64
+
+	query := c.db.WithContext(ctx).Model(&ModelPrice{})
+	if filter.ProviderKind != "" {
+		query = query.Where("provider_kind = ?", filter.ProviderKind)
+	}
+	if filter.Model != "" {
+		query = query.Where("model = ?", filter.Model)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("provider_kind, model, effective_from DESC").Limit(limit).Offset(offset).Find(&prices).Error
+	return prices, total, err
+}
+
+// Get returns a price by ID
+func (c *Catalog) Get(ctx context.Context, id uuid.UUID) (*ModelPrice, error) {
+	var price ModelPrice
+	if err := c.db.WithContext(ctx).First(&price, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &price, nil
+}
+
+// Create adds a price
+func (c *Catalog) Create(ctx context.Context, price *ModelPrice) error {
+	if price.ID == uuid.Nil {
+		price.ID = uuid.New()
+	}
+	return c.db.WithContext(ctx).Create(price).Error
+}
+
+// Update saves a price
+func (c *Catalog) Update(ctx context.Context, price *ModelPrice) error {
+	return c.db.WithContext(ctx).Save(price).Error
+}
+
+// Delete removes a price
+func (c *Catalog) Delete(ctx context.Context, id uuid.UUID) error {
+	return c.db.WithContext(ctx).Delete(&ModelPrice{}, "id = ?", id).Error
+}
+
+// Resolve returns the price of a model at the given time, nil if none is configured
+func (c *Catalog) Resolve(ctx context.Context, providerKind, model string, at time.Time) (*ModelPrice, error) {
+	var prices []ModelPrice
+	err := c.db.WithContext(ctx).
+		Where("provider_kind IN ? AND effective_from <= ?", []string{providerKind, WildcardPattern}, at).
+		Find(&prices).Error
+	if err != nil {
+		return nil, err
+	}
+	return resolvePrice(prices, providerKind, model, at), nil
+}
+
+// Recompute re-prices the usage records a price applies to, of the project or
+// of every project when projectID is nil. It is called with the price before
+// and after a change, so records that no longer match are re-priced too.
+// Without prices it re-prices every record.
+func (c *Catalog) Recompute(ctx context.Context, projectID *uuid.UUID, changed ...*ModelPrice) (int64, error) {
+	var prices []ModelPrice
+	if err := c.db.WithContext(ctx).Find(&prices).Error; err != nil {
+		return 0, err
+	}
+
+	query := c.db.WithContext(ctx).Model(&UsageRecord{})
+	if projectID != nil {
+		query = query.Where("project_id = ?", *projectID)
+	}
+	if len(changed) > 0 {
+		scope := c.db.Where("1 = 0")
+		for _, p := range changed {
+			if p != nil {
+				scope = scope.Or(recordScope(c.db, p))
+			}
+		}
+		query = query.Where(scope)
+	}
+
+	var updated int64
+	var records []UsageRecord
+	err := query.FindInBatches(&records, recomputeBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range records {
+			r := &records[i]
+			cost, priceID, currency := priceRecord(prices, r)
+			if r.Cost == cost && uuidPtrEqual(r.PriceID, priceID) && r.Currency == currency {
+				continue
+			}
+			err := c.db.WithContext(ctx).Model(&UsageRecord{}).
+				Where("id = ?", r.ID).
+				Updates(map[string]interface{}{"cost": cost, "price_id": priceID, "currency": currency}).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return updated, err
+	}
+	return updated, nil
+}
+
+// recordScope selects the usage records a price could apply to
+func recordScope(db *gorm.DB, p *ModelPrice) *gorm.DB {
+	scope := db.Where("created_at >= ?", p.EffectiveFrom)
+	if p.ProviderKind != WildcardPattern {
+		scope = scope.Where("provider_kind = ?", p.ProviderKind)
+	}
+	if prefix, ok := strings.CutSuffix(p.Model, WildcardPattern); ok {
+		if prefix != "" {
+			scope = scope.Where("model LIKE ?", escapeLike(prefix)+"%")
+		}
+	} else {
+		scope = scope.Where("model = ?", p.Model)
+	}
+	return scope
+}
+
+// priceRecord returns the cost, price and currency of a usage record
+func priceRecord(prices []ModelPrice, r *UsageRecord) (float64, *uuid.UUID, string) {
+	price := resolvePrice(prices, r.ProviderKind, r.Model, r.CreatedAt)
+	if price == nil {
+		return 0, nil, ""
+	}
+	id := price.ID
+	return price.Cost(r.PromptTokens, r.CachedTokens, r.CompletionTokens, r.ReasoningTokens), &id, price.Currency
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func uuidPtrEqual(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,269 @@
+package usage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestResolvePrice(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	price := func(name, providerKind, model string, effectiveFrom time.Time) ModelPrice {
+		return ModelPrice{ID: uuid.NewSHA1(uuid.Nil, []byte(name)), ProviderKind: providerKind, Model: model, EffectiveFrom: effectiveFrom}
+	}
+	id := func(name string) uuid.UUID { return uuid.NewSHA1(uuid.Nil, []byte(name)) }
+	lastYear := now.AddDate(-1, 0, 0)
+	lastMonth := now.AddDate(0, -1, 0)
+
+	tests := []struct {
+		name         string
+		prices       []ModelPrice
+		providerKind string
+		model        string
+		want         string
+	}{
+		{
+			name: "exact model beats prefix",
+			prices: []ModelPrice{
+				price("prefix", "openai", "gpt-4o*", lastYear),
+				price("exact", "openai", "gpt-4o-mini", lastYear),
+			},
+			providerKind: "openai", model: "gpt-4o-mini",
+			want: "exact",
+		},
+		{
+			name: "longer prefix beats shorter prefix",
+			prices: []ModelPrice{
+				price("short", "openai", "gpt-*", lastYear),
+				price("long", "openai", "gpt-4o*", lastYear),
+				price("any", "openai", "*", lastYear),
+			},
+			providerKind: "openai", model: "gpt-4o-mini",
+			want: "long",
+		},
+		{
+			name: "provider match beats model match",
+			prices: []ModelPrice{
+				price("wildcard provider", "*", "gpt-4o-mini", lastYear),
+				price("provider", "openai", "*", lastYear),
+			},
+			providerKind: "openai", model: "gpt-4o-mini",
+			want: "provider",
+		},
+		{
+			name: "wildcard provider as fallback",
+			prices: []ModelPrice{
+				price("other provider", "anthropic", "gpt-4o-mini", lastYear),
+				price("wildcard provider", "*", "gpt-4o*", lastYear),
+			},
+			providerKind: "openai", model: "gpt-4o-mini",
+			want: "wildcard provider",
+		},
+		{
+			name: "newest effective price of equal match",
+			prices: []ModelPrice{
+				price("old", "openai", "gpt-4o", lastYear),
+				price("new", "openai", "gpt-4o", lastMonth),
+			},
+			providerKind: "openai", model: "gpt-4o",
+			want: "new",
+		},
+		{
+			name: "future price ignored",
+			prices: []ModelPrice{
+				price("current", "openai", "gpt-4o", lastYear),
+				price("future", "openai", "gpt-4o", now.AddDate(0, 1, 0)),
+			},
+			providerKind: "openai", model: "gpt-4o",
+			want: "current",
+		},
+		{
+			name: "prefix does not match other models",
+			prices: []ModelPrice{
+				price("prefix", "openai", "gpt-4o*", lastYear),
+			},
+			providerKind: "openai", model: "gpt-4",
+		},
+		{
+			name: "other provider does not match",
+			prices: []ModelPrice{
+				price("other provider", "anthropic", "*", lastYear),
+			},
+			providerKind: "openai", model: "gpt-4o",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolvePrice(tt.prices, tt.providerKind, tt.model, now)
+			if tt.want == "" {
+				if got != nil {
+					t.Fatalf("resolvePrice() = %s/%s, want nil", got.ProviderKind, got.Model)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("resolvePrice() = nil, want %q", tt.want)
+			}
+			if got.ID != id(tt.want) {
+				t.Errorf("resolvePrice() = %s/%s effective %s, want %q", got.ProviderKind, got.Model, got.EffectiveFrom, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelPriceCost(t *testing.T) {
+	cached := 0.5
+	reasoning := 20.0
+
+	tests := []struct {
+		name       string
+		price      ModelPrice
+		prompt     int
+		cached     int
+		completion int
+		reasoning  int
+		want       float64
+	}{
+		{
+			name:   "input and output",
+			price:  ModelPrice{InputPrice: 2.5, OutputPrice: 10},
+			prompt: 1000, completion: 500,
+			want: 0.0075,
+		},
+		{
+			name:   "cached and reasoning default to input and output",
+			price:  ModelPrice{InputPrice: 2.5, OutputPrice: 10},
+			prompt: 1000, cached: 400, completion: 500, reasoning: 200,
+			want: 0.0075,
+		},
+		{
+			name:   "cached and reasoning prices",
+			price:  ModelPrice{InputPrice: 2.5, CachedInputPrice: &cached, OutputPrice: 10, ReasoningPrice: &reasoning},
+			prompt: 1000, cached: 400, completion: 500, reasoning: 200,
+			want: 0.0015 + 0.0002 + 0.003 + 0.004,
+		},
+		{
+			name:   "cached and reasoning tokens clamped",
+			price:  ModelPrice{InputPrice: 2.5, CachedInputPrice: &cached, OutputPrice: 10, ReasoningPrice: &reasoning},
+			prompt: 100, cached: 400, completion: 50, reasoning: 200,
+			want: 0.00005 + 0.001,
+		},
+		{
+			name:   "rounded to the stored precision",
+			price:  ModelPrice{InputPrice: 0.15, OutputPrice: 0.6},
+			prompt: 1, completion: 1,
+			want: 0.000001,
+		},
+		{
+			name:   "below the stored precision",
+			price:  ModelPrice{InputPrice: 0.15},
+			prompt: 3,
+			want:   0,
+		},
+		{
+			name:  "no tokens",
+			price: ModelPrice{InputPrice: 2.5, OutputPrice: 10},
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.price.Cost(tt.prompt, tt.cached, tt.completion, tt.reasoning)
+			if diff := got - tt.want; diff > 1e-12 || diff < -1e-12 {
+				t.Errorf("Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelPriceValidate(t *testing.T) {
+	negative := -1.0
+
+	tests := []struct {
+		name    string
+		price   ModelPrice
+		wantErr bool
+	}{
+		{name: "valid", price: ModelPrice{ProviderKind: "openai", Model: "gpt-4o", Currency: "USD"}},
+		{name: "model prefix", price: ModelPrice{ProviderKind: "*", Model: "gpt-4o*", Currency: "USD"}},
+		{name: "missing provider kind", price: ModelPrice{Model: "gpt-4o", Currency: "USD"}, wantErr: true},
+		{name: "missing model", price: ModelPrice{ProviderKind: "openai", Currency: "USD"}, wantErr: true},
+		{name: "inner wildcard", price: ModelPrice{ProviderKind: "openai", Model: "gpt-*-mini", Currency: "USD"}, wantErr: true},
+		{name: "negative price", price: ModelPrice{ProviderKind: "openai", Model: "gpt-4o", InputPrice: -1, Currency: "USD"}, wantErr: true},
+		{name: "negative cached price", price: ModelPrice{ProviderKind: "openai", Model: "gpt-4o", CachedInputPrice: &negative, Currency: "USD"}, wantErr: true},
+		{name: "invalid currency", price: ModelPrice{ProviderKind: "openai", Model: "gpt-4o", Currency: "DOLLAR"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.price.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultPrices(t *testing.T) {
+	prices := DefaultPrices()
+	seen := make(map[uuid.UUID]bool)
+	for _, p := range prices {
+		if err := p.Validate(); err != nil {
+			t.Errorf("default price %s/%s: %v", p.ProviderKind, p.Model, err)
+		}
+		if seen[p.ID] {
+			t.Errorf("default price %s/%s shares its ID", p.ProviderKind, p.Model)
+		}
+		seen[p.ID] = true
+	}
+	if again := DefaultPrices(); again[0].ID != prices[0].ID {
+		t.Error("DefaultPrices() IDs change between calls, seeding would duplicate them")
+	}
+
+	now := time.Now()
+	tests := []struct {
+		providerKind, model string
+		wantModel           string
+	}{
+		{"openai", "gpt-4o", "gpt-4o*"},
+		{"openai", "gpt-4o-mini-2024-07-18", "gpt-4o-mini*"},
+		{"openai", "o3-mini", "o3-mini*"},
+		{"anthropic", "claude-sonnet-4-20250514", "claude-sonnet-4*"},
+		{"anthropic", "claude-3-5-haiku-latest", "claude-3-5-haiku*"},
+		{"google", "gemini-2.0-flash-lite", "gemini-2.0-flash-lite*"},
+		{"ollama", "llama3.1", WildcardPattern},
+		{"ark", "doubao-pro-32k", ""},
+	}
+	for _, tt := range tests {
+		got := resolvePrice(prices, tt.providerKind, tt.model, now)
+		switch {
+		case tt.wantModel == "" && got != nil:
+			t.Errorf("%s/%s is priced by the defaults as %s", tt.providerKind, tt.model, got.Model)
+		case tt.wantModel != "" && (got == nil || got.Model != tt.wantModel):
+			t.Errorf("%s/%s resolved to %+v, want the %s default", tt.providerKind, tt.model, got, tt.wantModel)
+		}
+	}
+}
+
+func TestSeedPricesKeepsExistingPrices(t *testing.T) {
+	db := dryRunDB(t)
+	var sql string
+	if err := db.Callback().Create().After("gorm:create").Register("test:capture", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if err := SeedPrices(context.Background(), db); err != nil {
+		t.Fatalf("SeedPrices() error = %v", err)
+	}
+	if !strings.Contains(sql, `INSERT INTO "usage_model_prices"`) || !strings.Contains(sql, "ON CONFLICT DO NOTHING") {
+		t.Errorf("SeedPrices() = %s, want an insert that leaves existing prices alone", sql)
+	}
+}
@@ -0,0 +1,158 @@
+package usage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Recompute job statuses
+const (
+	RecomputePending   = "pending"
+	RecomputeRunning   = "running"
+	RecomputeCompleted = "completed"
+	RecomputeFailed    = "failed"
+)
+
+const (
+	// recomputeConcurrency is the number of recompute jobs running at once,
+	// the others wait for their turn
+	recomputeConcurrency = 2
+	// recomputeJobTimeout bounds a recompute job once it runs
+	recomputeJobTimeout = 10 * time.Minute
+	// recomputeJobRetention is how long finished jobs can be looked up
+	recomputeJobRetention = time.Hour
+)
+
+// RecomputeJob is a background re-pricing of usage records
+type RecomputeJob struct {
+	ID uuid.UUID `json:"id"`
+	// ProjectID is the project re-priced, nil for every project
+	ProjectID  *uuid.UUID `json:"project_id,omitempty"`
+	Status     string     `json:"status"`
+	Updated    int64      `json:"updated"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Recomputer runs recompute jobs in the background, a few at a time and each
+// within recomputeJobTimeout. A full recompute of a scope already pending or
+// running is not started twice.
+type Recomputer struct {
+	catalog *Catalog
+	slots   chan struct{}
+
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*RecomputeJob
+	// full is the pending or running full recompute of each scope
+	full map[string]*RecomputeJob
+}
+
+// NewRecomputer creates a recompute job runner for the catalog
+func NewRecomputer(catalog *Catalog) *Recomputer {
+	return &Recomputer{
+		catalog: catalog,
+		slots:   make(chan struct{}, recomputeConcurrency),
+		jobs:    make(map[uuid.UUID]*RecomputeJob),
+		full:    make(map[string]*RecomputeJob),
+	}
+}
+
+// Start queues a recompute of the usage of the project, or of every project
+// when projectID is nil, limited to the records the changed prices apply to
+// if any. It returns the state of the job.
+func (r *Recomputer) Start(projectID *uuid.UUID, changed ...*ModelPrice) RecomputeJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune()
+
+	scope := recomputeScope(projectID)
+	if len(changed) == 0 {
+		if job, ok := r.full[scope]; ok {
+			return *job
+		}
+	}
+
+	job := &RecomputeJob{
+		ID:        uuid.New(),
+		ProjectID: projectID,
+		Status:    RecomputePending,
+		CreatedAt: time.Now(),
+	}
+	r.jobs[job.ID] = job
+	if len(changed) == 0 {
+		r.full[scope] = job
+	}
+
+	go r.run(job, changed)
+	return *job
+}
+
+// Get returns the state of a job, false if it is unknown or expired
+func (r *Recomputer) Get(id uuid.UUID) (RecomputeJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return RecomputeJob{}, false
+	}
+	return *job, true
+}
+
+func (r *Recomputer) run(job *RecomputeJob, changed []*ModelPrice) {
+	r.slots <- struct{}{}
+	defer func() { <-r.slots }()
+
+	r.setStatus(job, RecomputeRunning, 0, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), recomputeJobTimeout)
+	defer cancel()
+
+	updated, err := r.catalog.Recompute(ctx, job.ProjectID, changed...)
+	if err != nil {
+		log.Printf("[Usage] Recompute job %s failed after %d usage records: %v", job.ID, updated, err)
+		r.setStatus(job, RecomputeFailed, updated, err)
+		return
+	}
+	log.Printf("[Usage] Recompute job %s re-priced %d usage records", job.ID, updated)
+	r.setStatus(job, RecomputeCompleted, updated, nil)
+}
+
+func (r *Recomputer) setStatus(job *RecomputeJob, status string, updated int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job.Status = status
+	job.Updated = updated
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if status == RecomputeCompleted || status == RecomputeFailed {
+		now := time.Now()
+		job.FinishedAt = &now
+		scope := recomputeScope(job.ProjectID)
+		if r.full[scope] == job {
+			delete(r.full, scope)
+		}
+	}
+}
+
+// prune forgets the jobs finished for longer than recomputeJobRetention
+func (r *Recomputer) prune() {
+	for id, job := range r.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > recomputeJobRetention {
+			delete(r.jobs, id)
+		}
+	}
+}
+
+func recomputeScope(projectID *uuid.UUID) string {
+	if projectID == nil {
+		return WildcardPattern
+	}
+	return projectID.String()
+}
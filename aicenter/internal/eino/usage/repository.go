@@ -68,6 +68,7 @@ func (r *Repository) GetSummary(ctx context.Context, projectID uuid.UUID, start,
 		TotalCompletionTokens int64
 		TotalTokens           int64
 		TotalCost             float64
+		UnpricedRequests      int64
 		AvgLatencyMs          float64
 	}
 
@@ -81,6 +82,7 @@ func (r *Repository) GetSummary(ctx context.Context, projectID uuid.UUID, start,
 			COALESCE(SUM(completion_tokens), 0) as total_completion_tokens,
 			COALESCE(SUM(total_tokens), 0) as total_tokens,
 			COALESCE(SUM(cost), 0) as total_cost,
+			SUM(CASE WHEN success AND price_id IS NULL THEN 1 ELSE 0 END) as unpriced_requests,
 			COALESCE(AVG(latency_ms), 0) as avg_latency_ms
 		`).
 		Where("project_id = ? AND created_at >= ? AND created_at <= ?", projectID, start, end).
@@ -99,6 +101,7 @@ func (r *Repository) GetSummary(ctx context.Context, projectID uuid.UUID, start,
 		TotalCompletionTokens: result.TotalCompletionTokens,
 		TotalTokens:           result.TotalTokens,
 		TotalCost:             result.TotalCost,
+		UnpricedRequests:      result.UnpricedRequests,
 		AvgLatencyMs:          result.AvgLatencyMs,
 		PeriodStart:           start,
 		PeriodEnd:             end,
@@ -114,12 +117,13 @@ func (r *Repository) GetUsageByModel(ctx context.Context, projectID uuid.UUID, s
 		Select(`
 			model,
 			provider_kind,
+			COALESCE(currency, '') as currency,
 			COUNT(*) as request_count,
 			COALESCE(SUM(total_tokens), 0) as total_tokens,
 			COALESCE(SUM(cost), 0) as total_cost
 		`).
 		Where("project_id = ? AND created_at >= ? AND created_at <= ?", projectID, start, end).
-		Group("model, provider_kind").
+		Group("model, provider_kind, currency").
 		Order("total_tokens DESC").
 		Scan(&results).Error
 
@@ -133,14 +137,38 @@ func (r *Repository) GetUsageByAgent(ctx context.Context, projectID uuid.UUID, s
 	err := r.db.WithContext(ctx).
 		Model(&UsageRecord{}).
 		Select(`
-			agent_id,
+			usage_records.agent_id,
+			COALESCE(MAX(ai_agents.name), '') as agent_name,
 			COUNT(*) as request_count,
+			COALESCE(SUM(usage_records.total_tokens), 0) as total_tokens,
+			COALESCE(SUM(usage_records.cost), 0) as total_cost
+		`).
+		Joins("LEFT JOIN ai_agents ON ai_agents.id = usage_records.agent_id").
+		Where("usage_records.project_id = ? AND usage_records.agent_id IS NOT NULL AND usage_records.created_at >= ? AND usage_records.created_at <= ?", projectID, start, end).
+		Group("usage_records.agent_id").
+		Order("total_tokens DESC").
+		Scan(&results).Error
+
+	return results, err
+}
+
+// GetDailyUsage returns usage aggregated per day, oldest first
+func (r *Repository) GetDailyUsage(ctx context.Context, projectID uuid.UUID, start, end time.Time) ([]DailyUsage, error) {
+	var results []DailyUsage
+
+	err := r.db.WithContext(ctx).
+		Model(&UsageRecord{}).
+		Select(`
+			DATE_TRUNC('day', created_at) as date,
+			COUNT(*) as request_count,
+			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) as completion_tokens,
 			COALESCE(SUM(total_tokens), 0) as total_tokens,
 			COALESCE(SUM(cost), 0) as total_cost
 		`).
-		Where("project_id = ? AND agent_id IS NOT NULL AND created_at >= ? AND created_at <= ?", projectID, start, end).
-		Group("agent_id").
-		Order("total_tokens DESC").
+		Where("project_id = ? AND created_at >= ? AND created_at <= ?", projectID, start, end).
+		Group("DATE_TRUNC('day', created_at)").
+		Order("date ASC").
 		Scan(&results).Error
 
 	return results, err
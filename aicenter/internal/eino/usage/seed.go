@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// seedNamespace derives the IDs of the default prices, so that seeding twice
+// inserts nothing and a deleted default stays deleted
+var seedNamespace = uuid.MustParse("5d1e3c52-0b8f-4f47-9a55-7c1f0f6a2d41")
+
+// seedEffectiveFrom makes the default prices apply to every usage record
+var seedEffectiveFrom = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// defaultPrice is a list price in USD per 1M tokens
+type defaultPrice struct {
+	providerKind string
+	model        string
+	input        float64
+	cachedInput  float64
+	output       float64
+}
+
+// defaultPrices are the list prices of the models of the providers priced
+// per token in USD. Ark, DashScope and OpenAI compatible models have to be
+// priced in the catalog.
+var defaultPrices = []defaultPrice{
+	{"openai", "gpt-4o*", 2.50, 1.25, 10.00},
+	{"openai", "gpt-4o-mini*", 0.15, 0.075, 0.60},
+	{"openai", "gpt-4.1*", 2.00, 0.50, 8.00},
+	{"openai", "gpt-4.1-mini*", 0.40, 0.10, 1.60},
+	{"openai", "gpt-4.1-nano*", 0.10, 0.025, 0.40},
+	{"openai", "gpt-4-turbo*", 10.00, 10.00, 30.00},
+	{"openai", "gpt-3.5-turbo*", 0.50, 0.50, 1.50},
+	{"openai", "o1*", 15.00, 7.50, 60.00},
+	{"openai", "o3*", 2.00, 0.50, 8.00},
+	{"openai", "o3-mini*", 1.10, 0.55, 4.40},
+	{"openai", "o4-mini*", 1.10, 0.275, 4.40},
+	{"anthropic", "claude-3-haiku*", 0.25, 0.03, 1.25},
+	{"anthropic", "claude-3-5-haiku*", 0.80, 0.08, 4.00},
+	{"anthropic", "claude-3-5-sonnet*", 3.00, 0.30, 15.00},
+	{"anthropic", "claude-3-7-sonnet*", 3.00, 0.30, 15.00},
+	{"anthropic", "claude-sonnet-4*", 3.00, 0.30, 15.00},
+	{"anthropic", "claude-3-opus*", 15.00, 1.50, 75.00},
+	{"anthropic", "claude-opus-4*", 15.00, 1.50, 75.00},
+	{"google", "gemini-1.5-flash*", 0.075, 0.01875, 0.30},
+	{"google", "gemini-1.5-pro*", 1.25, 0.3125, 5.00},
+	{"google", "gemini-2.0-flash*", 0.10, 0.025, 0.40},
+	{"google", "gemini-2.0-flash-lite*", 0.075, 0.075, 0.30},
+	{"google", "gemini-2.5-flash*", 0.30, 0.075, 2.50},
+	{"google", "gemini-2.5-pro*", 1.25, 0.31, 10.00},
+	// Local models cost nothing per token
+	{"ollama", WildcardPattern, 0, 0, 0},
+}
+
+// DefaultPrices returns the prices seeded in an empty catalog
+func DefaultPrices() []ModelPrice {
+	prices := make([]ModelPrice, 0, len(defaultPrices))
+	for _, d := range defaultPrices {
+		cached := d.cachedInput
+		prices = append(prices, ModelPrice{
+			ID:               uuid.NewSHA1(seedNamespace, []byte(d.providerKind+"/"+d.model)),
+			ProviderKind:     d.providerKind,
+			Model:            d.model,
+			InputPrice:       d.input,
+			CachedInputPrice: &cached,
+			OutputPrice:      d.output,
+			Currency:         DefaultCurrency,
+			EffectiveFrom:    seedEffectiveFrom,
+		})
+	}
+	return prices
+}
+
+// SeedPrices adds the default prices missing from the catalog. Prices an
+// admin changed or deleted are left as they are.
+func SeedPrices(ctx context.Context, db *gorm.DB) error {
+	prices := DefaultPrices()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&prices).Error
+}
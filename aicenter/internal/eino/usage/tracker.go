@@ -2,6 +2,8 @@ package usage
 
 import (
 	"context"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,16 +12,26 @@ import (
 
 // Tracker tracks usage for LLM calls
 type Tracker struct {
-	repo *Repository
+	repo    *Repository
+	catalog *Catalog
+	// unpriced holds the "provider/model" of the calls recorded without a
+	// price, each is logged once
+	unpriced sync.Map
 }
 
 // NewTracker creates a new usage tracker
 func NewTracker(db *gorm.DB) *Tracker {
 	return &Tracker{
-		repo: NewRepository(db),
+		repo:    NewRepository(db),
+		catalog: NewCatalog(db),
 	}
 }
 
+// Catalog returns the price catalog used to cost usage
+func (t *Tracker) Catalog() *Catalog {
+	return t.catalog
+}
+
 // TrackRequest represents a request to track
 type TrackRequest struct {
 	ProjectID        uuid.UUID
@@ -30,15 +42,18 @@ type TrackRequest struct {
 	ProviderKind     string
 	Model            string
 	PromptTokens     int
+	CachedTokens     int
 	CompletionTokens int
+	ReasoningTokens  int
 	LatencyMs        int64
 	Success          bool
 	ErrorMessage     string
 	Metadata         map[string]interface{}
 }
 
-// Track records a usage event
+// Track records a usage event, costed with the price in effect now
 func (t *Tracker) Track(ctx context.Context, req *TrackRequest) error {
+	now := time.Now()
 	record := &UsageRecord{
 		ID:               uuid.New(),
 		ProjectID:        req.ProjectID,
@@ -49,14 +64,27 @@ func (t *Tracker) Track(ctx context.Context, req *TrackRequest) error {
 		ProviderKind:     req.ProviderKind,
 		Model:            req.Model,
 		PromptTokens:     req.PromptTokens,
+		CachedTokens:     req.CachedTokens,
 		CompletionTokens: req.CompletionTokens,
+		ReasoningTokens:  req.ReasoningTokens,
 		TotalTokens:      req.PromptTokens + req.CompletionTokens,
-		Cost:             calculateCost(req.ProviderKind, req.Model, req.PromptTokens, req.CompletionTokens),
 		LatencyMs:        req.LatencyMs,
 		Success:          req.Success,
 		ErrorMessage:     req.ErrorMessage,
 		Metadata:         JSONMap(req.Metadata),
-		CreatedAt:        time.Now(),
+		CreatedAt:        now,
+	}
+
+	price, err := t.catalog.Resolve(ctx, req.ProviderKind, req.Model, now)
+	if err != nil {
+		// Keep the record unpriced, a later recompute fills the cost in
+		log.Printf("[Usage] Failed to resolve price for %s/%s: %v", req.ProviderKind, req.Model, err)
+	} else if price != nil {
+		record.Cost = price.Cost(req.PromptTokens, req.CachedTokens, req.CompletionTokens, req.ReasoningTokens)
+		record.Currency = price.Currency
+		record.PriceID = &price.ID
+	} else if _, warned := t.unpriced.LoadOrStore(req.ProviderKind+"/"+req.Model, true); !warned {
+		log.Printf("[Usage] No price configured for %s/%s, its usage is recorded without cost until one is added", req.ProviderKind, req.Model)
 	}
 
 	return t.repo.Create(ctx, record)
@@ -93,53 +121,7 @@ func (t *Tracker) GetUsageByAgent(ctx context.Context, projectID uuid.UUID, star
 	return t.repo.GetUsageByAgent(ctx, projectID, start, end)
 }
 
-// calculateCost calculates the cost based on provider pricing
-func calculateCost(providerKind, model string, promptTokens, completionTokens int) float64 {
-	// Pricing per 1M tokens (simplified)
-	var promptPrice, completionPrice float64
-
-	switch providerKind {
-	case "openai":
-		switch model {
-		case "gpt-4", "gpt-4-turbo":
-			promptPrice = 30.0 // $30 per 1M tokens
-			completionPrice = 60.0
-		case "gpt-4o":
-			promptPrice = 5.0
-			completionPrice = 15.0
-		case "gpt-4o-mini":
-			promptPrice = 0.15
-			completionPrice = 0.60
-		case "gpt-3.5-turbo":
-			promptPrice = 0.5
-			completionPrice = 1.5
-		default:
-			promptPrice = 1.0
-			completionPrice = 2.0
-		}
-	case "anthropic":
-		switch model {
-		case "claude-3-opus":
-			promptPrice = 15.0
-			completionPrice = 75.0
-		case "claude-3-sonnet":
-			promptPrice = 3.0
-			completionPrice = 15.0
-		case "claude-3-haiku":
-			promptPrice = 0.25
-			completionPrice = 1.25
-		default:
-			promptPrice = 3.0
-			completionPrice = 15.0
-		}
-	default:
-		promptPrice = 1.0
-		completionPrice = 2.0
-	}
-
-	// Calculate cost (prices are per 1M tokens)
-	cost := (float64(promptTokens) * promptPrice / 1000000) +
-		(float64(completionTokens) * completionPrice / 1000000)
-
-	return cost
+// GetDailyUsage returns the daily usage series of a project
+func (t *Tracker) GetDailyUsage(ctx context.Context, projectID uuid.UUID, start, end time.Time) ([]DailyUsage, error) {
+	return t.repo.GetDailyUsage(ctx, projectID, start, end)
 }
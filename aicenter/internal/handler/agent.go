@@ -7,6 +7,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/structured"
 	"github.com/tgo/captain/aicenter/internal/model"
 	"github.com/tgo/captain/aicenter/internal/pkg/response"
 	"github.com/tgo/captain/aicenter/internal/service"
@@ -58,6 +60,10 @@ func (h *AgentHandler) Create(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
+	if err := validateRuntimeConfig(req.Config); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
 
 	req.ProjectID = projectID
 	if err := h.svc.Create(c.Request.Context(), &req); err != nil {
@@ -150,6 +156,10 @@ func (h *AgentHandler) Update(c *gin.Context) {
 		agent.IsEnabled = *req.IsEnabled
 	}
 	if req.Config != nil {
+		if err := validateRuntimeConfig(req.Config); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
 		agent.Config = req.Config
 	}
 	if req.TeamID != nil {
@@ -262,3 +272,19 @@ func (h *AgentHandler) SetCollectionEnabled(c *gin.Context) {
 
 	response.NoContent(c)
 }
+
+// validateRuntimeConfig validates the runtime settings stored in an agent,
+// team or project config: generation params, provider failover and output
+// schema
+func validateRuntimeConfig(cfg map[string]interface{}) error {
+	if _, err := llm.ParseGenerationParams(cfg); err != nil {
+		return err
+	}
+	if _, _, err := service.ParseFallbackConfig(cfg); err != nil {
+		return err
+	}
+	if _, err := structured.FromConfig(cfg); err != nil {
+		return err
+	}
+	return nil
+}
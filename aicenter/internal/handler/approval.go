@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/middleware"
+	"github.com/tgo/captain/aicenter/internal/pkg/response"
+	"github.com/tgo/captain/aicenter/internal/service"
+)
+
+const (
+	// ErrCodeApprovalDecided is returned when deciding an approval twice
+	ErrCodeApprovalDecided = "APPROVAL_DECIDED"
+	// ErrCodeApprovalNotResumable is returned when resuming a run that is not
+	// waiting to be resumed
+	ErrCodeApprovalNotResumable = "APPROVAL_NOT_RESUMABLE"
+)
+
+// ApprovalHandler lets staff decide the tool calls that wait for approval
+type ApprovalHandler struct {
+	runtimeSvc *service.RuntimeService
+}
+
+func NewApprovalHandler(runtimeSvc *service.RuntimeService) *ApprovalHandler {
+	return &ApprovalHandler{runtimeSvc: runtimeSvc}
+}
+
+// DecisionRequest is the decision of staff on a tool call. The staff member
+// deciding is the one the request is authenticated as.
+type DecisionRequest struct {
+	// Comment is reported to the agent when the call is rejected
+	Comment string `json:"comment"`
+}
+
+// List returns the tool approvals of the project, filtered by status
+func (h *ApprovalHandler) List(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	approvals, total, err := h.runtimeSvc.ListApprovals(c.Request.Context(), projectID, c.Query("status"), limit, offset)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.List(c, approvals, total, limit, offset)
+}
+
+func (h *ApprovalHandler) Get(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	approvalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid approval id")
+		return
+	}
+
+	approval, err := h.runtimeSvc.GetApproval(c.Request.Context(), projectID, approvalID)
+	if err != nil {
+		response.NotFound(c, "APPROVAL")
+		return
+	}
+
+	response.Success(c, approval)
+}
+
+// Approve executes the tool call, resuming the run once every call it paused
+// on is decided
+func (h *ApprovalHandler) Approve(c *gin.Context) {
+	h.decide(c, true)
+}
+
+// Reject skips the tool call, the agent is told it was rejected
+func (h *ApprovalHandler) Reject(c *gin.Context) {
+	h.decide(c, false)
+}
+
+func (h *ApprovalHandler) decide(c *gin.Context, approved bool) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	approvalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid approval id")
+		return
+	}
+
+	var req DecisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	outcome, err := h.runtimeSvc.DecideApproval(c.Request.Context(), projectID, approvalID, approved, decidedBy(c), req.Comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.NotFound(c, "APPROVAL")
+		case errors.Is(err, service.ErrApprovalDecided):
+			response.Error(c, http.StatusConflict, ErrCodeApprovalDecided, err.Error(), nil)
+		default:
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	response.Success(c, outcome)
+}
+
+// Resume retries resuming the run of a decided approval after its resume
+// failed or was interrupted
+func (h *ApprovalHandler) Resume(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	approvalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid approval id")
+		return
+	}
+
+	outcome, err := h.runtimeSvc.ResumeApproval(c.Request.Context(), projectID, approvalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.NotFound(c, "APPROVAL")
+		case errors.Is(err, service.ErrApprovalNotResumable):
+			response.Error(c, http.StatusConflict, ErrCodeApprovalNotResumable, err.Error(), nil)
+		default:
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	response.Success(c, outcome)
+}
+
+// decidedBy identifies the staff member the request is authenticated as,
+// empty without authentication
+func decidedBy(c *gin.Context) string {
+	info := middleware.GetTokenInfo(c)
+	if info == nil {
+		return ""
+	}
+	if info.Username != "" {
+		return info.Username
+	}
+	return info.UserID
+}
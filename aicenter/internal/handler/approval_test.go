@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tgo/captain/aicenter/internal/middleware"
+	"github.com/tgo/captain/aicenter/pkg/auth"
+)
+
+func TestDecidedBy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		info *auth.TokenInfo
+		want string
+	}{
+		{name: "unauthenticated", info: nil, want: ""},
+		{name: "username", info: &auth.TokenInfo{UserID: "42", Username: "alice"}, want: "alice"},
+		{name: "user id", info: &auth.TokenInfo{UserID: "42"}, want: "42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.info != nil {
+				c.Set(middleware.ContextKeyTokenInfo, tt.info)
+			}
+			if got := decidedBy(c); got != tt.want {
+				t.Errorf("decidedBy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
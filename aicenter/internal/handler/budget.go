@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+	"github.com/tgo/captain/aicenter/internal/pkg/response"
+)
+
+type BudgetHandler struct {
+	guard *usage.BudgetGuard
+}
+
+func NewBudgetHandler(guard *usage.BudgetGuard) *BudgetHandler {
+	return &BudgetHandler{guard: guard}
+}
+
+// BudgetRequest sets the limits of a project, omitted limits are unlimited
+type BudgetRequest struct {
+	Enabled             *bool    `json:"enabled"`
+	DailyTokenLimit     *int64   `json:"daily_token_limit"`
+	DailyCostLimit      *float64 `json:"daily_cost_limit"`
+	DailyRequestLimit   *int64   `json:"daily_request_limit"`
+	MonthlyTokenLimit   *int64   `json:"monthly_token_limit"`
+	MonthlyCostLimit    *float64 `json:"monthly_cost_limit"`
+	MonthlyRequestLimit *int64   `json:"monthly_request_limit"`
+	SoftThreshold       *float64 `json:"soft_threshold"`
+	ExceededAction      string   `json:"exceeded_action"`
+	FallbackMessage     string   `json:"fallback_message"`
+}
+
+// Get returns the project budget with the usage of the current day and month
+func (h *BudgetHandler) Get(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	status, err := h.guard.Status(c.Request.Context(), projectID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "BUDGET")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, status)
+}
+
+// Put replaces the project budget
+func (h *BudgetHandler) Put(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	var req BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	budget, err := h.guard.Get(c.Request.Context(), projectID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			response.InternalError(c, err.Error())
+			return
+		}
+		budget = &usage.Budget{ProjectID: projectID}
+	}
+
+	budget.Enabled = req.Enabled == nil || *req.Enabled
+	budget.DailyTokenLimit = req.DailyTokenLimit
+	budget.DailyCostLimit = req.DailyCostLimit
+	budget.DailyRequestLimit = req.DailyRequestLimit
+	budget.MonthlyTokenLimit = req.MonthlyTokenLimit
+	budget.MonthlyCostLimit = req.MonthlyCostLimit
+	budget.MonthlyRequestLimit = req.MonthlyRequestLimit
+	budget.SoftThreshold = usage.DefaultSoftThreshold
+	if req.SoftThreshold != nil {
+		budget.SoftThreshold = *req.SoftThreshold
+	}
+	budget.ExceededAction = req.ExceededAction
+	if budget.ExceededAction == "" {
+		budget.ExceededAction = usage.ActionFallbackMessage
+	}
+	budget.FallbackMessage = req.FallbackMessage
+
+	if err := budget.Validate(); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.guard.Save(c.Request.Context(), budget); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, budget)
+}
+
+// Delete removes the project budget
+func (h *BudgetHandler) Delete(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	if err := h.guard.Delete(c.Request.Context(), projectID); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.NoContent(c)
+}
+
+// Alerts lists the soft and hard limit alerts of the project
+func (h *BudgetHandler) Alerts(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	alerts, total, err := h.guard.ListAlerts(c.Request.Context(), projectID, limit, offset)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.List(c, alerts, total, limit, offset)
+}
@@ -1,26 +1,47 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
-	"github.com/cloudwego/eino/adk"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"github.com/tgo/captain/aicenter/internal/config"
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+	"github.com/tgo/captain/aicenter/internal/eino/structured"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
 	"github.com/tgo/captain/aicenter/internal/pkg/response"
 	"github.com/tgo/captain/aicenter/internal/service"
 )
 
+const (
+	// ErrCodeBudgetExceeded is returned when a run is refused by the project budget
+	ErrCodeBudgetExceeded = "BUDGET_EXCEEDED"
+	// ErrCodeRunCancelled is returned when a run is cancelled before it completes
+	ErrCodeRunCancelled = "RUN_CANCELLED"
+	// ErrCodeInvalidOutput is returned when the answer of a run still does not
+	// conform to its output schema once repaired
+	ErrCodeInvalidOutput = "INVALID_OUTPUT"
+)
+
 type ChatHandler struct {
 	runtimeSvc *service.RuntimeService
+	streams    *streaming.Manager
 	cfg        *config.Config
 }
 
-func NewChatHandler(runtimeSvc *service.RuntimeService, cfg *config.Config) *ChatHandler {
-	return &ChatHandler{runtimeSvc: runtimeSvc, cfg: cfg}
+func NewChatHandler(runtimeSvc *service.RuntimeService, streams *streaming.Manager, cfg *config.Config) *ChatHandler {
+	return &ChatHandler{runtimeSvc: runtimeSvc, streams: streams, cfg: cfg}
 }
 
 // SupervisorConfig matches tgo-ai Python API
@@ -36,7 +57,7 @@ type SupervisorRunRequest struct {
 	TeamID         *string           `json:"team_id"`
 	AgentID        *string           `json:"agent_id"`
 	AgentIDs       []string          `json:"agent_ids"`
-	Message        string            `json:"message" binding:"required,min=1,max=10000"`
+	Message        string            `json:"message" binding:"max=10000"`
 	SystemMessage  *string           `json:"system_message"`
 	ExpectedOutput *string           `json:"expected_output"`
 	SessionID      *string           `json:"session_id"`
@@ -46,6 +67,73 @@ type SupervisorRunRequest struct {
 	MCPURL         *string           `json:"mcp_url"`
 	RAGURL         *string           `json:"rag_url"`
 	EnableMemory   bool              `json:"enable_memory"`
+	VisitorID      *uuid.UUID        `json:"visitor_id"` // 访客 ID，用于转人工和访客长期记忆
+
+	// Generation param overrides, applied on top of the agent/team config
+	Temperature *float32 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+
+	// OutputSchema is the JSON Schema the answer must conform to, the
+	// conforming value is returned as data. ExpectedOutput may hold the schema
+	// instead, otherwise it describes the answer as free text.
+	OutputSchema json.RawMessage `json:"output_schema,omitempty"`
+
+	// Attachments are the files sent with the message, such as screenshots,
+	// given by URL or by the file_id of a file stored by the apiserver
+	Attachments []service.Attachment `json:"attachments,omitempty"`
+}
+
+// GenerationParams returns the validated generation overrides of the request
+func (r *SupervisorRunRequest) GenerationParams() (*llm.GenerationParams, error) {
+	return newGenerationParams(r.Temperature, r.MaxTokens, r.TopP, r.Stop)
+}
+
+// Output returns the validated output schema of the request, and the
+// instruction of a free text expected output
+func (r *SupervisorRunRequest) Output() (json.RawMessage, string, error) {
+	if len(r.OutputSchema) > 0 {
+		if _, err := structured.Parse("", r.OutputSchema); err != nil {
+			return nil, "", err
+		}
+		return r.OutputSchema, "", nil
+	}
+	if r.ExpectedOutput == nil {
+		return nil, "", nil
+	}
+	expected := strings.TrimSpace(*r.ExpectedOutput)
+	if strings.HasPrefix(expected, "{") && json.Valid([]byte(expected)) {
+		if _, err := structured.Parse("", json.RawMessage(expected)); err != nil {
+			return nil, "", err
+		}
+		return json.RawMessage(expected), "", nil
+	}
+	if expected == "" {
+		return nil, "", nil
+	}
+	return nil, "Expected output: " + expected, nil
+}
+
+// RequireConsensus reports whether the answers of the agents must agree
+func (r *SupervisorRunRequest) RequireConsensus() bool {
+	return r.Config != nil && r.Config.RequireConsensus
+}
+
+func newGenerationParams(temperature *float32, maxTokens *int, topP *float32, stop []string) (*llm.GenerationParams, error) {
+	if temperature == nil && maxTokens == nil && topP == nil && len(stop) == 0 {
+		return nil, nil
+	}
+	params := &llm.GenerationParams{
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+		TopP:        topP,
+		Stop:        stop,
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return params, nil
 }
 
 // Run executes the agent with SSE streaming by default
@@ -61,6 +149,22 @@ func (h *ChatHandler) Run(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
+	if _, err := req.GenerationParams(); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if _, _, err := req.Output(); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if err := service.ValidateAttachments(req.Attachments); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if req.Message == "" && len(req.Attachments) == 0 {
+		response.BadRequest(c, "message or attachments is required")
+		return
+	}
 
 	// 默认使用流式输出，除非显式设置 stream=false
 	useStream := req.Stream == nil || *req.Stream
@@ -75,6 +179,8 @@ func (h *ChatHandler) Run(c *gin.Context) {
 func (h *ChatHandler) runSync(c *gin.Context, projectID uuid.UUID, req *SupervisorRunRequest) {
 	var resp *service.RunResponse
 	var err error
+	params, _ := req.GenerationParams()
+	outputSchema, instruction, _ := req.Output()
 
 	// Debug routing decision
 	log.Printf("[ChatHandler] Routing: agent_id=%v, team_id=%v, agent_ids=%v",
@@ -82,17 +188,35 @@ func (h *ChatHandler) runSync(c *gin.Context, projectID uuid.UUID, req *Supervis
 		req.TeamID != nil && *req.TeamID != "",
 		len(req.AgentIDs) > 0)
 
-	// If agent_id is specified, use RunWithAgentTools for direct RAG tool access
+	// If agent_id is specified, use RunAgent for direct RAG tool access
 	if req.AgentID != nil && *req.AgentID != "" {
 		sessionID := ""
 		if req.SessionID != nil {
 			sessionID = *req.SessionID
 		}
-		resp, err = h.runtimeSvc.RunWithAgentTools(c.Request.Context(), projectID, *req.AgentID, req.Message, sessionID, req.EnableMemory)
-	} else if (req.TeamID == nil || *req.TeamID == "") && len(req.AgentIDs) == 0 {
-		// No agent_id, team_id or agent_ids specified - use QueryAnalyzer for smart routing
+		resp, err = h.runtimeSvc.RunAgent(c.Request.Context(), projectID, &service.RunRequest{
+			AgentID:      req.AgentID,
+			Message:      req.Message,
+			SessionID:    &sessionID,
+			EnableMemory: req.EnableMemory,
+			VisitorID:    req.VisitorID,
+			Params:       params,
+			Instruction:  instruction,
+			OutputSchema: outputSchema,
+			Attachments:  req.Attachments,
+		})
+	} else if (req.TeamID == nil || *req.TeamID == "") && len(req.AgentIDs) == 0 && outputSchema == nil && instruction == "" && len(req.Attachments) == 0 && !req.RequireConsensus() {
+		// No agent_id, team_id or agent_ids specified - use QueryAnalyzer for smart routing.
+		// Runs with an expected output, attachments or requiring consensus are
+		// answered by the default team.
 		log.Printf("[ChatHandler] Using QueryAnalyzer path")
-		resp, err = h.runtimeSvc.RunWithQueryAnalyzer(c.Request.Context(), projectID, req.Message)
+		resp, err = h.runtimeSvc.RunWithQueryAnalyzer(c.Request.Context(), projectID, &service.RunRequest{
+			Message:      req.Message,
+			SessionID:    req.SessionID,
+			EnableMemory: req.EnableMemory,
+			VisitorID:    req.VisitorID,
+			Params:       params,
+		})
 	} else {
 		// Use traditional supervisor routing
 		svcReq := &service.RunRequest{
@@ -103,11 +227,32 @@ func (h *ChatHandler) runSync(c *gin.Context, projectID uuid.UUID, req *Supervis
 			SessionID:    req.SessionID,
 			Stream:       false,
 			EnableMemory: req.EnableMemory,
+			VisitorID:    req.VisitorID,
+			Params:       params,
+			Instruction:  instruction,
+			OutputSchema: outputSchema,
+			Attachments:  req.Attachments,
+
+			RequireConsensus: req.RequireConsensus(),
 		}
 		resp, err = h.runtimeSvc.Run(c.Request.Context(), projectID, svcReq)
 	}
 
 	if err != nil {
+		var budgetErr *usage.BudgetExceededError
+		if errors.As(err, &budgetErr) {
+			response.Error(c, http.StatusTooManyRequests, ErrCodeBudgetExceeded, budgetErr.Error(), budgetErr)
+			return
+		}
+		if errors.Is(err, runs.ErrCancelled) {
+			response.Error(c, http.StatusConflict, ErrCodeRunCancelled, err.Error(), nil)
+			return
+		}
+		var outputErr *structured.Error
+		if errors.As(err, &outputErr) {
+			response.Error(c, http.StatusUnprocessableEntity, ErrCodeInvalidOutput, err.Error(), outputErr.Errors)
+			return
+		}
 		response.InternalError(c, err.Error())
 		return
 	}
@@ -116,13 +261,11 @@ func (h *ChatHandler) runSync(c *gin.Context, projectID uuid.UUID, req *Supervis
 }
 
 func (h *ChatHandler) runStream(c *gin.Context, projectID uuid.UUID, req *SupervisorRunRequest) {
-	// Set SSE headers
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("X-Accel-Buffering", "no")
-
+	params, _ := req.GenerationParams()
+	outputSchema, instruction, _ := req.Output()
+	runID := uuid.New().String()
 	svcReq := &service.RunRequest{
+		RunID:        runID,
 		TeamID:       req.TeamID,
 		AgentID:      req.AgentID,
 		AgentIDs:     req.AgentIDs,
@@ -130,201 +273,229 @@ func (h *ChatHandler) runStream(c *gin.Context, projectID uuid.UUID, req *Superv
 		SessionID:    req.SessionID,
 		Stream:       true,
 		EnableMemory: req.EnableMemory,
+		VisitorID:    req.VisitorID,
+		Params:       params,
+		Instruction:  instruction,
+		OutputSchema: outputSchema,
+		Attachments:  req.Attachments,
+
+		RequireConsensus: req.RequireConsensus(),
 	}
 
-	// Send connected event
-	h.sendSSE(c, "connected", map[string]string{"status": "connected"})
+	// The run outlives the request, clients that drop resume with
+	// GET /agents/run/:run_id/events
+	session := h.streams.CreateSession(runID, projectID)
+	// The connected event carries the run_id, which can be used to resume or
+	// cancel the run
+	session.Emit(streaming.NewConnectedEvent(runID))
+	go h.execStream(context.WithoutCancel(c.Request.Context()), session, projectID, svcReq)
+
+	h.followStream(c, projectID, runID, 0)
+}
 
-	err := h.runtimeSvc.Stream(c.Request.Context(), projectID, svcReq, func(event *adk.AgentEvent) error {
-		sseEvent := service.ConvertADKEvent(event)
-		return h.sendSSE(c, "event", sseEvent)
+// execStream runs the agents and emits their events to the session
+func (h *ChatHandler) execStream(ctx context.Context, session *streaming.Session, projectID uuid.UUID, req *service.RunRequest) {
+	defer session.Complete()
+
+	err := h.runtimeSvc.Stream(ctx, projectID, req, func(event *supervisor.Event) error {
+		session.Emit(service.ConvertStreamEvent(event))
+		return nil
 	})
 
+	if errors.Is(err, runs.ErrCancelled) {
+		session.Emit(streaming.NewCancelledEvent(req.RunID))
+		return
+	}
 	if err != nil {
-		h.sendSSE(c, "error", map[string]string{"error": err.Error()})
+		var budgetErr *usage.BudgetExceededError
+		var outputErr *structured.Error
+		if errors.As(err, &budgetErr) {
+			session.Emit(streaming.NewFailedEvent(err.Error(), ErrCodeBudgetExceeded, budgetErr))
+		} else if errors.As(err, &outputErr) {
+			session.Emit(streaming.NewFailedEvent(err.Error(), ErrCodeInvalidOutput, outputErr.Errors))
+		} else {
+			session.Emit(streaming.NewFailedEvent(err.Error(), "", nil))
+		}
+		session.SetError(err.Error())
 	}
 
 	// Send done event
-	h.sendSSE(c, "done", map[string]string{"status": "done"})
+	session.Emit(streaming.NewDoneEvent(req.RunID))
 }
 
-func (h *ChatHandler) sendSSE(c *gin.Context, eventType string, data interface{}) error {
-	jsonData, err := json.Marshal(data)
+// Events streams the events of a run, e.g. to a client resuming after a
+// dropped connection or to the staff console. Events after Last-Event-ID
+// (header, or last_event_id query) are replayed before the live ones.
+func (h *ChatHandler) Events(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
 	if err != nil {
-		return err
+		response.BadRequest(c, "invalid project_id")
+		return
 	}
-	c.SSEvent(eventType, string(jsonData))
-	c.Writer.Flush()
-	return nil
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			response.BadRequest(c, "invalid Last-Event-ID")
+			return
+		}
+	}
+
+	h.followStream(c, projectID, c.Param("run_id"), lastID)
 }
 
-// Cancel cancels a running agent execution
-func (h *ChatHandler) Cancel(c *gin.Context) {
-	runID := c.Param("run_id")
+// followStream sends the events of a run after lastID until the run ends or
+// the client leaves. A subscriber dropped for lagging behind resumes from
+// the last event it sent.
+func (h *ChatHandler) followStream(c *gin.Context, projectID uuid.UUID, runID string, lastID int64) {
+	ctx := c.Request.Context()
+	started := false
+	for {
+		events, err := h.streams.Resume(ctx, runID, projectID, lastID)
+		if err != nil {
+			if started {
+				return
+			}
+			if errors.Is(err, streaming.ErrSessionNotFound) {
+				response.NotFound(c, "RUN")
+				return
+			}
+			response.InternalError(c, err.Error())
+			return
+		}
 
-	cancelled, reason := h.runtimeSvc.Cancel(c.Request.Context(), runID)
+		if !started {
+			// Set SSE headers
+			c.Writer.Header().Set("Content-Type", "text/event-stream")
+			c.Writer.Header().Set("Cache-Control", "no-cache")
+			c.Writer.Header().Set("Connection", "keep-alive")
+			c.Writer.Header().Set("X-Accel-Buffering", "no")
+			started = true
+		}
 
-	c.JSON(http.StatusAccepted, gin.H{
-		"run_id":    runID,
-		"cancelled": cancelled,
-		"reason":    reason,
-	})
+		received := false
+		for event := range events {
+			received = true
+			lastID = event.ID
+			if err := h.sendStreamEvent(c, event); err != nil {
+				return
+			}
+			if event.Terminal() {
+				return
+			}
+		}
+		if ctx.Err() != nil || !received {
+			return
+		}
+	}
 }
 
-// CompletionsRequest represents OpenAI-compatible chat completions request
-type CompletionsRequest struct {
-	Model       string              `json:"model" binding:"required"`
-	Messages    []CompletionMessage `json:"messages" binding:"required"`
-	Stream      bool                `json:"stream"`
-	Temperature *float64            `json:"temperature,omitempty"`
-	MaxTokens   *int                `json:"max_tokens,omitempty"`
-	TopP        *float64            `json:"top_p,omitempty"`
-	AgentID     *string             `json:"agent_id,omitempty"` // Optional agent ID for RAG tools
+// sendStreamEvent sends a session event with its id, so clients can resume
+// with Last-Event-ID
+func (h *ChatHandler) sendStreamEvent(c *gin.Context, event streaming.Event) error {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.SSEName(), jsonData); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
 }
 
-type CompletionMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// CancelRequest optionally explains why a run is cancelled
+type CancelRequest struct {
+	Reason string `json:"reason"`
 }
 
-// Completions provides OpenAI-compatible chat completions API
-func (h *ChatHandler) Completions(c *gin.Context) {
+// GetRun returns the status of a run
+func (h *ChatHandler) GetRun(c *gin.Context) {
 	projectID, err := uuid.Parse(c.GetString("project_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": gin.H{
-				"message": "invalid project_id",
-				"type":    "invalid_request_error",
-			},
-		})
+		response.BadRequest(c, "invalid project_id")
 		return
 	}
 
-	var req CompletionsRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": gin.H{
-				"message": err.Error(),
-				"type":    "invalid_request_error",
-			},
-		})
+	run, err := h.runtimeSvc.GetRun(c.Request.Context(), projectID, c.Param("run_id"))
+	if err != nil {
+		if errors.Is(err, runs.ErrNotFound) {
+			response.NotFound(c, "RUN")
+			return
+		}
+		response.InternalError(c, err.Error())
 		return
 	}
 
-	// Extract last user message
-	var userMessage string
-	for i := len(req.Messages) - 1; i >= 0; i-- {
-		if req.Messages[i].Role == "user" {
-			userMessage = req.Messages[i].Content
-			break
-		}
-	}
+	response.Success(c, run)
+}
 
-	if userMessage == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": gin.H{
-				"message": "no user message found",
-				"type":    "invalid_request_error",
-			},
-		})
+// Cancel cancels a running agent execution
+func (h *ChatHandler) Cancel(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
 		return
 	}
+	runID := c.Param("run_id")
 
-	svcReq := &service.RunRequest{
-		AgentID: req.AgentID,
-		Message: userMessage,
-		Stream:  req.Stream,
+	var req CancelRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.Reason == "" {
+		req.Reason = "cancelled by request"
 	}
 
-	if req.Stream {
-		// SSE streaming for OpenAI-compatible format
-		c.Writer.Header().Set("Content-Type", "text/event-stream")
-		c.Writer.Header().Set("Cache-Control", "no-cache")
-		c.Writer.Header().Set("Connection", "keep-alive")
-
-		runID := uuid.New().String()
-
-		err := h.runtimeSvc.Stream(c.Request.Context(), projectID, svcReq, func(event *adk.AgentEvent) error {
-			content := service.GetEventContent(event)
-			if content == "" {
-				return nil
-			}
-			chunk := gin.H{
-				"id":     runID,
-				"object": "chat.completion.chunk",
-				"model":  req.Model,
-				"choices": []gin.H{{
-					"index": 0,
-					"delta": gin.H{
-						"content": content,
-					},
-					"finish_reason": nil,
-				}},
-			}
-			data, _ := json.Marshal(chunk)
-			c.Writer.WriteString("data: " + string(data) + "\n\n")
-			c.Writer.Flush()
-			return nil
-		})
-
-		if err != nil {
-			c.Writer.WriteString("data: [DONE]\n\n")
-		} else {
-			// Send final chunk with finish_reason
-			finalChunk := gin.H{
-				"id":     runID,
-				"object": "chat.completion.chunk",
-				"model":  req.Model,
-				"choices": []gin.H{{
-					"index":         0,
-					"delta":         gin.H{},
-					"finish_reason": "stop",
-				}},
-			}
-			data, _ := json.Marshal(finalChunk)
-			c.Writer.WriteString("data: " + string(data) + "\n\n")
-			c.Writer.WriteString("data: [DONE]\n\n")
+	cancelled, err := h.runtimeSvc.Cancel(c.Request.Context(), projectID, runID, req.Reason)
+	if err != nil {
+		if errors.Is(err, runs.ErrNotFound) {
+			response.NotFound(c, "RUN")
+			return
 		}
-		c.Writer.Flush()
-	} else {
-		// Non-streaming response
-		var resp *service.RunResponse
-		var err error
+		response.InternalError(c, err.Error())
+		return
+	}
 
-		// If agent_id is specified, try to use ReAct agent with tools
-		if req.AgentID != nil && *req.AgentID != "" {
-			resp, err = h.runtimeSvc.RunWithAgentTools(c.Request.Context(), projectID, *req.AgentID, userMessage, "", false)
-		} else {
-			resp, err = h.runtimeSvc.Run(c.Request.Context(), projectID, svcReq)
-		}
+	reason := req.Reason
+	if !cancelled {
+		reason = "run already finished"
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"run_id":    runID,
+		"cancelled": cancelled,
+		"reason":    reason,
+	})
+}
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": gin.H{
-					"message": err.Error(),
-					"type":    "api_error",
-				},
-			})
-			return
-		}
+// CancelSession cancels every running execution of a session, e.g. when
+// staff take over the conversation
+func (h *ChatHandler) CancelSession(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+	sessionID := c.Param("session_id")
 
-		c.JSON(http.StatusOK, gin.H{
-			"id":     uuid.New().String(),
-			"object": "chat.completion",
-			"model":  req.Model,
-			"choices": []gin.H{{
-				"index": 0,
-				"message": gin.H{
-					"role":    "assistant",
-					"content": resp.Content,
-				},
-				"finish_reason": "stop",
-			}},
-			"usage": gin.H{
-				"prompt_tokens":     0,
-				"completion_tokens": 0,
-				"total_tokens":      0,
-			},
-		})
+	var req CancelRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.Reason == "" {
+		req.Reason = "cancelled by request"
 	}
+
+	cancelled, err := h.runtimeSvc.CancelSession(c.Request.Context(), projectID, sessionID, req.Reason)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"session_id": sessionID,
+		"cancelled":  cancelled,
+		"reason":     req.Reason,
+	})
 }
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+)
+
+func TestSendStreamEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		event    streaming.Event
+		wantName string
+	}{
+		{
+			name:     "message delta",
+			event:    streaming.Event{ID: 3, Type: streaming.EventTypeMessage, MessageID: "m1", Delta: true, Content: "Hel"},
+			wantName: "event",
+		},
+		{name: "connected", event: streaming.Event{ID: 1, Type: streaming.EventTypeConnected, RunID: "run-1"}, wantName: "connected"},
+		{name: "failed", event: streaming.Event{ID: 9, Type: streaming.EventTypeFailed, Error: "boom"}, wantName: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if err := (&ChatHandler{}).sendStreamEvent(c, tt.event); err != nil {
+				t.Fatalf("sendStreamEvent() error = %v", err)
+			}
+
+			frame := w.Body.String()
+			if !strings.HasSuffix(frame, "\n\n") || strings.Count(frame, "\n\n") != 1 {
+				t.Fatalf("sendStreamEvent() wrote %q, want one SSE frame", frame)
+			}
+			lines := strings.Split(strings.TrimSuffix(frame, "\n\n"), "\n")
+			if len(lines) != 3 {
+				t.Fatalf("sendStreamEvent() frame has lines %q, want id, event and data", lines)
+			}
+			if want := "id: " + strconv.FormatInt(tt.event.ID, 10); lines[0] != want {
+				t.Errorf("frame id line = %q, want %q", lines[0], want)
+			}
+			if want := "event: " + tt.wantName; lines[1] != want {
+				t.Errorf("frame event line = %q, want %q", lines[1], want)
+			}
+			var got streaming.Event
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &got); err != nil {
+				t.Fatalf("frame data %q is not an event: %v", lines[2], err)
+			}
+			if got.ID != tt.event.ID || got.Type != tt.event.Type || got.Content != tt.event.Content || got.Delta != tt.event.Delta {
+				t.Errorf("frame data = %+v, want %+v", got, tt.event)
+			}
+		})
+	}
+}
@@ -0,0 +1,659 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/structured"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+	"github.com/tgo/captain/aicenter/internal/service"
+)
+
+// Model ids of the OpenAI-compatible API select an agent or a team, other
+// model names run the default team
+const (
+	agentModelPrefix = "agent:"
+	teamModelPrefix  = "team:"
+	modelOwner       = "captain"
+)
+
+// OpenAI error types
+const (
+	errTypeInvalidRequest = "invalid_request_error"
+	errTypeAPI            = "api_error"
+	errTypeQuota          = "insufficient_quota"
+)
+
+// CompletionsRequest represents OpenAI-compatible chat completions request
+type CompletionsRequest struct {
+	Model               string              `json:"model" binding:"required"`
+	Messages            []CompletionMessage `json:"messages" binding:"required"`
+	Stream              bool                `json:"stream"`
+	Temperature         *float32            `json:"temperature,omitempty"`
+	MaxTokens           *int                `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int                `json:"max_completion_tokens,omitempty"`
+	TopP                *float32            `json:"top_p,omitempty"`
+	Stop                StopSequences       `json:"stop,omitempty"`
+	// N must be 1, several choices are not supported
+	N              *int                      `json:"n,omitempty"`
+	Tools          []CompletionTool          `json:"tools,omitempty"`
+	ToolChoice     json.RawMessage           `json:"tool_choice,omitempty"`
+	ResponseFormat *CompletionResponseFormat `json:"response_format,omitempty"`
+	AgentID        *string                   `json:"agent_id,omitempty"` // Optional agent ID for RAG tools
+	TeamID         *string                   `json:"team_id,omitempty"`
+	// StreamOptions.IncludeUsage adds a final chunk with the token usage
+	StreamOptions *CompletionStreamOptions `json:"stream_options,omitempty"`
+}
+
+type CompletionStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type CompletionMessage struct {
+	Role       string               `json:"role"`
+	Content    CompletionContent    `json:"content"`
+	Name       string               `json:"name,omitempty"`
+	ToolCalls  []CompletionToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string               `json:"tool_call_id,omitempty"`
+}
+
+// CompletionContent is the content of a message: a string, null or an array
+// of content parts
+type CompletionContent struct {
+	Parts []CompletionContentPart
+}
+
+type CompletionContentPart struct {
+	Type     string              `json:"type"`
+	Text     string              `json:"text,omitempty"`
+	ImageURL *CompletionImageURL `json:"image_url,omitempty"`
+}
+
+// CompletionImageURL is the image of an image_url content part
+type CompletionImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (c *CompletionContent) UnmarshalJSON(data []byte) error {
+	c.Parts = nil
+	switch {
+	case string(data) == "null":
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		c.Parts = []CompletionContentPart{{Type: "text", Text: text}}
+		return nil
+	}
+	return json.Unmarshal(data, &c.Parts)
+}
+
+// Text joins the text parts of the content
+func (c CompletionContent) Text() (string, error) {
+	texts := make([]string, 0, len(c.Parts))
+	for _, p := range c.Parts {
+		switch p.Type {
+		case "text":
+			texts = append(texts, p.Text)
+		case "image_url":
+			// Images are read with Attachments
+		default:
+			return "", fmt.Errorf("unsupported content part type %q", p.Type)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// Attachments returns the images of the image_url parts of the content
+func (c CompletionContent) Attachments() []service.Attachment {
+	var attachments []service.Attachment
+	for _, p := range c.Parts {
+		if p.Type == "image_url" && p.ImageURL != nil {
+			attachments = append(attachments, service.Attachment{Type: service.AttachmentTypeImage, URL: p.ImageURL.URL})
+		}
+	}
+	return attachments
+}
+
+// StopSequences accepts a single stop sequence or an array of them
+type StopSequences []string
+
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var stop string
+		if err := json.Unmarshal(data, &stop); err != nil {
+			return err
+		}
+		*s = StopSequences{stop}
+		return nil
+	}
+	var stops []string
+	if err := json.Unmarshal(data, &stops); err != nil {
+		return err
+	}
+	*s = stops
+	return nil
+}
+
+type CompletionToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type CompletionTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type CompletionResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema *struct {
+		Name   string          `json:"name"`
+		Schema json.RawMessage `json:"schema"`
+		Strict bool            `json:"strict,omitempty"`
+	} `json:"json_schema,omitempty"`
+}
+
+// completionError is an OpenAI error object, answered with its status
+type completionError struct {
+	status  int
+	errType string
+	param   string
+	code    string
+	message string
+}
+
+func invalidCompletionRequest(param, message string) *completionError {
+	return &completionError{status: http.StatusBadRequest, errType: errTypeInvalidRequest, param: param, message: message}
+}
+
+func (e *completionError) body() gin.H {
+	body := gin.H{
+		"message": e.message,
+		"type":    e.errType,
+		"param":   nil,
+		"code":    nil,
+	}
+	if e.param != "" {
+		body["param"] = e.param
+	}
+	if e.code != "" {
+		body["code"] = e.code
+	}
+	return gin.H{"error": body}
+}
+
+func (e *completionError) write(c *gin.Context) {
+	c.JSON(e.status, e.body())
+}
+
+// completionRunError maps the error of a run onto an OpenAI error object
+func completionRunError(err error) *completionError {
+	switch {
+	case errors.Is(err, usage.ErrBudgetExceeded):
+		return &completionError{status: http.StatusTooManyRequests, errType: errTypeQuota, code: "budget_exceeded", message: err.Error()}
+	case errors.Is(err, runs.ErrCancelled):
+		return &completionError{status: http.StatusConflict, errType: errTypeAPI, code: "run_cancelled", message: err.Error()}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &completionError{status: http.StatusNotFound, errType: errTypeInvalidRequest, param: "model", code: "model_not_found", message: err.Error()}
+	}
+	var outputErr *structured.Error
+	if errors.As(err, &outputErr) {
+		return &completionError{status: http.StatusUnprocessableEntity, errType: errTypeAPI, code: "invalid_output", message: err.Error()}
+	}
+	return &completionError{status: http.StatusInternalServerError, errType: errTypeAPI, message: err.Error()}
+}
+
+// toRunRequest converts the request to a run of its agent or team. The last
+// message is the input, unless it is a tool result for the caller tools; the
+// system messages become an instruction and the others the history.
+func (req *CompletionsRequest) toRunRequest() (*service.RunRequest, *completionError) {
+	if req.N != nil && *req.N != 1 {
+		return nil, invalidCompletionRequest("n", "only n=1 is supported")
+	}
+	if len(req.Messages) == 0 {
+		return nil, invalidCompletionRequest("messages", "messages must not be empty")
+	}
+
+	maxTokens := req.MaxTokens
+	if req.MaxCompletionTokens != nil {
+		maxTokens = req.MaxCompletionTokens
+	}
+	params, err := newGenerationParams(req.Temperature, maxTokens, req.TopP, []string(req.Stop))
+	if err != nil {
+		return nil, invalidCompletionRequest("", err.Error())
+	}
+
+	svcReq := &service.RunRequest{
+		AgentID: req.AgentID,
+		TeamID:  req.TeamID,
+		Stream:  req.Stream,
+		Params:  params,
+	}
+	switch {
+	case strings.HasPrefix(req.Model, agentModelPrefix):
+		id := strings.TrimPrefix(req.Model, agentModelPrefix)
+		svcReq.AgentID = &id
+	case strings.HasPrefix(req.Model, teamModelPrefix):
+		id := strings.TrimPrefix(req.Model, teamModelPrefix)
+		svcReq.TeamID = &id
+	}
+	for _, id := range []*string{svcReq.AgentID, svcReq.TeamID} {
+		if id != nil && *id != "" {
+			if _, err := uuid.Parse(*id); err != nil {
+				return nil, invalidCompletionRequest("model", fmt.Sprintf("invalid agent or team id %q", *id))
+			}
+		}
+	}
+
+	var instructions []string
+	var history []*schema.Message
+	var attachments []service.Attachment
+	for i, m := range req.Messages {
+		param := fmt.Sprintf("messages[%d]", i)
+		text, err := m.Content.Text()
+		if err != nil {
+			return nil, invalidCompletionRequest(param+".content", err.Error())
+		}
+		switch m.Role {
+		case "system", "developer":
+			instructions = append(instructions, text)
+		case "user":
+			// Images of the earlier messages are only described, those of the
+			// last one are sent to the model
+			attachments = m.Content.Attachments()
+			if err := service.ValidateAttachments(attachments); err != nil {
+				return nil, invalidCompletionRequest(param+".content", err.Error())
+			}
+			if i < len(req.Messages)-1 {
+				text = service.AttachmentsText(text, attachments)
+			}
+			history = append(history, schema.UserMessage(text))
+		case "assistant":
+			toolCalls := make([]schema.ToolCall, 0, len(m.ToolCalls))
+			for _, tc := range m.ToolCalls {
+				call := schema.ToolCall{ID: tc.ID, Type: tc.Type}
+				call.Function.Name = tc.Function.Name
+				call.Function.Arguments = tc.Function.Arguments
+				toolCalls = append(toolCalls, call)
+			}
+			history = append(history, schema.AssistantMessage(text, toolCalls))
+		case "tool":
+			if m.ToolCallID == "" {
+				return nil, invalidCompletionRequest(param+".tool_call_id", "tool messages must have a tool_call_id")
+			}
+			history = append(history, schema.ToolMessage(text, m.ToolCallID))
+		default:
+			return nil, invalidCompletionRequest(param+".role", fmt.Sprintf("unsupported role %q", m.Role))
+		}
+	}
+	if len(history) == 0 {
+		return nil, invalidCompletionRequest("messages", "no user message found")
+	}
+
+	last := history[len(history)-1]
+	switch last.Role {
+	case schema.User:
+		svcReq.Message = last.Content
+		svcReq.Attachments = attachments
+		svcReq.History = history[:len(history)-1]
+	case schema.Tool:
+		// The caller ran the tools, the model goes on from their results
+		svcReq.History = history
+	default:
+		return nil, invalidCompletionRequest("messages", "the last message must be from the user or a tool")
+	}
+
+	for i, t := range req.Tools {
+		param := fmt.Sprintf("tools[%d]", i)
+		if t.Type != "function" || t.Function.Name == "" {
+			return nil, invalidCompletionRequest(param, "only function tools with a name are supported")
+		}
+		info := &schema.ToolInfo{Name: t.Function.Name, Desc: t.Function.Description}
+		if len(t.Function.Parameters) > 0 {
+			var params jsonschema.Schema
+			if err := json.Unmarshal(t.Function.Parameters, &params); err != nil {
+				return nil, invalidCompletionRequest(param+".function.parameters", err.Error())
+			}
+			info.ParamsOneOf = schema.NewParamsOneOfByJSONSchema(&params)
+		}
+		svcReq.Tools = append(svcReq.Tools, info)
+	}
+	if len(req.ToolChoice) > 0 {
+		choice, cerr := parseToolChoice(req.ToolChoice)
+		if cerr != nil {
+			return nil, cerr
+		}
+		svcReq.ToolChoice = choice
+	}
+	if last.Role == schema.Tool && len(svcReq.Tools) == 0 {
+		return nil, invalidCompletionRequest("tools", "tool results require the tools they answer")
+	}
+
+	format, outputSchema, cerr := responseFormat(req.ResponseFormat)
+	if cerr != nil {
+		return nil, cerr
+	}
+	if format != "" {
+		instructions = append(instructions, format)
+	}
+	svcReq.OutputSchema = outputSchema
+	svcReq.Instruction = strings.Join(instructions, "\n\n")
+
+	return svcReq, nil
+}
+
+// clientTools reports whether the request is answered with calls of the
+// caller tools
+func clientTools(req *service.RunRequest) bool {
+	return len(req.Tools) > 0 && (req.ToolChoice == nil || req.ToolChoice.Mode != service.ToolChoiceNone)
+}
+
+func parseToolChoice(raw json.RawMessage) (*service.ToolChoice, *completionError) {
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		switch mode {
+		case service.ToolChoiceAuto, service.ToolChoiceNone, service.ToolChoiceRequired:
+			return &service.ToolChoice{Mode: mode}, nil
+		}
+		return nil, invalidCompletionRequest("tool_choice", fmt.Sprintf("unsupported tool_choice %q", mode))
+	}
+
+	var named struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Type != "function" || named.Function.Name == "" {
+		return nil, invalidCompletionRequest("tool_choice", "tool_choice must be a mode or a function")
+	}
+	return &service.ToolChoice{Mode: service.ToolChoiceRequired, Function: named.Function.Name}, nil
+}
+
+// responseFormat returns the instruction telling the model how to format its
+// answer, or the output schema the answer must conform to
+func responseFormat(format *CompletionResponseFormat) (string, json.RawMessage, *completionError) {
+	if format == nil {
+		return "", nil, nil
+	}
+	switch format.Type {
+	case "", "text":
+		return "", nil, nil
+	case "json_object":
+		return "Respond with a single valid JSON object and nothing else.", nil, nil
+	case "json_schema":
+		if format.JSONSchema == nil || len(format.JSONSchema.Schema) == 0 {
+			return "", nil, invalidCompletionRequest("response_format.json_schema", "json_schema.schema is required")
+		}
+		if _, err := structured.Parse(format.JSONSchema.Name, format.JSONSchema.Schema); err != nil {
+			return "", nil, invalidCompletionRequest("response_format.json_schema.schema", err.Error())
+		}
+		return "", format.JSONSchema.Schema, nil
+	}
+	return "", nil, invalidCompletionRequest("response_format.type", fmt.Sprintf("unsupported response_format type %q", format.Type))
+}
+
+// Completions provides OpenAI-compatible chat completions API
+func (h *ChatHandler) Completions(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		invalidCompletionRequest("", "invalid project_id").write(c)
+		return
+	}
+
+	var req CompletionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidCompletionRequest("", err.Error()).write(c)
+		return
+	}
+
+	svcReq, cerr := req.toRunRequest()
+	if cerr != nil {
+		cerr.write(c)
+		return
+	}
+	if svcReq.Message == "" && !clientTools(svcReq) {
+		invalidCompletionRequest("messages", "no user message found").write(c)
+		return
+	}
+
+	runID := uuid.New().String()
+	svcReq.RunID = runID
+	ctx, counter := usage.WithCounter(c.Request.Context())
+
+	if !req.Stream {
+		resp, err := h.complete(ctx, projectID, svcReq)
+		if err != nil {
+			completionRunError(err).write(c)
+			return
+		}
+
+		message := gin.H{"role": "assistant", "content": resp.Content}
+		finishReason := "stop"
+		if len(resp.ToolCalls) > 0 {
+			if resp.Content == "" {
+				message["content"] = nil
+			}
+			message["tool_calls"] = completionToolCalls(resp.ToolCalls)
+			finishReason = "tool_calls"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":      "chatcmpl-" + resp.RunID,
+			"object":  "chat.completion",
+			"created": time.Now().Unix(),
+			"model":   req.Model,
+			"choices": []gin.H{{
+				"index":         0,
+				"message":       message,
+				"finish_reason": finishReason,
+			}},
+			"usage": resp.Usage,
+		})
+		return
+	}
+
+	// SSE streaming for OpenAI-compatible format
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	chunk := completionChunker{
+		id:           "chatcmpl-" + runID,
+		model:        req.Model,
+		created:      time.Now().Unix(),
+		includeUsage: includeUsage,
+	}
+
+	// The first chunk announces the role, as OpenAI does
+	chunk.write(c, gin.H{"role": "assistant", "content": ""}, nil)
+
+	finishReason := "stop"
+	if clientTools(svcReq) {
+		// Caller tools are answered in one model call, sent as whole chunks
+		var resp *service.RunResponse
+		resp, err = h.runtimeSvc.RunWithClientTools(ctx, projectID, svcReq)
+		if err == nil {
+			if resp.Content != "" {
+				chunk.write(c, gin.H{"content": resp.Content}, nil)
+			}
+			if len(resp.ToolCalls) > 0 {
+				chunk.write(c, gin.H{"tool_calls": completionToolCalls(resp.ToolCalls)}, nil)
+				finishReason = "tool_calls"
+			}
+		}
+	} else if len(svcReq.OutputSchema) > 0 {
+		// The answer is repaired to match the schema once complete, so it is
+		// buffered and sent as a whole chunk
+		var resp *service.RunResponse
+		resp, err = h.complete(ctx, projectID, svcReq)
+		if err == nil && resp.Content != "" {
+			chunk.write(c, gin.H{"content": resp.Content}, nil)
+		}
+	} else {
+		err = h.runtimeSvc.Stream(ctx, projectID, svcReq, func(event *supervisor.Event) error {
+			content := service.GetEventContent(event)
+			if content == "" {
+				return nil
+			}
+			chunk.write(c, gin.H{"content": content}, nil)
+			return nil
+		})
+	}
+
+	if err != nil {
+		chunk.send(c, completionRunError(err).body())
+	} else {
+		chunk.write(c, gin.H{}, finishReason)
+		if includeUsage {
+			chunk.writeUsage(c, counter.Usage())
+		}
+	}
+	c.Writer.WriteString("data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// complete runs the request without streaming: with the caller tools, the
+// agent and its tools, or the team
+func (h *ChatHandler) complete(ctx context.Context, projectID uuid.UUID, req *service.RunRequest) (*service.RunResponse, error) {
+	switch {
+	case clientTools(req):
+		return h.runtimeSvc.RunWithClientTools(ctx, projectID, req)
+	case req.AgentID != nil && *req.AgentID != "":
+		return h.runtimeSvc.RunAgent(ctx, projectID, req)
+	}
+	return h.runtimeSvc.Run(ctx, projectID, req)
+}
+
+// completionToolCalls converts tool calls to the OpenAI format
+func completionToolCalls(toolCalls []schema.ToolCall) []gin.H {
+	calls := make([]gin.H, 0, len(toolCalls))
+	for i, tc := range toolCalls {
+		calls = append(calls, gin.H{
+			"index": i,
+			"id":    tc.ID,
+			"type":  "function",
+			"function": gin.H{
+				"name":      tc.Function.Name,
+				"arguments": tc.Function.Arguments,
+			},
+		})
+	}
+	return calls
+}
+
+// Models lists the enabled agents and teams of the project as models of the
+// OpenAI-compatible API
+func (h *ChatHandler) Models(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		invalidCompletionRequest("", "invalid project_id").write(c)
+		return
+	}
+
+	agents, teams, err := h.runtimeSvc.ListCompletionTargets(c.Request.Context(), projectID)
+	if err != nil {
+		completionRunError(err).write(c)
+		return
+	}
+
+	models := make([]gin.H, 0, len(agents)+len(teams))
+	for _, a := range agents {
+		models = append(models, gin.H{
+			"id":          agentModelPrefix + a.ID.String(),
+			"object":      "model",
+			"created":     a.CreatedAt.Unix(),
+			"owned_by":    modelOwner,
+			"name":        a.Name,
+			"description": a.Description,
+		})
+	}
+	for _, t := range teams {
+		models = append(models, gin.H{
+			"id":          teamModelPrefix + t.ID.String(),
+			"object":      "model",
+			"created":     t.CreatedAt.Unix(),
+			"owned_by":    modelOwner,
+			"name":        t.Name,
+			"description": t.Description,
+			"is_default":  t.IsDefault,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   models,
+	})
+}
+
+// completionChunker writes the chunks of an OpenAI-compatible stream, they all
+// share the completion id and creation time
+type completionChunker struct {
+	id           string
+	model        string
+	created      int64
+	includeUsage bool
+}
+
+// write sends a chunk with the delta, finishReason is nil until the last one
+func (w *completionChunker) write(c *gin.Context, delta gin.H, finishReason interface{}) {
+	chunk := w.chunk([]gin.H{{
+		"index":         0,
+		"delta":         delta,
+		"finish_reason": finishReason,
+	}})
+	if w.includeUsage {
+		// Only the final usage chunk carries usage
+		chunk["usage"] = nil
+	}
+	w.send(c, chunk)
+}
+
+// writeUsage sends the final usage chunk, which has no choices
+func (w *completionChunker) writeUsage(c *gin.Context, tokens usage.TokenUsage) {
+	chunk := w.chunk([]gin.H{})
+	chunk["usage"] = tokens
+	w.send(c, chunk)
+}
+
+func (w *completionChunker) chunk(choices []gin.H) gin.H {
+	return gin.H{
+		"id":      w.id,
+		"object":  "chat.completion.chunk",
+		"created": w.created,
+		"model":   w.model,
+		"choices": choices,
+	}
+}
+
+func (w *completionChunker) send(c *gin.Context, chunk gin.H) {
+	data, _ := json.Marshal(chunk)
+	c.Writer.WriteString("data: " + string(data) + "\n\n")
+	c.Writer.Flush()
+}
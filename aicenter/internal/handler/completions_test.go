@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+)
+
+// completionChunks decodes the data of the SSE frames of a completion stream
+func completionChunks(t *testing.T, body string) []map[string]interface{} {
+	t.Helper()
+	var chunks []map[string]interface{}
+	for _, frame := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		data, ok := strings.CutPrefix(frame, "data: ")
+		if !ok {
+			t.Fatalf("frame %q is not a data frame", frame)
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("frame %q is not JSON: %v", frame, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func TestCompletionChunker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		includeUsage bool
+	}{
+		{name: "without usage"},
+		{name: "with usage", includeUsage: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			chunker := completionChunker{id: "chatcmpl-run-1", model: "support", created: 1700000000, includeUsage: tt.includeUsage}
+			chunker.write(c, gin.H{"role": "assistant", "content": ""}, nil)
+			chunker.write(c, gin.H{"content": "Hello"}, nil)
+			chunker.write(c, gin.H{}, "stop")
+			if tt.includeUsage {
+				chunker.writeUsage(c, usage.TokenUsage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12})
+			}
+
+			chunks := completionChunks(t, w.Body.String())
+			wantChunks := 3
+			if tt.includeUsage {
+				wantChunks = 4
+			}
+			if len(chunks) != wantChunks {
+				t.Fatalf("wrote %d chunks, want %d", len(chunks), wantChunks)
+			}
+			for i, chunk := range chunks {
+				if chunk["id"] != "chatcmpl-run-1" || chunk["object"] != "chat.completion.chunk" || chunk["created"] != float64(1700000000) || chunk["model"] != "support" {
+					t.Errorf("chunk %d = %v, want the completion id, object, creation time and model", i, chunk)
+				}
+				usageValue, hasUsage := chunk["usage"]
+				if hasUsage != tt.includeUsage {
+					t.Errorf("chunk %d has usage %v, want it only when included", i, hasUsage)
+				}
+				if i < 3 && usageValue != nil {
+					t.Errorf("chunk %d has usage %v, want null before the usage chunk", i, usageValue)
+				}
+			}
+
+			choices := func(i int) map[string]interface{} {
+				return chunks[i]["choices"].([]interface{})[0].(map[string]interface{})
+			}
+			if delta := choices(1)["delta"].(map[string]interface{}); delta["content"] != "Hello" || choices(1)["finish_reason"] != nil {
+				t.Errorf("content chunk choice = %v, want the delta and no finish reason", choices(1))
+			}
+			if choices(2)["finish_reason"] != "stop" {
+				t.Errorf("final chunk choice = %v, want finish reason stop", choices(2))
+			}
+			if tt.includeUsage {
+				last := chunks[3]
+				if len(last["choices"].([]interface{})) != 0 || last["usage"].(map[string]interface{})["total_tokens"] != float64(12) {
+					t.Errorf("usage chunk = %v, want no choices and the usage", last)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+	"github.com/tgo/captain/aicenter/internal/model"
+	"github.com/tgo/captain/aicenter/internal/pkg/response"
+	"github.com/tgo/captain/aicenter/internal/service"
+)
+
+type IntentRuleHandler struct {
+	svc        *service.IntentRuleService
+	runtimeSvc *service.RuntimeService
+}
+
+func NewIntentRuleHandler(svc *service.IntentRuleService, runtimeSvc *service.RuntimeService) *IntentRuleHandler {
+	return &IntentRuleHandler{svc: svc, runtimeSvc: runtimeSvc}
+}
+
+// IntentDryRunRequest is a query to route without running the agents
+type IntentDryRunRequest struct {
+	Query string `json:"query" binding:"required,max=10000"`
+	// UseLLM runs the LLM analysis when no rule routes the query
+	UseLLM bool `json:"use_llm"`
+	// SessionID is the conversation whose history rewrites a follow-up
+	// query, with the LLM analysis only
+	SessionID string `json:"session_id"`
+}
+
+func (h *IntentRuleHandler) List(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	rules, total, err := h.svc.List(c.Request.Context(), projectID, limit, offset)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.List(c, rules, total, limit, offset)
+}
+
+func (h *IntentRuleHandler) Create(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	req := model.IntentRule{IsEnabled: true}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	req.ProjectID = projectID
+	if err := h.svc.Validate(c.Request.Context(), &req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if err := h.svc.Create(c.Request.Context(), &req); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Created(c, req)
+}
+
+func (h *IntentRuleHandler) Get(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	ruleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid intent rule id")
+		return
+	}
+
+	rule, err := h.svc.GetByID(c.Request.Context(), projectID, ruleID)
+	if err != nil {
+		response.NotFound(c, "INTENT_RULE")
+		return
+	}
+
+	response.Success(c, rule)
+}
+
+func (h *IntentRuleHandler) Update(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	ruleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid intent rule id")
+		return
+	}
+
+	rule, err := h.svc.GetByID(c.Request.Context(), projectID, ruleID)
+	if err != nil {
+		response.NotFound(c, "INTENT_RULE")
+		return
+	}
+
+	if err := c.ShouldBindJSON(rule); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	rule.ID = ruleID
+	rule.ProjectID = projectID
+	if err := h.svc.Validate(c.Request.Context(), rule); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if err := h.svc.Update(c.Request.Context(), rule); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, rule)
+}
+
+func (h *IntentRuleHandler) Delete(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	ruleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid intent rule id")
+		return
+	}
+
+	// Get rule first for response
+	rule, err := h.svc.GetByID(c.Request.Context(), projectID, ruleID)
+	if err != nil {
+		response.NotFound(c, "INTENT_RULE")
+		return
+	}
+
+	if err := h.svc.Delete(c.Request.Context(), projectID, ruleID); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, rule)
+}
+
+// DryRun shows how a query would be routed: the matching rule, or the LLM
+// analysis when requested
+func (h *IntentRuleHandler) DryRun(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	var req IntentDryRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	result, err := h.runtimeSvc.DryRunQuery(c.Request.Context(), projectID, req.Query, req.SessionID, req.UseLLM)
+	if err != nil {
+		var budgetErr *usage.BudgetExceededError
+		if errors.As(err, &budgetErr) {
+			response.Error(c, http.StatusTooManyRequests, ErrCodeBudgetExceeded, budgetErr.Error(), budgetErr)
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
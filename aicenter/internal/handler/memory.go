@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/pkg/response"
+	"github.com/tgo/captain/aicenter/internal/service"
+)
+
+// MemoryHandler lets staff inspect, export and erase the conversation memory
+// of a project, e.g. to clear a poisoned conversation or on erasure requests
+type MemoryHandler struct {
+	runtimeSvc *service.RuntimeService
+}
+
+func NewMemoryHandler(runtimeSvc *service.RuntimeService) *MemoryHandler {
+	return &MemoryHandler{runtimeSvc: runtimeSvc}
+}
+
+// TruncateMemoryRequest is how many of the first messages of a session to keep
+type TruncateMemoryRequest struct {
+	Keep *int `json:"keep" binding:"required,min=0"`
+}
+
+func (h *MemoryHandler) List(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	sessions, total, err := h.runtimeSvc.ListMemorySessions(c.Request.Context(), projectID, limit, offset)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.List(c, sessions, total, limit, offset)
+}
+
+func (h *MemoryHandler) Get(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	session, err := h.runtimeSvc.GetMemorySession(c.Request.Context(), projectID, c.Param("session_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "MEMORY_SESSION")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, session)
+}
+
+// Export downloads the stored history of a session as JSONL, one message per
+// line
+func (h *MemoryHandler) Export(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+	sessionID := c.Param("session_id")
+
+	session, err := h.runtimeSvc.GetMemorySession(c.Request.Context(), projectID, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "MEMORY_SESSION")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "session-"+sessionID+".jsonl"))
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	for _, msg := range session.Messages {
+		if err := enc.Encode(msg); err != nil {
+			return
+		}
+	}
+}
+
+// Delete erases a session from every store
+func (h *MemoryHandler) Delete(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+	sessionID := c.Param("session_id")
+
+	erased, err := h.runtimeSvc.DeleteMemorySession(c.Request.Context(), projectID, sessionID)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+	if erased == 0 {
+		response.NotFound(c, "MEMORY_SESSION")
+		return
+	}
+
+	response.Success(c, gin.H{"session_id": sessionID, "deleted": erased})
+}
+
+// Truncate removes the messages of a session after the first keep ones
+func (h *MemoryHandler) Truncate(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+	sessionID := c.Param("session_id")
+
+	var req TruncateMemoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	removed, err := h.runtimeSvc.TruncateMemorySession(c.Request.Context(), projectID, sessionID, *req.Keep)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{"session_id": sessionID, "kept": *req.Keep, "deleted": removed})
+}
+
+// EraseVisitor erases all memory of a visitor: their facts and sessions. The
+// session_id query parameters add sessions not attributed to the visitor.
+func (h *MemoryHandler) EraseVisitor(c *gin.Context) {
+	projectID, visitorID, ok := visitorParams(c)
+	if !ok {
+		return
+	}
+
+	erasure, err := h.runtimeSvc.EraseVisitorMemory(c.Request.Context(), projectID, visitorID, c.QueryArray("session_id"))
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, erasure)
+}
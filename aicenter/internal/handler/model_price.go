@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+	"github.com/tgo/captain/aicenter/internal/middleware"
+	"github.com/tgo/captain/aicenter/internal/pkg/response"
+)
+
+// ModelPriceHandler manages the model price catalog. Prices are global, so
+// only admins change them; changing one re-prices the recorded usage it
+// applies to in the background.
+type ModelPriceHandler struct {
+	catalog    *usage.Catalog
+	recomputer *usage.Recomputer
+}
+
+func NewModelPriceHandler(catalog *usage.Catalog) *ModelPriceHandler {
+	return &ModelPriceHandler{catalog: catalog, recomputer: usage.NewRecomputer(catalog)}
+}
+
+func (h *ModelPriceHandler) List(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	filter := usage.ListPricesFilter{
+		ProviderKind: c.Query("provider_kind"),
+		Model:        c.Query("model"),
+	}
+	if filter.ProviderKind != "" && filter.ProviderKind != usage.WildcardPattern {
+		filter.ProviderKind = string(llm.NormalizeProviderKind(filter.ProviderKind))
+	}
+
+	prices, total, err := h.catalog.List(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.List(c, prices, total, limit, offset)
+}
+
+func (h *ModelPriceHandler) Get(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid price id")
+		return
+	}
+
+	price, err := h.catalog.Get(c.Request.Context(), id)
+	if err != nil {
+		response.NotFound(c, "MODEL_PRICE")
+		return
+	}
+
+	response.Success(c, price)
+}
+
+func (h *ModelPriceHandler) Create(c *gin.Context) {
+	var price usage.ModelPrice
+	if err := c.ShouldBindJSON(&price); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	price.ID = uuid.Nil
+	normalizeModelPrice(&price)
+	if err := price.Validate(); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.catalog.Create(c.Request.Context(), &price); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+	h.recompute(&price)
+
+	response.Created(c, price)
+}
+
+func (h *ModelPriceHandler) Update(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid price id")
+		return
+	}
+
+	price, err := h.catalog.Get(c.Request.Context(), id)
+	if err != nil {
+		response.NotFound(c, "MODEL_PRICE")
+		return
+	}
+	previous := *price
+
+	if err := c.ShouldBindJSON(price); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	price.ID = id
+	normalizeModelPrice(price)
+	if err := price.Validate(); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.catalog.Update(c.Request.Context(), price); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+	h.recompute(&previous, price)
+
+	response.Success(c, price)
+}
+
+func (h *ModelPriceHandler) Delete(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid price id")
+		return
+	}
+
+	price, err := h.catalog.Get(c.Request.Context(), id)
+	if err != nil {
+		response.NotFound(c, "MODEL_PRICE")
+		return
+	}
+
+	if err := h.catalog.Delete(c.Request.Context(), id); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+	h.recompute(price)
+
+	response.NoContent(c)
+}
+
+// Recompute starts a background re-pricing of the usage of the calling
+// project. Admins re-price every project, or the one of the project_id query
+// parameter.
+func (h *ModelPriceHandler) Recompute(c *gin.Context) {
+	projectID, ok := recomputeProject(c)
+	if !ok {
+		return
+	}
+
+	job := h.recomputer.Start(projectID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetRecompute returns the state of a recompute job, only the jobs of the
+// calling project unless called by an admin
+func (h *ModelPriceHandler) GetRecompute(c *gin.Context) {
+	jobID, err := uuid.Parse(c.Param("job_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid job id")
+		return
+	}
+	projectID, ok := recomputeProject(c)
+	if !ok {
+		return
+	}
+
+	job, found := h.recomputer.Get(jobID)
+	if !found || (!middleware.IsAdmin(c) && (job.ProjectID == nil || *job.ProjectID != *projectID)) {
+		response.NotFound(c, "RECOMPUTE_JOB")
+		return
+	}
+
+	response.Success(c, job)
+}
+
+// recompute re-prices the usage affected by a price change in the background
+func (h *ModelPriceHandler) recompute(changed ...*usage.ModelPrice) {
+	h.recomputer.Start(nil, changed...)
+}
+
+// recomputeProject returns the project a recompute applies to, nil for every
+// project, responding with the error when it is invalid
+func recomputeProject(c *gin.Context) (*uuid.UUID, bool) {
+	raw := c.GetString("project_id")
+	if middleware.IsAdmin(c) {
+		raw = c.Query("project_id")
+		if raw == "" {
+			return nil, true
+		}
+	}
+
+	projectID, err := uuid.Parse(raw)
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return nil, false
+	}
+	return &projectID, true
+}
+
+func normalizeModelPrice(price *usage.ModelPrice) {
+	price.ProviderKind = strings.TrimSpace(price.ProviderKind)
+	if price.ProviderKind != "" && price.ProviderKind != usage.WildcardPattern {
+		price.ProviderKind = string(llm.NormalizeProviderKind(price.ProviderKind))
+	}
+	price.Model = strings.TrimSpace(price.Model)
+	price.Currency = strings.ToUpper(strings.TrimSpace(price.Currency))
+	if price.Currency == "" {
+		price.Currency = usage.DefaultCurrency
+	}
+	if price.EffectiveFrom.IsZero() {
+		price.EffectiveFrom = time.Now()
+	}
+}
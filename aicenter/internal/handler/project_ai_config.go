@@ -74,6 +74,14 @@ func (h *ProjectAIConfigHandler) Upsert(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
+	if err := validateRuntimeConfig(req.Config); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if _, err := service.ParseSummaryModel(req.Config); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
 
 	// Check if exists
 	existing, _ := h.svc.GetByProjectID(c.Request.Context(), req.ProjectID)
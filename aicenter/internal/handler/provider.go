@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
 	"github.com/tgo/captain/aicenter/internal/model"
 	"github.com/tgo/captain/aicenter/internal/pkg/response"
 	"github.com/tgo/captain/aicenter/internal/service"
@@ -228,14 +230,110 @@ func (h *ProviderHandler) Test(c *gin.Context) {
 	})
 }
 
-func buildTestRequest(provider *model.LLMProvider) (string, string, map[string]string, error) {
-	if provider.APIKey == "" {
-		return "", "", nil, fmt.Errorf("API key is not set for this provider")
+// Models lists the models available on a provider. Ollama servers are queried
+// live, the stored models are only changed by RefreshModels.
+func (h *ProviderHandler) Models(c *gin.Context) {
+	provider, ok := h.providerParam(c)
+	if !ok {
+		return
+	}
+
+	if llm.NormalizeProviderKind(provider.ProviderKind) != llm.ProviderOllama {
+		response.Success(c, gin.H{"models": provider.AvailableModels})
+		return
+	}
+
+	names, models, ok := listOllamaModels(c, provider)
+	if !ok {
+		return
+	}
+	response.Success(c, gin.H{"models": names, "details": models})
+}
+
+// RefreshModels queries the models pulled on an Ollama server and stores them
+// as the provider's available models
+func (h *ProviderHandler) RefreshModels(c *gin.Context) {
+	provider, ok := h.providerParam(c)
+	if !ok {
+		return
+	}
+
+	if llm.NormalizeProviderKind(provider.ProviderKind) != llm.ProviderOllama {
+		response.BadRequest(c, "only the models of ollama providers can be refreshed")
+		return
+	}
+
+	names, models, ok := listOllamaModels(c, provider)
+	if !ok {
+		return
+	}
+	provider.AvailableModels = names
+	if err := h.svc.Update(c.Request.Context(), provider); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{"models": names, "details": models})
+}
+
+// providerParam returns the provider of the request path, it writes the error
+// response when there is none
+func (h *ProviderHandler) providerParam(c *gin.Context) (*model.LLMProvider, bool) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return nil, false
 	}
 
+	providerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid provider id")
+		return nil, false
+	}
+
+	provider, err := h.svc.GetByID(c.Request.Context(), projectID, providerID)
+	if err != nil {
+		response.NotFound(c, "LLM_PROVIDER")
+		return nil, false
+	}
+	return provider, true
+}
+
+// listOllamaModels queries the models pulled on the Ollama server of provider,
+// it writes the error response when the server cannot be reached
+func listOllamaModels(c *gin.Context, provider *model.LLMProvider) (model.JSONArray, []llm.OllamaModel, bool) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	models, err := llm.ListOllamaModels(ctx, provider.APIBaseURL)
+	if err != nil {
+		response.Error(c, http.StatusBadGateway, "PROVIDER_UNAVAILABLE", fmt.Sprintf("list models failed: %v", err), nil)
+		return nil, nil, false
+	}
+
+	names := make(model.JSONArray, 0, len(models))
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+	return names, models, true
+}
+
+func buildTestRequest(provider *model.LLMProvider) (string, string, map[string]string, error) {
 	kind := strings.ToLower(provider.ProviderKind)
 	base := strings.TrimRight(provider.APIBaseURL, "/")
 
+	// Self-hosted servers usually run without authentication
+	if kind == "ollama" {
+		if base == "" {
+			base = "http://localhost:11434"
+		}
+		return "GET", strings.TrimSuffix(base, "/v1") + "/api/version", nil, nil
+	}
+
+	if provider.APIKey == "" {
+		return "", "", nil, fmt.Errorf("API key is not set for this provider")
+	}
+
 	switch kind {
 	case "openai", "gpt", "oai":
 		if base == "" {
@@ -256,6 +354,12 @@ func buildTestRequest(provider *model.LLMProvider) (string, string, map[string]s
 			"anthropic-version": version,
 		}, nil
 
+	case "google", "gemini":
+		if base == "" {
+			base = "https://generativelanguage.googleapis.com"
+		}
+		return "GET", base + "/v1beta/models", map[string]string{"x-goog-api-key": provider.APIKey}, nil
+
 	case "dashscope", "ali", "aliyun":
 		if base == "" || !strings.Contains(base, "compatible-mode") {
 			base = "https://dashscope.aliyuncs.com/compatible-mode/v1"
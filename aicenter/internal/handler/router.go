@@ -1,15 +1,21 @@
 package handler
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/cloudwego/eino/callbacks"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"github.com/tgo/captain/aicenter/internal/config"
 	"github.com/tgo/captain/aicenter/internal/eino/memory"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
 	"github.com/tgo/captain/aicenter/internal/middleware"
 	"github.com/tgo/captain/aicenter/internal/pkg/apiserver"
 	"github.com/tgo/captain/aicenter/internal/repository"
@@ -24,6 +30,14 @@ type Handlers struct {
 	Provider        *ProviderHandler
 	Tool            *ToolHandler
 	ProjectAIConfig *ProjectAIConfigHandler
+	Usage           *UsageHandler
+	ModelPrice      *ModelPriceHandler
+	Budget          *BudgetHandler
+	Run             *RunHandler
+	Approval        *ApprovalHandler
+	IntentRule      *IntentRuleHandler
+	VisitorMemory   *VisitorMemoryHandler
+	Memory          *MemoryHandler
 }
 
 func SetupRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
@@ -75,7 +89,56 @@ func SetupRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 
 		// Agent Run (SSE)
 		v1.POST("/agents/run", handlers.Chat.Run)
+		v1.GET("/agents/run/:run_id", handlers.Chat.GetRun)
+		v1.GET("/agents/run/:run_id/events", handlers.Chat.Events)
 		v1.POST("/agents/run/:run_id/cancel", handlers.Chat.Cancel)
+		v1.POST("/agents/sessions/:session_id/cancel", handlers.Chat.CancelSession)
+
+		// Run history
+		runHistory := v1.Group("/runs")
+		{
+			runHistory.GET("", handlers.Run.List)
+			runHistory.GET("/:run_id", handlers.Run.Get)
+			runHistory.POST("/:run_id/replay", handlers.Run.Replay)
+		}
+
+		// Tool approvals
+		approvals := v1.Group("/approvals")
+		{
+			approvals.GET("", handlers.Approval.List)
+			approvals.GET("/:id", handlers.Approval.Get)
+		}
+
+		// Intent rules of the QueryAnalyzer
+		intentRules := v1.Group("/intent-rules")
+		{
+			intentRules.GET("", handlers.IntentRule.List)
+			intentRules.POST("", handlers.IntentRule.Create)
+			intentRules.POST("/dry-run", handlers.IntentRule.DryRun)
+			intentRules.GET("/:id", handlers.IntentRule.Get)
+			intentRules.PATCH("/:id", handlers.IntentRule.Update)
+			intentRules.DELETE("/:id", handlers.IntentRule.Delete)
+		}
+
+		// Long-term memory of visitors, across sessions
+		visitors := v1.Group("/visitors/:visitor_id")
+		{
+			visitors.GET("/facts", handlers.VisitorMemory.List)
+			visitors.DELETE("/facts", handlers.VisitorMemory.DeleteAll)
+			visitors.POST("/facts/extract", handlers.VisitorMemory.Extract)
+			visitors.DELETE("/facts/:fact_id", handlers.VisitorMemory.Delete)
+			visitors.DELETE("/memory", handlers.Memory.EraseVisitor)
+		}
+
+		// Conversation memory of the sessions
+		memorySessions := v1.Group("/memory/sessions")
+		{
+			memorySessions.GET("", handlers.Memory.List)
+			memorySessions.GET("/:session_id", handlers.Memory.Get)
+			memorySessions.GET("/:session_id/export", handlers.Memory.Export)
+			memorySessions.POST("/:session_id/truncate", handlers.Memory.Truncate)
+			memorySessions.DELETE("/:session_id", handlers.Memory.Delete)
+		}
 
 		// Teams
 		teams := v1.Group("/teams")
@@ -98,10 +161,13 @@ func SetupRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 			providers.PATCH("/:id", handlers.Provider.Update)
 			providers.DELETE("/:id", handlers.Provider.Delete)
 			providers.POST("/:id/test", handlers.Provider.Test)
+			providers.GET("/:id/models", handlers.Provider.Models)
+			providers.POST("/:id/models/refresh", handlers.Provider.RefreshModels)
 		}
 
 		// Chat Completions (OpenAI compatible)
 		v1.POST("/chat/completions", handlers.Chat.Completions)
+		v1.GET("/models", handlers.Chat.Models)
 
 		// Tools
 		tools := v1.Group("/tools")
@@ -120,6 +186,64 @@ func SetupRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 			projectConfigs.PUT("", handlers.ProjectAIConfig.Upsert)
 			projectConfigs.GET("", handlers.ProjectAIConfig.Get)
 		}
+
+		// Token usage
+		usageGroup := v1.Group("/usage")
+		{
+			usageGroup.GET("/summary", handlers.Usage.Summary)
+			usageGroup.GET("/by-model", handlers.Usage.ByModel)
+			usageGroup.GET("/by-agent", handlers.Usage.ByAgent)
+			usageGroup.GET("/daily", handlers.Usage.Daily)
+		}
+
+		// Project budget
+		budget := v1.Group("/budget")
+		{
+			budget.GET("", handlers.Budget.Get)
+			budget.PUT("", handlers.Budget.Put)
+			budget.DELETE("", handlers.Budget.Delete)
+			budget.GET("/alerts", handlers.Budget.Alerts)
+		}
+
+		// Model price catalog (global, read-only to projects), re-pricing
+		// of the project usage
+		prices := v1.Group("/model-prices")
+		{
+			prices.GET("", handlers.ModelPrice.List)
+			prices.POST("/recompute", handlers.ModelPrice.Recompute)
+			prices.GET("/recompute/:job_id", handlers.ModelPrice.GetRecompute)
+			prices.GET("/:id", handlers.ModelPrice.Get)
+		}
+	}
+
+	// Approval decisions are made by staff, authenticated with their token
+	decisions := r.Group("/api/v1/approvals")
+	if authMw != nil {
+		decisions.Use(authMw.JWTAuth())
+	} else {
+		decisions.Use(middleware.ProjectID())
+	}
+	{
+		decisions.POST("/:id/approve", handlers.Approval.Approve)
+		decisions.POST("/:id/reject", handlers.Approval.Reject)
+		decisions.POST("/:id/resume", handlers.Approval.Resume)
+	}
+
+	// Admin API, shared by every project
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.AdminAuth(cfg.AdminAPIKey))
+	{
+		// Model price catalog
+		prices := admin.Group("/model-prices")
+		{
+			prices.GET("", handlers.ModelPrice.List)
+			prices.POST("", handlers.ModelPrice.Create)
+			prices.POST("/recompute", handlers.ModelPrice.Recompute)
+			prices.GET("/recompute/:job_id", handlers.ModelPrice.GetRecompute)
+			prices.GET("/:id", handlers.ModelPrice.Get)
+			prices.PATCH("/:id", handlers.ModelPrice.Update)
+			prices.DELETE("/:id", handlers.ModelPrice.Delete)
+		}
 	}
 
 	return r
@@ -139,6 +263,7 @@ func initHandlers(db *gorm.DB, cfg *config.Config) *Handlers {
 	providerRepo := repository.NewProviderRepository(db)
 	toolRepo := repository.NewToolRepository(db)
 	projectConfigRepo := repository.NewProjectAIConfigRepository(db)
+	intentRuleRepo := repository.NewIntentRuleRepository(db)
 
 	// Initialize services
 	agentSvc := service.NewAgentService(agentRepo)
@@ -147,31 +272,67 @@ func initHandlers(db *gorm.DB, cfg *config.Config) *Handlers {
 	runtimeSvc := service.NewRuntimeService(db, teamRepo, projectConfigRepo, providerRepo, cfg.RAGServiceURL, cfg.MCPServiceURL)
 	toolSvc := service.NewToolService(toolRepo)
 	projectConfigSvc := service.NewProjectAIConfigService(projectConfigRepo)
+	intentRuleSvc := service.NewIntentRuleService(intentRuleRepo, agentRepo)
+	runtimeSvc.SetIntentRules(intentRuleSvc)
+
+	// Record token usage of every model call
+	usageTracker := usage.NewTracker(db)
+	callbacks.AppendGlobalHandlers(usage.NewCallbackHandler(usageTracker))
+	// Stream the tool invocations of streamed runs
+	callbacks.AppendGlobalHandlers(streaming.NewToolCallbackHandler())
+	budgetGuard := usage.NewBudgetGuard(db)
+	runtimeSvc.SetBudgetGuard(budgetGuard)
+	runtimeSvc.SetRunHistory(runs.NewHistory(db))
 
 	// Set up apiserver client for internal API calls
 	if cfg.InternalAPIURL != "" {
-		apiserverClient := apiserver.NewClient(cfg.InternalAPIURL)
+		apiserverClient := apiserver.NewClient(cfg.InternalAPIURL, cfg.InternalAPIKey)
 		runtimeSvc.SetApiserverClient(apiserverClient)
+		budgetGuard.SetNotifier(runtimeSvc)
 		log.Printf("Apiserver internal client enabled -> %s", cfg.InternalAPIURL)
 	}
 
-	// Set up Redis for memory caching
+	// Set up Redis for memory caching, cross-replica run cancellation,
+	// resumable streams, checkpoints of runs waiting for approval and
+	// reloading intent rules
+	var runRegistry *runs.Registry
+	streamCfg := streaming.DefaultManagerConfig()
+	streamMgr := streaming.NewManager(streamCfg)
 	if cfg.RedisURL != "" {
 		redisStore, err := memory.NewRedisStoreFromURL(cfg.RedisURL, 30*time.Minute)
 		if err != nil {
 			log.Printf("Warning: Failed to connect to Redis for memory, using PostgreSQL only: %v", err)
 		} else {
 			runtimeSvc.SetRedisStore(redisStore)
+			runRegistry = runs.NewRegistry(redisStore.Client())
+			runtimeSvc.SetCheckPointStore(supervisor.NewRedisCheckPointStore(redisStore.Client()))
+			streamMgr.SetBuffer(streaming.NewRedisBuffer(redisStore.Client(), streamCfg.BufferSize))
+			intentRuleSvc.SetRedisClient(redisStore.Client())
 			log.Printf("Redis memory cache enabled -> %s", cfg.RedisURL)
 		}
 	}
+	if runRegistry == nil {
+		runRegistry = runs.NewRegistry(nil)
+	}
+	runRegistry.Start(context.Background())
+	runtimeSvc.SetRunRegistry(runRegistry)
+	streamMgr.Start()
+	intentRuleSvc.Start(context.Background())
 
 	return &Handlers{
 		Agent:           NewAgentHandler(agentSvc),
 		Team:            NewTeamHandler(teamSvc),
-		Chat:            NewChatHandler(runtimeSvc, cfg),
+		Chat:            NewChatHandler(runtimeSvc, streamMgr, cfg),
 		Provider:        NewProviderHandler(providerSvc),
 		Tool:            NewToolHandler(toolSvc),
 		ProjectAIConfig: NewProjectAIConfigHandler(projectConfigSvc),
+		Usage:           NewUsageHandler(usageTracker),
+		ModelPrice:      NewModelPriceHandler(usageTracker.Catalog()),
+		Budget:          NewBudgetHandler(budgetGuard),
+		Run:             NewRunHandler(runtimeSvc),
+		Approval:        NewApprovalHandler(runtimeSvc),
+		IntentRule:      NewIntentRuleHandler(intentRuleSvc, runtimeSvc),
+		VisitorMemory:   NewVisitorMemoryHandler(runtimeSvc),
+		Memory:          NewMemoryHandler(runtimeSvc),
 	}
 }
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/pkg/response"
+	"github.com/tgo/captain/aicenter/internal/service"
+)
+
+// RunHandler exposes the persisted run history
+type RunHandler struct {
+	runtimeSvc *service.RuntimeService
+}
+
+func NewRunHandler(runtimeSvc *service.RuntimeService) *RunHandler {
+	return &RunHandler{runtimeSvc: runtimeSvc}
+}
+
+// List returns the runs of the project, filtered by session, visitor, team,
+// agent, status or replayed run
+func (h *RunHandler) List(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	filter := runs.ListFilter{
+		SessionID: c.Query("session_id"),
+		AgentID:   c.Query("agent_id"),
+		Status:    runs.Status(c.Query("status")),
+		ReplayOf:  c.Query("replay_of"),
+	}
+	if v := c.Query("visitor_id"); v != "" {
+		visitorID, err := uuid.Parse(v)
+		if err != nil {
+			response.BadRequest(c, "invalid visitor_id")
+			return
+		}
+		filter.VisitorID = &visitorID
+	}
+	if v := c.Query("team_id"); v != "" {
+		teamID, err := uuid.Parse(v)
+		if err != nil {
+			response.BadRequest(c, "invalid team_id")
+			return
+		}
+		filter.TeamID = &teamID
+	}
+
+	records, total, err := h.runtimeSvc.ListRuns(c.Request.Context(), projectID, filter, limit, offset)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.List(c, records, total, limit, offset)
+}
+
+// Get returns a run with its event timeline
+func (h *RunHandler) Get(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+
+	record, err := h.runtimeSvc.GetRunHistory(c.Request.Context(), projectID, c.Param("run_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "RUN")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, record)
+}
+
+// Replay re-runs a recorded run against the current config and returns both
+// runs for comparison. Tools with side effects return their recorded results,
+// execute_tools=true runs them again, repeating their side effects.
+func (h *RunHandler) Replay(c *gin.Context) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return
+	}
+	runID := c.Param("run_id")
+	executeTools := c.Query("execute_tools") == "true"
+
+	original, err := h.runtimeSvc.GetRunHistory(c.Request.Context(), projectID, runID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "RUN")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	replay, err := h.runtimeSvc.Replay(c.Request.Context(), projectID, runID, executeTools)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{
+		"original":      original,
+		"replay":        replay,
+		"execute_tools": executeTools,
+	})
+}
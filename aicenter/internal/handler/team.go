@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -50,6 +51,14 @@ func (h *TeamHandler) Create(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
+	if err := validateRuntimeConfig(req.Config); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if !req.ExecutionMode.Valid() {
+		response.BadRequest(c, "invalid execution_mode: "+string(req.ExecutionMode))
+		return
+	}
 
 	req.ProjectID = projectID
 	if err := h.svc.Create(c.Request.Context(), &req); err != nil {
@@ -82,6 +91,77 @@ func (h *TeamHandler) Get(c *gin.Context) {
 	response.Success(c, team)
 }
 
+// TeamUpdateRequest holds the fields of a team an update may change, the
+// ones left out are kept
+type TeamUpdateRequest struct {
+	Name                  string                   `json:"name,omitempty"`
+	Description           string                   `json:"description,omitempty"`
+	Model                 string                   `json:"model,omitempty"`
+	SupervisorInstruction string                   `json:"supervisor_instruction,omitempty"`
+	Instruction           string                   `json:"instruction,omitempty"`
+	ExpectedOutput        string                   `json:"expected_output,omitempty"`
+	SessionID             string                   `json:"session_id,omitempty"`
+	IsDefault             *bool                    `json:"is_default,omitempty"`
+	IsEnabled             *bool                    `json:"is_enabled,omitempty"`
+	Config                map[string]interface{}   `json:"config,omitempty"`
+	SupervisorLLMID       *uuid.UUID               `json:"supervisor_llm_id,omitempty"`
+	AIProviderID          *uuid.UUID               `json:"ai_provider_id,omitempty"`
+	ExecutionMode         *model.TeamExecutionMode `json:"execution_mode,omitempty"`
+}
+
+// apply validates the update and sets its fields on team
+func (r *TeamUpdateRequest) apply(team *model.Team) error {
+	if r.Config != nil {
+		if err := validateRuntimeConfig(r.Config); err != nil {
+			return err
+		}
+	}
+	if r.ExecutionMode != nil && !r.ExecutionMode.Valid() {
+		return fmt.Errorf("invalid execution_mode: %s", *r.ExecutionMode)
+	}
+
+	if r.Name != "" {
+		team.Name = r.Name
+	}
+	if r.Description != "" {
+		team.Description = r.Description
+	}
+	if r.Model != "" {
+		team.Model = r.Model
+	}
+	if r.SupervisorInstruction != "" {
+		team.SupervisorInstruction = r.SupervisorInstruction
+	}
+	if r.Instruction != "" {
+		team.Instruction = r.Instruction
+	}
+	if r.ExpectedOutput != "" {
+		team.ExpectedOutput = r.ExpectedOutput
+	}
+	if r.SessionID != "" {
+		team.SessionID = r.SessionID
+	}
+	if r.IsDefault != nil {
+		team.IsDefault = *r.IsDefault
+	}
+	if r.IsEnabled != nil {
+		team.IsEnabled = *r.IsEnabled
+	}
+	if r.Config != nil {
+		team.Config = r.Config
+	}
+	if r.SupervisorLLMID != nil {
+		team.SupervisorLLMID = r.SupervisorLLMID
+	}
+	if r.AIProviderID != nil {
+		team.AIProviderID = r.AIProviderID
+	}
+	if r.ExecutionMode != nil {
+		team.ExecutionMode = *r.ExecutionMode
+	}
+	return nil
+}
+
 func (h *TeamHandler) Update(c *gin.Context) {
 	projectID, err := uuid.Parse(c.GetString("project_id"))
 	if err != nil {
@@ -101,7 +181,12 @@ func (h *TeamHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if err := c.ShouldBindJSON(team); err != nil {
+	var req TeamUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if err := req.apply(team); err != nil {
 		response.BadRequest(c, err.Error())
 		return
 	}
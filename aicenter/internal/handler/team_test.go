@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/model"
+)
+
+func TestTeamUpdateRequestApply(t *testing.T) {
+	planExecute, unknown := model.TeamModePlanExecute, model.TeamExecutionMode("round_robin")
+	disabled := false
+	projectID := uuid.New()
+	newTeam := func() *model.Team {
+		return &model.Team{
+			ProjectID:     projectID,
+			Name:          "support",
+			Instruction:   "Help the customer.",
+			IsEnabled:     true,
+			ExecutionMode: model.TeamModeSupervisor,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		req     TeamUpdateRequest
+		check   func(t *testing.T, team *model.Team)
+		wantErr bool
+	}{
+		{
+			name: "fields left out are kept",
+			req:  TeamUpdateRequest{Name: "billing"},
+			check: func(t *testing.T, team *model.Team) {
+				if team.Name != "billing" || team.Instruction != "Help the customer." || !team.IsEnabled || team.ExecutionMode != model.TeamModeSupervisor {
+					t.Errorf("updated team = %+v, want only the name changed", team)
+				}
+			},
+		},
+		{
+			name: "execution mode and flags",
+			req:  TeamUpdateRequest{ExecutionMode: &planExecute, IsEnabled: &disabled},
+			check: func(t *testing.T, team *model.Team) {
+				if team.ExecutionMode != model.TeamModePlanExecute || team.IsEnabled {
+					t.Errorf("updated team = %+v, want it plan-execute and disabled", team)
+				}
+			},
+		},
+		{name: "unknown execution mode", req: TeamUpdateRequest{ExecutionMode: &unknown}, wantErr: true},
+		{name: "invalid config", req: TeamUpdateRequest{Config: map[string]interface{}{"temperature": "hot"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := newTeam()
+			err := tt.req.apply(team)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("apply() error = nil, want an error")
+				}
+				if !reflect.DeepEqual(team, newTeam()) {
+					t.Errorf("apply() changed the team to %+v on error", team)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			if team.ProjectID != projectID {
+				t.Errorf("apply() moved the team to project %s", team.ProjectID)
+			}
+			tt.check(t, team)
+		})
+	}
+}
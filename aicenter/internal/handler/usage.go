@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+	"github.com/tgo/captain/aicenter/internal/pkg/response"
+)
+
+// defaultUsagePeriod is the period reported when no start is given
+const defaultUsagePeriod = 30 * 24 * time.Hour
+
+type UsageHandler struct {
+	tracker *usage.Tracker
+}
+
+func NewUsageHandler(tracker *usage.Tracker) *UsageHandler {
+	return &UsageHandler{tracker: tracker}
+}
+
+// Summary returns the aggregated usage of the project
+func (h *UsageHandler) Summary(c *gin.Context) {
+	projectID, start, end, ok := parseUsageQuery(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.tracker.GetSummary(c.Request.Context(), projectID, start, end)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+	response.Success(c, summary)
+}
+
+// ByModel returns usage grouped by provider and model
+func (h *UsageHandler) ByModel(c *gin.Context) {
+	projectID, start, end, ok := parseUsageQuery(c)
+	if !ok {
+		return
+	}
+
+	results, err := h.tracker.GetUsageByModel(c.Request.Context(), projectID, start, end)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+	if results == nil {
+		results = []usage.UsageByModel{}
+	}
+	response.Success(c, results)
+}
+
+// ByAgent returns usage grouped by agent
+func (h *UsageHandler) ByAgent(c *gin.Context) {
+	projectID, start, end, ok := parseUsageQuery(c)
+	if !ok {
+		return
+	}
+
+	results, err := h.tracker.GetUsageByAgent(c.Request.Context(), projectID, start, end)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+	if results == nil {
+		results = []usage.UsageByAgent{}
+	}
+	response.Success(c, results)
+}
+
+// Daily returns the daily usage series
+func (h *UsageHandler) Daily(c *gin.Context) {
+	projectID, start, end, ok := parseUsageQuery(c)
+	if !ok {
+		return
+	}
+
+	results, err := h.tracker.GetDailyUsage(c.Request.Context(), projectID, start, end)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+	if results == nil {
+		results = []usage.DailyUsage{}
+	}
+	response.Success(c, results)
+}
+
+// parseUsageQuery reads the project and the start/end query params
+// (RFC 3339 or YYYY-MM-DD). It defaults to the last 30 days.
+func parseUsageQuery(c *gin.Context) (uuid.UUID, time.Time, time.Time, bool) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return uuid.Nil, time.Time{}, time.Time{}, false
+	}
+
+	end := time.Now()
+	if v := c.Query("end"); v != "" {
+		t, dateOnly, err := parseUsageTime(v)
+		if err != nil {
+			response.BadRequest(c, "invalid end: "+err.Error())
+			return uuid.Nil, time.Time{}, time.Time{}, false
+		}
+		if dateOnly {
+			// A date includes the whole day
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		end = t
+	}
+
+	start := end.Add(-defaultUsagePeriod)
+	if v := c.Query("start"); v != "" {
+		t, _, err := parseUsageTime(v)
+		if err != nil {
+			response.BadRequest(c, "invalid start: "+err.Error())
+			return uuid.Nil, time.Time{}, time.Time{}, false
+		}
+		start = t
+	}
+
+	if start.After(end) {
+		response.BadRequest(c, "start must be before end")
+		return uuid.Nil, time.Time{}, time.Time{}, false
+	}
+	return projectID, start, end, true
+}
+
+func parseUsageTime(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("expected RFC 3339 or YYYY-MM-DD, got %q", v)
+}
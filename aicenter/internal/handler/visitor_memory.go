@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+	"github.com/tgo/captain/aicenter/internal/pkg/response"
+	"github.com/tgo/captain/aicenter/internal/service"
+)
+
+// VisitorMemoryHandler lets staff view and delete what is remembered about
+// visitors across sessions
+type VisitorMemoryHandler struct {
+	runtimeSvc *service.RuntimeService
+}
+
+func NewVisitorMemoryHandler(runtimeSvc *service.RuntimeService) *VisitorMemoryHandler {
+	return &VisitorMemoryHandler{runtimeSvc: runtimeSvc}
+}
+
+// ExtractVisitorFactsRequest is the session to extract the facts of
+type ExtractVisitorFactsRequest struct {
+	SessionID string `json:"session_id" binding:"required"`
+}
+
+func (h *VisitorMemoryHandler) List(c *gin.Context) {
+	projectID, visitorID, ok := visitorParams(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	ctx := c.Request.Context()
+	facts, total, err := h.runtimeSvc.VisitorMemory(ctx, projectID).List(ctx, visitorID, limit, offset)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.List(c, facts, total, limit, offset)
+}
+
+func (h *VisitorMemoryHandler) Delete(c *gin.Context) {
+	projectID, visitorID, ok := visitorParams(c)
+	if !ok {
+		return
+	}
+
+	factID, err := uuid.Parse(c.Param("fact_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid fact id")
+		return
+	}
+
+	// Get fact first for response
+	ctx := c.Request.Context()
+	visitorMem := h.runtimeSvc.VisitorMemory(ctx, projectID)
+	fact, err := visitorMem.Get(ctx, visitorID, factID)
+	if err != nil {
+		response.NotFound(c, "VISITOR_FACT")
+		return
+	}
+
+	if err := visitorMem.Delete(ctx, visitorID, factID); err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, fact)
+}
+
+// DeleteAll forgets everything remembered about a visitor
+func (h *VisitorMemoryHandler) DeleteAll(c *gin.Context) {
+	projectID, visitorID, ok := visitorParams(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	deleted, err := h.runtimeSvc.VisitorMemory(ctx, projectID).DeleteAll(ctx, visitorID)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{"deleted": deleted})
+}
+
+// Extract runs the extraction pass of a session now, instead of once it is
+// idle, and returns the new facts
+func (h *VisitorMemoryHandler) Extract(c *gin.Context) {
+	projectID, visitorID, ok := visitorParams(c)
+	if !ok {
+		return
+	}
+
+	var req ExtractVisitorFactsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	facts, err := h.runtimeSvc.ExtractVisitorFacts(c.Request.Context(), projectID, visitorID, req.SessionID)
+	if err != nil {
+		var budgetErr *usage.BudgetExceededError
+		if errors.As(err, &budgetErr) {
+			response.Error(c, http.StatusTooManyRequests, ErrCodeBudgetExceeded, budgetErr.Error(), budgetErr)
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, facts)
+}
+
+// visitorParams parses the project and visitor of the request, responding
+// with the error when either is invalid
+func visitorParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	projectID, err := uuid.Parse(c.GetString("project_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid project_id")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	visitorID, err := uuid.Parse(c.Param("visitor_id"))
+	if err != nil {
+		response.BadRequest(c, "invalid visitor id")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return projectID, visitorID, true
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +14,7 @@ const (
 	ContextKeyTokenInfo = "token_info"
 	ContextKeyProjectID = "project_id"
 	ContextKeyAPIKey    = "api_key"
+	ContextKeyAdmin     = "admin"
 )
 
 type AuthMiddleware struct {
@@ -157,6 +159,41 @@ func (m *AuthMiddleware) APIKeyAuth() gin.HandlerFunc {
 	}
 }
 
+// AdminAuth only lets through requests carrying the admin key in the
+// X-Admin-Key header. Without a configured key every request is refused.
+func AdminAuth(adminKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminKey == "" {
+			c.AbortWithStatusJSON(403, gin.H{
+				"error": gin.H{
+					"code":    "ADMIN_DISABLED",
+					"message": "Admin API is not configured",
+				},
+			})
+			return
+		}
+
+		key := c.GetHeader("X-Admin-Key")
+		if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_ADMIN_KEY",
+					"message": "Invalid or missing X-Admin-Key header",
+				},
+			})
+			return
+		}
+
+		c.Set(ContextKeyAdmin, true)
+		c.Next()
+	}
+}
+
+// IsAdmin reports whether the request was authenticated with the admin key
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool(ContextKeyAdmin)
+}
+
 // GetProjectID extracts project ID from context
 func GetProjectID(c *gin.Context) uuid.UUID {
 	projectIDStr := c.GetString(ContextKeyProjectID)
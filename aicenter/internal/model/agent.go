@@ -37,7 +37,9 @@ type AgentTool struct {
 	ToolProvider string    `gorm:"size:100;not null" json:"tool_provider"`
 	ToolName     string    `gorm:"size:255;not null" json:"tool_name"`
 	IsEnabled    bool      `gorm:"default:true" json:"is_enabled"`
-	Config       JSONMap   `gorm:"type:jsonb" json:"config,omitempty"`
+	// RequiresApproval pauses the run on each call of the tool until staff approve it
+	RequiresApproval bool    `gorm:"default:false" json:"requires_approval"`
+	Config           JSONMap `gorm:"type:jsonb" json:"config,omitempty"`
 }
 
 func (AgentTool) TableName() string {
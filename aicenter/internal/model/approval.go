@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ApprovalStatus is the state of a tool approval
+type ApprovalStatus string
+
+const (
+	ApprovalStatusPending  ApprovalStatus = "pending"
+	ApprovalStatusApproved ApprovalStatus = "approved"
+	ApprovalStatusRejected ApprovalStatus = "rejected"
+)
+
+// ToolApproval is a call of a tool that requires approval. The run that made
+// it is paused at a checkpoint until every pending approval of the run is
+// decided, then it is resumed with the decisions.
+type ToolApproval struct {
+	BaseModel
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index" json:"project_id"`
+	// RunID is the paused run, its checkpoint is stored under this ID
+	RunID string `gorm:"size:64;not null;index" json:"run_id"`
+	// InterruptID addresses the paused tool call when resuming the run
+	InterruptID string     `gorm:"type:text;not null" json:"-"`
+	TeamID      *uuid.UUID `gorm:"type:uuid" json:"team_id,omitempty"`
+	SessionID   string     `gorm:"size:255;index" json:"session_id,omitempty"`
+	VisitorID   *uuid.UUID `gorm:"type:uuid;index" json:"visitor_id,omitempty"`
+	// EnableMemory stores the answer of the resumed run in the session memory
+	EnableMemory bool    `gorm:"default:false" json:"enable_memory"`
+	Params       JSONMap `gorm:"type:jsonb" json:"params,omitempty"`
+
+	AgentName  string         `gorm:"size:255" json:"agent_name"`
+	ToolName   string         `gorm:"size:255;not null" json:"tool_name"`
+	ToolCallID string         `gorm:"size:255" json:"tool_call_id"`
+	Arguments  string         `gorm:"type:text" json:"arguments"`
+	Status     ApprovalStatus `gorm:"size:20;not null;index" json:"status"`
+	DecidedBy  string         `gorm:"size:255" json:"decided_by,omitempty"`
+	Comment    string         `gorm:"type:text" json:"comment,omitempty"`
+	DecidedAt  *time.Time     `json:"decided_at,omitempty"`
+
+	// ResumeRunID is the run that continued the paused run once every
+	// approval was decided, Output is its answer
+	ResumeRunID string `gorm:"size:64;index" json:"resume_run_id,omitempty"`
+	Output      string `gorm:"type:text" json:"output,omitempty"`
+}
+
+func (ToolApproval) TableName() string {
+	return "ai_tool_approvals"
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"github.com/google/uuid"
+)
+
+// IntentRule routes the queries matching its keywords or patterns without an
+// LLM analysis of the query
+type IntentRule struct {
+	BaseModel
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index" json:"project_id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	// Intent labels the matched queries, e.g. "order", or "human" to hand
+	// them over to staff
+	Intent string `gorm:"size:64" json:"intent"`
+	// Keywords match the queries containing them, ignoring case
+	Keywords JSONArray `gorm:"type:jsonb" json:"keywords"`
+	// Patterns are regular expressions matched against the queries
+	Patterns JSONArray `gorm:"type:jsonb" json:"patterns"`
+	// Priority orders the rules, highest first. At equal priority the rules
+	// of the project match before the built-in ones.
+	Priority int `gorm:"default:0;index" json:"priority"`
+	// TargetAgentID answers the matched queries. Without it the agents of
+	// the default team run them with TargetWorkflow, and without either the
+	// LLM analysis still selects the agents.
+	TargetAgentID  *uuid.UUID `gorm:"type:uuid" json:"target_agent_id,omitempty"`
+	TargetWorkflow string     `gorm:"size:32" json:"target_workflow,omitempty"`
+	// IsEnabled has no default tag, GORM would omit false from inserts.
+	// Rules are created enabled unless the request says otherwise.
+	IsEnabled bool `gorm:"not null" json:"is_enabled"`
+}
+
+func (IntentRule) TableName() string {
+	return "ai_intent_rules"
+}
@@ -4,6 +4,25 @@ import (
 	"github.com/google/uuid"
 )
 
+// TeamExecutionMode is how the agents of a team work together on a run
+type TeamExecutionMode string
+
+const (
+	TeamModeSupervisor  TeamExecutionMode = "supervisor"
+	TeamModePlanExecute TeamExecutionMode = "plan_execute"
+	TeamModeSequential  TeamExecutionMode = "sequential"
+	TeamModeParallel    TeamExecutionMode = "parallel"
+)
+
+// Valid reports whether m is a known execution mode, empty meaning supervisor
+func (m TeamExecutionMode) Valid() bool {
+	switch m {
+	case "", TeamModeSupervisor, TeamModePlanExecute, TeamModeSequential, TeamModeParallel:
+		return true
+	}
+	return false
+}
+
 type Team struct {
 	BaseModel
 	ProjectID             uuid.UUID  `gorm:"type:uuid;not null;index" json:"project_id"`
@@ -19,6 +38,10 @@ type Team struct {
 	IsDefault             bool       `gorm:"default:false" json:"is_default"`
 	IsEnabled             bool       `gorm:"default:true" json:"is_enabled"`
 	Config                JSONMap    `gorm:"type:jsonb" json:"config,omitempty"`
+	// ExecutionMode is how the agents work together: a supervisor delegating
+	// to them, a plan executed step by step, or all of them in sequence or
+	// in parallel
+	ExecutionMode TeamExecutionMode `gorm:"size:32;default:supervisor" json:"execution_mode"`
 
 	// For runtime use (populated via JOIN/Preload, not stored)
 	SupervisorLLM *LLMProvider `gorm:"-" json:"-"`
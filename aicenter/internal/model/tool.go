@@ -33,6 +33,8 @@ type Tool struct {
 	Endpoint      string        `gorm:"size:500" json:"endpoint,omitempty"`
 	Config        JSONMap       `gorm:"type:jsonb" json:"config,omitempty"`
 	IsEnabled     bool          `gorm:"default:true" json:"is_enabled"`
+	// RequiresApproval pauses the run on each call of the tool until staff approve it
+	RequiresApproval bool `gorm:"default:false" json:"requires_approval"`
 }
 
 func (Tool) TableName() string {
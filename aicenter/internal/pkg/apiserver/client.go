@@ -3,25 +3,42 @@ package apiserver
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// InternalTokenHeader carries the token that signs the requests to the
+// internal routes of the apiserver that read project data
+const InternalTokenHeader = "X-Internal-Token"
+
+// internalTokenTTL is how long a signed internal request stays valid
+const internalTokenTTL = time.Minute
+
 // Client is a client for the apiserver internal API
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL     string
+	internalKey string
+	httpClient  *http.Client
 }
 
-// NewClient creates a new apiserver client
-func NewClient(baseURL string) *Client {
+// NewClient creates a new apiserver client. internalKey is shared with the
+// apiserver and signs the requests that read project data, they are
+// refused when it is empty.
+func NewClient(baseURL, internalKey string) *Client {
 	return &Client{
-		baseURL: baseURL,
+		baseURL:     baseURL,
+		internalKey: internalKey,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -30,8 +47,10 @@ func NewClient(baseURL string) *Client {
 
 // AIServiceEvent represents an event to send to the apiserver
 type AIServiceEvent struct {
-	EventType string                 `json:"event_type"`
-	VisitorID *uuid.UUID             `json:"visitor_id,omitempty"`
+	EventType string     `json:"event_type"`
+	VisitorID *uuid.UUID `json:"visitor_id,omitempty"`
+	// ProjectID identifies the project of the events without a visitor
+	ProjectID *uuid.UUID             `json:"project_id,omitempty"`
 	Payload   map[string]interface{} `json:"payload,omitempty"`
 }
 
@@ -132,6 +151,38 @@ func (c *Client) SendVisitorSentimentUpdate(ctx context.Context, visitorID uuid.
 	return c.SendAIEvent(ctx, event)
 }
 
+// SendToolApprovalRequest asks the staff of the visitor to approve a tool call
+func (c *Client) SendToolApprovalRequest(ctx context.Context, visitorID uuid.UUID, approval map[string]interface{}) (*AIEventResponse, error) {
+	event := &AIServiceEvent{
+		EventType: "tool_approval.request",
+		VisitorID: &visitorID,
+		Payload:   approval,
+	}
+	return c.SendAIEvent(ctx, event)
+}
+
+// SendToolApprovalResolved sends the visitor the answer of a run resumed
+// after its tool calls were decided
+func (c *Client) SendToolApprovalResolved(ctx context.Context, visitorID uuid.UUID, outcome map[string]interface{}) (*AIEventResponse, error) {
+	event := &AIServiceEvent{
+		EventType: "tool_approval.resolved",
+		VisitorID: &visitorID,
+		Payload:   outcome,
+	}
+	return c.SendAIEvent(ctx, event)
+}
+
+// SendBudgetAlert tells the admins of the project that a usage budget
+// reached its alert threshold or its limit
+func (c *Client) SendBudgetAlert(ctx context.Context, projectID uuid.UUID, alert map[string]interface{}) (*AIEventResponse, error) {
+	event := &AIServiceEvent{
+		EventType: "budget.alert",
+		ProjectID: &projectID,
+		Payload:   alert,
+	}
+	return c.SendAIEvent(ctx, event)
+}
+
 // GetVisitorInfo gets visitor information from apiserver
 func (c *Client) GetVisitorInfo(ctx context.Context, projectID, visitorID string) (map[string]interface{}, error) {
 	if c.baseURL == "" {
@@ -170,3 +221,69 @@ func (c *Client) GetVisitorInfo(ctx context.Context, projectID, visitorID string
 
 	return result, nil
 }
+
+// File is a file downloaded from the apiserver
+type File struct {
+	Data     []byte
+	MimeType string
+	Name     string
+}
+
+// DownloadFile downloads a file stored by the apiserver for a project,
+// files larger than maxSize are rejected
+func (c *Client) DownloadFile(ctx context.Context, projectID, fileID uuid.UUID, maxSize int64) (*File, error) {
+	if c.baseURL == "" {
+		return nil, fmt.Errorf("apiserver internal URL not configured")
+	}
+	if c.internalKey == "" {
+		return nil, fmt.Errorf("apiserver internal key not configured")
+	}
+
+	endpoint, err := url.JoinPath(c.baseURL, "v1/internal/files", url.PathEscape(fileID.String()), "download")
+	if err != nil {
+		return nil, fmt.Errorf("build url: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set(InternalTokenHeader, c.internalToken(projectID, req.URL.Path, time.Now().Add(internalTokenTTL)))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("file not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("apiserver returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxSize)
+	}
+
+	file := &File{Data: data, MimeType: resp.Header.Get("Content-Type")}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		file.Name = params["filename"]
+	}
+	return file, nil
+}
+
+// internalToken signs a request to the path of an internal route for a
+// project: "<project_id>.<expires_unix>.<hex HMAC-SHA256>". The apiserver
+// serves the data of the project of the token.
+func (c *Client) internalToken(projectID uuid.UUID, path string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(c.internalKey))
+	mac.Write([]byte(projectID.String() + "\n" + path + "\n" + exp))
+	return projectID.String() + "." + exp + "." + hex.EncodeToString(mac.Sum(nil))
+}
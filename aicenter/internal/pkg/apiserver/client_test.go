@@ -0,0 +1,67 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDownloadFileSignsRequest(t *testing.T) {
+	projectID, fileID := uuid.New(), uuid.New()
+	var gotPath, gotToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotToken = r.URL.Path, r.Header.Get(InternalTokenHeader)
+		if r.URL.RawQuery != "" {
+			t.Errorf("query = %q, the project must come from the token", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "secret")
+	file, err := c.DownloadFile(context.Background(), projectID, fileID, 1024)
+	if err != nil {
+		t.Fatalf("DownloadFile() error = %v", err)
+	}
+	if string(file.Data) != "png" || file.MimeType != "image/png" {
+		t.Errorf("DownloadFile() = %+v", file)
+	}
+	if want := "/v1/internal/files/" + fileID.String() + "/download"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+
+	parts := strings.Split(gotToken, ".")
+	if len(parts) != 3 || parts[0] != projectID.String() {
+		t.Fatalf("token = %q, want it to name project %s", gotToken, projectID)
+	}
+	other := NewClient(server.URL, "other")
+	if gotToken == other.internalToken(projectID, gotPath, parseUnix(t, parts[1])) {
+		t.Error("tokens signed with different keys are equal")
+	}
+	if gotToken != c.internalToken(projectID, gotPath, parseUnix(t, parts[1])) {
+		t.Error("the token does not sign the project, path and expiry")
+	}
+}
+
+func TestDownloadFileRequiresKey(t *testing.T) {
+	c := NewClient("http://apiserver", "")
+	if _, err := c.DownloadFile(context.Background(), uuid.New(), uuid.New(), 1024); err == nil {
+		t.Error("DownloadFile() without an internal key error = nil")
+	}
+}
+
+func parseUnix(t *testing.T, s string) time.Time {
+	t.Helper()
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		t.Fatalf("token expiry %q: %v", s, err)
+	}
+	return time.Unix(sec, 0)
+}
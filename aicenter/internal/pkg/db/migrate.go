@@ -4,6 +4,8 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/tgo/captain/aicenter/internal/eino/memory"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
 	"github.com/tgo/captain/aicenter/internal/model"
 )
 
@@ -16,7 +18,18 @@ func AutoMigrate(db *gorm.DB) error {
 		&model.AgentTool{},
 		&model.AgentCollection{},
 		&model.Tool{},
+		&model.ToolApproval{},
 		&model.ProjectAIConfig{},
+		&model.IntentRule{},
 		&memory.ConversationMessage{}, // 会话记忆持久化
+		&memory.ConversationSummary{}, // 会话滚动摘要
+		&memory.VisitorFact{},         // 访客长期记忆
+		&memory.VisitorExtraction{},   // 访客记忆提取进度
+		&usage.UsageRecord{},          // Token 用量记录
+		&usage.ModelPrice{},           // 模型价格目录
+		&usage.Budget{},               // 项目用量预算
+		&usage.BudgetAlert{},          // 预算告警
+		&runs.Record{},                // 运行历史
+		&runs.Event{},                 // 运行事件时间线
 	)
 }
@@ -145,11 +145,12 @@ func (r *AgentRepository) Update(ctx context.Context, agent *model.Agent) error
 			// Create new tools with fresh IDs
 			for _, tool := range agent.Tools {
 				newTool := model.AgentTool{
-					AgentID:      agent.ID,
-					ToolProvider: tool.ToolProvider,
-					ToolName:     tool.ToolName,
-					IsEnabled:    tool.IsEnabled,
-					Config:       tool.Config,
+					AgentID:          agent.ID,
+					ToolProvider:     tool.ToolProvider,
+					ToolName:         tool.ToolName,
+					IsEnabled:        tool.IsEnabled,
+					Config:           tool.Config,
+					RequiresApproval: tool.RequiresApproval,
 				}
 				if err := tx.Create(&newTool).Error; err != nil {
 					return err
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/model"
+)
+
+type ApprovalRepository struct {
+	db *gorm.DB
+}
+
+func NewApprovalRepository(db *gorm.DB) *ApprovalRepository {
+	return &ApprovalRepository{db: db}
+}
+
+func (r *ApprovalRepository) CreateBatch(ctx context.Context, approvals []*model.ToolApproval) error {
+	if len(approvals) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&approvals).Error
+}
+
+func (r *ApprovalRepository) List(ctx context.Context, projectID uuid.UUID, status string, limit, offset int) ([]model.ToolApproval, int64, error) {
+	var approvals []model.ToolApproval
+	var total int64
+
+	query := r.db.WithContext(ctx).Where("project_id = ?", projectID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Model(&model.ToolApproval{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	if err := query.Order("created_at DESC").Find(&approvals).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return approvals, total, nil
+}
+
+func (r *ApprovalRepository) GetByID(ctx context.Context, projectID, approvalID uuid.UUID) (*model.ToolApproval, error) {
+	var approval model.ToolApproval
+	err := r.db.WithContext(ctx).
+		Where("project_id = ? AND id = ?", projectID, approvalID).
+		First(&approval).Error
+	if err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// ListByRun returns the approvals requested by a run
+func (r *ApprovalRepository) ListByRun(ctx context.Context, projectID uuid.UUID, runID string) ([]model.ToolApproval, error) {
+	var approvals []model.ToolApproval
+	err := r.db.WithContext(ctx).
+		Where("project_id = ? AND run_id = ?", projectID, runID).
+		Order("created_at").
+		Find(&approvals).Error
+	return approvals, err
+}
+
+// Decide records the decision of a pending approval, it reports false when
+// the approval was already decided
+func (r *ApprovalRepository) Decide(ctx context.Context, approval *model.ToolApproval, status model.ApprovalStatus, decidedBy, comment string) (bool, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&model.ToolApproval{}).
+		Where("id = ? AND status = ?", approval.ID, model.ApprovalStatusPending).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"decided_by": decidedBy,
+			"comment":    comment,
+			"decided_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	approval.Status = status
+	approval.DecidedBy = decidedBy
+	approval.Comment = comment
+	approval.DecidedAt = &now
+	return true, nil
+}
+
+// ClaimResume assigns the decided approvals of a run to the run resuming it,
+// once none is pending. It returns the claimed approvals, none when another
+// caller claimed them first or some are still pending.
+func (r *ApprovalRepository) ClaimResume(ctx context.Context, projectID uuid.UUID, runID, resumeRunID string) ([]model.ToolApproval, error) {
+	pending := r.db.Model(&model.ToolApproval{}).
+		Select("1").
+		Where("project_id = ? AND run_id = ? AND status = ?", projectID, runID, model.ApprovalStatusPending)
+	err := r.db.WithContext(ctx).
+		Model(&model.ToolApproval{}).
+		Where("project_id = ? AND run_id = ? AND resume_run_id = ''", projectID, runID).
+		Where("NOT EXISTS (?)", pending).
+		Update("resume_run_id", resumeRunID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var approvals []model.ToolApproval
+	err = r.db.WithContext(ctx).
+		Where("project_id = ? AND resume_run_id = ?", projectID, resumeRunID).
+		Order("created_at").
+		Find(&approvals).Error
+	return approvals, err
+}
+
+// ReleaseResume frees the approvals claimed by a resume that did not answer,
+// so that another resume can claim them
+func (r *ApprovalRepository) ReleaseResume(ctx context.Context, projectID uuid.UUID, resumeRunID string) error {
+	return r.db.WithContext(ctx).
+		Model(&model.ToolApproval{}).
+		Where("project_id = ? AND resume_run_id = ? AND output = ''", projectID, resumeRunID).
+		Update("resume_run_id", "").Error
+}
+
+// SetOutput records the answer of the run that resumed the approvals
+func (r *ApprovalRepository) SetOutput(ctx context.Context, projectID uuid.UUID, resumeRunID, output string) error {
+	return r.db.WithContext(ctx).
+		Model(&model.ToolApproval{}).
+		Where("project_id = ? AND resume_run_id = ?", projectID, resumeRunID).
+		Update("output", output).Error
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/model"
+)
+
+type IntentRuleRepository struct {
+	db *gorm.DB
+}
+
+func NewIntentRuleRepository(db *gorm.DB) *IntentRuleRepository {
+	return &IntentRuleRepository{db: db}
+}
+
+// List returns the intent rules of the project, highest priority first
+func (r *IntentRuleRepository) List(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]model.IntentRule, int64, error) {
+	var rules []model.IntentRule
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&model.IntentRule{}).Where("project_id = ?", projectID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Order("priority DESC, created_at").Find(&rules).Error; err != nil {
+		return nil, 0, err
+	}
+	return rules, total, nil
+}
+
+// ListEnabled returns the enabled intent rules of the project, highest
+// priority first
+func (r *IntentRuleRepository) ListEnabled(ctx context.Context, projectID uuid.UUID) ([]model.IntentRule, error) {
+	var rules []model.IntentRule
+	err := r.db.WithContext(ctx).
+		Where("project_id = ? AND is_enabled = ?", projectID, true).
+		Order("priority DESC, created_at").
+		Find(&rules).Error
+	return rules, err
+}
+
+func (r *IntentRuleRepository) GetByID(ctx context.Context, projectID, ruleID uuid.UUID) (*model.IntentRule, error) {
+	var rule model.IntentRule
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND project_id = ?", ruleID, projectID).
+		First(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *IntentRuleRepository) Create(ctx context.Context, rule *model.IntentRule) error {
+	return r.db.WithContext(ctx).Create(rule).Error
+}
+
+func (r *IntentRuleRepository) Update(ctx context.Context, rule *model.IntentRule) error {
+	return r.db.WithContext(ctx).Save(rule).Error
+}
+
+func (r *IntentRuleRepository) Delete(ctx context.Context, projectID, ruleID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("id = ? AND project_id = ?", ruleID, projectID).
+		Delete(&model.IntentRule{}).Error
+}
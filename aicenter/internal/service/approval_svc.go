@@ -0,0 +1,412 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	einoTool "github.com/cloudwego/eino/components/tool"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+	"github.com/tgo/captain/aicenter/internal/eino/tool"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+	"github.com/tgo/captain/aicenter/internal/model"
+)
+
+// approvalPendingMessage answers the user while tool calls wait for approval
+const approvalPendingMessage = "Your request needs to be confirmed by our staff. We will get back to you shortly."
+
+// approvalReleaseTimeout bounds the release of the approvals of a failed
+// resume, it survives the request context
+const approvalReleaseTimeout = 5 * time.Second
+
+var (
+	// ErrApprovalDecided is returned when deciding an approval that was already decided
+	ErrApprovalDecided = errors.New("approval already decided")
+	// ErrApprovalNotResumable is returned when resuming the run of an approval
+	// that is pending, waits for other approvals or is being resumed
+	ErrApprovalNotResumable = errors.New("approval run is not resumable")
+)
+
+// ApprovalOutcome is the result of deciding an approval
+type ApprovalOutcome struct {
+	Approval *model.ToolApproval `json:"approval"`
+	// ResumeRunID is the run resuming the paused run in the background, its
+	// status is read from the runs API. Empty while other approvals of the
+	// run are pending.
+	ResumeRunID string `json:"resume_run_id,omitempty"`
+}
+
+// approvalTools returns the names of the tools whose calls require approval:
+// the flagged tools of the project, and per agent its flagged agent tools
+func (s *RuntimeService) approvalTools(ctx context.Context, projectID uuid.UUID, agentIDs []uuid.UUID) (map[string]bool, map[uuid.UUID]map[string]bool) {
+	project := make(map[string]bool)
+	var tools []model.Tool
+	s.db.WithContext(ctx).
+		Where("project_id = ? AND is_enabled = ? AND requires_approval = ?", projectID, true, true).
+		Find(&tools)
+	for _, t := range tools {
+		project[t.Name] = true
+	}
+
+	agents := make(map[uuid.UUID]map[string]bool)
+	if len(agentIDs) == 0 {
+		return project, agents
+	}
+	var agentTools []model.AgentTool
+	s.db.WithContext(ctx).
+		Where("agent_id IN ? AND is_enabled = ? AND requires_approval = ?", agentIDs, true, true).
+		Find(&agentTools)
+	for _, t := range agentTools {
+		if agents[t.AgentID] == nil {
+			agents[t.AgentID] = make(map[string]bool)
+		}
+		agents[t.AgentID][t.ToolName] = true
+	}
+	return project, agents
+}
+
+// withApprovals wraps the tools whose calls require approval, the run pauses
+// on their calls until staff decide them. Only team runs are checkpointed and
+// can pause, the other runs use withRefusedApprovals.
+func withApprovals(ctx context.Context, tools []einoTool.BaseTool, names ...map[string]bool) []einoTool.BaseTool {
+	return wrapApprovalTools(ctx, tools, tool.RequireApproval, names)
+}
+
+// withRefusedApprovals wraps the tools whose calls require approval for runs
+// that cannot pause: their calls are refused rather than run unapproved
+func withRefusedApprovals(ctx context.Context, tools []einoTool.BaseTool, names ...map[string]bool) []einoTool.BaseTool {
+	return wrapApprovalTools(ctx, tools, tool.RefuseUnapproved, names)
+}
+
+// wrapApprovalTools wraps the tools named in one of the sets
+func wrapApprovalTools(ctx context.Context, tools []einoTool.BaseTool, wrap func(einoTool.BaseTool) einoTool.BaseTool, names []map[string]bool) []einoTool.BaseTool {
+	for i, t := range tools {
+		if t == nil {
+			continue
+		}
+		info, err := t.Info(ctx)
+		if err != nil {
+			continue
+		}
+		for _, set := range names {
+			if set[info.Name] {
+				tools[i] = wrap(t)
+				break
+			}
+		}
+	}
+	return tools
+}
+
+// refuseAgentApprovals applies withRefusedApprovals to the tools of an agent
+func (s *RuntimeService) refuseAgentApprovals(ctx context.Context, projectID, agentID uuid.UUID, tools []einoTool.BaseTool) []einoTool.BaseTool {
+	if len(tools) == 0 {
+		return tools
+	}
+	projectApprovals, agentApprovals := s.approvalTools(ctx, projectID, []uuid.UUID{agentID})
+	return withRefusedApprovals(ctx, tools, projectApprovals, agentApprovals[agentID])
+}
+
+// approvalBase returns the run fields of an approval, for the approvals of
+// the same run
+func approvalBase(approval model.ToolApproval) model.ToolApproval {
+	return model.ToolApproval{
+		ProjectID:    approval.ProjectID,
+		RunID:        approval.RunID,
+		TeamID:       approval.TeamID,
+		SessionID:    approval.SessionID,
+		VisitorID:    approval.VisitorID,
+		EnableMemory: approval.EnableMemory,
+		Params:       approval.Params,
+	}
+}
+
+// requestApprovals records an approval for each tool call the run paused on
+// and asks the staff of the visitor to decide them. base holds the run the
+// approvals belong to.
+func (s *RuntimeService) requestApprovals(ctx context.Context, base model.ToolApproval, interrupts []supervisor.Interrupt) ([]*model.ToolApproval, error) {
+	approvals := make([]*model.ToolApproval, 0, len(interrupts))
+	for _, interrupt := range interrupts {
+		request, ok := interrupt.Info.(*tool.ApprovalRequest)
+		if !ok {
+			return nil, fmt.Errorf("run %s interrupted by %s: %v", base.RunID, interrupt.AgentName, interrupt.Info)
+		}
+		approval := base
+		approval.InterruptID = interrupt.ID
+		approval.AgentName = interrupt.AgentName
+		approval.ToolName = request.ToolName
+		approval.ToolCallID = request.ToolCallID
+		approval.Arguments = request.Arguments
+		approval.Status = model.ApprovalStatusPending
+		approvals = append(approvals, &approval)
+	}
+	if err := s.approvals.CreateBatch(ctx, approvals); err != nil {
+		return nil, fmt.Errorf("record approvals: %w", err)
+	}
+
+	for _, approval := range approvals {
+		log.Printf("[Approval] Run %s waits for approval %s of %s", approval.RunID, approval.ID, approval.ToolName)
+		if approval.VisitorID == nil || s.apiserverClient == nil {
+			continue
+		}
+		if _, err := s.apiserverClient.SendToolApprovalRequest(ctx, *approval.VisitorID, map[string]interface{}{
+			"approval_id": approval.ID.String(),
+			"run_id":      approval.RunID,
+			"agent_name":  approval.AgentName,
+			"tool_name":   approval.ToolName,
+			"arguments":   approval.Arguments,
+		}); err != nil {
+			log.Printf("[Approval] Failed to notify staff of approval %s: %v", approval.ID, err)
+		}
+	}
+	return approvals, nil
+}
+
+// approvalEvent reports the approvals a streamed run paused on
+func approvalEvent(approvals []*model.ToolApproval) *supervisor.Event {
+	data := make([]map[string]interface{}, 0, len(approvals))
+	agentName := ""
+	for _, approval := range approvals {
+		agentName = approval.AgentName
+		data = append(data, map[string]interface{}{
+			"approval_id": approval.ID.String(),
+			"tool_name":   approval.ToolName,
+			"arguments":   approval.Arguments,
+		})
+	}
+	event := streaming.NewApprovalRequiredEvent(agentName, approvalPendingMessage, data)
+	return &supervisor.Event{Tool: &event}
+}
+
+// ListApprovals returns the tool approvals of the project, optionally only
+// those with the given status
+func (s *RuntimeService) ListApprovals(ctx context.Context, projectID uuid.UUID, status string, limit, offset int) ([]model.ToolApproval, int64, error) {
+	return s.approvals.List(ctx, projectID, status, limit, offset)
+}
+
+// GetApproval returns a tool approval of the project
+func (s *RuntimeService) GetApproval(ctx context.Context, projectID, approvalID uuid.UUID) (*model.ToolApproval, error) {
+	return s.approvals.GetByID(ctx, projectID, approvalID)
+}
+
+// DecideApproval approves or rejects a paused tool call. Once every approval
+// of its run is decided, the run is resumed in the background: approved calls
+// are executed, rejected ones are reported to the agent, and the answer is
+// sent to the visitor.
+func (s *RuntimeService) DecideApproval(ctx context.Context, projectID, approvalID uuid.UUID, approved bool, decidedBy, comment string) (*ApprovalOutcome, error) {
+	approval, err := s.approvals.GetByID(ctx, projectID, approvalID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := model.ApprovalStatusRejected
+	if approved {
+		status = model.ApprovalStatusApproved
+	}
+	decided, err := s.approvals.Decide(ctx, approval, status, decidedBy, comment)
+	if err != nil {
+		return nil, err
+	}
+	if !decided {
+		return nil, ErrApprovalDecided
+	}
+	log.Printf("[Approval] Approval %s of run %s %s by %s", approval.ID, approval.RunID, status, decidedBy)
+
+	return s.resumeDecided(ctx, projectID, approval)
+}
+
+// ResumeApproval resumes the run of a decided approval whose resume stopped
+// without an answer: it failed, or the replica running it went away. Resumes
+// in progress or already answered are left alone.
+func (s *RuntimeService) ResumeApproval(ctx context.Context, projectID, approvalID uuid.UUID) (*ApprovalOutcome, error) {
+	approval, err := s.approvals.GetByID(ctx, projectID, approvalID)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status == model.ApprovalStatusPending {
+		return nil, ErrApprovalNotResumable
+	}
+
+	if approval.ResumeRunID != "" {
+		if !s.resumeAbandoned(ctx, projectID, approval) {
+			return nil, ErrApprovalNotResumable
+		}
+		if err := s.approvals.ReleaseResume(ctx, projectID, approval.ResumeRunID); err != nil {
+			return nil, fmt.Errorf("release resume of run %s: %w", approval.RunID, err)
+		}
+		log.Printf("[Approval] Released abandoned resume %s of run %s", approval.ResumeRunID, approval.RunID)
+		approval.ResumeRunID = ""
+	}
+
+	outcome, err := s.resumeDecided(ctx, projectID, approval)
+	if err != nil {
+		return nil, err
+	}
+	if outcome.ResumeRunID == "" {
+		return nil, ErrApprovalNotResumable
+	}
+	return outcome, nil
+}
+
+// resumeDecided claims the run of a decided approval once every approval of
+// the run is decided, and resumes it in the background so that the decision
+// does not wait for the agent. The claim on the approvals is released when
+// the resume fails, so that it can be retried with ResumeApproval.
+func (s *RuntimeService) resumeDecided(ctx context.Context, projectID uuid.UUID, approval *model.ToolApproval) (*ApprovalOutcome, error) {
+	resumeRunID := uuid.New().String()
+	claimed, err := s.approvals.ClaimResume(ctx, projectID, approval.RunID, resumeRunID)
+	if err != nil {
+		return nil, err
+	}
+	if len(claimed) == 0 {
+		return &ApprovalOutcome{Approval: approval}, nil
+	}
+
+	runCtx := context.WithoutCancel(ctx)
+	go func() {
+		if _, err := s.resumeRun(runCtx, projectID, resumeRunID, claimed); err != nil {
+			log.Printf("[Approval] Failed to resume run %s: %v", approval.RunID, err)
+			releaseCtx, cancel := context.WithTimeout(runCtx, approvalReleaseTimeout)
+			defer cancel()
+			if releaseErr := s.approvals.ReleaseResume(releaseCtx, projectID, resumeRunID); releaseErr != nil {
+				log.Printf("[Approval] Failed to release resume %s of run %s: %v", resumeRunID, approval.RunID, releaseErr)
+			}
+		}
+	}()
+	approval.ResumeRunID = resumeRunID
+	return &ApprovalOutcome{Approval: approval, ResumeRunID: resumeRunID}, nil
+}
+
+// resumeAbandoned reports whether the resume of a run stopped without an
+// answer. Resumes still running on a replica, or that paused again on new
+// approvals, are not abandoned.
+func (s *RuntimeService) resumeAbandoned(ctx context.Context, projectID uuid.UUID, approval *model.ToolApproval) bool {
+	if approval.Output != "" {
+		return false
+	}
+	if run, err := s.runs.Get(ctx, projectID, approval.ResumeRunID); err == nil {
+		return run.Status == runs.StatusFailed || run.Status == runs.StatusCancelled
+	}
+	// The registry forgot the run, its history tells whether it completed. A
+	// run recorded as still running lost its replica.
+	if s.history != nil {
+		if record, err := s.history.Get(ctx, projectID, approval.ResumeRunID); err == nil {
+			return record.Status != runs.StatusCompleted
+		}
+	}
+	return true
+}
+
+// resumeRun continues the run the decided approvals paused, in the team it
+// was interrupted in
+func (s *RuntimeService) resumeRun(ctx context.Context, projectID uuid.UUID, resumeRunID string, approvals []model.ToolApproval) (_ *RunResponse, err error) {
+	first := approvals[0]
+	checkPointID := first.RunID
+
+	var team *model.Team
+	if first.TeamID != nil {
+		team, err = s.teamRepo.GetWithAgents(ctx, projectID, *first.TeamID)
+	} else {
+		team, err = s.teamRepo.GetDefault(ctx, projectID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var params *llm.GenerationParams
+	if len(first.Params) > 0 {
+		if params, err = llm.ParseGenerationParams(first.Params); err != nil {
+			return nil, fmt.Errorf("parse params: %w", err)
+		}
+	}
+
+	ctx, rec, finish := s.startRun(ctx, &runs.Record{
+		ID:        resumeRunID,
+		ProjectID: projectID,
+		Kind:      runs.KindResume,
+		SessionID: first.SessionID,
+		VisitorID: first.VisitorID,
+		Params:    paramsSnapshot(params),
+		ResumeOf:  &checkPointID,
+	})
+	defer func() {
+		err = runError(ctx, err)
+		finish(ctx, err)
+	}()
+	rec.SetTeam(&team.ID, teamAgentIDs(team))
+
+	ctx = teamUsageScope(ctx, projectID, team, first.SessionID, rec.ID())
+	ctx, counter := usage.WithCounter(ctx)
+
+	teamCfg := s.buildTeamConfigWithVisitor(ctx, projectID, team, s.mcpURL, s.ragURL, first.VisitorID, params)
+	rec.SetConfig("team", teamCfg.Snapshot(ctx))
+
+	targets := make(map[string]any, len(approvals))
+	for _, approval := range approvals {
+		targets[approval.InterruptID] = &tool.ApprovalDecision{
+			Approved: approval.Status == model.ApprovalStatusApproved,
+			Comment:  approval.Comment,
+		}
+	}
+	result, err := s.runner.Resume(ctx, teamCfg, checkPointID, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &RunResponse{
+		Content:  result.Content,
+		RunID:    rec.ID(),
+		Provider: result.Provider,
+		Model:    result.Model,
+		Usage:    counter.Usage(),
+	}
+
+	// The resumed run paused again, it stays checkpointed under its first ID
+	if len(result.Interrupts) > 0 {
+		if resp.Approvals, err = s.requestApprovals(ctx, approvalBase(first), result.Interrupts); err != nil {
+			return nil, err
+		}
+		resp.Content = approvalPendingMessage
+		rec.SetOutput(resp.Content, result.Provider, result.Model)
+		return resp, nil
+	}
+
+	rec.SetOutput(result.Content, result.Provider, result.Model)
+	if err := s.approvals.SetOutput(ctx, projectID, resumeRunID, result.Content); err != nil {
+		log.Printf("[Approval] Failed to record output of run %s: %v", resumeRunID, err)
+	}
+	if err := s.runner.CheckPoints().Delete(ctx, checkPointID); err != nil {
+		log.Printf("[Approval] Failed to delete checkpoint of run %s: %v", checkPointID, err)
+	}
+
+	if first.EnableMemory && first.SessionID != "" && result.Content != "" {
+		memMgr := s.GetMemoryManager(projectID, true)
+		_ = memMgr.AddAssistantMessage(ctx, first.SessionID, result.Content)
+		s.scheduleVisitorExtraction(projectID, first.VisitorID, first.SessionID)
+	}
+	if first.VisitorID != nil && s.apiserverClient != nil && result.Content != "" {
+		decisions := make([]map[string]interface{}, 0, len(approvals))
+		for _, approval := range approvals {
+			decisions = append(decisions, map[string]interface{}{
+				"approval_id": approval.ID.String(),
+				"tool_name":   approval.ToolName,
+				"status":      string(approval.Status),
+			})
+		}
+		if _, err := s.apiserverClient.SendToolApprovalResolved(ctx, *first.VisitorID, map[string]interface{}{
+			"run_id":    checkPointID,
+			"approvals": decisions,
+			"content":   result.Content,
+		}); err != nil {
+			log.Printf("[Approval] Failed to send the answer of run %s: %v", resumeRunID, err)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	einoTool "github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+type namedTool struct {
+	name  string
+	calls int
+}
+
+func (t *namedTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name}, nil
+}
+
+func (t *namedTool) InvokableRun(context.Context, string, ...einoTool.Option) (string, error) {
+	t.calls++
+	return "executed", nil
+}
+
+func TestWithRefusedApprovals(t *testing.T) {
+	refund, lookup, cancel := &namedTool{name: "refund"}, &namedTool{name: "lookup"}, &namedTool{name: "cancel_order"}
+	tools := withRefusedApprovals(context.Background(),
+		[]einoTool.BaseTool{refund, lookup, nil, cancel},
+		map[string]bool{"refund": true}, map[string]bool{"cancel_order": true})
+
+	for i, inner := range []*namedTool{refund, lookup, nil, cancel} {
+		if inner == nil {
+			if tools[i] != nil {
+				t.Errorf("tool %d = %v, want nil kept", i, tools[i])
+			}
+			continue
+		}
+		if _, err := tools[i].(einoTool.InvokableTool).InvokableRun(context.Background(), "{}"); err != nil {
+			t.Fatalf("%s: InvokableRun() error = %v", inner.name, err)
+		}
+	}
+	if refund.calls != 0 || cancel.calls != 0 {
+		t.Errorf("tools requiring approval were called: refund %d, cancel_order %d", refund.calls, cancel.calls)
+	}
+	if lookup.calls != 1 {
+		t.Errorf("lookup was called %d times, want 1", lookup.calls)
+	}
+}
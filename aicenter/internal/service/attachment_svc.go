@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+)
+
+// AttachmentTypeImage is the type of image attachments, the only type
+// supported
+const AttachmentTypeImage = "image"
+
+// MaxAttachments bounds the attachments of a run request
+const MaxAttachments = 10
+
+// maxAttachmentSize bounds the files downloaded from the apiserver and
+// the files sent inline as data URLs
+const maxAttachmentSize = 20 << 20
+
+// Attachment is a file the visitor sent with the message of a run, given by
+// URL or by the ID of a file stored by the apiserver
+type Attachment struct {
+	// Type is the kind of file, "image" when empty
+	Type string `json:"type,omitempty"`
+	// URL is a public http(s) or base64 data URL of the file
+	URL string `json:"url,omitempty"`
+	// FileID is the ID of a file stored by the apiserver for the project
+	FileID string `json:"file_id,omitempty"`
+	// MimeType is the media type of the file, e.g. "image/png"
+	MimeType string `json:"mime_type,omitempty"`
+	// Name is the file name shown to the model
+	Name string `json:"name,omitempty"`
+}
+
+// ValidateAttachments checks the attachments of a run request and defaults
+// their type
+func ValidateAttachments(attachments []Attachment) error {
+	if len(attachments) > MaxAttachments {
+		return fmt.Errorf("at most %d attachments are allowed", MaxAttachments)
+	}
+	for i := range attachments {
+		a := &attachments[i]
+		if a.Type == "" {
+			a.Type = AttachmentTypeImage
+		}
+		if a.Type != AttachmentTypeImage {
+			return fmt.Errorf("attachments[%d]: unsupported type %q, only %q is supported", i, a.Type, AttachmentTypeImage)
+		}
+		if (a.URL == "") == (a.FileID == "") {
+			return fmt.Errorf("attachments[%d]: exactly one of url and file_id is required", i)
+		}
+		if a.FileID != "" {
+			fileID, err := uuid.Parse(a.FileID)
+			if err != nil {
+				return fmt.Errorf("attachments[%d]: file_id must be a UUID", i)
+			}
+			a.FileID = fileID.String()
+		}
+		if a.URL != "" {
+			if _, data, ok := llm.ParseDataURL(a.URL); ok {
+				if base64.StdEncoding.DecodedLen(len(data)) > maxAttachmentSize {
+					return fmt.Errorf("attachments[%d]: inline files are limited to %d bytes", i, maxAttachmentSize)
+				}
+				continue
+			}
+			// Images given by URL may be downloaded by aicenter, see
+			// llm.ValidatePublicURL
+			if err := llm.ValidatePublicURL(a.URL); err != nil {
+				return fmt.Errorf("attachments[%d]: url must be a public http(s) or base64 data URL: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// inputText is the text of the message of a run, with its attachments
+// described. It is what the session memory and the run history keep.
+func inputText(req *RunRequest) string {
+	return AttachmentsText(req.Message, req.Attachments)
+}
+
+// AttachmentsText returns a message followed by the description of its
+// attachments, for the places where only text is kept
+func AttachmentsText(message string, attachments []Attachment) string {
+	if len(attachments) == 0 {
+		return message
+	}
+	parts := make([]string, 0, len(attachments)+1)
+	if message != "" {
+		parts = append(parts, message)
+	}
+	for _, a := range attachments {
+		parts = append(parts, describeAttachment(a))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// describeAttachment describes an attachment as text
+func describeAttachment(a Attachment) string {
+	var b strings.Builder
+	b.WriteString("[Attachment: ")
+	b.WriteString(a.Type)
+	if a.Name != "" {
+		fmt.Fprintf(&b, " %q", a.Name)
+	}
+	if a.MimeType != "" {
+		fmt.Fprintf(&b, " (%s)", a.MimeType)
+	}
+	switch {
+	case a.FileID != "":
+		fmt.Fprintf(&b, ", file %s", a.FileID)
+	case strings.HasPrefix(a.URL, "data:"):
+		b.WriteString(", sent inline")
+	default:
+		fmt.Fprintf(&b, " at %s", a.URL)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// userMessage builds the user message of a run. Models that accept images
+// receive the attachments as image parts; the others receive their
+// description, with a note that they cannot be viewed.
+func (s *RuntimeService) userMessage(ctx context.Context, projectID uuid.UUID, req *RunRequest, vision bool) *schema.Message {
+	if len(req.Attachments) == 0 {
+		return schema.UserMessage(req.Message)
+	}
+	if !vision {
+		return schema.UserMessage(textOnlyInput(req))
+	}
+
+	var parts []schema.MessageInputPart
+	if req.Message != "" {
+		parts = append(parts, schema.MessageInputPart{Type: schema.ChatMessagePartTypeText, Text: req.Message})
+	}
+	for _, a := range req.Attachments {
+		url, mimeType, err := s.attachmentURL(ctx, projectID, a)
+		if err != nil {
+			log.Printf("[Attachments] Failed to load attachment %s of run %s: %v", a.FileID, runID(ctx), err)
+			parts = append(parts, schema.MessageInputPart{
+				Type: schema.ChatMessagePartTypeText,
+				Text: describeAttachment(a) + " The file could not be loaded, ask the visitor to send it again if it is needed.",
+			})
+			continue
+		}
+		parts = append(parts, schema.MessageInputPart{
+			Type: schema.ChatMessagePartTypeImageURL,
+			Image: &schema.MessageInputImage{
+				MessagePartCommon: schema.MessagePartCommon{URL: &url, MIMEType: mimeType},
+				Detail:            schema.ImageURLDetailAuto,
+			},
+		})
+	}
+	return &schema.Message{Role: schema.User, UserInputMultiContent: parts}
+}
+
+// textOnlyInput is the message of a run for models that cannot view images
+func textOnlyInput(req *RunRequest) string {
+	return inputText(req) + "\n(The attached images cannot be viewed by this assistant. " +
+		"If their content matters, ask the visitor to describe it.)"
+}
+
+// attachmentURL returns the URL an attachment is sent to the model with:
+// files stored by the apiserver are inlined as base64 data URLs
+func (s *RuntimeService) attachmentURL(ctx context.Context, projectID uuid.UUID, a Attachment) (string, string, error) {
+	if a.FileID == "" {
+		mimeType := a.MimeType
+		if dataType, _, ok := llm.ParseDataURL(a.URL); ok && dataType != "" {
+			mimeType = dataType
+		}
+		return a.URL, mimeType, nil
+	}
+	if s.apiserverClient == nil {
+		return "", "", fmt.Errorf("apiserver client not configured")
+	}
+	fileID, err := uuid.Parse(a.FileID)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid file ID: %w", err)
+	}
+	file, err := s.apiserverClient.DownloadFile(ctx, projectID, fileID, maxAttachmentSize)
+	if err != nil {
+		return "", "", err
+	}
+	mimeType := a.MimeType
+	if mimeType == "" {
+		mimeType, _, _ = mime.ParseMediaType(file.MimeType)
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", "", fmt.Errorf("file is not an image: %q", mimeType)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(file.Data), mimeType, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAttachments(t *testing.T) {
+	const fileID = "5f0c7a4e-2b1d-4c3e-9a8f-6d7e8f9a0b1c"
+	oversized := "data:image/png;base64," + strings.Repeat("A", maxAttachmentSize/3*4+8)
+	tests := []struct {
+		name        string
+		attachments []Attachment
+		wantErr     bool
+	}{
+		{name: "none"},
+		{name: "public url", attachments: []Attachment{{URL: "https://cdn.example.com/cat.png"}}},
+		{name: "data url", attachments: []Attachment{{URL: "data:image/png;base64,iVBORw0KGgo="}}},
+		{name: "oversized data url", attachments: []Attachment{{URL: oversized}}, wantErr: true},
+		{name: "file id", attachments: []Attachment{{FileID: fileID}}},
+		{name: "file id not a UUID", attachments: []Attachment{{FileID: "file-1"}}, wantErr: true},
+		{name: "file id with a path", attachments: []Attachment{{FileID: "../../admin?project_id=x"}}, wantErr: true},
+		{name: "url and file id", attachments: []Attachment{{URL: "https://cdn.example.com/cat.png", FileID: fileID}}, wantErr: true},
+		{name: "neither url nor file id", attachments: []Attachment{{Name: "cat.png"}}, wantErr: true},
+		{name: "unsupported type", attachments: []Attachment{{Type: "video", FileID: fileID}}, wantErr: true},
+		{name: "unsupported scheme", attachments: []Attachment{{URL: "file:///etc/passwd"}}, wantErr: true},
+		{name: "loopback url", attachments: []Attachment{{URL: "http://127.0.0.1:8080/admin"}}, wantErr: true},
+		{name: "localhost url", attachments: []Attachment{{URL: "http://localhost/admin"}}, wantErr: true},
+		{name: "metadata url", attachments: []Attachment{{URL: "http://169.254.169.254/latest/meta-data/"}}, wantErr: true},
+		{name: "private url", attachments: []Attachment{{URL: "http://10.0.0.5/internal.png"}}, wantErr: true},
+		{name: "too many", attachments: make([]Attachment, MaxAttachments+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAttachments(tt.attachments)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAttachments() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	attachments := []Attachment{{FileID: strings.ToUpper(fileID)}}
+	if err := ValidateAttachments(attachments); err != nil {
+		t.Fatalf("ValidateAttachments() error = %v", err)
+	}
+	if attachments[0].Type != AttachmentTypeImage {
+		t.Errorf("Type = %q, want the %q default", attachments[0].Type, AttachmentTypeImage)
+	}
+	if attachments[0].FileID != fileID {
+		t.Errorf("FileID = %q, want the canonical %q", attachments[0].FileID, fileID)
+	}
+}
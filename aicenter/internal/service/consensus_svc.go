@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/agent"
+	"github.com/tgo/captain/aicenter/internal/eino/memory"
+	"github.com/tgo/captain/aicenter/internal/eino/orchestration"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+	"github.com/tgo/captain/aicenter/internal/model"
+)
+
+// consensusEscalatedMessage answers the user while staff check an answer the
+// agents disagreed on
+const consensusEscalatedMessage = "We want to make sure you get an accurate answer. A member of our staff will confirm it and get back to you shortly."
+
+// minConsensusAgents is the number of enabled agents a consensus needs
+const minConsensusAgents = 2
+
+// Status of the consensus of a run
+const (
+	// ConsensusReached means the answers of the agents agree
+	ConsensusReached = "reached"
+	// ConsensusConflict means the answers differ in opinions or wording, or
+	// in facts when the run could not be handed over to staff. The content
+	// reconciles them.
+	ConsensusConflict = "conflict"
+	// ConsensusEscalated means the agents disagree on facts, the run was
+	// handed over to staff instead of answering
+	ConsensusEscalated = "escalated"
+)
+
+// ConsensusInfo reports how the agents of a run requiring consensus agreed
+type ConsensusInfo struct {
+	Status   string                     `json:"status"`
+	Conflict orchestration.ConflictInfo `json:"conflict"`
+	// Answers are the answers of each agent, failed ones included
+	Answers []AgentAnswer `json:"answers"`
+	// Escalated is set once the visitor was handed over to staff
+	Escalated bool `json:"escalated"`
+}
+
+// AgentAnswer is the answer of one agent of a run requiring consensus
+type AgentAnswer struct {
+	AgentID   string `json:"agent_id"`
+	AgentName string `json:"agent_name"`
+	Content   string `json:"content,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RunWithConsensus asks every agent of the request, or else of its team, the
+// same message and checks their answers for conflicts. The answers are
+// reconciled into one, unless the agents disagree on facts: the visitor is
+// then handed over to staff, e.g. rather than quoting one of two prices.
+func (s *RuntimeService) RunWithConsensus(ctx context.Context, projectID uuid.UUID, req *RunRequest) (*RunResponse, error) {
+	resp, _, err := s.runConsensus(ctx, projectID, req)
+	return resp, err
+}
+
+// streamConsensus runs RunWithConsensus for a streamed request, emitting the
+// consensus and the answer once the agents all answered
+func (s *RuntimeService) streamConsensus(ctx context.Context, projectID uuid.UUID, req *RunRequest, callback supervisor.StreamCallback) error {
+	resp, teamName, err := s.runConsensus(ctx, projectID, req)
+	if err != nil {
+		return err
+	}
+
+	consensus := streaming.NewConsensusEvent(teamName, resp.Consensus.Status, resp.Consensus)
+	if err := callback(&supervisor.Event{Tool: &consensus}); err != nil {
+		return err
+	}
+	answer := streaming.NewMessageEvent(teamName, resp.Content)
+	answer.Role = string(schema.Assistant)
+	if err := callback(&supervisor.Event{Tool: &answer}); err != nil {
+		return err
+	}
+	if resp.Data != nil {
+		output := streaming.NewOutputEvent(teamName, resp.Data)
+		return callback(&supervisor.Event{Tool: &output})
+	}
+	return nil
+}
+
+// runConsensus runs a request requiring consensus, it returns the name of
+// the team answering
+func (s *RuntimeService) runConsensus(ctx context.Context, projectID uuid.UUID, req *RunRequest) (_ *RunResponse, _ string, err error) {
+	if err := s.checkBudget(ctx, projectID); err != nil {
+		return nil, "", err
+	}
+
+	var team *model.Team
+	if req.TeamID != nil {
+		teamID, parseErr := uuid.Parse(*req.TeamID)
+		if parseErr != nil {
+			return nil, "", parseErr
+		}
+		team, err = s.teamRepo.GetWithAgents(ctx, projectID, teamID)
+	} else {
+		team, err = s.teamRepo.GetDefault(ctx, projectID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	agents, err := s.consensusAgents(ctx, projectID, team, req.AgentIDs)
+	if err != nil {
+		return nil, "", err
+	}
+	out, err := outputSchema(req, team.Config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var memMgr *memory.Manager
+	var history []*schema.Message
+	sessionID := uuid.New().String()
+	if req.SessionID != nil && *req.SessionID != "" {
+		sessionID = *req.SessionID
+	}
+
+	agentIDs := make([]string, 0, len(agents))
+	for _, a := range agents {
+		agentIDs = append(agentIDs, a.ID.String())
+	}
+	ctx, rec, finish := s.startRun(ctx, &runs.Record{
+		ID:        req.RunID,
+		ProjectID: projectID,
+		Kind:      runs.KindConsensus,
+		SessionID: sessionID,
+		VisitorID: req.VisitorID,
+		Input:     inputText(req),
+		Params:    paramsSnapshot(req.Params),
+	})
+	defer func() {
+		err = runError(ctx, err)
+		finish(ctx, err)
+	}()
+	rec.SetTeam(&team.ID, agentIDs)
+
+	ctx = teamUsageScope(ctx, projectID, team, sessionID, rec.ID())
+	ctx, counter := usage.WithCounter(ctx)
+
+	configs := make([]*agent.AgentConfig, 0, len(agents))
+	vision := true
+	for _, a := range agents {
+		agentCfg, err := s.buildAgentConfig(ctx, projectID, a.ID, req.Params)
+		if err != nil {
+			return nil, "", fmt.Errorf("build agent config of %s: %w", a.Name, err)
+		}
+		vision = vision && agentCfg.Provider.SupportsVision()
+		configs = append(configs, agentCfg)
+	}
+	facts := s.visitorFactsInstruction(ctx, projectID, req.VisitorID, inputText(req))
+	for _, agentCfg := range configs {
+		agentCfg.Instruction += facts
+	}
+
+	if req.EnableMemory {
+		// The history is windowed to fit every agent
+		memMgr = s.windowedMemoryManager(ctx, projectID, configs...)
+		history, _ = memMgr.GetWindowedHistory(ctx, sessionID)
+		_ = memMgr.AddUserMessage(ctx, sessionID, inputText(req))
+	}
+	if req.History != nil {
+		history = req.History
+	}
+	if replay := runs.ReplayFromContext(ctx); replay != nil {
+		history = replay.History
+	}
+	rec.SetHistory(history)
+	history = withInstruction(history, outputInstruction(req.Instruction, out))
+
+	messages := append(append([]*schema.Message{}, history...), s.userMessage(ctx, projectID, req, vision))
+
+	// Every agent answers the same messages
+	answers := make([]AgentAnswer, len(agents))
+	results := make([]orchestration.AgentResult, len(agents))
+	var wg sync.WaitGroup
+	for i := range agents {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			answers[i] = AgentAnswer{AgentID: agents[i].ID.String(), AgentName: agents[i].Name}
+			results[i] = orchestration.AgentResult{AgentID: answers[i].AgentID}
+			content, err := s.runAgentConfig(ctx, configs[i], messages)
+			if err != nil {
+				log.Printf("[Consensus] Agent %s failed in run %s: %v", agents[i].Name, rec.ID(), err)
+				answers[i].Error = err.Error()
+				results[i].Error = err
+				return
+			}
+			answers[i].Content = content
+			results[i].Content = content
+		}(i)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, "", context.Cause(ctx)
+	}
+
+	providerCfg, err := s.getDefaultProviderConfig(ctx, projectID)
+	if err != nil {
+		return nil, "", fmt.Errorf("get provider config: %w", err)
+	}
+	providerCfg = providerCfg.WithParams(req.Params)
+	chatModel, err := s.llmFactory.CreateChatModel(ctx, providerCfg)
+	if err != nil {
+		return nil, "", fmt.Errorf("create chat model: %w", err)
+	}
+
+	execResult := &orchestration.ExecutionResult{Workflow: orchestration.WorkflowParallel, Results: results, IsSuccess: true}
+	failed := 0
+	for _, r := range results {
+		if r.Error != nil {
+			execResult.IsSuccess = false
+			failed++
+		}
+	}
+	if failed == len(results) {
+		return nil, "", fmt.Errorf("all %d agents failed: %s", len(answers), answers[0].Error)
+	}
+	consolidated, err := orchestration.NewResultConsolidator(chatModel).ConsolidateWithConflictDetection(ctx, execResult, inputText(req))
+	if err != nil {
+		return nil, "", err
+	}
+
+	info := &ConsensusInfo{Status: ConsensusReached, Conflict: consolidated.Conflict, Answers: answers}
+	content := consolidated.Content
+	var data json.RawMessage
+	// The visitor is only told staff will answer once they were handed over,
+	// factual conflicts that could not be escalated get the reconciled answer
+	info.Escalated = consolidated.Conflict.Factual() && s.escalateConflict(ctx, req.VisitorID, consolidated.Conflict)
+	switch {
+	case info.Escalated:
+		info.Status = ConsensusEscalated
+		content = consensusEscalatedMessage
+	case consolidated.Conflict.Detected:
+		info.Status = ConsensusConflict
+	}
+	if info.Status != ConsensusEscalated {
+		content, data, err = s.structureOutput(ctx, providerCfg, out, content)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	log.Printf("[Consensus] Run %s: %s, %d/%d agents answered", rec.ID(), info.Status, consolidated.SuccessCount, len(answers))
+	rec.SetConfig("consensus", info)
+	rec.SetOutput(content, "", "")
+
+	if memMgr != nil && content != "" {
+		_ = memMgr.AddAssistantMessage(ctx, sessionID, content)
+		s.scheduleVisitorExtraction(projectID, req.VisitorID, sessionID)
+	}
+
+	return &RunResponse{
+		Content:   content,
+		RunID:     rec.ID(),
+		Usage:     counter.Usage(),
+		Data:      data,
+		Consensus: info,
+	}, team.Name, nil
+}
+
+// consensusAgents returns the enabled agents of the project listed in
+// agentIDs, or else the enabled agents of the team. At least
+// minConsensusAgents are required.
+func (s *RuntimeService) consensusAgents(ctx context.Context, projectID uuid.UUID, team *model.Team, agentIDs []string) ([]model.Agent, error) {
+	if len(agentIDs) == 0 {
+		agents := make([]model.Agent, 0, len(team.Agents))
+		for _, a := range team.Agents {
+			if a.IsEnabled {
+				agents = append(agents, a)
+			}
+		}
+		if len(agents) < minConsensusAgents {
+			return nil, fmt.Errorf("team %s has %d enabled agents, consensus needs at least %d", team.Name, len(agents), minConsensusAgents)
+		}
+		return agents, nil
+	}
+	if len(agentIDs) < minConsensusAgents {
+		return nil, fmt.Errorf("consensus needs at least %d agents, got %d", minConsensusAgents, len(agentIDs))
+	}
+
+	ids := make([]uuid.UUID, 0, len(agentIDs))
+	for _, id := range agentIDs {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent ID %q", id)
+		}
+		ids = append(ids, parsed)
+	}
+	var agents []model.Agent
+	if err := s.db.WithContext(ctx).Where("project_id = ? AND id IN ? AND is_enabled = ?", projectID, ids, true).Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	if len(agents) != len(ids) {
+		return nil, fmt.Errorf("agents not found or disabled: %d of %d", len(ids)-len(agents), len(ids))
+	}
+	return agents, nil
+}
+
+// escalateConflict hands the visitor over to staff, it reports whether the
+// request was sent
+func (s *RuntimeService) escalateConflict(ctx context.Context, visitorID *uuid.UUID, conflict orchestration.ConflictInfo) bool {
+	if visitorID == nil || s.apiserverClient == nil {
+		log.Printf("[Consensus] Run %s: agents disagree on facts, no visitor to hand over", runID(ctx))
+		return false
+	}
+	reason := "Agents gave conflicting answers: " + conflict.Description
+	if err := s.SendManualServiceRequest(ctx, *visitorID, reason); err != nil {
+		log.Printf("[Consensus] Failed to hand over visitor %s: %v", visitorID, err)
+		return false
+	}
+	return true
+}
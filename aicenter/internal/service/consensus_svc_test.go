@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/orchestration"
+	"github.com/tgo/captain/aicenter/internal/model"
+)
+
+func TestConsensusAgentsOfTeam(t *testing.T) {
+	agent := func(name string, enabled bool) model.Agent {
+		return model.Agent{BaseModel: model.BaseModel{ID: uuid.New()}, Name: name, IsEnabled: enabled}
+	}
+
+	tests := []struct {
+		name    string
+		agents  []model.Agent
+		want    []string
+		wantErr bool
+	}{
+		{name: "enabled agents", agents: []model.Agent{agent("a", true), agent("b", true)}, want: []string{"a", "b"}},
+		{name: "disabled agents are left out", agents: []model.Agent{agent("a", true), agent("b", false), agent("c", true)}, want: []string{"a", "c"}},
+		{name: "one enabled agent", agents: []model.Agent{agent("a", true), agent("b", false)}, wantErr: true},
+		{name: "no agents", wantErr: true},
+	}
+
+	s := &RuntimeService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := &model.Team{Name: "support", Agents: tt.agents}
+			got, err := s.consensusAgents(context.Background(), uuid.New(), team, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("consensusAgents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("consensusAgents() returned %d agents, want %v", len(got), tt.want)
+			}
+			for i, a := range got {
+				if a.Name != tt.want[i] {
+					t.Errorf("consensusAgents()[%d] = %s, want %s", i, a.Name, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConsensusAgentsNeedTwo(t *testing.T) {
+	s := &RuntimeService{}
+	if _, err := s.consensusAgents(context.Background(), uuid.New(), &model.Team{}, []string{uuid.NewString()}); err == nil {
+		t.Error("consensusAgents() with one agent ID error = nil, want an error")
+	}
+}
+
+func TestEscalateConflictWithoutVisitor(t *testing.T) {
+	s := &RuntimeService{}
+	conflict := orchestration.ConflictInfo{Detected: true, Type: orchestration.ConflictFactual}
+	if s.escalateConflict(context.Background(), nil, conflict) {
+		t.Error("escalateConflict() without a visitor reported the hand over as sent")
+	}
+}
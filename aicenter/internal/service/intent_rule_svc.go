@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/tgo/captain/aicenter/internal/eino/orchestration"
+	"github.com/tgo/captain/aicenter/internal/model"
+	"github.com/tgo/captain/aicenter/internal/repository"
+)
+
+const (
+	// intentRulesChannel tells the other replicas the rules of a project changed
+	intentRulesChannel = "aicenter:intent-rules:reload"
+	// intentRulesTTL bounds how long a replica that missed a reload message
+	// routes with outdated rules
+	intentRulesTTL = 5 * time.Minute
+)
+
+// cachedRouter is the intent router of a project built from its rules
+type cachedRouter struct {
+	router   *orchestration.IntentRouter
+	loadedAt time.Time
+}
+
+// IntentRuleService manages the intent rules of the projects and caches
+// their routers. Changes reload the routers of every replica.
+type IntentRuleService struct {
+	repo      *repository.IntentRuleRepository
+	agentRepo *repository.AgentRepository
+	cli       *redis.Client
+
+	mu      sync.RWMutex
+	routers map[uuid.UUID]*cachedRouter
+	// generations count the reloads of each project, a router loaded across
+	// a reload is not cached
+	generations map[uuid.UUID]uint64
+}
+
+func NewIntentRuleService(repo *repository.IntentRuleRepository, agentRepo *repository.AgentRepository) *IntentRuleService {
+	return &IntentRuleService{
+		repo:        repo,
+		agentRepo:   agentRepo,
+		routers:     make(map[uuid.UUID]*cachedRouter),
+		generations: make(map[uuid.UUID]uint64),
+	}
+}
+
+// SetRedisClient shares rule changes with the other replicas
+func (s *IntentRuleService) SetRedisClient(cli *redis.Client) {
+	s.cli = cli
+}
+
+// Start listens for the rule changes of other replicas until ctx is done
+func (s *IntentRuleService) Start(ctx context.Context) {
+	if s.cli == nil {
+		return
+	}
+
+	pubsub := s.cli.Subscribe(ctx, intentRulesChannel)
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			projectID, err := uuid.Parse(msg.Payload)
+			if err != nil {
+				log.Printf("[IntentRules] Invalid reload message: %v", err)
+				continue
+			}
+			s.forget(projectID)
+		}
+	}()
+}
+
+func (s *IntentRuleService) List(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]model.IntentRule, int64, error) {
+	return s.repo.List(ctx, projectID, limit, offset)
+}
+
+func (s *IntentRuleService) GetByID(ctx context.Context, projectID, ruleID uuid.UUID) (*model.IntentRule, error) {
+	return s.repo.GetByID(ctx, projectID, ruleID)
+}
+
+func (s *IntentRuleService) Create(ctx context.Context, rule *model.IntentRule) error {
+	if err := s.repo.Create(ctx, rule); err != nil {
+		return err
+	}
+	s.reload(ctx, rule.ProjectID)
+	return nil
+}
+
+func (s *IntentRuleService) Update(ctx context.Context, rule *model.IntentRule) error {
+	if err := s.repo.Update(ctx, rule); err != nil {
+		return err
+	}
+	s.reload(ctx, rule.ProjectID)
+	return nil
+}
+
+func (s *IntentRuleService) Delete(ctx context.Context, projectID, ruleID uuid.UUID) error {
+	if err := s.repo.Delete(ctx, projectID, ruleID); err != nil {
+		return err
+	}
+	s.reload(ctx, projectID)
+	return nil
+}
+
+// Validate checks a rule can be stored: its patterns compile and its target
+// is an agent of the project or a known workflow
+func (s *IntentRuleService) Validate(ctx context.Context, rule *model.IntentRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(rule.Keywords) == 0 && len(rule.Patterns) == 0 {
+		return fmt.Errorf("keywords or patterns are required")
+	}
+	if _, err := compileIntentRule(rule); err != nil {
+		return err
+	}
+	switch orchestration.WorkflowType(rule.TargetWorkflow) {
+	case "", orchestration.WorkflowSingle, orchestration.WorkflowParallel, orchestration.WorkflowSequential,
+		orchestration.WorkflowHierarchical, orchestration.WorkflowPipeline:
+	default:
+		return fmt.Errorf("invalid target_workflow: %s", rule.TargetWorkflow)
+	}
+	if rule.Intent == "" && rule.TargetAgentID == nil && rule.TargetWorkflow == "" {
+		return fmt.Errorf("intent, target_agent_id or target_workflow is required")
+	}
+	if rule.TargetAgentID != nil {
+		if _, err := s.agentRepo.GetByID(ctx, rule.ProjectID, *rule.TargetAgentID); err != nil {
+			return fmt.Errorf("target agent %s not found", rule.TargetAgentID)
+		}
+	}
+	return nil
+}
+
+// Router returns the intent router of the project: its enabled rules on top
+// of the built-in ones
+func (s *IntentRuleService) Router(ctx context.Context, projectID uuid.UUID) (*orchestration.IntentRouter, error) {
+	cached, generation := s.cached(projectID)
+	if cached != nil && time.Since(cached.loadedAt) < intentRulesTTL {
+		return cached.router, nil
+	}
+
+	loadedAt := time.Now()
+	rules, err := s.repo.ListEnabled(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("list intent rules: %w", err)
+	}
+	compiled := make([]orchestration.IntentRule, 0, len(rules))
+	for i := range rules {
+		rule, err := compileIntentRule(&rules[i])
+		if err != nil {
+			log.Printf("[IntentRules] Skipping rule %s of project %s: %v", rules[i].ID, projectID, err)
+			continue
+		}
+		compiled = append(compiled, rule)
+	}
+	router := orchestration.NewIntentRouterWithRules(compiled...)
+	s.store(projectID, generation, &cachedRouter{router: router, loadedAt: loadedAt})
+	return router, nil
+}
+
+// cached returns the cached router of the project, nil when there is none,
+// and the generation of the rules a new router would be loaded from
+func (s *IntentRuleService) cached(projectID uuid.UUID) (*cachedRouter, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.routers[projectID], s.generations[projectID]
+}
+
+// store caches a router loaded at the given generation, unless the rules were
+// reloaded since: the router may miss their changes
+func (s *IntentRuleService) store(projectID uuid.UUID, generation uint64, router *cachedRouter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generations[projectID] != generation {
+		return
+	}
+	// Of two loads of the same generation, the latest one is kept
+	if current, ok := s.routers[projectID]; ok && current.loadedAt.After(router.loadedAt) {
+		return
+	}
+	s.routers[projectID] = router
+}
+
+// reload drops the router of the project on every replica, it is rebuilt
+// from the rules on next use
+func (s *IntentRuleService) reload(ctx context.Context, projectID uuid.UUID) {
+	s.forget(projectID)
+	if s.cli == nil {
+		return
+	}
+	if err := s.cli.Publish(ctx, intentRulesChannel, projectID.String()).Err(); err != nil {
+		log.Printf("[IntentRules] Failed to publish reload of project %s: %v", projectID, err)
+	}
+}
+
+func (s *IntentRuleService) forget(projectID uuid.UUID) {
+	s.mu.Lock()
+	delete(s.routers, projectID)
+	s.generations[projectID]++
+	s.mu.Unlock()
+}
+
+// compileIntentRule converts a stored rule for the intent router
+func compileIntentRule(rule *model.IntentRule) (orchestration.IntentRule, error) {
+	compiled := orchestration.IntentRule{
+		ID:             rule.ID.String(),
+		Name:           rule.Name,
+		Intent:         orchestration.IntentType(rule.Intent),
+		Keywords:       rule.Keywords,
+		Priority:       rule.Priority,
+		TargetWorkflow: orchestration.WorkflowType(rule.TargetWorkflow),
+	}
+	if rule.TargetAgentID != nil {
+		compiled.TargetAgentID = rule.TargetAgentID.String()
+	}
+	for _, p := range rule.Patterns {
+		pattern, err := regexp.Compile(p)
+		if err != nil {
+			return compiled, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		compiled.Patterns = append(compiled.Patterns, pattern)
+	}
+	return compiled, nil
+}
+
+// IntentDryRun is how a query would be routed, no agent is run
+type IntentDryRun struct {
+	Query string `json:"query"`
+	// Rule is the result of matching the intent rules
+	Rule *orchestration.QuickMatchResult `json:"rule"`
+	// Analysis is the routing of the query, from the matched rule or the
+	// LLM analysis. It is nil when the query needs the LLM analysis and it
+	// was not requested.
+	Analysis *orchestration.QueryAnalysisResult `json:"analysis,omitempty"`
+}
+
+// DryRunQuery routes a query as RunWithQueryAnalyzer would, without running
+// the agents. The LLM analysis, which is billed, only runs with useLLM; it
+// then rewrites a follow-up with the history of the session, if any.
+func (s *RuntimeService) DryRunQuery(ctx context.Context, projectID uuid.UUID, query, sessionID string, useLLM bool) (*IntentDryRun, error) {
+	team, err := s.teamRepo.GetDefault(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("get default team: %w", err)
+	}
+
+	analyzer := s.newQueryAnalyzer(ctx, projectID, nil)
+	dryRun := &IntentDryRun{
+		Query: query,
+		Rule:  analyzer.GetIntentRouter().Match(query),
+	}
+	if !dryRun.Rule.SkipLLM && !useLLM {
+		return dryRun, nil
+	}
+
+	if !dryRun.Rule.SkipLLM {
+		if err := s.checkBudget(ctx, projectID); err != nil {
+			return nil, err
+		}
+		providerCfg, err := s.getDefaultProviderConfig(ctx, projectID)
+		if err != nil {
+			return nil, fmt.Errorf("get provider config: %w", err)
+		}
+		chatModel, err := s.llmFactory.CreateChatModel(ctx, providerCfg)
+		if err != nil {
+			return nil, fmt.Errorf("create chat model: %w", err)
+		}
+		analyzer = s.newQueryAnalyzer(ctx, projectID, chatModel)
+		ctx = teamUsageScope(ctx, projectID, team, "", "")
+	}
+
+	analysisCtx := analysisContext(projectID, team, query)
+	if !dryRun.Rule.SkipLLM && sessionID != "" {
+		analysisCtx.SessionID = sessionID
+		analysisCtx.History, _ = s.GetMemoryManager(projectID, true).GetWindowedHistory(ctx, sessionID)
+	}
+	dryRun.Analysis, err = analyzer.Analyze(ctx, analysisCtx)
+	if err != nil {
+		return nil, err
+	}
+	return dryRun, nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/orchestration"
+)
+
+func TestIntentRuleServiceReloadDuringLoad(t *testing.T) {
+	s := NewIntentRuleService(nil, nil)
+	projectID := uuid.New()
+
+	// A load starts, the rules change and are reloaded, then the load ends
+	cached, generation := s.cached(projectID)
+	if cached != nil {
+		t.Fatalf("cached() = %+v before any load", cached)
+	}
+	s.forget(projectID)
+	s.store(projectID, generation, &cachedRouter{router: orchestration.NewIntentRouterWithRules(), loadedAt: time.Now()})
+
+	if cached, _ := s.cached(projectID); cached != nil {
+		t.Error("the router loaded before the reload was cached")
+	}
+
+	// The next load sees the reload and is cached
+	_, generation = s.cached(projectID)
+	router := &cachedRouter{router: orchestration.NewIntentRouterWithRules(), loadedAt: time.Now()}
+	s.store(projectID, generation, router)
+	if cached, _ := s.cached(projectID); cached != router {
+		t.Error("the router loaded after the reload was not cached")
+	}
+}
+
+func TestIntentRuleServiceConcurrentLoads(t *testing.T) {
+	s := NewIntentRuleService(nil, nil)
+	projectID := uuid.New()
+	_, generation := s.cached(projectID)
+
+	newer := &cachedRouter{router: orchestration.NewIntentRouterWithRules(), loadedAt: time.Now()}
+	older := &cachedRouter{router: orchestration.NewIntentRouterWithRules(), loadedAt: newer.loadedAt.Add(-time.Second)}
+	s.store(projectID, generation, newer)
+	s.store(projectID, generation, older)
+
+	if cached, _ := s.cached(projectID); cached != newer {
+		t.Error("an older load replaced the cached router")
+	}
+}
+
+func TestIntentRuleServiceReloadOtherProject(t *testing.T) {
+	s := NewIntentRuleService(nil, nil)
+	projectID := uuid.New()
+	_, generation := s.cached(projectID)
+
+	s.forget(uuid.New())
+	router := &cachedRouter{router: orchestration.NewIntentRouterWithRules(), loadedAt: time.Now()}
+	s.store(projectID, generation, router)
+
+	if cached, _ := s.cached(projectID); cached != router {
+		t.Error("the reload of another project discarded the router")
+	}
+}
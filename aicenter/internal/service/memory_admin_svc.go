@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tgo/captain/aicenter/internal/eino/memory"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+)
+
+// MemorySession is a stored session with its history
+type MemorySession struct {
+	memory.SessionInfo
+	// Summary is the rolling summary of the first SummarizedCount messages
+	Summary         string                 `json:"summary,omitempty"`
+	SummarizedCount int                    `json:"summarized_count,omitempty"`
+	Messages        []memory.StoredMessage `json:"messages"`
+}
+
+// VisitorErasure reports what was erased about a visitor
+type VisitorErasure struct {
+	VisitorID uuid.UUID `json:"visitor_id"`
+	Sessions  []string  `json:"sessions"`
+	Messages  int64     `json:"messages"`
+	Facts     int64     `json:"facts"`
+	// Runs is the number of runs deleted from the run history
+	Runs int64 `json:"runs"`
+}
+
+// ListMemorySessions returns a page of the stored sessions of the project,
+// most recently active first
+func (s *RuntimeService) ListMemorySessions(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]memory.SessionInfo, int64, error) {
+	return memory.NewPostgresStore(s.db, projectID).ListSessionInfos(ctx, limit, offset)
+}
+
+// GetMemorySession returns the stored history of a session, read from
+// PostgreSQL rather than the Redis cache. It returns gorm.ErrRecordNotFound
+// when the session has no messages.
+func (s *RuntimeService) GetMemorySession(ctx context.Context, projectID uuid.UUID, sessionID string) (*MemorySession, error) {
+	pgStore := memory.NewPostgresStore(s.db, projectID)
+	info, err := pgStore.GetSessionInfo(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	msgs, err := pgStore.ReadStored(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("read messages: %w", err)
+	}
+	session := &MemorySession{SessionInfo: *info, Messages: msgs}
+
+	summary, err := memory.NewSummaryStore(s.db, projectID).Get(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get summary: %w", err)
+	}
+	if summary != nil {
+		session.Summary = summary.Content
+		for _, msg := range msgs {
+			if msg.Seq <= summary.LastSeq {
+				session.SummarizedCount++
+			}
+		}
+	}
+	return session, nil
+}
+
+// DeleteMemorySession permanently erases a session: its messages in
+// PostgreSQL and Redis, its summary and its fact extraction progress. The
+// facts already learned from it are kept, see EraseVisitorMemory.
+func (s *RuntimeService) DeleteMemorySession(ctx context.Context, projectID uuid.UUID, sessionID string) (int64, error) {
+	s.cancelVisitorExtraction(projectID, sessionID)
+
+	if err := s.deleteCachedSession(ctx, projectID, sessionID); err != nil {
+		return 0, err
+	}
+	erased, err := memory.NewPostgresStore(s.db, projectID).Erase(ctx, sessionID)
+	if err != nil {
+		return 0, fmt.Errorf("erase messages: %w", err)
+	}
+	if err := memory.NewSummaryStore(s.db, projectID).Delete(ctx, sessionID); err != nil {
+		return erased, fmt.Errorf("delete summary: %w", err)
+	}
+	if err := memory.NewVisitorMemory(s.db, projectID).DeleteExtraction(ctx, sessionID); err != nil {
+		return erased, fmt.Errorf("delete extraction progress: %w", err)
+	}
+	return erased, nil
+}
+
+// TruncateMemorySession permanently removes the messages of a session after
+// the first keep ones, e.g. from the turn that poisoned the conversation, and
+// returns how many were removed. The summary, which may cover removed
+// messages, is dropped and rebuilt from the kept ones on the next reply.
+func (s *RuntimeService) TruncateMemorySession(ctx context.Context, projectID uuid.UUID, sessionID string, keep int) (int64, error) {
+	if keep < 0 {
+		return 0, fmt.Errorf("keep must not be negative")
+	}
+
+	removed, err := memory.NewPostgresStore(s.db, projectID).Truncate(ctx, sessionID, keep)
+	if err != nil {
+		return 0, fmt.Errorf("truncate messages: %w", err)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// The cache is reloaded from PostgreSQL on the next read
+	if err := s.deleteCachedSession(ctx, projectID, sessionID); err != nil {
+		return removed, err
+	}
+	if err := memory.NewSummaryStore(s.db, projectID).Delete(ctx, sessionID); err != nil {
+		return removed, fmt.Errorf("delete summary: %w", err)
+	}
+	if err := memory.NewVisitorMemory(s.db, projectID).RewindExtraction(ctx, sessionID, keep); err != nil {
+		return removed, fmt.Errorf("rewind extraction progress: %w", err)
+	}
+	return removed, nil
+}
+
+// EraseVisitorMemory permanently erases everything remembered about a
+// visitor: the facts, the sessions recorded as theirs in the run history or
+// the visitor memory along with sessionIDs, and the runs of the visitor and
+// of those sessions with their events.
+func (s *RuntimeService) EraseVisitorMemory(ctx context.Context, projectID, visitorID uuid.UUID, sessionIDs []string) (*VisitorErasure, error) {
+	visitorMem := memory.NewVisitorMemory(s.db, projectID)
+	learned, err := visitorMem.Sessions(ctx, visitorID)
+	if err != nil {
+		return nil, fmt.Errorf("list visitor sessions: %w", err)
+	}
+	var recorded []string
+	err = s.db.WithContext(ctx).
+		Model(&runs.Record{}).
+		Where("project_id = ? AND visitor_id = ? AND session_id <> ''", projectID, visitorID).
+		Distinct("session_id").
+		Pluck("session_id", &recorded).Error
+	if err != nil {
+		return nil, fmt.Errorf("list visitor runs: %w", err)
+	}
+
+	erasure := &VisitorErasure{VisitorID: visitorID, Sessions: uniqueSessions(sessionIDs, learned, recorded)}
+	for _, sessionID := range erasure.Sessions {
+		erased, err := s.DeleteMemorySession(ctx, projectID, sessionID)
+		erasure.Messages += erased
+		if err != nil {
+			return erasure, fmt.Errorf("erase session %s: %w", sessionID, err)
+		}
+	}
+	if erasure.Facts, err = visitorMem.DeleteAll(ctx, visitorID); err != nil {
+		return erasure, fmt.Errorf("delete facts: %w", err)
+	}
+	if erasure.Runs, err = runs.NewHistory(s.db).DeleteVisitor(ctx, projectID, visitorID, erasure.Sessions); err != nil {
+		return erasure, fmt.Errorf("delete runs: %w", err)
+	}
+	return erasure, nil
+}
+
+// deleteCachedSession removes a session of the project from the Redis cache,
+// if any
+func (s *RuntimeService) deleteCachedSession(ctx context.Context, projectID uuid.UUID, sessionID string) error {
+	if s.redisStore == nil {
+		return nil
+	}
+	if err := s.redisStore.ForProject(projectID).Delete(ctx, sessionID); err != nil {
+		return fmt.Errorf("delete cached session: %w", err)
+	}
+	return nil
+}
+
+// uniqueSessions merges lists of session IDs, sorted and without duplicates
+func uniqueSessions(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	sessions := []string{}
+	for _, list := range lists {
+		for _, sessionID := range list {
+			if sessionID == "" || seen[sessionID] {
+				continue
+			}
+			seen[sessionID] = true
+			sessions = append(sessions, sessionID)
+		}
+	}
+	sort.Strings(sessions)
+	return sessions
+}
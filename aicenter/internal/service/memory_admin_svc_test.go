@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestEraseVisitorMemoryDeletesRuns(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open dry run db: %v", err)
+	}
+	var deletes []string
+	capture := func(tx *gorm.DB) {
+		deletes = append(deletes, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("test:capture", capture); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	projectID, visitorID := uuid.New(), uuid.New()
+	s := &RuntimeService{db: db}
+	if _, err := s.EraseVisitorMemory(context.Background(), projectID, visitorID, []string{"session-1"}); err != nil {
+		t.Fatalf("EraseVisitorMemory() error = %v", err)
+	}
+
+	var events, runs string
+	for _, sql := range deletes {
+		switch {
+		case strings.HasPrefix(sql, `DELETE FROM "ai_run_events"`):
+			events = sql
+		case strings.HasPrefix(sql, `DELETE FROM "ai_runs"`):
+			runs = sql
+		}
+	}
+	if events == "" || runs == "" {
+		t.Fatalf("EraseVisitorMemory() deleted no runs or run events: %v", deletes)
+	}
+	for _, sql := range []string{events, runs} {
+		for _, want := range []string{projectID.String(), visitorID.String(), "'session-1'", "replay_of IN", "resume_of IN"} {
+			if !strings.Contains(sql, want) {
+				t.Errorf("delete %s does not select %s", sql, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/agent"
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/memory"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+)
+
+// ParseSummaryModel reads the "summary_model" of a project AI config: the
+// model summarizing long conversations, e.g. a cheaper one than the default.
+// An empty ProviderID means the default provider, nil means the default model.
+func ParseSummaryModel(cfg map[string]interface{}) (*FallbackTarget, error) {
+	raw, ok := cfg["summary_model"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	var target FallbackTarget
+	if err := decodeConfigValue(raw, &target); err != nil {
+		return nil, fmt.Errorf("invalid summary_model: %w", err)
+	}
+	if target.ProviderID == nil && target.Model == "" {
+		return nil, fmt.Errorf("summary_model: provider_id or model is required")
+	}
+	return &target, nil
+}
+
+// newSummarizer returns how the memory of the project builds its summarizer:
+// the one set with SetSummarizer, or else one using the summary model of the
+// project
+func (s *RuntimeService) newSummarizer(projectID uuid.UUID) func(ctx context.Context) (*memory.Summarizer, error) {
+	return func(ctx context.Context) (*memory.Summarizer, error) {
+		if s.summarizer != nil {
+			return s.summarizer, nil
+		}
+		providerCfg, err := s.getSummaryProviderConfig(ctx, projectID)
+		if err != nil {
+			return nil, err
+		}
+		chatModel, err := s.llmFactory.CreateChatModel(ctx, providerCfg)
+		if err != nil {
+			return nil, fmt.Errorf("create chat model: %w", err)
+		}
+		return memory.NewSummarizer(ctx, &memory.SummarizerConfig{Model: chatModel})
+	}
+}
+
+// getSummaryProviderConfig returns the provider config of the summary model
+// of the project, or else of its default model
+func (s *RuntimeService) getSummaryProviderConfig(ctx context.Context, projectID uuid.UUID) (*llm.ProviderConfig, error) {
+	providerCfg, err := s.getDefaultProviderConfig(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("get provider config: %w", err)
+	}
+	aiConfig, err := s.aiConfigRepo.GetByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("get AI config: %w", err)
+	}
+	target, err := ParseSummaryModel(aiConfig.Config)
+	if err != nil || target == nil {
+		return providerCfg, err
+	}
+
+	if target.ProviderID == nil {
+		out := *providerCfg
+		out.Model = target.Model
+		return &out, nil
+	}
+	provider, err := s.providerRepo.GetByID(ctx, projectID, *target.ProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("get summary provider: %w", err)
+	}
+	modelName := target.Model
+	if modelName == "" {
+		modelName = provider.DefaultModel
+	}
+	return s.withFallbacks(ctx, projectID, newProviderConfig(provider, modelName), aiConfig.Config), nil
+}
+
+// windowedMemoryManager returns the memory of the project windowed by the
+// smallest history budget of the agents the history is sent to
+func (s *RuntimeService) windowedMemoryManager(ctx context.Context, projectID uuid.UUID, agents ...*agent.AgentConfig) *memory.Manager {
+	memMgr := s.GetMemoryManager(projectID, true)
+	if len(agents) == 0 {
+		return memMgr
+	}
+	budget := memory.MaxHistoryTokens
+	for _, a := range agents {
+		budget = min(budget, memory.HistoryBudget(ctx, a.Provider, a.Instruction, a.Tools))
+	}
+	memMgr.SetTokenBudget(budget, agents[0].Provider.Tokenizer())
+	return memMgr
+}
+
+// teamAgents returns the supervisor and the agents of a team, which all read
+// the history
+func teamAgents(cfg *supervisor.SupervisorConfig) []*agent.AgentConfig {
+	agents := make([]*agent.AgentConfig, 0, len(cfg.Agents)+1)
+	agents = append(agents, &agent.AgentConfig{
+		Instruction: cfg.SupervisorInstruction,
+		Provider:    cfg.SupervisorProvider,
+	})
+	return append(agents, cfg.Agents...)
+}
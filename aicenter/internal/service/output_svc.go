@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+	"github.com/tgo/captain/aicenter/internal/eino/structured"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+	"github.com/tgo/captain/aicenter/internal/model"
+)
+
+// outputSchema returns the output schema of a run: the one of the request, or
+// else the first one declared by the agent or team configs. It returns nil
+// when the run answers with free text.
+func outputSchema(req *RunRequest, configs ...model.JSONMap) (*structured.Schema, error) {
+	if len(req.OutputSchema) > 0 {
+		return structured.Parse("", req.OutputSchema)
+	}
+	for _, cfg := range configs {
+		out, err := structured.FromConfig(cfg)
+		if err != nil || out != nil {
+			return out, err
+		}
+	}
+	return nil, nil
+}
+
+// withOutputSchema sets the output schema declared by an agent or team config
+// on the request, unless the request declares its own
+func withOutputSchema(req *RunRequest, configs ...model.JSONMap) error {
+	out, err := outputSchema(req, configs...)
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		req.OutputSchema = out.Raw
+	}
+	return nil
+}
+
+// outputInstruction appends the instruction to follow the output schema to
+// the caller instruction
+func outputInstruction(instruction string, out *structured.Schema) string {
+	if out == nil {
+		return instruction
+	}
+	if instruction == "" {
+		return out.Instruction()
+	}
+	return instruction + "\n\n" + out.Instruction()
+}
+
+// structureOutput validates the answer of a run against its output schema and
+// returns the conforming JSON both as the answer and as its data. Answers that
+// do not conform are sent back to the model of providerCfg to be repaired,
+// with the native response format of the provider when it has one. Without
+// output schema the answer is returned as is.
+func (s *RuntimeService) structureOutput(ctx context.Context, providerCfg *llm.ProviderConfig, out *structured.Schema, content string) (string, json.RawMessage, error) {
+	if out == nil {
+		return content, nil, nil
+	}
+	data, errs := out.Check(content)
+	if len(errs) == 0 {
+		return string(data), data, nil
+	}
+	log.Printf("[Output] Answer of run %s does not conform to schema %s, repairing: %v", runID(ctx), out.Name, errs)
+
+	chatModel, err := s.llmFactory.Create(ctx, providerCfg.WithOutput(out.Output()))
+	if err != nil {
+		return "", nil, fmt.Errorf("create chat model: %w", err)
+	}
+	data, err = structured.Repair(ctx, chatModel, out, content, structured.DefaultRepairAttempts)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(data), data, nil
+}
+
+// outputEvent reports the structured answer of a streamed run
+func outputEvent(agentName string, data json.RawMessage) *supervisor.Event {
+	event := streaming.NewOutputEvent(agentName, data)
+	return &supervisor.Event{Tool: &event}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+
+	einoTool "github.com/cloudwego/eino/components/tool"
+
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/tool"
+)
+
+type recordedCallsKey struct{}
+
+// withRecordedCalls makes the tools of the runs started with ctx answer with
+// the results recorded by the original run instead of running again
+func withRecordedCalls(ctx context.Context, original *runs.Record) context.Context {
+	return context.WithValue(ctx, recordedCallsKey{}, tool.NewRecordedCalls(recordedToolCalls(original.Events)))
+}
+
+// recordedToolCalls pairs the tool calls of a recorded run with their results
+func recordedToolCalls(events []runs.Event) []tool.RecordedCall {
+	results := make(map[string]string)
+	for _, e := range events {
+		if e.Type == runs.EventToolResult && e.ToolCallID != "" {
+			results[e.ToolCallID] = e.Content
+		}
+	}
+
+	var calls []tool.RecordedCall
+	for _, e := range events {
+		if e.Type != runs.EventToolCall {
+			continue
+		}
+		result, ok := results[e.ToolCallID]
+		if !ok {
+			continue
+		}
+		calls = append(calls, tool.RecordedCall{Name: e.ToolName, Arguments: e.Content, Result: result})
+	}
+	return calls
+}
+
+// withReplayedTools replaces the tools with side effects by their recorded
+// results when ctx replays a run without executing tools. Read-only tools run
+// again.
+func withReplayedTools(ctx context.Context, tools []einoTool.BaseTool) []einoTool.BaseTool {
+	recorded, ok := ctx.Value(recordedCallsKey{}).(*tool.RecordedCalls)
+	if !ok {
+		return tools
+	}
+	replayed := make([]einoTool.BaseTool, 0, len(tools))
+	for _, t := range tools {
+		if t != nil && !tool.IsReadOnly(t) {
+			t = tool.Replayed(t, recorded)
+		}
+		replayed = append(replayed, t)
+	}
+	return replayed
+}
+
+// withoutReplayHistory keeps replaying the run of ctx for a step that ran
+// without the conversation history, like the agent answering the rewritten
+// query of an analyzer run. The run keeps its recorded tool results.
+func withoutReplayHistory(ctx context.Context) context.Context {
+	replay := runs.ReplayFromContext(ctx)
+	if replay == nil || len(replay.History) == 0 {
+		return ctx
+	}
+	inner := *replay
+	inner.History = nil
+	return runs.WithReplay(ctx, &inner)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	einoTool "github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/tool"
+	"github.com/tgo/captain/aicenter/internal/eino/tool/builtin"
+)
+
+type ticketTool struct{ calls int }
+
+func (t *ticketTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: "create_ticket"}, nil
+}
+
+func (t *ticketTool) InvokableRun(context.Context, string, ...einoTool.Option) (string, error) {
+	t.calls++
+	return "ticket created", nil
+}
+
+func TestRecordedToolCalls(t *testing.T) {
+	events := []runs.Event{
+		{Type: runs.EventMessage, Content: "let me check"},
+		{Type: runs.EventToolCall, ToolName: "create_ticket", ToolCallID: "call_1", Content: `{"title":"a"}`},
+		{Type: runs.EventToolCall, ToolName: "refund", ToolCallID: "call_2", Content: `{"order":"1"}`},
+		{Type: runs.EventToolResult, ToolName: "create_ticket", ToolCallID: "call_1", Content: "ticket 7"},
+		// The run ended before the refund returned
+	}
+
+	want := []tool.RecordedCall{{Name: "create_ticket", Arguments: `{"title":"a"}`, Result: "ticket 7"}}
+	if got := recordedToolCalls(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("recordedToolCalls() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithReplayedTools(t *testing.T) {
+	tickets := &ticketTool{}
+	calculator := builtin.NewCalculatorTool()
+	tools := []einoTool.BaseTool{tickets, calculator}
+
+	if got := withReplayedTools(context.Background(), tools); !reflect.DeepEqual(got, tools) {
+		t.Fatal("withReplayedTools() changed the tools of a run that is not a replay")
+	}
+
+	original := &runs.Record{Events: []runs.Event{
+		{Type: runs.EventToolCall, ToolName: "create_ticket", ToolCallID: "call_1", Content: `{}`},
+		{Type: runs.EventToolResult, ToolName: "create_ticket", ToolCallID: "call_1", Content: "ticket 7"},
+	}}
+	ctx := withRecordedCalls(context.Background(), original)
+	replayed := withReplayedTools(ctx, tools)
+
+	if replayed[1] != calculator {
+		t.Error("withReplayedTools() replaced a read-only tool")
+	}
+	got, err := replayed[0].(einoTool.InvokableTool).InvokableRun(ctx, `{}`)
+	if err != nil || got != "ticket 7" {
+		t.Errorf("replayed create_ticket = %q, %v, want the recorded result", got, err)
+	}
+	if tickets.calls != 0 {
+		t.Errorf("create_ticket ran %d times during the replay", tickets.calls)
+	}
+	if tools[0] != tickets {
+		t.Error("withReplayedTools() modified the tools it was given")
+	}
+}
+
+func TestWithoutReplayHistory(t *testing.T) {
+	if ctx := withoutReplayHistory(context.Background()); runs.ReplayFromContext(ctx) != nil {
+		t.Fatal("withoutReplayHistory() made a run a replay")
+	}
+
+	original := &runs.Record{
+		ID:      "run-1",
+		History: runs.Messages{schema.UserMessage("my order is late"), schema.AssistantMessage("which order?", nil)},
+	}
+	replay := runs.ReplayFromContext(withoutReplayHistory(runs.WithReplay(context.Background(), original)))
+	if replay == nil || replay.ID != "run-1" {
+		t.Fatalf("withoutReplayHistory() replays %v, want run-1", replay)
+	}
+	if len(replay.History) != 0 {
+		t.Errorf("withoutReplayHistory() kept %d history messages", len(replay.History))
+	}
+	if len(original.History) != 2 {
+		t.Error("withoutReplayHistory() modified the replayed record")
+	}
+}
@@ -2,12 +2,19 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudwego/eino/adk"
 	einoSupervisor "github.com/cloudwego/eino/adk/prebuilt/supervisor"
+	einoModel "github.com/cloudwego/eino/components/model"
 	einoTool "github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/flow/agent/react"
 	"github.com/cloudwego/eino/schema"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -16,8 +23,12 @@ import (
 	"github.com/tgo/captain/aicenter/internal/eino/llm"
 	"github.com/tgo/captain/aicenter/internal/eino/memory"
 	"github.com/tgo/captain/aicenter/internal/eino/orchestration"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+	"github.com/tgo/captain/aicenter/internal/eino/structured"
 	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
 	"github.com/tgo/captain/aicenter/internal/eino/tool"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
 	"github.com/tgo/captain/aicenter/internal/model"
 	"github.com/tgo/captain/aicenter/internal/pkg/apiserver"
 	"github.com/tgo/captain/aicenter/internal/repository"
@@ -36,6 +47,13 @@ type RuntimeService struct {
 	mcpURL          string             // MCP service URL for MCP tools
 	redisStore      *memory.RedisStore // Redis store for memory caching
 	summarizer      *memory.Summarizer // Conversation summarizer
+	budgets         *usage.BudgetGuard // Per-project usage budgets
+	runs            *runs.Registry     // In-flight runs, for cancellation
+	history         *runs.History      // Persisted run history
+	approvals       *repository.ApprovalRepository
+	intentRules     *IntentRuleService // Project intent rules of the QueryAnalyzer
+	extractionsMu   sync.Mutex
+	extractions     map[string]*time.Timer // Pending visitor fact extractions, by session
 }
 
 func NewRuntimeService(db *gorm.DB, teamRepo *repository.TeamRepository, aiConfigRepo *repository.ProjectAIConfigRepository, providerRepo *repository.ProviderRepository, ragURL, mcpURL string) *RuntimeService {
@@ -54,6 +72,9 @@ func NewRuntimeService(db *gorm.DB, teamRepo *repository.TeamRepository, aiConfi
 		runner:       runner,
 		ragURL:       ragURL,
 		mcpURL:       mcpURL,
+		runs:         runs.NewRegistry(nil),
+		approvals:    repository.NewApprovalRepository(db),
+		extractions:  make(map[string]*time.Timer),
 	}
 }
 
@@ -67,11 +88,96 @@ func (s *RuntimeService) SetRedisStore(store *memory.RedisStore) {
 	s.redisStore = store
 }
 
-// SetSummarizer sets the conversation summarizer
+// SetSummarizer sets the conversation summarizer of every project, instead
+// of one using the summary model of each project
 func (s *RuntimeService) SetSummarizer(summarizer *memory.Summarizer) {
 	s.summarizer = summarizer
 }
 
+// SetBudgetGuard enables per-project budget enforcement
+func (s *RuntimeService) SetBudgetGuard(guard *usage.BudgetGuard) {
+	s.budgets = guard
+}
+
+// SetRunRegistry sets the run registry, e.g. one shared across replicas
+func (s *RuntimeService) SetRunRegistry(registry *runs.Registry) {
+	s.runs = registry
+}
+
+// SetRunHistory enables persisting the history of every run
+func (s *RuntimeService) SetRunHistory(history *runs.History) {
+	s.history = history
+}
+
+// SetIntentRules routes queries with the intent rules of their project
+func (s *RuntimeService) SetIntentRules(rules *IntentRuleService) {
+	s.intentRules = rules
+}
+
+// SetCheckPointStore sets where runs waiting for approval are checkpointed,
+// e.g. a store shared across replicas
+func (s *RuntimeService) SetCheckPointStore(store supervisor.CheckPointStore) {
+	s.runner.SetCheckPointStore(store)
+}
+
+// startRun registers the run so it can be cancelled and starts recording its
+// history. Nested calls, e.g. the QueryAnalyzer delegating to Run, join the
+// outer run. The returned func must be called with the final ctx and error.
+func (s *RuntimeService) startRun(ctx context.Context, record *runs.Record) (context.Context, *runs.Recorder, func(context.Context, error)) {
+	if rec := runs.RecorderFromContext(ctx); rec != nil {
+		return ctx, rec, func(context.Context, error) {}
+	}
+
+	ctx, run := s.runs.Register(ctx, record.ID, record.ProjectID, record.SessionID)
+	record.ID = run.ID
+	rec := runs.NewRecorder(ctx, s.history, record)
+	ctx = runs.WithRecorder(ctx, rec)
+
+	return ctx, rec, func(ctx context.Context, err error) {
+		s.runs.Finish(run, err)
+		_, counter := usage.WithCounter(ctx)
+		rec.Finish(ctx, run, counter.Usage())
+	}
+}
+
+// paramsSnapshot converts generation params for the run history
+func paramsSnapshot(params *llm.GenerationParams) runs.JSONMap {
+	if params == nil {
+		return nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+	var snapshot runs.JSONMap
+	_ = json.Unmarshal(data, &snapshot)
+	return snapshot
+}
+
+// runError reports the error of a cancelled run as runs.ErrCancelled
+func runError(ctx context.Context, err error) error {
+	if err != nil && runs.Cancelled(ctx) {
+		return runs.ErrCancelled
+	}
+	return err
+}
+
+// runID returns the ID of the run the context belongs to
+func runID(ctx context.Context) string {
+	if run := runs.FromContext(ctx); run != nil {
+		return run.ID
+	}
+	return orchestration.GenerateRunID()
+}
+
+// checkBudget returns a *usage.BudgetExceededError when the project may not run
+func (s *RuntimeService) checkBudget(ctx context.Context, projectID uuid.UUID) error {
+	if s.budgets == nil {
+		return nil
+	}
+	return s.budgets.Check(ctx, projectID)
+}
+
 // SendManualServiceRequest sends a manual service request to the apiserver
 func (s *RuntimeService) SendManualServiceRequest(ctx context.Context, visitorID uuid.UUID, reason string) error {
 	if s.apiserverClient == nil {
@@ -81,6 +187,24 @@ func (s *RuntimeService) SendManualServiceRequest(ctx context.Context, visitorID
 	return err
 }
 
+// NotifyBudgetAlert tells the admins of the project about a budget alert
+// through the apiserver, it implements usage.AlertNotifier
+func (s *RuntimeService) NotifyBudgetAlert(ctx context.Context, alert *usage.BudgetAlert) error {
+	if s.apiserverClient == nil {
+		return nil
+	}
+	_, err := s.apiserverClient.SendBudgetAlert(ctx, alert.ProjectID, map[string]interface{}{
+		"alert_id":     alert.ID.String(),
+		"level":        alert.Level,
+		"period":       alert.Period,
+		"period_start": alert.PeriodStart,
+		"metric":       alert.Metric,
+		"limit":        alert.Limit,
+		"used":         alert.Used,
+	})
+	return err
+}
+
 // GetMemoryManager returns a memory manager for the given project
 // Uses HybridStore (Redis + PostgreSQL) if Redis is available, otherwise PostgresStore
 func (s *RuntimeService) GetMemoryManager(projectID uuid.UUID, enablePersistence bool) *memory.Manager {
@@ -90,7 +214,7 @@ func (s *RuntimeService) GetMemoryManager(projectID uuid.UUID, enablePersistence
 		DB:                s.db,
 		ProjectID:         projectID,
 		RedisStore:        s.redisStore, // Will use HybridStore if not nil
-		Summarizer:        s.summarizer, // Will enable auto-summarization if not nil
+		NewSummarizer:     s.newSummarizer(projectID),
 	})
 }
 
@@ -107,17 +231,81 @@ type RunRequest struct {
 	CollectionIDs []string   `json:"collection_ids"`
 	EnableMemory  bool       `json:"enable_memory"`
 	VisitorID     *uuid.UUID `json:"visitor_id,omitempty"` // For transfer to human tool
+	// RunID identifies the run for cancellation, generated when empty
+	RunID string `json:"run_id,omitempty"`
+	// Params overrides the generation params of every agent in the run
+	Params *llm.GenerationParams `json:"params,omitempty"`
+	// History is the conversation sent with the request, it replaces the
+	// session memory
+	History []*schema.Message `json:"-"`
+	// Instruction is appended to the system prompt, e.g. the system messages
+	// of an OpenAI-compatible request
+	Instruction string `json:"-"`
+	// Tools are declared by the caller: the model answers with calls of them
+	// instead of running the agent tools
+	Tools      []*schema.ToolInfo `json:"-"`
+	ToolChoice *ToolChoice        `json:"-"`
+	// OutputSchema is the JSON Schema the answer must conform to, it
+	// overrides the "output_schema" of the agent or team config
+	OutputSchema json.RawMessage `json:"output_schema,omitempty"`
+	// Attachments are the files sent with the message, such as screenshots
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// RequireConsensus runs every agent on the message and checks their
+	// answers agree, see RunWithConsensus
+	RequireConsensus bool `json:"require_consensus,omitempty"`
+}
+
+// ToolChoice controls how the model uses the caller tools
+type ToolChoice struct {
+	// Mode is "auto", "none" or "required"
+	Mode string
+	// Function forces a call of the named tool
+	Function string
 }
 
+// Tool choice modes, as in the OpenAI API
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
 type RunResponse struct {
 	Content string `json:"content"`
 	RunID   string `json:"run_id"`
+	// Provider and Model that actually answered (after failover)
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Usage sums the tokens of every model call made for the run
+	Usage usage.TokenUsage `json:"usage"`
+	// ToolCalls are the calls of the caller tools the model answered with
+	ToolCalls []schema.ToolCall `json:"tool_calls,omitempty"`
+	// Approvals are set when the run paused on tool calls waiting for
+	// approval, Content then tells the user to wait for staff
+	Approvals []*model.ToolApproval `json:"approvals,omitempty"`
+	// Data is the answer decoded as the output schema of the run, Content
+	// then holds the same JSON
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// Steps are the results of the sub-questions of a run executed as a
+	// dependency graph, failed steps included
+	Steps []orchestration.StepResult `json:"steps,omitempty"`
+
+	// Consensus is set for runs requiring consensus: whether the agents
+	// agreed, and the conflicts found between their answers
+	Consensus *ConsensusInfo `json:"consensus,omitempty"`
 }
 
-func (s *RuntimeService) Run(ctx context.Context, projectID uuid.UUID, req *RunRequest) (*RunResponse, error) {
+func (s *RuntimeService) Run(ctx context.Context, projectID uuid.UUID, req *RunRequest) (_ *RunResponse, err error) {
+	if req.RequireConsensus {
+		return s.RunWithConsensus(ctx, projectID, req)
+	}
+	if err := s.checkBudget(ctx, projectID); err != nil {
+		return nil, err
+	}
+
 	// Get team
 	var team *model.Team
-	var err error
 
 	if req.TeamID != nil {
 		teamID, parseErr := uuid.Parse(*req.TeamID)
@@ -131,6 +319,10 @@ func (s *RuntimeService) Run(ctx context.Context, projectID uuid.UUID, req *RunR
 	if err != nil {
 		return nil, err
 	}
+	out, err := outputSchema(req, team.Config)
+	if err != nil {
+		return nil, err
+	}
 
 	// Setup memory if enabled
 	var memMgr *memory.Manager
@@ -139,13 +331,24 @@ func (s *RuntimeService) Run(ctx context.Context, projectID uuid.UUID, req *RunR
 	if req.SessionID != nil && *req.SessionID != "" {
 		sessionID = *req.SessionID
 	}
-	if req.EnableMemory {
-		memMgr = s.GetMemoryManager(projectID, true)
-		// Get history before adding new message
-		history, _ = memMgr.GetWindowedHistory(ctx, sessionID)
-		// Store user message
-		_ = memMgr.AddUserMessage(ctx, sessionID, req.Message)
-	}
+
+	ctx, rec, finish := s.startRun(ctx, &runs.Record{
+		ID:        req.RunID,
+		ProjectID: projectID,
+		Kind:      runs.KindTeam,
+		SessionID: sessionID,
+		VisitorID: req.VisitorID,
+		Input:     inputText(req),
+		Params:    paramsSnapshot(req.Params),
+	})
+	defer func() {
+		err = runError(ctx, err)
+		finish(ctx, err)
+	}()
+	rec.SetTeam(&team.ID, teamAgentIDs(team))
+
+	ctx = teamUsageScope(ctx, projectID, team, sessionID, rec.ID())
+	ctx, counter := usage.WithCounter(ctx)
 
 	// Build team config - use service URLs, allow request to override
 	mcpURL := s.mcpURL
@@ -156,111 +359,252 @@ func (s *RuntimeService) Run(ctx context.Context, projectID uuid.UUID, req *RunR
 	if req.RAGURL != nil && *req.RAGURL != "" {
 		ragURL = *req.RAGURL
 	}
-	teamCfg := s.buildTeamConfigWithVisitor(ctx, projectID, team, mcpURL, ragURL, req.VisitorID)
+	teamCfg := s.buildTeamConfigWithVisitor(ctx, projectID, team, mcpURL, ragURL, req.VisitorID, req.Params)
+	withVisitorFacts(teamCfg, s.visitorFactsInstruction(ctx, projectID, req.VisitorID, inputText(req)))
+	rec.SetConfig("team", teamCfg.Snapshot(ctx))
+
+	if req.EnableMemory {
+		// The history is windowed to fit the supervisor and every agent
+		memMgr = s.windowedMemoryManager(ctx, projectID, teamAgents(teamCfg)...)
+		// Get history before adding new message
+		history, _ = memMgr.GetWindowedHistory(ctx, sessionID)
+		// Store user message
+		_ = memMgr.AddUserMessage(ctx, sessionID, inputText(req))
+	}
+	if req.History != nil {
+		history = req.History
+	}
+	if replay := runs.ReplayFromContext(ctx); replay != nil {
+		history = replay.History
+	}
+	rec.SetHistory(history)
+	history = withInstruction(history, outputInstruction(req.Instruction, out))
 
 	// Run with history
-	result, err := s.runner.RunWithHistory(ctx, teamCfg, req.Message, history)
+	messages := append(append([]*schema.Message{}, history...), s.userMessage(ctx, projectID, req, teamCfg.SupportsVision()))
+	result, err := s.runner.RunMessages(ctx, teamCfg, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tool calls wait for approval, the run resumes once staff decide them
+	if len(result.Interrupts) > 0 {
+		approvals, err := s.requestApprovals(ctx, runApproval(projectID, rec.ID(), team, sessionID, req), result.Interrupts)
+		if err != nil {
+			return nil, err
+		}
+		rec.SetOutput(approvalPendingMessage, result.Provider, result.Model)
+		return &RunResponse{
+			Content:   approvalPendingMessage,
+			RunID:     rec.ID(),
+			Provider:  result.Provider,
+			Model:     result.Model,
+			Usage:     counter.Usage(),
+			Approvals: approvals,
+		}, nil
+	}
+	content, data, err := s.structureOutput(ctx, teamCfg.SupervisorProvider, out, result.Content)
 	if err != nil {
 		return nil, err
 	}
+	rec.SetOutput(content, result.Provider, result.Model)
 
 	// Store assistant response if memory enabled
-	if memMgr != nil && result.Content != "" {
-		_ = memMgr.AddAssistantMessage(ctx, sessionID, result.Content)
+	if memMgr != nil && content != "" {
+		_ = memMgr.AddAssistantMessage(ctx, sessionID, content)
+		s.scheduleVisitorExtraction(projectID, req.VisitorID, sessionID)
 	}
 
 	return &RunResponse{
-		Content: result.Content,
-		RunID:   uuid.New().String(),
+		Content:  content,
+		RunID:    rec.ID(),
+		Provider: result.Provider,
+		Model:    result.Model,
+		Usage:    counter.Usage(),
+		Data:     data,
 	}, nil
 }
 
-// RunWithReactAgent runs a single agent with tools using ReAct pattern
-// This is recommended for agents with RAG/tool support
-func (s *RuntimeService) RunWithReactAgent(ctx context.Context, projectID uuid.UUID, agentID string, message string, instruction string, tools []einoTool.BaseTool) (*RunResponse, error) {
-	// Get project default provider config
-	var providerCfg *llm.ProviderConfig
-	if aiConfig, err := s.aiConfigRepo.GetByProjectID(ctx, projectID); err == nil && aiConfig != nil {
-		if aiConfig.DefaultChatProviderID != nil {
-			if provider, err := s.providerRepo.GetByID(ctx, projectID, *aiConfig.DefaultChatProviderID); err == nil && provider != nil {
-				providerCfg = &llm.ProviderConfig{
-					Kind:    llm.ProviderKind(provider.ProviderKind),
-					APIKey:  provider.APIKey,
-					Model:   aiConfig.DefaultChatModel,
-					BaseURL: provider.APIBaseURL,
-				}
-			}
-		}
+// RunWithReactAgentAndMemory runs ReAct agent with session memory support
+func (s *RuntimeService) RunWithReactAgentAndMemory(ctx context.Context, projectID uuid.UUID, req *RunRequest, instruction string, tools []einoTool.BaseTool) (_ *RunResponse, err error) {
+	if err := s.checkBudget(ctx, projectID); err != nil {
+		return nil, err
 	}
 
-	if providerCfg == nil {
-		return nil, fmt.Errorf("no default provider configured for project")
+	ctx, rec, finish := s.startAgentRun(ctx, projectID, req)
+	defer func() {
+		err = runError(ctx, err)
+		finish(ctx, err)
+	}()
+	ctx, counter := usage.WithCounter(ctx)
+
+	out, err := outputSchema(req)
+	if err != nil {
+		return nil, err
+	}
+	reactAgent, agentCfg, messages, err := s.prepareReactAgent(ctx, projectID, req, instruction, tools, out, rec)
+	if err != nil {
+		return nil, err
 	}
 
-	// Build ReAct agent config
-	agentCfg := &agent.AgentConfig{
-		Name:        "assistant",
-		Description: "AI assistant with knowledge base tools",
-		Instruction: instruction,
-		Provider:    providerCfg,
-		Tools:       tools,
+	// Run agent, recording its model and tool calls in the run history
+	resp, err := reactAgent.Generate(ctx, messages, rec.ReactOption(agentCfg.Name))
+	if err != nil {
+		return nil, fmt.Errorf("react agent generate: %w", err)
+	}
+	content, data, err := s.structureOutput(ctx, agentCfg.Provider, out, resp.Content)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create ReAct agent
-	reactAgent, err := s.agentBuilder.BuildReactAgent(ctx, agentCfg)
+	s.saveAgentMemory(ctx, projectID, req, agentCfg, content)
+
+	provider, modelName, _ := llm.AnsweredBy(resp)
+	rec.SetOutput(content, provider, modelName)
+	return &RunResponse{
+		Content:  content,
+		RunID:    rec.ID(),
+		Provider: provider,
+		Model:    modelName,
+		Usage:    counter.Usage(),
+		Data:     data,
+	}, nil
+}
+
+// StreamAgent streams the answer of the agent of the request. Agents without
+// tools are run by the team, as with RunWithAgentTools.
+func (s *RuntimeService) StreamAgent(ctx context.Context, projectID uuid.UUID, req *RunRequest, callback supervisor.StreamCallback) (err error) {
+	dbAgent, tools, err := s.loadAgentTools(ctx, *req.AgentID)
+	if err != nil {
+		return err
+	}
+	agentReq := *req
+	agentReq.Params = parseGenerationParams(dbAgent.Config).Merge(req.Params)
+	if err := withOutputSchema(&agentReq, dbAgent.Config); err != nil {
+		return err
+	}
+	if len(tools) == 0 {
+		log.Printf("[DEBUG] No tools loaded, falling back to team stream")
+		agentReq.AgentID = nil
+		return s.Stream(ctx, projectID, &agentReq, callback)
+	}
+	out, err := outputSchema(&agentReq)
 	if err != nil {
-		return nil, fmt.Errorf("build react agent: %w", err)
+		return err
 	}
 
-	// Build messages with system instruction (required for react agent to use tools properly)
-	var messages []*schema.Message
+	ctx, rec, finish := s.startAgentRun(ctx, projectID, &agentReq)
+	defer func() {
+		err = runError(ctx, err)
+		finish(ctx, err)
+	}()
 
-	// Add system instruction that tells the agent to use tools
-	systemPrompt := instruction
-	if systemPrompt == "" {
-		systemPrompt = "You are a helpful assistant with access to knowledge base search tools. When answering questions, always search the knowledge base first to find relevant information."
-	} else {
-		systemPrompt += "\n\nIMPORTANT: You have access to knowledge base search tools. When answering questions, ALWAYS use the search tools to find relevant information before responding."
+	reactAgent, agentCfg, messages, err := s.prepareReactAgent(ctx, projectID, &agentReq, dbAgent.Instruction, tools, out, rec)
+	if err != nil {
+		return err
 	}
-	messages = append(messages, schema.SystemMessage(systemPrompt))
-	messages = append(messages, schema.UserMessage(message))
 
-	log.Printf("[DEBUG] Running ReAct agent with %d messages", len(messages))
+	ctx, callback, stop := supervisor.Forward(ctx, callback)
+	defer stop()
 
-	// Run agent
-	resp, err := reactAgent.Generate(ctx, messages)
+	stream, err := reactAgent.Stream(ctx, messages, rec.ReactOption(agentCfg.Name))
 	if err != nil {
-		return nil, fmt.Errorf("react agent generate: %w", err)
+		return fmt.Errorf("react agent stream: %w", err)
+	}
+
+	// Forward the answer as the streamed message of the agent
+	var answer *schema.Message
+	err = supervisor.StreamMessage(ctx, &adk.AgentEvent{
+		AgentName: agentCfg.Name,
+		Output: &adk.AgentOutput{
+			MessageOutput: &adk.MessageVariant{IsStreaming: true, MessageStream: stream, Role: schema.Assistant},
+		},
+	}, func(event *supervisor.Event) error {
+		if event.MessageDone {
+			answer = event.Message()
+		}
+		return callback(event)
+	})
+	if err != nil {
+		return err
 	}
 
-	return &RunResponse{
-		Content: resp.Content,
-		RunID:   uuid.New().String(),
-	}, nil
+	if answer != nil {
+		content, data, err := s.structureOutput(ctx, agentCfg.Provider, out, answer.Content)
+		if err != nil {
+			return err
+		}
+		if data != nil {
+			if err := callback(outputEvent(agentCfg.Name, data)); err != nil {
+				return err
+			}
+		}
+		s.saveAgentMemory(ctx, projectID, &agentReq, agentCfg, content)
+		provider, modelName, _ := llm.AnsweredBy(answer)
+		rec.SetOutput(content, provider, modelName)
+	}
+	return nil
 }
 
-// RunWithReactAgentAndMemory runs ReAct agent with session memory support
-func (s *RuntimeService) RunWithReactAgentAndMemory(ctx context.Context, projectID uuid.UUID, agentID string, message string, instruction string, tools []einoTool.BaseTool, sessionID string, enableMemory bool) (*RunResponse, error) {
+// startAgentRun starts the run of a single agent and scopes its usage
+func (s *RuntimeService) startAgentRun(ctx context.Context, projectID uuid.UUID, req *RunRequest) (context.Context, *runs.Recorder, func(context.Context, error)) {
+	agentID := *req.AgentID
+	var sessionID string
+	if req.SessionID != nil {
+		sessionID = *req.SessionID
+	}
+
+	ctx, rec, finish := s.startRun(ctx, &runs.Record{
+		ID:        req.RunID,
+		ProjectID: projectID,
+		Kind:      runs.KindAgent,
+		SessionID: sessionID,
+		VisitorID: req.VisitorID,
+		Input:     inputText(req),
+		Params:    paramsSnapshot(req.Params),
+	})
+	rec.SetTeam(nil, []string{agentID})
+
+	scope := &usage.Scope{ProjectID: projectID, SessionID: sessionID, RequestID: rec.ID()}
+	if id, err := uuid.Parse(agentID); err == nil {
+		scope.AgentID = &id
+	}
+	return usage.WithScope(ctx, scope), rec, finish
+}
+
+// prepareReactAgent builds the ReAct agent of the request and the messages it
+// runs with: system prompt, history and the request message. The agent answers
+// as out when it is set.
+func (s *RuntimeService) prepareReactAgent(ctx context.Context, projectID uuid.UUID, req *RunRequest, instruction string, tools []einoTool.BaseTool, out *structured.Schema, rec *runs.Recorder) (*react.Agent, *agent.AgentConfig, []*schema.Message, error) {
 	// Get provider config
 	providerCfg, err := s.getDefaultProviderConfig(ctx, projectID)
 	if err != nil {
-		return nil, fmt.Errorf("get provider config: %w", err)
+		return nil, nil, nil, fmt.Errorf("get provider config: %w", err)
+	}
+	providerCfg = providerCfg.WithParams(req.Params).WithOutput(out.Output())
+
+	// Facts about the visitor from previous sessions, and the tool to remember new ones
+	facts := s.visitorFactsInstruction(ctx, projectID, req.VisitorID, inputText(req))
+	if req.VisitorID != nil {
+		tools = append(append([]einoTool.BaseTool{}, tools...), s.rememberVisitorFactTool(projectID, *req.VisitorID))
+		facts += rememberVisitorFactInstruction
 	}
 
 	// Build ReAct agent config
 	agentCfg := &agent.AgentConfig{
 		Name:        "assistant",
 		Description: "AI assistant with knowledge base tools",
-		Instruction: instruction,
+		Instruction: instruction + facts,
 		Provider:    providerCfg,
-		Tools:       tools,
+		Tools:       withReplayedTools(ctx, tools),
 	}
 
 	// Create ReAct agent
 	reactAgent, err := s.agentBuilder.BuildReactAgent(ctx, agentCfg)
 	if err != nil {
-		return nil, fmt.Errorf("build react agent: %w", err)
+		return nil, nil, nil, fmt.Errorf("build react agent: %w", err)
 	}
+	rec.SetConfig("agent", agentCfg.Snapshot(ctx))
 
 	// Build messages with system instruction
 	var messages []*schema.Message
@@ -270,60 +614,70 @@ func (s *RuntimeService) RunWithReactAgentAndMemory(ctx context.Context, project
 	} else {
 		systemPrompt += "\n\nIMPORTANT: You have access to knowledge base search tools. When answering questions, ALWAYS use the search tools to find relevant information before responding."
 	}
+	systemPrompt += facts
+	if extra := outputInstruction(req.Instruction, out); extra != "" {
+		systemPrompt += "\n\n" + extra
+	}
 	messages = append(messages, schema.SystemMessage(systemPrompt))
 
 	// Add conversation history if memory is enabled
-	if enableMemory && sessionID != "" {
-		memMgr := s.GetMemoryManager(projectID, true)
-		history, err := memMgr.GetWindowedHistory(ctx, sessionID)
+	var history []*schema.Message
+	sessionID := ""
+	if req.SessionID != nil {
+		sessionID = *req.SessionID
+	}
+	if req.EnableMemory && sessionID != "" {
+		memMgr := s.windowedMemoryManager(ctx, projectID, agentCfg)
+		history, err = memMgr.GetWindowedHistory(ctx, sessionID)
 		if err != nil {
 			log.Printf("[WARN] Failed to get history: %v", err)
 		} else if len(history) > 0 {
 			log.Printf("[DEBUG] Loaded %d messages from session %s", len(history), sessionID)
-			messages = append(messages, history...)
 		}
 	}
+	if req.History != nil {
+		history = req.History
+	}
+	if replay := runs.ReplayFromContext(ctx); replay != nil {
+		history = replay.History
+	}
+	rec.SetHistory(history)
+	messages = append(messages, history...)
 
 	// Add current user message
-	messages = append(messages, schema.UserMessage(message))
+	messages = append(messages, s.userMessage(ctx, projectID, req, providerCfg.SupportsVision()))
 
-	log.Printf("[DEBUG] Running ReAct agent with %d messages (memory=%v, session=%s)", len(messages), enableMemory, sessionID)
+	log.Printf("[DEBUG] Running ReAct agent with %d messages (memory=%v, session=%s)", len(messages), req.EnableMemory, sessionID)
+	return reactAgent, agentCfg, messages, nil
+}
 
-	// Run agent
-	resp, err := reactAgent.Generate(ctx, messages)
-	if err != nil {
-		return nil, fmt.Errorf("react agent generate: %w", err)
+// saveAgentMemory stores the exchange of an agent run in the session memory
+func (s *RuntimeService) saveAgentMemory(ctx context.Context, projectID uuid.UUID, req *RunRequest, agentCfg *agent.AgentConfig, answer string) {
+	if !req.EnableMemory || req.SessionID == nil || *req.SessionID == "" {
+		return
 	}
-
-	// Save to memory if enabled
-	if enableMemory && sessionID != "" {
-		memMgr := s.GetMemoryManager(projectID, true)
-		if err := memMgr.AddUserMessage(ctx, sessionID, message); err != nil {
-			log.Printf("[WARN] Failed to save user message: %v", err)
-		}
-		if err := memMgr.AddAssistantMessage(ctx, sessionID, resp.Content); err != nil {
-			log.Printf("[WARN] Failed to save assistant message: %v", err)
-		}
+	sessionID := *req.SessionID
+	memMgr := s.windowedMemoryManager(ctx, projectID, agentCfg)
+	if err := memMgr.AddUserMessage(ctx, sessionID, inputText(req)); err != nil {
+		log.Printf("[WARN] Failed to save user message: %v", err)
 	}
-
-	return &RunResponse{
-		Content: resp.Content,
-		RunID:   uuid.New().String(),
-	}, nil
+	if err := memMgr.AddAssistantMessage(ctx, sessionID, answer); err != nil {
+		log.Printf("[WARN] Failed to save assistant message: %v", err)
+	}
+	s.scheduleVisitorExtraction(projectID, req.VisitorID, sessionID)
 }
 
-// RunWithAgentTools loads agent's tools and runs using ReAct pattern
-func (s *RuntimeService) RunWithAgentTools(ctx context.Context, projectID uuid.UUID, agentID string, message string, sessionID string, enableMemory bool) (*RunResponse, error) {
-	// Get agent with collections
+// loadAgentTools returns an agent with the RAG tools of its collections
+func (s *RuntimeService) loadAgentTools(ctx context.Context, agentID string) (*model.Agent, []einoTool.BaseTool, error) {
 	agentUUID, err := uuid.Parse(agentID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid agent_id: %w", err)
+		return nil, nil, fmt.Errorf("invalid agent_id: %w", err)
 	}
 
 	// Query agent and its collections from database
 	var dbAgent model.Agent
 	if err := s.db.WithContext(ctx).Where("id = ?", agentUUID).First(&dbAgent).Error; err != nil {
-		return nil, fmt.Errorf("agent not found: %w", err)
+		return nil, nil, fmt.Errorf("agent not found: %w", err)
 	}
 
 	// Load agent's collections
@@ -344,21 +698,223 @@ func (s *RuntimeService) RunWithAgentTools(ctx context.Context, projectID uuid.U
 	} else {
 		log.Printf("[DEBUG] Loaded %d RAG tools", len(tools))
 	}
+	// Single agent runs are not checkpointed and cannot wait for approvals
+	tools = s.refuseAgentApprovals(ctx, dbAgent.ProjectID, dbAgent.ID, tools)
+	return &dbAgent, tools, nil
+}
+
+// RunWithAgentTools loads agent's tools and runs using ReAct pattern
+func (s *RuntimeService) RunWithAgentTools(ctx context.Context, projectID uuid.UUID, agentID string, message string, sessionID string, enableMemory bool, params *llm.GenerationParams) (*RunResponse, error) {
+	return s.RunAgent(ctx, projectID, &RunRequest{
+		AgentID:      &agentID,
+		Message:      message,
+		SessionID:    &sessionID,
+		EnableMemory: enableMemory,
+		Params:       params,
+	})
+}
+
+// RunAgent runs the agent of the request with its tools using ReAct pattern
+func (s *RuntimeService) RunAgent(ctx context.Context, projectID uuid.UUID, req *RunRequest) (*RunResponse, error) {
+	dbAgent, tools, err := s.loadAgentTools(ctx, *req.AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	agentReq := *req
+	agentReq.Params = parseGenerationParams(dbAgent.Config).Merge(req.Params)
+	if err := withOutputSchema(&agentReq, dbAgent.Config); err != nil {
+		return nil, err
+	}
 
 	// If no tools, fall back to regular run
 	if len(tools) == 0 {
 		log.Printf("[DEBUG] No tools loaded, falling back to regular run")
-		return s.Run(ctx, projectID, &RunRequest{Message: message, SessionID: &sessionID, EnableMemory: enableMemory})
+		agentReq.AgentID = nil
+		return s.Run(ctx, projectID, &agentReq)
 	}
 
-	// Use RunWithReactAgent with memory support
-	return s.RunWithReactAgentAndMemory(ctx, projectID, agentID, message, dbAgent.Instruction, tools, sessionID, enableMemory)
+	// Run the ReAct agent with memory support
+	return s.RunWithReactAgentAndMemory(ctx, projectID, &agentReq, dbAgent.Instruction, tools)
+}
+
+// RunWithClientTools answers the request with a single model call that may
+// call the tools declared by the caller, which runs them itself. The agent of
+// the request, if any, provides the model and instruction.
+func (s *RuntimeService) RunWithClientTools(ctx context.Context, projectID uuid.UUID, req *RunRequest) (_ *RunResponse, err error) {
+	if err := s.checkBudget(ctx, projectID); err != nil {
+		return nil, err
+	}
+
+	providerCfg, err := s.getDefaultProviderConfig(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("get provider config: %w", err)
+	}
+	params := req.Params
+	instruction := req.Instruction
+	var agentConfig model.JSONMap
+	record := &runs.Record{
+		ID:        req.RunID,
+		ProjectID: projectID,
+		Kind:      runs.KindCompletion,
+		Input:     inputText(req),
+		Params:    paramsSnapshot(params),
+	}
+	scope := &usage.Scope{ProjectID: projectID}
+	var agentIDs []string
+	if req.AgentID != nil && *req.AgentID != "" {
+		agentUUID, err := uuid.Parse(*req.AgentID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent_id: %w", err)
+		}
+		var dbAgent model.Agent
+		if err := s.db.WithContext(ctx).Where("id = ? AND project_id = ?", agentUUID, projectID).First(&dbAgent).Error; err != nil {
+			return nil, fmt.Errorf("agent not found: %w", err)
+		}
+		providerCfg = s.withFallbacks(ctx, projectID, providerCfg, dbAgent.Config)
+		params = parseGenerationParams(dbAgent.Config).Merge(params)
+		instruction = strings.TrimSpace(dbAgent.Instruction + "\n\n" + instruction)
+		agentConfig = dbAgent.Config
+		scope.AgentID = &agentUUID
+		agentIDs = []string{agentUUID.String()}
+	}
+	out, err := outputSchema(req, agentConfig)
+	if err != nil {
+		return nil, err
+	}
+	instruction = outputInstruction(instruction, out)
+	providerCfg = providerCfg.WithParams(params).WithOutput(out.Output())
+
+	ctx, rec, finish := s.startRun(ctx, record)
+	defer func() {
+		err = runError(ctx, err)
+		finish(ctx, err)
+	}()
+	rec.SetTeam(nil, agentIDs)
+	rec.SetHistory(req.History)
+	rec.SetConfig("provider", providerCfg.Snapshot())
+	scope.RequestID = rec.ID()
+	ctx = usage.WithScope(ctx, scope)
+	ctx, counter := usage.WithCounter(ctx)
+
+	chatModel, err := s.llmFactory.CreateToolCalling(ctx, providerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create chat model: %w", err)
+	}
+
+	var opts []einoModel.Option
+	choice := req.ToolChoice
+	if choice == nil {
+		choice = &ToolChoice{Mode: ToolChoiceAuto}
+	}
+	if choice.Mode != ToolChoiceNone {
+		tools := req.Tools
+		if choice.Function != "" {
+			tools = nil
+			for _, t := range req.Tools {
+				if t.Name == choice.Function {
+					tools = append(tools, t)
+				}
+			}
+			if len(tools) == 0 {
+				return nil, fmt.Errorf("tool_choice function %q is not declared", choice.Function)
+			}
+		}
+		chatModel, err = chatModel.WithTools(tools)
+		if err != nil {
+			return nil, fmt.Errorf("bind tools: %w", err)
+		}
+		if choice.Mode == ToolChoiceRequired || choice.Function != "" {
+			opts = append(opts, einoModel.WithToolChoice(schema.ToolChoiceForced))
+		}
+	}
+
+	var messages []*schema.Message
+	if instruction != "" {
+		messages = append(messages, schema.SystemMessage(instruction))
+	}
+	messages = append(messages, req.History...)
+	if req.Message != "" || len(req.Attachments) > 0 {
+		messages = append(messages, s.userMessage(ctx, projectID, req, providerCfg.SupportsVision()))
+	}
+
+	msg, err := chatModel.Generate(ctx, messages, opts...)
+	if err != nil {
+		return nil, err
+	}
+	rec.ObserveMessage("assistant", msg)
+
+	// Calls of the caller tools are answered before the final answer
+	content := msg.Content
+	var data json.RawMessage
+	if len(msg.ToolCalls) == 0 {
+		if content, data, err = s.structureOutput(ctx, providerCfg, out, msg.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	provider, modelName, _ := llm.AnsweredBy(msg)
+	rec.SetOutput(content, provider, modelName)
+	return &RunResponse{
+		Content:   content,
+		RunID:     rec.ID(),
+		Provider:  provider,
+		Model:     modelName,
+		Usage:     counter.Usage(),
+		ToolCalls: msg.ToolCalls,
+		Data:      data,
+	}, nil
+}
+
+// ListCompletionTargets returns the enabled agents and teams of the project,
+// which the OpenAI-compatible API exposes as models
+func (s *RuntimeService) ListCompletionTargets(ctx context.Context, projectID uuid.UUID) ([]model.Agent, []model.Team, error) {
+	var agents []model.Agent
+	if err := s.db.WithContext(ctx).Where("project_id = ? AND is_enabled = ?", projectID, true).Order("created_at").Find(&agents).Error; err != nil {
+		return nil, nil, err
+	}
+	var teams []model.Team
+	if err := s.db.WithContext(ctx).Where("project_id = ? AND is_enabled = ?", projectID, true).Order("created_at").Find(&teams).Error; err != nil {
+		return nil, nil, err
+	}
+	return agents, teams, nil
+}
+
+// withInstruction prepends the caller instruction to the history as a system
+// message
+func withInstruction(history []*schema.Message, instruction string) []*schema.Message {
+	if instruction == "" {
+		return history
+	}
+	return append([]*schema.Message{schema.SystemMessage(instruction)}, history...)
 }
 
 // RunWithQueryAnalyzer 使用 QueryAnalyzer 智能路由查询
-// 首先分析查询意图和复杂度，然后选择合适的执行策略
-func (s *RuntimeService) RunWithQueryAnalyzer(ctx context.Context, projectID uuid.UUID, message string) (*RunResponse, error) {
+// 会话的窗口历史用于将追问改写为独立问题，Agent 使用改写后的问题执行
+func (s *RuntimeService) RunWithQueryAnalyzer(ctx context.Context, projectID uuid.UUID, req *RunRequest) (_ *RunResponse, err error) {
+	message, params := req.Message, req.Params
 	log.Printf("[RunWithQueryAnalyzer] Starting analysis for: %s", message)
+	if err := s.checkBudget(ctx, projectID); err != nil {
+		return nil, err
+	}
+	var sessionID string
+	if req.SessionID != nil {
+		sessionID = *req.SessionID
+	}
+	ctx, rec, finish := s.startRun(ctx, &runs.Record{
+		ID:        req.RunID,
+		ProjectID: projectID,
+		Kind:      runs.KindAnalyzer,
+		SessionID: sessionID,
+		VisitorID: req.VisitorID,
+		Input:     message,
+		Params:    paramsSnapshot(params),
+	})
+	defer func() {
+		err = runError(ctx, err)
+		finish(ctx, err)
+	}()
+	ctx, _ = usage.WithCounter(ctx)
 
 	// 1. 获取项目的默认 provider 配置
 	providerCfg, err := s.getDefaultProviderConfig(ctx, projectID)
@@ -378,74 +934,149 @@ func (s *RuntimeService) RunWithQueryAnalyzer(ctx context.Context, projectID uui
 		return nil, fmt.Errorf("get default team: %w", err)
 	}
 
-	// 构建 Agent 简介列表
-	agentProfiles := make([]orchestration.AgentProfile, 0, len(team.Agents))
-	for _, a := range team.Agents {
-		agentProfiles = append(agentProfiles, orchestration.AgentProfile{
-			ID:          a.ID.String(),
-			Name:        a.Name,
-			Description: a.Description,
+	ctx = teamUsageScope(ctx, projectID, team, sessionID, rec.ID())
+	rec.SetTeam(&team.ID, teamAgentIDs(team))
+
+	// 4. 加载会话的窗口历史
+	var memMgr *memory.Manager
+	var history []*schema.Message
+	if req.EnableMemory && sessionID != "" {
+		memMgr = s.windowedMemoryManager(ctx, projectID, &agent.AgentConfig{
+			Instruction: orchestration.QueryRewritePrompt,
+			Provider:    providerCfg,
 		})
+		history, _ = memMgr.GetWindowedHistory(ctx, sessionID)
 	}
-
-	// 4. 创建 QueryAnalyzer 并分析
-	analyzer := orchestration.NewQueryAnalyzer(chatModel)
-	analysisCtx := &orchestration.AnalysisContext{
-		ProjectID:       projectID.String(),
-		UserQuery:       message,
-		AvailableAgents: agentProfiles,
+	if replay := runs.ReplayFromContext(ctx); replay != nil {
+		history = replay.History
 	}
+	rec.SetHistory(history)
 
+	// 5. 创建 QueryAnalyzer 并分析
+	analyzer := s.newQueryAnalyzer(ctx, projectID, chatModel)
+	analysisCtx := analysisContext(projectID, team, message)
+	analysisCtx.SessionID = sessionID
+	analysisCtx.History = history
 	result, err := analyzer.Analyze(ctx, analysisCtx)
 	if err != nil {
 		log.Printf("[QueryAnalyzer] Analysis failed: %v, falling back to default", err)
 		// 降级到默认处理
-		return s.Run(ctx, projectID, &RunRequest{Message: message})
+		return s.Run(ctx, projectID, &RunRequest{Message: message, SessionID: req.SessionID, EnableMemory: req.EnableMemory, VisitorID: req.VisitorID, Params: params, Attachments: req.Attachments})
 	}
 
 	log.Printf("[QueryAnalyzer] Result: workflow=%s, agents=%v, is_complex=%v, confidence=%.2f",
 		result.Workflow, result.SelectedAgentIDs, result.IsComplex, result.ConfidenceScore)
+	rec.SetConfig("analysis", result)
+
+	// 追问改写为独立问题后，Agent 无需会话历史即可回答
+	query := message
+	if result.RewrittenQuery != "" {
+		query = result.RewrittenQuery
+	}
+	// 重放时 Agent 同样不带会话历史执行，与原运行一致
+	agentCtx := withoutReplayHistory(ctx)
 
-	// 5. 根据分析结果执行
+	// 6. 根据分析结果执行
+	var resp *RunResponse
 	switch result.Workflow {
 	case orchestration.WorkflowSingle:
 		// 单 Agent 执行
-		if len(result.SelectedAgentIDs) > 0 {
-			return s.RunWithAgentTools(ctx, projectID, result.SelectedAgentIDs[0], message, "", false)
+		if len(result.SelectedAgentIDs) == 0 {
+			return s.Run(ctx, projectID, &RunRequest{Message: message, SessionID: req.SessionID, EnableMemory: req.EnableMemory, VisitorID: req.VisitorID, Params: params, Attachments: req.Attachments})
 		}
-		return s.Run(ctx, projectID, &RunRequest{Message: message})
+		// 改写后的问题不带会话历史，访客与附件随请求传递
+		resp, err = s.RunAgent(agentCtx, projectID, &RunRequest{
+			AgentID:      &result.SelectedAgentIDs[0],
+			Message:      query,
+			VisitorID:    req.VisitorID,
+			Params:       params,
+			Instruction:  req.Instruction,
+			OutputSchema: req.OutputSchema,
+			Attachments:  req.Attachments,
+		})
 
-	case orchestration.WorkflowParallel, orchestration.WorkflowSequential:
-		// 并行/串行多 Agent 执行
-		return s.executeMultiAgent(ctx, projectID, result, message)
+	case orchestration.WorkflowParallel, orchestration.WorkflowSequential,
+		orchestration.WorkflowHierarchical, orchestration.WorkflowPipeline:
+		// 多 Agent 执行
+		resp, err = s.executeMultiAgent(agentCtx, projectID, result, query, params)
 
 	default:
-		return s.Run(ctx, projectID, &RunRequest{Message: message})
+		return s.Run(ctx, projectID, &RunRequest{Message: message, SessionID: req.SessionID, EnableMemory: req.EnableMemory, VisitorID: req.VisitorID, Params: params, Attachments: req.Attachments})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 7. 保存原问题与回答，供后续追问使用
+	if memMgr != nil {
+		_ = memMgr.AddUserMessage(ctx, sessionID, message)
+		if resp.Content != "" {
+			_ = memMgr.AddAssistantMessage(ctx, sessionID, resp.Content)
+		}
+		s.scheduleVisitorExtraction(projectID, req.VisitorID, sessionID)
+	}
+	return resp, nil
+}
+
+// newQueryAnalyzer 创建使用项目意图规则的 QueryAnalyzer
+func (s *RuntimeService) newQueryAnalyzer(ctx context.Context, projectID uuid.UUID, chatModel einoModel.ChatModel) *orchestration.QueryAnalyzer {
+	analyzer := orchestration.NewQueryAnalyzer(chatModel)
+	if s.intentRules == nil {
+		return analyzer
+	}
+	router, err := s.intentRules.Router(ctx, projectID)
+	if err != nil {
+		log.Printf("[QueryAnalyzer] Failed to load intent rules of project %s: %v, using built-in rules", projectID, err)
+		return analyzer
+	}
+	analyzer.SetIntentRouter(router)
+	return analyzer
+}
+
+// analysisContext 构建分析上下文，可用 Agent 为团队的 Agent
+func analysisContext(projectID uuid.UUID, team *model.Team, message string) *orchestration.AnalysisContext {
+	agentProfiles := make([]orchestration.AgentProfile, 0, len(team.Agents))
+	for _, a := range team.Agents {
+		agentProfiles = append(agentProfiles, orchestration.AgentProfile{
+			ID:          a.ID.String(),
+			Name:        a.Name,
+			Description: a.Description,
+		})
+	}
+	return &orchestration.AnalysisContext{
+		ProjectID:       projectID.String(),
+		UserQuery:       message,
+		AvailableAgents: agentProfiles,
 	}
 }
 
 // executeMultiAgent 执行多 Agent 工作流（按 eino-examples 最佳实践）
-func (s *RuntimeService) executeMultiAgent(ctx context.Context, projectID uuid.UUID, analysis *orchestration.QueryAnalysisResult, message string) (*RunResponse, error) {
+func (s *RuntimeService) executeMultiAgent(ctx context.Context, projectID uuid.UUID, analysis *orchestration.QueryAnalysisResult, message string, params *llm.GenerationParams) (*RunResponse, error) {
 	log.Printf("[MultiAgent] Starting %s execution with %d agents (eino ADK)", analysis.Workflow, len(analysis.SelectedAgentIDs))
 
+	// 分层、流水线以及带有执行计划的工作流按依赖分组执行子问题
+	if hasExecutionPlan(analysis) {
+		return s.executeDAG(ctx, projectID, analysis, message, params)
+	}
+
 	// 根据工作流类型选择执行方式（全部使用 eino ADK）
 	switch analysis.Workflow {
 	case orchestration.WorkflowParallel:
-		return s.executeParallelWithEino(ctx, projectID, analysis, message)
-	case orchestration.WorkflowSequential, orchestration.WorkflowHierarchical, orchestration.WorkflowPipeline:
-		return s.executeSequentialWithEino(ctx, projectID, analysis, message)
+		return s.executeParallelWithEino(ctx, projectID, analysis, message, params)
+	case orchestration.WorkflowSequential:
+		return s.executeSequentialWithEino(ctx, projectID, analysis, message, params)
 	default:
 		// 默认使用并行执行
-		return s.executeParallelWithEino(ctx, projectID, analysis, message)
+		return s.executeParallelWithEino(ctx, projectID, analysis, message, params)
 	}
 }
 
 // executeParallelWithEino 使用 eino NewParallelAgent 并行执行
-func (s *RuntimeService) executeParallelWithEino(ctx context.Context, projectID uuid.UUID, analysis *orchestration.QueryAnalysisResult, message string) (*RunResponse, error) {
+func (s *RuntimeService) executeParallelWithEino(ctx context.Context, projectID uuid.UUID, analysis *orchestration.QueryAnalysisResult, message string, params *llm.GenerationParams) (*RunResponse, error) {
 	log.Printf("[MultiAgent] Parallel execution with eino NewParallelAgent")
 
 	// 1. 构建所有子 Agent
-	subAgents, err := s.buildSubAgents(ctx, projectID, analysis.SelectedAgentIDs)
+	subAgents, err := s.buildSubAgents(ctx, projectID, analysis.SelectedAgentIDs, params)
 	if err != nil {
 		return nil, fmt.Errorf("build sub agents: %w", err)
 	}
@@ -475,6 +1106,7 @@ func (s *RuntimeService) executeParallelWithEino(ctx context.Context, projectID
 		if !ok {
 			break
 		}
+		runs.Observe(ctx, event)
 		if event.Err != nil {
 			lastErr = event.Err
 			continue
@@ -490,18 +1122,20 @@ func (s *RuntimeService) executeParallelWithEino(ctx context.Context, projectID
 
 	log.Printf("[MultiAgent] Parallel execution completed, result length: %d", len(lastMsg.Content))
 
+	_, counter := usage.WithCounter(ctx)
 	return &RunResponse{
 		Content: lastMsg.Content,
-		RunID:   orchestration.GenerateRunID(),
+		RunID:   runID(ctx),
+		Usage:   counter.Usage(),
 	}, nil
 }
 
 // executeSequentialWithEino 使用 eino supervisor 串行执行
-func (s *RuntimeService) executeSequentialWithEino(ctx context.Context, projectID uuid.UUID, analysis *orchestration.QueryAnalysisResult, message string) (*RunResponse, error) {
+func (s *RuntimeService) executeSequentialWithEino(ctx context.Context, projectID uuid.UUID, analysis *orchestration.QueryAnalysisResult, message string, params *llm.GenerationParams) (*RunResponse, error) {
 	log.Printf("[MultiAgent] Sequential execution with eino Supervisor")
 
 	// 1. 构建所有子 Agent
-	subAgents, err := s.buildSubAgents(ctx, projectID, analysis.SelectedAgentIDs)
+	subAgents, err := s.buildSubAgents(ctx, projectID, analysis.SelectedAgentIDs, params)
 	if err != nil {
 		return nil, fmt.Errorf("build sub agents: %w", err)
 	}
@@ -512,7 +1146,7 @@ func (s *RuntimeService) executeSequentialWithEino(ctx context.Context, projectI
 		return nil, fmt.Errorf("get provider config: %w", err)
 	}
 
-	supervisorModel, err := s.llmFactory.CreateToolCalling(ctx, providerCfg)
+	supervisorModel, err := s.llmFactory.CreateToolCalling(ctx, providerCfg.WithParams(params))
 	if err != nil {
 		return nil, fmt.Errorf("create supervisor model: %w", err)
 	}
@@ -553,6 +1187,7 @@ func (s *RuntimeService) executeSequentialWithEino(ctx context.Context, projectI
 		if !ok {
 			break
 		}
+		runs.Observe(ctx, event)
 		if event.Err != nil {
 			lastErr = event.Err
 			continue
@@ -568,14 +1203,108 @@ func (s *RuntimeService) executeSequentialWithEino(ctx context.Context, projectI
 
 	log.Printf("[MultiAgent] Sequential execution completed, result length: %d", len(lastMsg.Content))
 
+	_, counter := usage.WithCounter(ctx)
 	return &RunResponse{
 		Content: lastMsg.Content,
-		RunID:   orchestration.GenerateRunID(),
+		RunID:   runID(ctx),
+		Usage:   counter.Usage(),
+	}, nil
+}
+
+// hasExecutionPlan 判断分析结果是否需要按依赖分组执行
+func hasExecutionPlan(analysis *orchestration.QueryAnalysisResult) bool {
+	switch analysis.Workflow {
+	case orchestration.WorkflowHierarchical, orchestration.WorkflowPipeline:
+		return true
+	}
+	plan := analysis.ExecutionPlan
+	return plan != nil && (len(plan.Dependencies) > 0 || len(plan.ParallelGroups) > 0)
+}
+
+// executeDAG 按 ExecutionPlan 的依赖分组执行子问题，并用 ResultConsolidator 聚合结果
+func (s *RuntimeService) executeDAG(ctx context.Context, projectID uuid.UUID, analysis *orchestration.QueryAnalysisResult, message string, params *llm.GenerationParams) (*RunResponse, error) {
+	log.Printf("[MultiAgent] %s execution with DAG executor", analysis.Workflow)
+
+	providerCfg, err := s.getDefaultProviderConfig(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("get provider config: %w", err)
+	}
+	consolidatorModel, err := s.llmFactory.CreateChatModel(ctx, providerCfg.WithParams(params))
+	if err != nil {
+		return nil, fmt.Errorf("create consolidator model: %w", err)
+	}
+
+	runStep := func(ctx context.Context, agentID, question string) (string, error) {
+		return s.runSubAgent(ctx, projectID, agentID, question, params)
+	}
+	executor := orchestration.NewDAGExecutor(runStep, orchestration.NewResultConsolidator(consolidatorModel))
+	result, err := executor.Execute(ctx, analysis, message)
+	if err != nil {
+		return nil, err
+	}
+	if rec := runs.RecorderFromContext(ctx); rec != nil {
+		rec.SetConfig("steps", result.Steps)
+	}
+
+	log.Printf("[MultiAgent] DAG execution completed with %d steps, result length: %d", len(result.Steps), len(result.Content))
+
+	_, counter := usage.WithCounter(ctx)
+	return &RunResponse{
+		Content: result.Content,
+		RunID:   runID(ctx),
+		Usage:   counter.Usage(),
+		Steps:   result.Steps,
 	}, nil
 }
 
+// runSubAgent 使用单个 Agent 回答一个子问题
+func (s *RuntimeService) runSubAgent(ctx context.Context, projectID uuid.UUID, agentIDStr, question string, params *llm.GenerationParams) (string, error) {
+	agentID, err := uuid.Parse(agentIDStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid agent ID %q", agentIDStr)
+	}
+	agentCfg, err := s.buildAgentConfig(ctx, projectID, agentID, params)
+	if err != nil {
+		return "", fmt.Errorf("build agent config: %w", err)
+	}
+	return s.runAgentConfig(ctx, agentCfg, []*schema.Message{schema.UserMessage(question)})
+}
+
+// runAgentConfig 使用 Agent 配置回答对话，返回最后一条消息的内容
+func (s *RuntimeService) runAgentConfig(ctx context.Context, agentCfg *agent.AgentConfig, messages []*schema.Message) (string, error) {
+	subAgent, err := s.agentBuilder.Build(ctx, agentCfg)
+	if err != nil {
+		return "", fmt.Errorf("build agent: %w", err)
+	}
+
+	runner := adk.NewRunner(ctx, adk.RunnerConfig{
+		EnableStreaming: false,
+		Agent:           subAgent,
+	})
+
+	iter := runner.Run(ctx, messages)
+	var lastMsg adk.Message
+	for {
+		event, ok := iter.Next()
+		if !ok {
+			break
+		}
+		runs.Observe(ctx, event)
+		if event.Err != nil {
+			return "", event.Err
+		}
+		if event.Output != nil {
+			lastMsg, _, _ = adk.GetMessage(event)
+		}
+	}
+	if lastMsg == nil {
+		return "", fmt.Errorf("agent returned no answer")
+	}
+	return lastMsg.Content, nil
+}
+
 // buildSubAgents 构建子 Agent 列表
-func (s *RuntimeService) buildSubAgents(ctx context.Context, projectID uuid.UUID, agentIDs []string) ([]adk.Agent, error) {
+func (s *RuntimeService) buildSubAgents(ctx context.Context, projectID uuid.UUID, agentIDs []string, params *llm.GenerationParams) ([]adk.Agent, error) {
 	subAgents := make([]adk.Agent, 0, len(agentIDs))
 
 	for _, agentIDStr := range agentIDs {
@@ -586,7 +1315,7 @@ func (s *RuntimeService) buildSubAgents(ctx context.Context, projectID uuid.UUID
 		}
 
 		// 获取 Agent 配置
-		agentCfg, err := s.buildAgentConfig(ctx, projectID, agentID)
+		agentCfg, err := s.buildAgentConfig(ctx, projectID, agentID, params)
 		if err != nil {
 			log.Printf("[MultiAgent] Failed to build agent config for %s: %v, skipping", agentIDStr, err)
 			continue
@@ -624,7 +1353,7 @@ INSTRUCTIONS:
 }
 
 // buildAgentConfig 构建 Agent 配置（用于 eino ADK）
-func (s *RuntimeService) buildAgentConfig(ctx context.Context, projectID uuid.UUID, agentID uuid.UUID) (*agent.AgentConfig, error) {
+func (s *RuntimeService) buildAgentConfig(ctx context.Context, projectID uuid.UUID, agentID uuid.UUID, params *llm.GenerationParams) (*agent.AgentConfig, error) {
 	// 1. 查询 Agent
 	var dbAgent model.Agent
 	if err := s.db.WithContext(ctx).Where("id = ?", agentID).First(&dbAgent).Error; err != nil {
@@ -636,6 +1365,9 @@ func (s *RuntimeService) buildAgentConfig(ctx context.Context, projectID uuid.UU
 	if err != nil {
 		return nil, fmt.Errorf("get provider config: %w", err)
 	}
+	// Agent level failover settings take precedence over the project ones
+	providerCfg = s.withFallbacks(ctx, projectID, providerCfg, dbAgent.Config)
+	providerCfg = providerCfg.WithParams(parseGenerationParams(dbAgent.Config)).WithParams(params)
 
 	// 3. 加载 RAG 工具
 	var collections []model.AgentCollection
@@ -655,16 +1387,175 @@ func (s *RuntimeService) buildAgentConfig(ctx context.Context, projectID uuid.UU
 			tools = append(tools, ragTools...)
 		}
 	}
+	// Sub-agents of the analyzer and consensus runs cannot wait for approvals
+	tools = s.refuseAgentApprovals(ctx, projectID, agentID, tools)
 
 	return &agent.AgentConfig{
 		Name:        dbAgent.Name,
 		Description: dbAgent.Description,
 		Instruction: dbAgent.Instruction,
 		Provider:    providerCfg,
-		Tools:       tools,
+		Tools:       withReplayedTools(ctx, tools),
 	}, nil
 }
 
+// newProviderConfig converts a stored LLM provider into an llm.ProviderConfig
+func newProviderConfig(provider *model.LLMProvider, modelName string) *llm.ProviderConfig {
+	return &llm.ProviderConfig{
+		Kind:    llm.NormalizeProviderKind(provider.ProviderKind),
+		APIKey:  provider.APIKey,
+		Model:   modelName,
+		BaseURL: provider.APIBaseURL,
+		Options: provider.Config,
+		Timeout: time.Duration(provider.Timeout * float64(time.Second)),
+	}
+}
+
+// FallbackTarget is one entry of the "fallbacks" list in an agent, team or
+// project AI config. An empty ProviderID means the primary provider.
+type FallbackTarget struct {
+	ProviderID *uuid.UUID `json:"provider_id,omitempty"`
+	Model      string     `json:"model,omitempty"`
+}
+
+// RetryConfig is the "retry" object in an agent, team or project AI config
+type RetryConfig struct {
+	MaxRetries       *int `json:"max_retries,omitempty"`
+	InitialBackoffMs int  `json:"initial_backoff_ms,omitempty"`
+	MaxBackoffMs     int  `json:"max_backoff_ms,omitempty"`
+}
+
+const (
+	maxFallbackTargets = 5
+	maxRetries         = 5
+)
+
+// ParseFallbackConfig reads and validates the failover settings of a config map
+func ParseFallbackConfig(cfg map[string]interface{}) ([]FallbackTarget, *RetryConfig, error) {
+	var targets []FallbackTarget
+	if raw, ok := cfg["fallbacks"]; ok && raw != nil {
+		if err := decodeConfigValue(raw, &targets); err != nil {
+			return nil, nil, fmt.Errorf("invalid fallbacks: %w", err)
+		}
+		if len(targets) > maxFallbackTargets {
+			return nil, nil, fmt.Errorf("at most %d fallbacks are allowed", maxFallbackTargets)
+		}
+		for i, t := range targets {
+			if t.ProviderID == nil && t.Model == "" {
+				return nil, nil, fmt.Errorf("fallbacks[%d]: provider_id or model is required", i)
+			}
+		}
+	}
+
+	var retry *RetryConfig
+	if raw, ok := cfg["retry"]; ok && raw != nil {
+		retry = &RetryConfig{}
+		if err := decodeConfigValue(raw, retry); err != nil {
+			return nil, nil, fmt.Errorf("invalid retry: %w", err)
+		}
+		if retry.MaxRetries != nil && (*retry.MaxRetries < 0 || *retry.MaxRetries > maxRetries) {
+			return nil, nil, fmt.Errorf("retry.max_retries must be between 0 and %d", maxRetries)
+		}
+		if retry.InitialBackoffMs < 0 || retry.MaxBackoffMs < 0 {
+			return nil, nil, fmt.Errorf("retry backoff must not be negative")
+		}
+	}
+
+	return targets, retry, nil
+}
+
+func decodeConfigValue(raw interface{}, out interface{}) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// withFallbacks attaches the retry policy and fallback chain to primary. The
+// first config (agent, team, project, ...) defining "fallbacks" or "retry" wins,
+// settings already on primary are kept when no config defines them. Calls are
+// not retried unless a config defines "retry".
+func (s *RuntimeService) withFallbacks(ctx context.Context, projectID uuid.UUID, primary *llm.ProviderConfig, configs ...model.JSONMap) *llm.ProviderConfig {
+	if primary == nil {
+		return nil
+	}
+
+	var targets []FallbackTarget
+	var retryCfg *RetryConfig
+	targetsSet := false
+	for _, cfg := range configs {
+		t, r, err := ParseFallbackConfig(cfg)
+		if err != nil {
+			log.Printf("[WARN] Ignoring invalid fallback config: %v", err)
+			continue
+		}
+		if !targetsSet && cfg["fallbacks"] != nil {
+			targets, targetsSet = t, true
+		}
+		if retryCfg == nil && r != nil {
+			retryCfg = r
+		}
+	}
+
+	out := *primary
+	if retryCfg != nil {
+		retry := llm.DefaultRetryPolicy
+		if primary.Retry != nil {
+			retry = *primary.Retry
+		}
+		if retryCfg.MaxRetries != nil {
+			retry.MaxRetries = *retryCfg.MaxRetries
+		}
+		if retryCfg.InitialBackoffMs > 0 {
+			retry.InitialBackoff = time.Duration(retryCfg.InitialBackoffMs) * time.Millisecond
+		}
+		if retryCfg.MaxBackoffMs > 0 {
+			retry.MaxBackoff = time.Duration(retryCfg.MaxBackoffMs) * time.Millisecond
+		}
+		out.Retry = &retry
+	}
+	if !targetsSet {
+		return &out
+	}
+
+	out.Fallbacks = nil
+	for _, t := range targets {
+		var fb *llm.ProviderConfig
+		if t.ProviderID == nil {
+			same := *primary
+			same.Fallbacks, same.Retry = nil, nil
+			same.Model = t.Model
+			fb = &same
+		} else {
+			provider, err := s.providerRepo.GetByID(ctx, projectID, *t.ProviderID)
+			if err != nil || provider == nil || !provider.IsActive {
+				log.Printf("[WARN] Fallback provider %s unavailable, skipping", t.ProviderID)
+				continue
+			}
+			modelName := t.Model
+			if modelName == "" {
+				modelName = provider.DefaultModel
+			}
+			fb = newProviderConfig(provider, modelName)
+			fb.Params = primary.Params
+		}
+		out.Fallbacks = append(out.Fallbacks, fb)
+	}
+	return &out
+}
+
+// parseGenerationParams reads generation params stored on an agent or team.
+// Params are validated on write, so invalid values are only logged here.
+func parseGenerationParams(cfg model.JSONMap) *llm.GenerationParams {
+	params, err := llm.ParseGenerationParams(cfg)
+	if err != nil {
+		log.Printf("[WARN] Ignoring invalid generation params: %v", err)
+		return nil
+	}
+	return params
+}
+
 // getDefaultProviderConfig 获取项目的默认 provider 配置
 func (s *RuntimeService) getDefaultProviderConfig(ctx context.Context, projectID uuid.UUID) (*llm.ProviderConfig, error) {
 	aiConfig, err := s.aiConfigRepo.GetByProjectID(ctx, projectID)
@@ -680,18 +1571,24 @@ func (s *RuntimeService) getDefaultProviderConfig(ctx context.Context, projectID
 		return nil, fmt.Errorf("get provider: %w", err)
 	}
 
-	return &llm.ProviderConfig{
-		Kind:    llm.ProviderKind(provider.ProviderKind),
-		APIKey:  provider.APIKey,
-		Model:   aiConfig.DefaultChatModel,
-		BaseURL: provider.APIBaseURL,
-	}, nil
+	return s.withFallbacks(ctx, projectID, newProviderConfig(provider, aiConfig.DefaultChatModel), aiConfig.Config), nil
 }
 
-func (s *RuntimeService) Stream(ctx context.Context, projectID uuid.UUID, req *RunRequest, callback supervisor.StreamCallback) error {
+// Stream runs the agent of the request, or else its team, and calls the
+// callback for each event
+func (s *RuntimeService) Stream(ctx context.Context, projectID uuid.UUID, req *RunRequest, callback supervisor.StreamCallback) (err error) {
+	if err := s.checkBudget(ctx, projectID); err != nil {
+		return err
+	}
+	if req.AgentID != nil && *req.AgentID != "" {
+		return s.StreamAgent(ctx, projectID, req, callback)
+	}
+	if req.RequireConsensus {
+		return s.streamConsensus(ctx, projectID, req, callback)
+	}
+
 	// Get team
 	var team *model.Team
-	var err error
 
 	if req.TeamID != nil {
 		teamID, parseErr := uuid.Parse(*req.TeamID)
@@ -705,6 +1602,10 @@ func (s *RuntimeService) Stream(ctx context.Context, projectID uuid.UUID, req *R
 	if err != nil {
 		return err
 	}
+	out, err := outputSchema(req, team.Config)
+	if err != nil {
+		return err
+	}
 
 	// Setup memory if enabled
 	var memMgr *memory.Manager
@@ -712,11 +1613,22 @@ func (s *RuntimeService) Stream(ctx context.Context, projectID uuid.UUID, req *R
 	if req.SessionID != nil && *req.SessionID != "" {
 		sessionID = *req.SessionID
 	}
-	if req.EnableMemory {
-		memMgr = s.GetMemoryManager(projectID, true)
-		// Store user message
-		_ = memMgr.AddUserMessage(ctx, sessionID, req.Message)
-	}
+	ctx, rec, finish := s.startRun(ctx, &runs.Record{
+		ID:        req.RunID,
+		ProjectID: projectID,
+		Kind:      runs.KindTeam,
+		SessionID: sessionID,
+		VisitorID: req.VisitorID,
+		Input:     inputText(req),
+		Params:    paramsSnapshot(req.Params),
+	})
+	defer func() {
+		err = runError(ctx, err)
+		finish(ctx, err)
+	}()
+	rec.SetTeam(&team.ID, teamAgentIDs(team))
+
+	ctx = teamUsageScope(ctx, projectID, team, sessionID, rec.ID())
 
 	// Build team config - use service URLs, allow request to override
 	mcpURL := s.mcpURL
@@ -727,53 +1639,105 @@ func (s *RuntimeService) Stream(ctx context.Context, projectID uuid.UUID, req *R
 	if req.RAGURL != nil && *req.RAGURL != "" {
 		ragURL = *req.RAGURL
 	}
-	teamCfg := s.buildTeamConfigWithVisitor(ctx, projectID, team, mcpURL, ragURL, req.VisitorID)
+	teamCfg := s.buildTeamConfigWithVisitor(ctx, projectID, team, mcpURL, ragURL, req.VisitorID, req.Params)
+	withVisitorFacts(teamCfg, s.visitorFactsInstruction(ctx, projectID, req.VisitorID, inputText(req)))
+	rec.SetConfig("team", teamCfg.Snapshot(ctx))
+
+	var history []*schema.Message
+	if req.EnableMemory {
+		// The history is windowed to fit the supervisor and every agent
+		memMgr = s.windowedMemoryManager(ctx, projectID, teamAgents(teamCfg)...)
+		// Get history before adding new message
+		history, _ = memMgr.GetWindowedHistory(ctx, sessionID)
+		// Store user message
+		_ = memMgr.AddUserMessage(ctx, sessionID, inputText(req))
+	}
+	if req.History != nil {
+		history = req.History
+	}
+	rec.SetHistory(history)
+	history = withInstruction(history, outputInstruction(req.Instruction, out))
 
 	// Wrap callback to capture final response for memory
 	var finalContent string
-	wrappedCallback := func(event *adk.AgentEvent) error {
-		// Capture content from message output
-		if event.Output != nil && event.Output.MessageOutput != nil {
-			if msg := event.Output.MessageOutput.Message; msg != nil {
-				finalContent = msg.Content
-			}
+	var interrupts []supervisor.Interrupt
+	wrappedCallback := func(event *supervisor.Event) error {
+		if paused := supervisor.Interrupts(event.AgentEvent); len(paused) > 0 {
+			interrupts = paused
+			return nil
+		}
+		// Capture the last complete assistant message
+		if msg := event.Message(); msg != nil && !event.Delta && msg.Role == schema.Assistant && msg.Content != "" {
+			finalContent = msg.Content
 		}
 		return callback(event)
 	}
 
 	// Stream
-	err = s.runner.Stream(ctx, teamCfg, req.Message, wrappedCallback)
+	messages := append(append([]*schema.Message{}, history...), s.userMessage(ctx, projectID, req, teamCfg.SupportsVision()))
+	err = s.runner.StreamMessages(ctx, teamCfg, messages, wrappedCallback)
+
+	// The answer was streamed as generated, its structured form follows
+	if err == nil && len(interrupts) == 0 && out != nil && finalContent != "" {
+		var data json.RawMessage
+		if finalContent, data, err = s.structureOutput(ctx, teamCfg.SupervisorProvider, out, finalContent); err != nil {
+			return err
+		}
+		if err := callback(outputEvent("", data)); err != nil {
+			return err
+		}
+	}
 
 	// Store assistant response if memory enabled
 	if memMgr != nil && finalContent != "" {
 		_ = memMgr.AddAssistantMessage(ctx, sessionID, finalContent)
+		s.scheduleVisitorExtraction(projectID, req.VisitorID, sessionID)
+	}
+
+	// Tool calls wait for approval, the run resumes once staff decide them
+	if err == nil && len(interrupts) > 0 {
+		approvals, err := s.requestApprovals(ctx, runApproval(projectID, rec.ID(), team, sessionID, req), interrupts)
+		if err != nil {
+			return err
+		}
+		rec.SetOutput(approvalPendingMessage, "", "")
+		return callback(approvalEvent(approvals))
 	}
 
 	return err
 }
 
 func (s *RuntimeService) buildTeamConfig(ctx context.Context, projectID uuid.UUID, team *model.Team, mcpURL, ragURL string) *supervisor.SupervisorConfig {
-	return s.buildTeamConfigWithVisitor(ctx, projectID, team, mcpURL, ragURL, nil)
+	return s.buildTeamConfigWithVisitor(ctx, projectID, team, mcpURL, ragURL, nil, nil)
 }
 
-func (s *RuntimeService) buildTeamConfigWithVisitor(ctx context.Context, projectID uuid.UUID, team *model.Team, mcpURL, ragURL string, visitorID *uuid.UUID) *supervisor.SupervisorConfig {
+// buildTeamConfigWithVisitor builds the supervisor config of a team. Generation
+// params are layered as team config < agent config < request override.
+func (s *RuntimeService) buildTeamConfigWithVisitor(ctx context.Context, projectID uuid.UUID, team *model.Team, mcpURL, ragURL string, visitorID *uuid.UUID, params *llm.GenerationParams) *supervisor.SupervisorConfig {
 	// Get project default provider config
 	var defaultProviderCfg *llm.ProviderConfig
+	var projectConfig model.JSONMap
 	if aiConfig, err := s.aiConfigRepo.GetByProjectID(ctx, projectID); err == nil && aiConfig != nil {
+		projectConfig = aiConfig.Config
 		if aiConfig.DefaultChatProviderID != nil {
 			if provider, err := s.providerRepo.GetByID(ctx, projectID, *aiConfig.DefaultChatProviderID); err == nil && provider != nil {
-				defaultProviderCfg = &llm.ProviderConfig{
-					Kind:    llm.ProviderKind(provider.ProviderKind),
-					APIKey:  provider.APIKey,
-					Model:   aiConfig.DefaultChatModel,
-					BaseURL: provider.APIBaseURL,
-				}
+				defaultProviderCfg = newProviderConfig(provider, aiConfig.DefaultChatModel)
 			}
 		}
 	}
 
+	teamParams := parseGenerationParams(team.Config)
+
+	// Tools flagged for approval, by project tool name and per agent
+	agentIDs := make([]uuid.UUID, 0, len(team.Agents))
+	for _, a := range team.Agents {
+		agentIDs = append(agentIDs, a.ID)
+	}
+	projectApprovals, agentApprovals := s.approvalTools(ctx, projectID, agentIDs)
+
 	// Build agent configs
 	agentConfigs := make([]*agent.AgentConfig, 0, len(team.Agents))
+	var firstAgentProvider *llm.ProviderConfig
 	for _, a := range team.Agents {
 		if !a.IsEnabled {
 			continue
@@ -781,16 +1745,16 @@ func (s *RuntimeService) buildTeamConfigWithVisitor(ctx context.Context, project
 
 		var providerCfg *llm.ProviderConfig
 		if a.LLMProvider != nil {
-			providerCfg = &llm.ProviderConfig{
-				Kind:    llm.ProviderKind(a.LLMProvider.ProviderKind),
-				APIKey:  a.LLMProvider.APIKey,
-				Model:   a.LLMProvider.DefaultModel,
-				BaseURL: a.LLMProvider.APIBaseURL,
-			}
+			providerCfg = newProviderConfig(a.LLMProvider, a.LLMProvider.DefaultModel)
 		} else if defaultProviderCfg != nil {
 			// Use project default provider
 			providerCfg = defaultProviderCfg
 		}
+		if firstAgentProvider == nil {
+			firstAgentProvider = providerCfg
+		}
+		providerCfg = s.withFallbacks(ctx, projectID, providerCfg, a.Config, team.Config, projectConfig)
+		providerCfg = providerCfg.WithParams(teamParams).WithParams(parseGenerationParams(a.Config)).WithParams(params)
 
 		// Load RAG tools from agent's collections
 		var collectionIDs []string
@@ -823,6 +1787,14 @@ func (s *RuntimeService) buildTeamConfigWithVisitor(ctx context.Context, project
 
 IMPORTANT: You have access to the transfer_to_human tool. When the user explicitly requests human assistance (e.g., "转人工", "人工客服", "human agent", "speak to agent"), you MUST call the transfer_to_human tool immediately with the reason. Do NOT ask for more details - just transfer them.`
 		}
+		// Add remember_visitor_fact tool so facts outlive the session
+		if visitorID != nil {
+			tools = append(tools, s.rememberVisitorFactTool(projectID, *visitorID))
+			instruction += rememberVisitorFactInstruction
+		}
+
+		tools = withApprovals(ctx, tools, projectApprovals, agentApprovals[a.ID])
+		tools = withReplayedTools(ctx, tools)
 
 		agentConfigs = append(agentConfigs, &agent.AgentConfig{
 			Name:        a.Name,
@@ -844,98 +1816,247 @@ IMPORTANT: You have access to the transfer_to_human tool. When the user explicit
 			})
 			defaultTools = append(defaultTools, transferTool)
 		}
+		defaultInstruction := `You are a helpful customer service assistant. Follow these rules:
+1. Be polite and helpful to users
+2. Answer questions to the best of your ability
+3. When the user explicitly requests human assistance (e.g., "转人工", "人工客服", "human agent"), use the transfer_to_human tool immediately
+4. Do not ask for more details when the user clearly wants human assistance - just transfer them`
+		if visitorID != nil {
+			defaultTools = append(defaultTools, s.rememberVisitorFactTool(projectID, *visitorID))
+			defaultInstruction += rememberVisitorFactInstruction
+		}
+		defaultTools = withApprovals(ctx, defaultTools, projectApprovals)
+		defaultTools = withReplayedTools(ctx, defaultTools)
 
 		agentConfigs = append(agentConfigs, &agent.AgentConfig{
 			Name:        "Assistant",
 			Description: "A helpful AI assistant that can answer questions and help users. Can transfer to human agents when needed.",
-			Instruction: `You are a helpful customer service assistant. Follow these rules:
-1. Be polite and helpful to users
-2. Answer questions to the best of your ability
-3. When the user explicitly requests human assistance (e.g., "转人工", "人工客服", "human agent"), use the transfer_to_human tool immediately
-4. Do not ask for more details when the user clearly wants human assistance - just transfer them`,
-			Provider: defaultProviderCfg,
-			Tools:    defaultTools,
+			Instruction: defaultInstruction,
+			Provider:    s.withFallbacks(ctx, projectID, defaultProviderCfg, team.Config, projectConfig).WithParams(teamParams).WithParams(params),
+			Tools:       defaultTools,
 		})
 	}
 
 	// Build supervisor provider config
 	var supervisorProvider *llm.ProviderConfig
 	if team.SupervisorLLM != nil {
-		supervisorProvider = &llm.ProviderConfig{
-			Kind:    llm.ProviderKind(team.SupervisorLLM.ProviderKind),
-			APIKey:  team.SupervisorLLM.APIKey,
-			Model:   team.SupervisorLLM.DefaultModel,
-			BaseURL: team.SupervisorLLM.APIBaseURL,
-		}
-	} else if len(agentConfigs) > 0 && agentConfigs[0].Provider != nil {
+		supervisorProvider = newProviderConfig(team.SupervisorLLM, team.SupervisorLLM.DefaultModel)
+	} else if firstAgentProvider != nil {
 		// Default to first agent's provider
-		supervisorProvider = agentConfigs[0].Provider
+		supervisorProvider = firstAgentProvider
 	} else if defaultProviderCfg != nil {
 		// Use project default provider
 		supervisorProvider = defaultProviderCfg
 	}
+	supervisorProvider = s.withFallbacks(ctx, projectID, supervisorProvider, team.Config, projectConfig)
+	supervisorProvider = supervisorProvider.WithParams(teamParams).WithParams(params)
 
 	return &supervisor.SupervisorConfig{
 		Name:                  team.Name,
 		SupervisorInstruction: team.SupervisorInstruction,
 		SupervisorProvider:    supervisorProvider,
 		Agents:                agentConfigs,
+		Mode:                  supervisor.Mode(team.ExecutionMode),
+	}
+}
+
+// runApproval returns the run fields of the approvals requested by a team run
+func runApproval(projectID uuid.UUID, runID string, team *model.Team, sessionID string, req *RunRequest) model.ToolApproval {
+	teamID := team.ID
+	return model.ToolApproval{
+		ProjectID:    projectID,
+		RunID:        runID,
+		TeamID:       &teamID,
+		SessionID:    sessionID,
+		VisitorID:    req.VisitorID,
+		EnableMemory: req.EnableMemory,
+		Params:       model.JSONMap(paramsSnapshot(req.Params)),
 	}
 }
 
-// StreamEvent converts ADK event to SSE format
-type StreamEvent struct {
-	Type      string      `json:"type"`
-	AgentName string      `json:"agent_name,omitempty"`
-	Content   string      `json:"content,omitempty"`
-	Error     string      `json:"error,omitempty"`
-	Data      interface{} `json:"data,omitempty"`
+// teamAgentIDs returns the IDs of the agents of a team
+func teamAgentIDs(team *model.Team) []string {
+	ids := make([]string, 0, len(team.Agents))
+	for _, a := range team.Agents {
+		ids = append(ids, a.ID.String())
+	}
+	return ids
+}
+
+// teamUsageScope scopes usage tracking of a run to the team and its agents
+func teamUsageScope(ctx context.Context, projectID uuid.UUID, team *model.Team, sessionID, runID string) context.Context {
+	agents := make(map[string]uuid.UUID, len(team.Agents))
+	for _, a := range team.Agents {
+		agents[a.Name] = a.ID
+	}
+	teamID := team.ID
+	return usage.WithScope(ctx, &usage.Scope{
+		ProjectID: projectID,
+		TeamID:    &teamID,
+		SessionID: sessionID,
+		RequestID: runID,
+		Agents:    agents,
+	})
 }
 
-func ConvertADKEvent(event *adk.AgentEvent) *StreamEvent {
-	se := &StreamEvent{
+// ConvertStreamEvent converts a stream event to the native SSE format.
+// Streamed messages are sent as "message" deltas sharing a message_id,
+// followed by a "message_end" event. Tool invocations and handoffs carry
+// their details in Data.
+func ConvertStreamEvent(event *supervisor.Event) streaming.Event {
+	if event.Tool != nil {
+		return *event.Tool
+	}
+
+	se := streaming.Event{
+		Timestamp: time.Now(),
 		AgentName: event.AgentName,
+		MessageID: event.MessageID,
+		Delta:     event.Delta,
 	}
 
 	if event.Err != nil {
-		se.Type = "error"
+		se.Type = streaming.EventTypeError
 		se.Error = event.Err.Error()
 		return se
 	}
 
-	if event.Output != nil && event.Output.MessageOutput != nil {
-		if msg := event.Output.MessageOutput.Message; msg != nil {
-			se.Type = "message"
+	if msg := event.Message(); msg != nil {
+		se.Role = string(msg.Role)
+		if event.MessageDone {
+			// The deltas already carried the content
+			se.Type = streaming.EventTypeMessageEnd
+		} else {
+			se.Type = streaming.EventTypeMessage
 			se.Content = msg.Content
 		}
+		if provider, modelName, ok := llm.AnsweredBy(msg); ok {
+			se.Data = map[string]interface{}{
+				"provider": provider,
+				"model":    modelName,
+			}
+		}
 	}
 
 	if event.Action != nil {
 		if event.Action.Exit {
-			se.Type = "exit"
+			se.Type = streaming.EventTypeExit
 		} else if event.Action.TransferToAgent != nil {
-			se.Type = "transfer"
-			se.Content = event.Action.TransferToAgent.DestAgentName
+			transfer := streaming.NewTransferEvent(event.AgentName, event.Action.TransferToAgent.DestAgentName)
+			se.Type = transfer.Type
+			se.Content = ""
+			se.Data = transfer.Data
 		}
 	}
 
 	return se
 }
 
-// GetEventContent extracts content from an ADK event
-func GetEventContent(event *adk.AgentEvent) string {
-	if event.Output != nil && event.Output.MessageOutput != nil {
-		if msg := event.Output.MessageOutput.Message; msg != nil {
-			return msg.Content
-		}
+// GetEventContent extracts the answer content of a stream event: the delta of
+// a streamed assistant message, or a whole non-streamed one
+func GetEventContent(event *supervisor.Event) string {
+	if event.MessageDone {
+		return ""
+	}
+	if msg := event.Message(); msg != nil && msg.Role == schema.Assistant {
+		return msg.Content
 	}
 	return ""
 }
 
-// Cancel cancels a running execution (placeholder - context cancellation is preferred)
-func (s *RuntimeService) Cancel(ctx context.Context, runID string) (bool, string) {
-	// In Go, cancellation is typically handled via context cancellation
-	// The runID would be used to lookup and cancel the associated context
-	// For now, return false as we don't have a run registry
-	return false, "cancellation not implemented - use context cancellation"
+// ErrRunHistoryDisabled is returned when runs are not persisted
+var ErrRunHistoryDisabled = errors.New("run history is not enabled")
+
+// ListRuns returns the recorded runs of the project
+func (s *RuntimeService) ListRuns(ctx context.Context, projectID uuid.UUID, filter runs.ListFilter, limit, offset int) ([]runs.Record, int64, error) {
+	if s.history == nil {
+		return nil, 0, ErrRunHistoryDisabled
+	}
+	return s.history.List(ctx, projectID, filter, limit, offset)
+}
+
+// GetRunHistory returns a recorded run with its event timeline
+func (s *RuntimeService) GetRunHistory(ctx context.Context, projectID uuid.UUID, runID string) (*runs.Record, error) {
+	if s.history == nil {
+		return nil, ErrRunHistoryDisabled
+	}
+	return s.history.Get(ctx, projectID, runID)
+}
+
+// Replay re-runs the input and history of a recorded run against the current
+// config and returns the recorded replay. Replays use no memory and no visitor,
+// so they cannot transfer the visitor to staff. Tools with side effects answer
+// with the results recorded by the original run, unless executeTools is set
+// and they run again.
+func (s *RuntimeService) Replay(ctx context.Context, projectID uuid.UUID, runID string, executeTools bool) (*runs.Record, error) {
+	original, err := s.GetRunHistory(ctx, projectID, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	var params *llm.GenerationParams
+	if len(original.Params) > 0 {
+		params, err = llm.ParseGenerationParams(original.Params)
+		if err != nil {
+			return nil, fmt.Errorf("parse params of run %s: %w", runID, err)
+		}
+	}
+
+	ctx = runs.WithReplay(ctx, original)
+	if !executeTools {
+		ctx = withRecordedCalls(ctx, original)
+	}
+	var resp *RunResponse
+	switch original.Kind {
+	case runs.KindAgent:
+		if len(original.AgentIDs) == 0 {
+			return nil, fmt.Errorf("run %s has no agent", runID)
+		}
+		resp, err = s.RunWithAgentTools(ctx, projectID, original.AgentIDs[0], original.Input, "", false, params)
+	case runs.KindAnalyzer:
+		req := &RunRequest{Message: original.Input, Params: params}
+		if original.SessionID != "" {
+			req.SessionID = &original.SessionID
+		}
+		resp, err = s.RunWithQueryAnalyzer(ctx, projectID, req)
+	case runs.KindConsensus:
+		req := &RunRequest{Message: original.Input, AgentIDs: original.AgentIDs, Params: params}
+		if original.TeamID != nil {
+			teamID := original.TeamID.String()
+			req.TeamID = &teamID
+		}
+		resp, err = s.RunWithConsensus(ctx, projectID, req)
+	case runs.KindCompletion:
+		return nil, fmt.Errorf("run %s answered with caller tools, which are not recorded", runID)
+	case runs.KindResume:
+		return nil, fmt.Errorf("run %s resumed an interrupted run from a checkpoint, which is not kept", runID)
+	default:
+		req := &RunRequest{Message: original.Input, Params: params}
+		if original.TeamID != nil {
+			teamID := original.TeamID.String()
+			req.TeamID = &teamID
+		}
+		resp, err = s.Run(ctx, projectID, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.history.Get(ctx, projectID, resp.RunID)
+}
+
+// GetRun returns the status of a run of the project
+func (s *RuntimeService) GetRun(ctx context.Context, projectID uuid.UUID, runID string) (*runs.Run, error) {
+	return s.runs.Get(ctx, projectID, runID)
+}
+
+// Cancel stops a run of the project, on whichever replica it runs. The
+// model and tool calls of the run see their context cancelled.
+func (s *RuntimeService) Cancel(ctx context.Context, projectID uuid.UUID, runID, reason string) (bool, error) {
+	return s.runs.Cancel(ctx, projectID, runID, reason)
+}
+
+// CancelSession stops every run of a session, e.g. when staff take over
+func (s *RuntimeService) CancelSession(ctx context.Context, projectID uuid.UUID, sessionID, reason string) (int, error) {
+	return s.runs.CancelSession(ctx, projectID, sessionID, reason)
 }
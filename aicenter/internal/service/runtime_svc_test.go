@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/streaming"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+	"github.com/tgo/captain/aicenter/internal/model"
+)
+
+func TestWithFallbacksRetry(t *testing.T) {
+	s := &RuntimeService{}
+	primary := &llm.ProviderConfig{Kind: llm.ProviderOpenAI, Model: "gpt-4o"}
+
+	if got := s.withFallbacks(context.Background(), uuid.New(), primary, model.JSONMap{}); got.Retry != nil {
+		t.Errorf("withFallbacks() retries with %+v, want no retry unless configured", *got.Retry)
+	}
+
+	got := s.withFallbacks(context.Background(), uuid.New(), primary,
+		model.JSONMap{},
+		model.JSONMap{"retry": map[string]interface{}{"max_retries": 1}},
+		model.JSONMap{"retry": map[string]interface{}{"max_retries": 4}})
+	if got.Retry == nil {
+		t.Fatal("withFallbacks() does not retry with a configured retry")
+	}
+	want := llm.DefaultRetryPolicy
+	want.MaxRetries = 1
+	if *got.Retry != want {
+		t.Errorf("withFallbacks() retry = %+v, want %+v", *got.Retry, want)
+	}
+	if primary.Retry != nil {
+		t.Error("withFallbacks() modified the primary config")
+	}
+}
+
+func TestConvertStreamEvent(t *testing.T) {
+	message := func(msg *schema.Message) *adk.AgentEvent {
+		return &adk.AgentEvent{
+			AgentName: "support",
+			Output:    &adk.AgentOutput{MessageOutput: &adk.MessageVariant{Message: msg, Role: msg.Role}},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		event       *supervisor.Event
+		wantType    streaming.EventType
+		wantContent string
+		wantDelta   bool
+	}{
+		{
+			name:        "delta",
+			event:       &supervisor.Event{AgentEvent: message(schema.AssistantMessage("Hel", nil)), MessageID: "m1", Delta: true},
+			wantType:    streaming.EventTypeMessage,
+			wantContent: "Hel",
+			wantDelta:   true,
+		},
+		{
+			name:     "message end",
+			event:    &supervisor.Event{AgentEvent: message(schema.AssistantMessage("Hello", nil)), MessageID: "m1", MessageDone: true},
+			wantType: streaming.EventTypeMessageEnd,
+		},
+		{
+			name:        "whole message",
+			event:       &supervisor.Event{AgentEvent: message(schema.AssistantMessage("Hello", nil)), MessageID: "m1"},
+			wantType:    streaming.EventTypeMessage,
+			wantContent: "Hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ConvertStreamEvent(tt.event)
+			if got.Type != tt.wantType || got.Content != tt.wantContent || got.Delta != tt.wantDelta {
+				t.Errorf("ConvertStreamEvent() = %s %q delta %v, want %s %q delta %v",
+					got.Type, got.Content, got.Delta, tt.wantType, tt.wantContent, tt.wantDelta)
+			}
+			if got.MessageID != "m1" || got.AgentName != "support" || got.Role != string(schema.Assistant) {
+				t.Errorf("ConvertStreamEvent() = %+v, want message m1 of support with the assistant role", got)
+			}
+		})
+	}
+}
+
+func TestGetEventContent(t *testing.T) {
+	event := func(msg *schema.Message, done bool) *supervisor.Event {
+		return &supervisor.Event{
+			AgentEvent: &adk.AgentEvent{
+				Output: &adk.AgentOutput{MessageOutput: &adk.MessageVariant{Message: msg, Role: msg.Role}},
+			},
+			MessageDone: done,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		event *supervisor.Event
+		want  string
+	}{
+		{name: "assistant delta", event: event(schema.AssistantMessage("Hel", nil), false), want: "Hel"},
+		{name: "complete message", event: event(schema.AssistantMessage("Hello", nil), true), want: ""},
+		{name: "tool result", event: event(schema.ToolMessage("42", "call_1"), false), want: ""},
+		{name: "no message", event: &supervisor.Event{AgentEvent: &adk.AgentEvent{}}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetEventContent(tt.event); got != tt.want {
+				t.Errorf("GetEventContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertStreamEventToolsAndHandoffs(t *testing.T) {
+	toolCall := streaming.NewToolCallEvent("support", "lookup_order", "call_1", map[string]interface{}{"id": "42"})
+	if got := ConvertStreamEvent(&supervisor.Event{Tool: &toolCall}); got.Type != streaming.EventTypeToolCall || got.Data["tool_call_id"] != "call_1" {
+		t.Errorf("ConvertStreamEvent() = %+v, want the tool_call as reported", got)
+	}
+
+	transfer := &supervisor.Event{AgentEvent: &adk.AgentEvent{
+		AgentName: "triage",
+		Action:    adk.NewTransferToAgentAction("billing"),
+	}}
+	got := ConvertStreamEvent(transfer)
+	if got.Type != streaming.EventTypeTransfer || got.Data["from_agent"] != "triage" || got.Data["to_agent"] != "billing" {
+		t.Errorf("ConvertStreamEvent() = %+v, want a transfer from triage to billing", got)
+	}
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	einoTool "github.com/cloudwego/eino/components/tool"
+	"github.com/google/uuid"
+
+	"github.com/tgo/captain/aicenter/internal/eino/llm"
+	"github.com/tgo/captain/aicenter/internal/eino/memory"
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+	"github.com/tgo/captain/aicenter/internal/eino/supervisor"
+	"github.com/tgo/captain/aicenter/internal/eino/tool"
+	"github.com/tgo/captain/aicenter/internal/eino/usage"
+)
+
+const (
+	// visitorFactsLimit is the number of facts about a visitor recalled into
+	// the instructions, the ones closest to the query when there are more
+	visitorFactsLimit = 10
+	// visitorSessionIdle is how long a session with a visitor stays quiet
+	// before it is considered over and its facts are extracted
+	visitorSessionIdle = 15 * time.Minute
+	// extractTimeout bounds an extraction pass
+	extractTimeout = 2 * time.Minute
+	// maxExtractMessages caps the messages of a session read by an extraction pass
+	maxExtractMessages = 100
+)
+
+// rememberVisitorFactInstruction is appended to the instruction of agents
+// with the remember_visitor_fact tool
+const rememberVisitorFactInstruction = `
+
+You have access to the remember_visitor_fact tool. When the visitor tells you something worth knowing in future conversations, such as an order number, a preference or their status, call it to remember the fact.`
+
+// VisitorMemory returns the long-term memory of the visitors of the project,
+// with semantic recall when the project has a default embedding model
+func (s *RuntimeService) VisitorMemory(ctx context.Context, projectID uuid.UUID) *memory.VisitorMemory {
+	visitorMem := memory.NewVisitorMemory(s.db, projectID)
+	providerCfg, err := s.getEmbeddingProviderConfig(ctx, projectID)
+	if err != nil || providerCfg == nil {
+		return visitorMem
+	}
+	embedder, err := s.llmFactory.CreateEmbedder(ctx, providerCfg)
+	if err != nil {
+		log.Printf("[VisitorMemory] Embedding model of project %s unavailable, recalling the newest facts: %v", projectID, err)
+		return visitorMem
+	}
+	visitorMem.SetEmbedder(embedder)
+	return visitorMem
+}
+
+// getEmbeddingProviderConfig returns the provider config of the default
+// embedding model of the project, nil if it has none
+func (s *RuntimeService) getEmbeddingProviderConfig(ctx context.Context, projectID uuid.UUID) (*llm.ProviderConfig, error) {
+	aiConfig, err := s.aiConfigRepo.GetByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("get AI config: %w", err)
+	}
+	if aiConfig == nil || aiConfig.DefaultEmbeddingProviderID == nil || aiConfig.DefaultEmbeddingModel == "" {
+		return nil, nil
+	}
+	provider, err := s.providerRepo.GetByID(ctx, projectID, *aiConfig.DefaultEmbeddingProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("get embedding provider: %w", err)
+	}
+	if !provider.IsActive {
+		return nil, nil
+	}
+	return newProviderConfig(provider, aiConfig.DefaultEmbeddingModel), nil
+}
+
+// visitorFactsInstruction recalls the facts about the visitor relevant to the
+// query, as instruction text. It is empty without a visitor or facts.
+func (s *RuntimeService) visitorFactsInstruction(ctx context.Context, projectID uuid.UUID, visitorID *uuid.UUID, query string) string {
+	if visitorID == nil || runs.ReplayFromContext(ctx) != nil {
+		return ""
+	}
+	facts, err := s.VisitorMemory(ctx, projectID).Recall(ctx, *visitorID, query, visitorFactsLimit)
+	if err != nil {
+		log.Printf("[VisitorMemory] Failed to recall facts of visitor %s: %v", *visitorID, err)
+		return ""
+	}
+	if text := memory.VisitorFactsInstruction(facts); text != "" {
+		return "\n\n" + text
+	}
+	return ""
+}
+
+// withVisitorFacts appends the recalled facts to the instructions of the
+// supervisor and of every agent of a team
+func withVisitorFacts(cfg *supervisor.SupervisorConfig, facts string) {
+	if facts == "" {
+		return
+	}
+	cfg.SupervisorInstruction += facts
+	for _, a := range cfg.Agents {
+		a.Instruction += facts
+	}
+}
+
+// rememberVisitorFactTool returns the tool agents remember facts about the
+// visitor with, in the session of the run calling it
+func (s *RuntimeService) rememberVisitorFactTool(projectID, visitorID uuid.UUID) einoTool.BaseTool {
+	return tool.NewRememberVisitorFactTool(func(ctx context.Context, content, category string) error {
+		var sessionID string
+		if run := runs.FromContext(ctx); run != nil {
+			sessionID = run.SessionID
+		}
+		_, err := s.VisitorMemory(ctx, projectID).Remember(ctx, visitorID, sessionID, memory.FactSourceTool,
+			[]memory.ExtractedFact{{Content: content, Category: category}})
+		return err
+	})
+}
+
+// ExtractVisitorFacts runs an extraction pass over the messages of the session
+// not extracted yet and returns the new facts about the visitor
+func (s *RuntimeService) ExtractVisitorFacts(ctx context.Context, projectID, visitorID uuid.UUID, sessionID string) ([]memory.VisitorFact, error) {
+	if err := s.checkBudget(ctx, projectID); err != nil {
+		return nil, err
+	}
+	visitorMem := s.VisitorMemory(ctx, projectID)
+	extracted, err := visitorMem.ExtractedCount(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get extraction cursor: %w", err)
+	}
+	msgs, err := s.GetMemoryManager(projectID, true).GetHistory(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get history: %w", err)
+	}
+	if len(msgs) <= extracted {
+		return nil, nil
+	}
+	pending := msgs[max(extracted, len(msgs)-maxExtractMessages):]
+
+	providerCfg, err := s.getSummaryProviderConfig(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	chatModel, err := s.llmFactory.CreateChatModel(ctx, providerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create chat model: %w", err)
+	}
+	extractor, err := memory.NewFactExtractor(chatModel)
+	if err != nil {
+		return nil, err
+	}
+	known, err := visitorMem.All(ctx, visitorID)
+	if err != nil {
+		return nil, fmt.Errorf("list facts: %w", err)
+	}
+
+	ctx = usage.WithScope(ctx, &usage.Scope{ProjectID: projectID, SessionID: sessionID})
+	facts, err := extractor.Extract(ctx, known, pending)
+	if err != nil {
+		return nil, err
+	}
+	added, err := visitorMem.Remember(ctx, visitorID, sessionID, memory.FactSourceExtraction, facts)
+	if err != nil {
+		return nil, fmt.Errorf("remember facts: %w", err)
+	}
+	if err := visitorMem.SetExtractedCount(ctx, visitorID, sessionID, len(msgs)); err != nil {
+		log.Printf("[VisitorMemory] Failed to record extraction of session %s: %v", sessionID, err)
+	}
+	log.Printf("[VisitorMemory] Extracted %d new facts of visitor %s from session %s", len(added), visitorID, sessionID)
+	return added, nil
+}
+
+// scheduleVisitorExtraction extracts the facts of a session with a visitor
+// once it has been idle for visitorSessionIdle. Every exchange restarts the
+// wait. Sessions left pending on shutdown are extracted after their next
+// exchange, from where the last pass stopped.
+func (s *RuntimeService) scheduleVisitorExtraction(projectID uuid.UUID, visitorID *uuid.UUID, sessionID string) {
+	if visitorID == nil || sessionID == "" {
+		return
+	}
+	vid := *visitorID
+	key := projectID.String() + ":" + sessionID
+
+	s.extractionsMu.Lock()
+	defer s.extractionsMu.Unlock()
+	if prev, ok := s.extractions[key]; ok {
+		prev.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(visitorSessionIdle, func() {
+		s.extractionsMu.Lock()
+		if s.extractions[key] == timer {
+			delete(s.extractions, key)
+		}
+		s.extractionsMu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), extractTimeout)
+		defer cancel()
+		if _, err := s.ExtractVisitorFacts(ctx, projectID, vid, sessionID); err != nil {
+			log.Printf("[VisitorMemory] Failed to extract facts of session %s: %v", sessionID, err)
+		}
+	})
+	s.extractions[key] = timer
+}
+
+// cancelVisitorExtraction drops the pending extraction of a session, e.g.
+// once it is erased
+func (s *RuntimeService) cancelVisitorExtraction(projectID uuid.UUID, sessionID string) {
+	key := projectID.String() + ":" + sessionID
+
+	s.extractionsMu.Lock()
+	defer s.extractionsMu.Unlock()
+	if timer, ok := s.extractions[key]; ok {
+		timer.Stop()
+		delete(s.extractions, key)
+	}
+}
@@ -0,0 +1,35 @@
+package task
+
+import (
+	"context"
+	"log"
+
+	"github.com/tgo/captain/aicenter/internal/eino/runs"
+)
+
+// StaleRunsTask fails the runs left running by a replica that stopped
+type StaleRunsTask struct {
+	history *runs.History
+}
+
+// NewStaleRunsTask creates a new stale runs task
+func NewStaleRunsTask(history *runs.History) *StaleRunsTask {
+	return &StaleRunsTask{
+		history: history,
+	}
+}
+
+func (t *StaleRunsTask) Name() string {
+	return "stale_runs"
+}
+
+func (t *StaleRunsTask) Run(ctx context.Context) error {
+	failed, err := t.history.FailStale(ctx)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		log.Printf("[Runs] Marked %d stale runs as failed", failed)
+	}
+	return nil
+}
@@ -32,6 +32,10 @@ type Config struct {
 	AICenterURL   string `mapstructure:"AICENTER_URL"`
 	PlatformURL   string `mapstructure:"PLATFORM_URL"`
 	RAGServiceURL string `mapstructure:"RAG_SERVICE_URL"`
+
+	// InternalAPIKey is shared with the AI center, which signs its requests
+	// to the internal routes with it
+	InternalAPIKey string `mapstructure:"INTERNAL_API_KEY"`
 }
 
 func Load() (*Config, error) {
@@ -55,6 +59,7 @@ func Load() (*Config, error) {
 		"PORT", "GIN_MODE", "ENVIRONMENT", "DATABASE_URL", "REDIS_URL",
 		"JWT_SECRET", "ACCESS_TOKEN_EXPIRE_MINUTES", "REFRESH_TOKEN_EXPIRE_DAYS",
 		"WUKONGIM_URL", "WUKONGIM_API_KEY", "WUKONGIM_WS_URL", "AICENTER_URL", "PLATFORM_URL", "RAG_SERVICE_URL",
+		"INTERNAL_API_KEY",
 	} {
 		if val := os.Getenv(key); val != "" {
 			viper.Set(key, val)
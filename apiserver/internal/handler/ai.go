@@ -2,7 +2,7 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
 
@@ -11,6 +11,7 @@ import (
 
 	"github.com/tgo/captain/apiserver/internal/pkg/aicenter"
 	"github.com/tgo/captain/apiserver/internal/pkg/wukongim"
+	"github.com/tgo/captain/apiserver/internal/service"
 )
 
 type AIHandler struct {
@@ -96,6 +97,42 @@ func (h *AIHandler) RunAgent(c *gin.Context) {
 	h.respond(c, data, status, err)
 }
 
+// Approvals
+
+func (h *AIHandler) ListApprovals(c *gin.Context) {
+	data, status, err := h.client.ListApprovals(c.Request.Context(), c.Request.URL.Query(), h.getHeaders(c))
+	h.respond(c, data, status, err)
+}
+
+func (h *AIHandler) GetApproval(c *gin.Context) {
+	data, status, err := h.client.GetApproval(c.Request.Context(), c.Param("id"), h.getHeaders(c))
+	h.respond(c, data, status, err)
+}
+
+func (h *AIHandler) ApproveApproval(c *gin.Context) {
+	h.decideApproval(c, true)
+}
+
+func (h *AIHandler) RejectApproval(c *gin.Context) {
+	h.decideApproval(c, false)
+}
+
+func (h *AIHandler) decideApproval(c *gin.Context, approved bool) {
+	// The body (an optional comment) may be empty
+	body := map[string]interface{}{}
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	data, status, err := h.client.DecideApproval(c.Request.Context(), c.Param("id"), approved, body, h.getHeaders(c))
+	h.respond(c, data, status, err)
+}
+
+func (h *AIHandler) ResumeApproval(c *gin.Context) {
+	data, status, err := h.client.ResumeApproval(c.Request.Context(), c.Param("id"), h.getHeaders(c))
+	h.respond(c, data, status, err)
+}
+
 // Teams
 
 func (h *AIHandler) ListTeams(c *gin.Context) {
@@ -448,7 +485,7 @@ func (h *AIHandler) TeamChat(c *gin.Context) {
 
 	// 2. Build body for aicenter (enable_memory always true like Python original)
 	// session_id format: {channel_id}@{channel_type} - used for memory tracking
-	sessionID := fmt.Sprintf("%s@%d", channelID, 1)
+	sessionID := service.BuildAISessionID(channelID, 1)
 	body := map[string]interface{}{
 		"project_id":    projectID,
 		"message":       req.Message,
@@ -542,7 +579,7 @@ func (h *AIHandler) TeamChatStream(c *gin.Context) {
 	} else {
 		channelID = req.AgentID + "-agent"
 	}
-	sessionID := fmt.Sprintf("%s@%d", channelID, 1)
+	sessionID := service.BuildAISessionID(channelID, 1)
 
 	body := map[string]interface{}{
 		"project_id":    projectID,
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -15,10 +16,14 @@ import (
 
 // Event type constants
 const (
-	ManualServiceEvent    = "manual_service.request"
-	VisitorInfoEvent      = "visitor_info.update"
-	VisitorSentimentEvent = "visitor_sentiment.update"
-	VisitorTagEvent       = "visitor_tag.add"
+	ManualServiceEvent        = "manual_service.request"
+	VisitorInfoEvent          = "visitor_info.update"
+	VisitorSentimentEvent     = "visitor_sentiment.update"
+	VisitorTagEvent           = "visitor_tag.add"
+	ToolApprovalEvent         = "tool_approval.request"
+	ToolApprovalResolvedEvent = "tool_approval.resolved"
+	// BudgetAlertEvent is about a project, it is sent without a visitor
+	BudgetAlertEvent = "budget.alert"
 )
 
 // Manual service tag constants
@@ -32,6 +37,7 @@ const (
 type AIServiceEvent struct {
 	EventType string                 `json:"event_type" binding:"required"`
 	VisitorID *uuid.UUID             `json:"visitor_id"`
+	ProjectID *uuid.UUID             `json:"project_id,omitempty"`
 	Payload   map[string]interface{} `json:"payload"`
 }
 
@@ -54,6 +60,11 @@ func (h *AIEventsHandler) IngestEvent(c *gin.Context) {
 		return
 	}
 
+	if strings.TrimSpace(strings.ToLower(event.EventType)) == BudgetAlertEvent {
+		h.ingestBudgetAlert(c, &event)
+		return
+	}
+
 	// Validate visitor_id is provided
 	if event.VisitorID == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"detail": "visitor_id is required in event payload"})
@@ -114,6 +125,22 @@ func (h *AIEventsHandler) IngestEvent(c *gin.Context) {
 		}
 		c.JSON(http.StatusAccepted, gin.H{"event_type": eventType, "result": result})
 
+	case ToolApprovalEvent:
+		result, err := h.handleToolApprovalRequest(c, &event, &project, &visitor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"event_type": eventType, "result": result})
+
+	case ToolApprovalResolvedEvent:
+		result, err := h.handleToolApprovalResolved(c, &event, &project, &visitor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"event_type": eventType, "result": result})
+
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"detail": "Unsupported AI event_type: " + event.EventType})
 	}
@@ -367,3 +394,163 @@ func (h *AIEventsHandler) handleVisitorTag(c *gin.Context, event *AIServiceEvent
 		"total_requested": len(tagItems),
 	}, nil
 }
+
+// handleToolApprovalRequest forwards a tool call waiting for approval to the
+// staff assigned to the visitor. Without an assigned staff the approval is
+// left in the pending approvals of the project, which any staff can decide.
+func (h *AIEventsHandler) handleToolApprovalRequest(c *gin.Context, event *AIServiceEvent, project *model.Project, visitor *model.Visitor) (map[string]interface{}, error) {
+	ctx := c.Request.Context()
+
+	payload := event.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	toolName, _ := payload["tool_name"].(string)
+	arguments, _ := payload["arguments"].(string)
+	approvalID, _ := payload["approval_id"].(string)
+
+	staffID := visitor.AssignedStaffID
+	if staffID == nil {
+		return map[string]interface{}{
+			"approval_id": approvalID,
+			"queued":      true,
+			"message":     "No assigned staff, the approval waits in the pending approvals",
+		}, nil
+	}
+
+	content := fmt.Sprintf("AI 请求执行 %s，需要您审批\n访客: %s\n参数: %s\n审批 ID: %s", toolName, visitor.ID, arguments, approvalID)
+
+	if h.wkClient != nil {
+		if _, err := h.wkClient.SendTextMessage(ctx, &wukongim.SendTextMessageRequest{
+			FromUID:     "ai-assistant",
+			ChannelID:   staffID.String() + "-staff",
+			ChannelType: 1,
+			Content:     content,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"approval_id":       approvalID,
+		"notified_staff_id": staffID.String(),
+	}, nil
+}
+
+// handleToolApprovalResolved sends the visitor the answer of a run resumed
+// after staff decided its tool calls
+func (h *AIEventsHandler) handleToolApprovalResolved(c *gin.Context, event *AIServiceEvent, project *model.Project, visitor *model.Visitor) (map[string]interface{}, error) {
+	ctx := c.Request.Context()
+
+	content := ""
+	if event.Payload != nil {
+		content, _ = event.Payload["content"].(string)
+	}
+	if strings.TrimSpace(content) == "" {
+		return map[string]interface{}{"visitor_id": visitor.ID.String(), "message": "No content"}, nil
+	}
+
+	channelID := "cs_" + visitor.ID.String()
+	if h.wkClient != nil {
+		h.wkClient.CreateOrUpdateChannel(ctx, channelID, 251, []string{"ai-assistant"})
+		if _, err := h.wkClient.SendTextMessage(ctx, &wukongim.SendTextMessageRequest{
+			FromUID:     "ai-assistant",
+			ChannelID:   channelID,
+			ChannelType: 251,
+			Content:     content,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := &model.Message{
+		ProjectID:   project.ID,
+		MessageID:   uuid.New().String(),
+		ChannelID:   channelID,
+		FromUID:     "ai-assistant",
+		MessageType: model.MessageTypeText,
+		Content:     content,
+		SentAt:      time.Now(),
+	}
+	if err := h.db.WithContext(ctx).Create(msg).Error; err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"visitor_id": visitor.ID.String(),
+		"message_id": msg.MessageID,
+		"channel_id": channelID,
+	}, nil
+}
+
+// ingestBudgetAlert handles the budget alerts of a project, which have no
+// visitor
+func (h *AIEventsHandler) ingestBudgetAlert(c *gin.Context, event *AIServiceEvent) {
+	if event.ProjectID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "project_id is required for budget alerts"})
+		return
+	}
+
+	var project model.Project
+	if err := h.db.WithContext(c.Request.Context()).
+		Where("id = ? AND deleted_at IS NULL", event.ProjectID).
+		First(&project).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "Project not found: " + event.ProjectID.String()})
+		return
+	}
+
+	result, err := h.handleBudgetAlert(c, event, &project)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"event_type": BudgetAlertEvent, "result": result})
+}
+
+// handleBudgetAlert notifies the active admins of the project that a usage
+// budget reached its alert threshold or its limit
+func (h *AIEventsHandler) handleBudgetAlert(c *gin.Context, event *AIServiceEvent, project *model.Project) (map[string]interface{}, error) {
+	ctx := c.Request.Context()
+
+	var admins []struct {
+		ID uuid.UUID
+	}
+	if err := h.db.WithContext(ctx).Table("staff").
+		Where("project_id = ? AND role = ? AND is_active = true AND deleted_at IS NULL", project.ID, model.AdminRole).
+		Find(&admins).Error; err != nil {
+		return nil, err
+	}
+
+	payload := event.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	level, _ := payload["level"].(string)
+	period, _ := payload["period"].(string)
+	metric, _ := payload["metric"].(string)
+	title := "AI 用量即将达到上限"
+	if level == "hard" {
+		title = "AI 用量已达上限"
+	}
+	content := fmt.Sprintf("%s\n周期: %s\n指标: %s\n已用: %v / 上限: %v", title, period, metric, payload["used"], payload["limit"])
+
+	notified := make([]string, 0, len(admins))
+	for _, admin := range admins {
+		if h.wkClient != nil {
+			if _, err := h.wkClient.SendTextMessage(ctx, &wukongim.SendTextMessageRequest{
+				FromUID:     "ai-assistant",
+				ChannelID:   admin.ID.String() + "-staff",
+				ChannelType: 1,
+				Content:     content,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		notified = append(notified, admin.ID.String())
+	}
+
+	return map[string]interface{}{
+		"project_id":        project.ID.String(),
+		"notified_staff_id": notified,
+	}, nil
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -338,13 +340,13 @@ func (h *ChatHandler) ChatCompletion(c *gin.Context) {
 	// Build channel ID
 	channelID := req.ChannelID
 	if channelID == "" {
-		channelID = "cs_" + visitor.ID.String()
+		channelID = service.BuildVisitorChannelID(visitor.ID)
 	}
 	channelType := req.ChannelType
 	if channelType == 0 {
-		channelType = 251 // Customer service channel type
+		channelType = service.ChannelTypeCustomerService
 	}
-	sessionID := channelID + "@" + strconv.Itoa(channelType)
+	sessionID := service.BuildAISessionID(channelID, channelType)
 
 	// Ensure visitor is subscribed to the channel
 	visitorWkUID := visitor.ID.String() + "-vtr"
@@ -416,6 +418,11 @@ func (h *ChatHandler) ChatCompletion(c *gin.Context) {
 	// Call AI service with visitor context (non-streaming for now, aicenter streaming needs fix)
 	resp, err := h.svc.CallAIServiceWithVisitor(c.Request.Context(), platform.ProjectID, &visitor.ID, req.Message, sessionID, req.SystemMessage, false)
 	if err != nil {
+		var budgetErr *service.AIBudgetExceededError
+		if errors.As(err, &budgetErr) {
+			h.replyBudgetExceeded(c, platform, visitor, channelID, budgetErr)
+			return
+		}
 		if strings.Contains(err.Error(), "ai_disabled") {
 			c.JSON(http.StatusOK, gin.H{
 				"success":    false,
@@ -477,7 +484,21 @@ func (h *ChatHandler) streamChatCompletion(c *gin.Context, platform *model.Platf
 	// Stream chunks
 	fullContent := ""
 	for chunk := range streamChan {
-		if chunk.Error != nil {
+		var budgetErr *service.AIBudgetExceededError
+		if errors.As(chunk.Error, &budgetErr) {
+			if budgetErr.Action == service.AIBudgetActionTransferToHuman {
+				result, err := h.svc.TriggerManualServiceRequest(c.Request.Context(), platform.ProjectID, visitor.ID, "AI budget exceeded")
+				if err != nil {
+					c.SSEvent("error", gin.H{"error": err.Error()})
+				} else {
+					c.SSEvent("message", result)
+				}
+				c.Writer.Flush()
+				return
+			}
+			// Answer with the fallback message as if the AI replied
+			chunk = service.StreamChunk{Content: budgetErr.Reply()}
+		} else if chunk.Error != nil {
 			c.SSEvent("error", gin.H{"error": chunk.Error.Error()})
 			c.Writer.Flush()
 			return
@@ -506,3 +527,34 @@ func (h *ChatHandler) streamChatCompletion(c *gin.Context, platform *model.Platf
 		h.svc.SendAIResponseToWukongim(c.Request.Context(), staffUID, channelID, channelType, fullContent)
 	}
 }
+
+// replyBudgetExceeded answers a visitor whose AI run was refused by the
+// project budget, with the fallback message or by transferring to a human
+func (h *ChatHandler) replyBudgetExceeded(c *gin.Context, platform *model.Platform, visitor *model.Visitor, channelID string, budgetErr *service.AIBudgetExceededError) {
+	log.Printf("[ChatCompletion] Project %s: %v", platform.ProjectID, budgetErr)
+
+	if budgetErr.Action == service.AIBudgetActionTransferToHuman {
+		result, err := h.svc.TriggerManualServiceRequest(c.Request.Context(), platform.ProjectID, visitor.ID, "AI budget exceeded")
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success":    false,
+				"event_type": "error",
+				"message":    err.Error(),
+				"visitor_id": visitor.ID.String(),
+				"channel_id": channelID,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	h.svc.SaveAIMessage(c.Request.Context(), platform.ProjectID, channelID, budgetErr.Reply())
+	c.JSON(http.StatusOK, gin.H{
+		"success":         true,
+		"event_type":      "message_sent",
+		"budget_exceeded": true,
+		"visitor_id":      visitor.ID.String(),
+		"channel_id":      channelID,
+	})
+}
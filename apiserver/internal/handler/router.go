@@ -86,6 +86,10 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, humanSessionSvc *service.Human
 	setupSvc := service.NewSetupService(db, setupRepo, platformRepo)
 	onboardingSvc := service.NewOnboardingService(onboardingRepo, aiClient, ragClient)
 	transferSvc := service.NewTransferService(staffRepo, visitorRepo, queueRepo, wkClient)
+	if aiClient != nil {
+		visitorSvc.SetAIClient(aiClient)
+		transferSvc.SetAIClient(aiClient)
+	}
 
 	// Initialize handlers
 	authHandler := NewAuthHandler(authSvc)
@@ -177,6 +181,11 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, humanSessionSvc *service.Human
 		internal := v1.Group("/internal")
 		{
 			internal.POST("/ai-events", aiEventsHandler.IngestEvent)
+			// Visitor attachments read by the AI center runtime, with a
+			// token signed by the key shared with the AI center
+			if ragHandler != nil {
+				internal.GET("/files/:id/download", middleware.InternalAuth(cfg.InternalAPIKey), ragHandler.DownloadFile)
+			}
 		}
 
 		// Staff login (alias for /auth/login for frontend compatibility)
@@ -414,6 +423,16 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, humanSessionSvc *service.Human
 					aiTeams.POST("/:id/run", aiHandler.RunTeam)
 				}
 
+				// AI tool call approvals, decided by the staff member of the token
+				aiApprovals := projectScoped.Group("/ai/approvals")
+				{
+					aiApprovals.GET("", aiHandler.ListApprovals)
+					aiApprovals.GET("/:id", aiHandler.GetApproval)
+					aiApprovals.POST("/:id/approve", aiHandler.ApproveApproval)
+					aiApprovals.POST("/:id/reject", aiHandler.RejectApproval)
+					aiApprovals.POST("/:id/resume", aiHandler.ResumeApproval)
+				}
+
 				// Tools
 				tools := projectScoped.Group("/tools")
 				{
@@ -1,8 +1,13 @@
 package middleware
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -133,3 +138,51 @@ func (m *AuthMiddleware) ProjectRequired() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// InternalTokenHeader carries the token the AI center signs its internal
+// requests with
+const InternalTokenHeader = "X-Internal-Token"
+
+// InternalAuth authenticates the requests of the AI center with a token
+// signed by the key both services share. The token is
+// "<project_id>.<expires_unix>.<hex HMAC-SHA256>" and signs the project,
+// the request path and the expiry, so it only grants access to one
+// resource of one project. The project of the request is the one of the
+// token. Every request is rejected when the key is empty.
+func InternalAuth(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Internal API key not configured"})
+			return
+		}
+		parts := strings.Split(c.GetHeader(InternalTokenHeader), ".")
+		if len(parts) != 3 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Internal token required"})
+			return
+		}
+		projectID, err := uuid.Parse(parts[0])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid internal token"})
+			return
+		}
+		expires, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || time.Now().Unix() > expires {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Internal token expired"})
+			return
+		}
+		signature, err := hex.DecodeString(parts[2])
+		if err != nil || !hmac.Equal(signature, internalSignature(key, parts[0], c.Request.URL.Path, parts[1])) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid internal token"})
+			return
+		}
+		c.Set("project_id", projectID.String())
+		c.Next()
+	}
+}
+
+// internalSignature signs the project, path and expiry of an internal token
+func internalSignature(key, projectID, path, expires string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(projectID + "\n" + path + "\n" + expires))
+	return mac.Sum(nil)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -84,6 +85,20 @@ func (c *Client) RunAgent(ctx context.Context, agentID string, body interface{},
 	return c.request(ctx, http.MethodPost, "/api/v1/agents/"+agentID+"/run", body, headers)
 }
 
+// CancelSessionRuns stops the in-flight runs of a session, on every aicenter replica
+func (c *Client) CancelSessionRuns(ctx context.Context, projectID, sessionID, reason string) error {
+	body := map[string]string{"reason": reason}
+	headers := map[string]string{"X-Project-ID": projectID}
+	_, statusCode, err := c.request(ctx, http.MethodPost, "/api/v1/agents/sessions/"+url.PathEscape(sessionID)+"/cancel", body, headers)
+	if err != nil {
+		return err
+	}
+	if statusCode >= 400 {
+		return fmt.Errorf("request failed with status %d", statusCode)
+	}
+	return nil
+}
+
 // Teams
 
 func (c *Client) ListTeams(ctx context.Context, projectID string, headers map[string]string) ([]byte, int, error) {
@@ -114,6 +129,35 @@ func (c *Client) RunTeam(ctx context.Context, teamID string, body interface{}, h
 	return c.request(ctx, http.MethodPost, "/api/v1/teams/"+teamID+"/run", body, headers)
 }
 
+// Approvals
+
+// ListApprovals lists the tool call approvals of the project, query is passed through (status, limit, offset)
+func (c *Client) ListApprovals(ctx context.Context, query url.Values, headers map[string]string) ([]byte, int, error) {
+	path := "/api/v1/approvals"
+	if encoded := query.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+	return c.request(ctx, http.MethodGet, path, nil, headers)
+}
+
+func (c *Client) GetApproval(ctx context.Context, approvalID string, headers map[string]string) ([]byte, int, error) {
+	return c.request(ctx, http.MethodGet, "/api/v1/approvals/"+url.PathEscape(approvalID), nil, headers)
+}
+
+// DecideApproval approves or rejects a pending approval, the decider is taken from the staff token in headers
+func (c *Client) DecideApproval(ctx context.Context, approvalID string, approved bool, body interface{}, headers map[string]string) ([]byte, int, error) {
+	action := "/reject"
+	if approved {
+		action = "/approve"
+	}
+	return c.request(ctx, http.MethodPost, "/api/v1/approvals/"+url.PathEscape(approvalID)+action, body, headers)
+}
+
+// ResumeApproval resumes the run of a decided approval whose resume failed
+func (c *Client) ResumeApproval(ctx context.Context, approvalID string, headers map[string]string) ([]byte, int, error) {
+	return c.request(ctx, http.MethodPost, "/api/v1/approvals/"+url.PathEscape(approvalID)+"/resume", nil, headers)
+}
+
 // Tools
 
 func (c *Client) ListTools(ctx context.Context, projectID string, headers map[string]string) ([]byte, int, error) {
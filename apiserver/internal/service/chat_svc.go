@@ -394,6 +394,80 @@ type AIServiceResponse struct {
 	Content string `json:"content"`
 }
 
+// aiBudgetExceededCode is the aicenter error code of runs refused by the project budget
+const aiBudgetExceededCode = "BUDGET_EXCEEDED"
+
+// Budget exceeded actions configured on the aicenter project budget
+const (
+	AIBudgetActionFallbackMessage = "fallback_message"
+	AIBudgetActionTransferToHuman = "transfer_to_human"
+)
+
+// DefaultAIBudgetFallbackMessage is sent when the budget has no fallback message
+const DefaultAIBudgetFallbackMessage = "当前咨询人数较多，AI 助手暂时无法回复，请稍后再试或联系人工客服。"
+
+// AIBudgetExceededError is returned when aicenter refuses a run because the
+// project reached a hard usage limit
+type AIBudgetExceededError struct {
+	Message         string `json:"-"`
+	Action          string `json:"action"`
+	FallbackMessage string `json:"fallback_message"`
+}
+
+func (e *AIBudgetExceededError) Error() string {
+	return "AI budget exceeded: " + e.Message
+}
+
+// Reply returns the message to send to the visitor
+func (e *AIBudgetExceededError) Reply() string {
+	if e.FallbackMessage != "" {
+		return e.FallbackMessage
+	}
+	return DefaultAIBudgetFallbackMessage
+}
+
+// parseAIBudgetExceeded returns the budget error of an aicenter error payload,
+// either {"error": {"code", "message", "details"}} or an SSE error event
+// {"error", "code", "details"}
+func parseAIBudgetExceeded(body []byte) *AIBudgetExceededError {
+	var payload struct {
+		Error   json.RawMessage        `json:"error"`
+		Code    string                 `json:"code"`
+		Details *AIBudgetExceededError `json:"details"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil
+	}
+
+	var message string
+	if len(payload.Error) > 0 && payload.Error[0] == '{' {
+		var info struct {
+			Code    string                 `json:"code"`
+			Message string                 `json:"message"`
+			Details *AIBudgetExceededError `json:"details"`
+		}
+		if err := json.Unmarshal(payload.Error, &info); err != nil {
+			return nil
+		}
+		payload.Code, payload.Details, message = info.Code, info.Details, info.Message
+	} else {
+		_ = json.Unmarshal(payload.Error, &message)
+	}
+
+	if payload.Code != aiBudgetExceededCode {
+		return nil
+	}
+	budgetErr := payload.Details
+	if budgetErr == nil {
+		budgetErr = &AIBudgetExceededError{}
+	}
+	budgetErr.Message = message
+	if budgetErr.Action == "" {
+		budgetErr.Action = AIBudgetActionFallbackMessage
+	}
+	return budgetErr
+}
+
 // CallAIService calls the AI center service
 func (s *ChatService) CallAIService(ctx context.Context, projectID uuid.UUID, message, sessionID, systemMessage string, stream bool) (*AIServiceResponse, error) {
 	return s.CallAIServiceWithVisitor(ctx, projectID, nil, message, sessionID, systemMessage, stream)
@@ -448,6 +522,9 @@ func (s *ChatService) CallAIServiceWithVisitor(ctx context.Context, projectID uu
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		if budgetErr := parseAIBudgetExceeded(body); budgetErr != nil {
+			return nil, budgetErr
+		}
 		return nil, fmt.Errorf("AI service error: %s", string(body))
 	}
 
@@ -738,6 +815,9 @@ func (s *ChatService) CallAIServiceStream(ctx context.Context, projectID uuid.UU
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
+		if budgetErr := parseAIBudgetExceeded(body); budgetErr != nil {
+			return nil, budgetErr
+		}
 		return nil, fmt.Errorf("AI service error: %s", string(body))
 	}
 
@@ -783,9 +863,19 @@ func (s *ChatService) CallAIServiceStream(ctx context.Context, projectID uuid.UU
 						return
 					}
 
+					// Run refused by the project budget
+					if code, _ := event["code"].(string); code == aiBudgetExceededCode {
+						if budgetErr := parseAIBudgetExceeded([]byte(jsonData)); budgetErr != nil {
+							chunkChan <- StreamChunk{Error: budgetErr}
+							return
+						}
+					}
+
 					// Extract content from event (aicenter format: type="message", content="...")
+					// Messages are streamed as deltas, only assistant ones answer the visitor
 					eventType, _ := event["type"].(string)
-					if eventType == "message" {
+					role, _ := event["role"].(string)
+					if eventType == "message" && (role == "" || role == "assistant") {
 						if content, ok := event["content"].(string); ok && content != "" {
 							chunkChan <- StreamChunk{Content: content}
 						}
@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/tgo/captain/apiserver/internal/model"
+	"github.com/tgo/captain/apiserver/internal/pkg/aicenter"
 	"github.com/tgo/captain/apiserver/internal/pkg/wukongim"
 	"github.com/tgo/captain/apiserver/internal/repository"
 )
@@ -36,6 +37,7 @@ type TransferService struct {
 	visitorRepo *repository.VisitorRepository
 	queueRepo   *repository.QueueRepository
 	wkClient    *wukongim.Client
+	aiClient    *aicenter.Client
 }
 
 // NewTransferService creates a new transfer service
@@ -53,6 +55,11 @@ func NewTransferService(
 	}
 }
 
+// SetAIClient enables stopping AI replies when a visitor is transferred to staff
+func (s *TransferService) SetAIClient(client *aicenter.Client) {
+	s.aiClient = client
+}
+
 // TransferRequest represents a transfer request
 type TransferRequest struct {
 	VisitorID           uuid.UUID
@@ -120,7 +127,8 @@ func (s *TransferService) TransferToStaff(ctx context.Context, req *TransferRequ
 		}, nil
 	}
 
-	// 5. Staff assigned - update visitor and add staff to channel
+	// 5. Staff assigned - stop AI replies, update visitor and add staff to channel
+	stopAIReplies(s.aiClient, req.ProjectID, visitor.ID)
 	channelID := BuildVisitorChannelID(visitor.ID)
 
 	// Add staff as subscriber to the visitor's channel
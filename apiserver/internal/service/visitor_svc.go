@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/tgo/captain/apiserver/internal/model"
+	"github.com/tgo/captain/apiserver/internal/pkg/aicenter"
 	"github.com/tgo/captain/apiserver/internal/pkg/wukongim"
 	"github.com/tgo/captain/apiserver/internal/repository"
 )
@@ -18,12 +21,18 @@ type VisitorService struct {
 	repo     *repository.VisitorRepository
 	wkClient *wukongim.Client
 	db       *gorm.DB
+	aiClient *aicenter.Client
 }
 
 func NewVisitorService(repo *repository.VisitorRepository, wkClient *wukongim.Client, db *gorm.DB) *VisitorService {
 	return &VisitorService{repo: repo, wkClient: wkClient, db: db}
 }
 
+// SetAIClient enables stopping AI replies when staff accept a visitor
+func (s *VisitorService) SetAIClient(client *aicenter.Client) {
+	s.aiClient = client
+}
+
 func (s *VisitorService) List(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]model.Visitor, int64, error) {
 	visitors, total, err := s.repo.FindByProjectID(ctx, projectID, limit, offset)
 	if err != nil {
@@ -92,11 +101,41 @@ type VisitorRegisterResponse struct {
 	IMToken     string `json:"im_token"`
 }
 
+// ChannelTypeCustomerService is the WuKongIM channel type of the customer
+// service channel of a visitor
+const ChannelTypeCustomerService = 251
+
 // BuildVisitorChannelID generates channel ID for visitor
 func BuildVisitorChannelID(visitorID uuid.UUID) string {
 	return "cs_" + visitorID.String()
 }
 
+// BuildAISessionID returns the aicenter session of the conversation on a
+// channel, "{channel_id}@{channel_type}", which keys its memory and runs
+func BuildAISessionID(channelID string, channelType int) string {
+	return channelID + "@" + strconv.Itoa(channelType)
+}
+
+// aiTakeoverTimeout bounds the call stopping AI replies on staff takeover
+const aiTakeoverTimeout = 5 * time.Second
+
+// stopAIReplies cancels the AI runs still answering a visitor once staff take
+// over. The aicenter session of a visitor is its customer service channel.
+func stopAIReplies(client *aicenter.Client, projectID, visitorID uuid.UUID) {
+	if client == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), aiTakeoverTimeout)
+		defer cancel()
+
+		sessionID := BuildAISessionID(BuildVisitorChannelID(visitorID), ChannelTypeCustomerService)
+		if err := client.CancelSessionRuns(ctx, projectID.String(), sessionID, "staff took over"); err != nil {
+			log.Printf("[AI] Failed to stop AI replies for visitor %s: %v", visitorID, err)
+		}
+	}()
+}
+
 // GetByChannelID gets visitor by channel ID
 func (s *VisitorService) GetByChannelID(ctx context.Context, projectID uuid.UUID, channelID string) (*model.Visitor, error) {
 	// Channel ID format: cs_{visitor_id}
@@ -181,6 +220,8 @@ func (s *VisitorService) AcceptVisitor(ctx context.Context, projectID, visitorID
 		return nil, err
 	}
 
+	stopAIReplies(s.aiClient, projectID, visitorID)
+
 	channelID := BuildVisitorChannelID(visitorID)
 	staffUID := staffID.String() + "-staff"
 